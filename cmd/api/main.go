@@ -2,9 +2,23 @@ package main
 
 import (
 	_ "api-vault/cmd/api/docs"
+	"api-vault/internal/config"
+	"api-vault/internal/crypto"
 	"api-vault/internal/db"
 	"api-vault/internal/integrations"
+	"api-vault/internal/oauth"
+	"api-vault/internal/oidc"
+	"api-vault/internal/refresher"
+	"api-vault/internal/rekey"
+	"api-vault/internal/signing"
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
 	"api-vault/internal/auth"
 	"api-vault/internal/tokens"
@@ -12,23 +26,36 @@ import (
 	"github.com/joho/godotenv"
 
 	"api-vault/internal/audit"
+	"api-vault/internal/auditsink"
 
+	"github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"gorm.io/gorm"
 )
 
-func setupRouter(conn *gorm.DB) *gin.Engine {
+func setupRouter(conn *gorm.DB, rf *refresher.Refresher, mw *jwt.GinJWTMiddleware, sso *oidc.Provider, mapping oidc.Mapping) *gin.Engine {
 	r := gin.Default()
-	mw, err := auth.JWTMiddlewareWithDB(conn)
-	if err != nil {
-		log.Fatal("Erro ao criar middleware JWT:", err)
+	// Sem proxies confiáveis o IP do cliente (usado no bloqueio de login) é o da conexão
+	if err := r.SetTrustedProxies(config.GetTrustedProxies()); err != nil {
+		log.Fatal("TRUSTED_PROXIES inválido:", err)
 	}
+	// ID de requisição para correlacionar os eventos de auditoria
+	r.Use(audit.RequestID())
+	// API keys de contas de serviço viram JWTs antes das rotas; precisa vir antes do registro delas
+	r.Use(auth.APIKeyMiddleware(conn, mw))
 	integrations.RegisterRoutes(r, conn, mw)
 	tokens.RegisterRoutes(r, conn, mw)
+	refresher.RegisterRoutes(r, conn, mw, rf)
+	oauth.RegisterRoutes(r, conn, mw, oauth.NewClient(nil))
 	auth.RegisterRoutes(r, conn, mw)
-	audit.RegisterRoutes(r, conn)
+	rekey.RegisterRoutes(r, conn, mw)
+	audit.RegisterRoutes(r, conn, mw)
+	signing.RegisterRoutes(r, conn, mw, auth.KeyringFor(mw))
+	if sso != nil {
+		oidc.RegisterRoutes(r, conn, mw, sso, mapping)
+	}
 	// Endpoint Swagger
 	r.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
@@ -45,11 +72,97 @@ func main() {
 
 	// Carrega variáveis do .env
 	_ = godotenv.Load()
+	provider, err := crypto.ProviderFromEnv()
+	if err != nil {
+		log.Fatal("Erro ao configurar KMS:", err)
+	}
+	crypto.SetProvider(provider)
+	// Chave inválida faria a auditoria falhar em silêncio
+	if _, err := crypto.AuditMACKey(); err != nil {
+		log.Fatal("Erro ao configurar auditoria:", err)
+	}
 	conn, err := db.Init()
 	if err != nil {
 		log.Fatal("Erro ao inicializar banco:", err)
 	}
 
-	r := setupRouter(conn)
-	r.Run(":8080")
+	// Depois de uma recriptografia sem falhas, segredos sem vínculo ao registro são recusados
+	migrated, err := rekey.Migrated(conn)
+	if err != nil {
+		log.Fatal("Erro ao consultar recriptografia:", err)
+	}
+	crypto.SetRequireAAD(migrated)
+
+	if ok, err := auth.HasAdmin(conn); err == nil && !ok {
+		log.Println("Nenhum admin cadastrado; crie o primeiro com: go run ./cmd/bootstrap -username <nome>")
+	}
+
+	// SIGINT/SIGTERM encerram os workers e o servidor HTTP
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Encaminhamento da auditoria para SIEM/syslog/webhook, fora das requisições
+	sinks, err := auditsink.FromEnv()
+	if err != nil {
+		log.Fatal("Erro ao configurar encaminhamento da auditoria:", err)
+	}
+	// Os forwarders param só depois do servidor HTTP, para receber os eventos das
+	// últimas requisições e gravar o que restar na fila como dead letter
+	forwardCtx, stopForwarding := context.WithCancel(context.Background())
+	var forwarding sync.WaitGroup
+	var forwarders []*audit.Forwarder
+	for _, sink := range sinks {
+		f := audit.NewForwarder(conn, sink)
+		forwarding.Add(1)
+		go func() {
+			defer forwarding.Done()
+			f.Start(forwardCtx)
+		}()
+		forwarders = append(forwarders, f)
+	}
+	audit.SetForwarders(forwarders...)
+
+	// Renovação automática dos tokens próximos de expirar
+	rf := refresher.New(conn, nil)
+	go rf.Start(ctx)
+
+	// Recusa subir com o JWT_SECRET padrão fora do modo de desenvolvimento
+	mw, err := auth.JWTMiddlewareWithDB(conn)
+	if err != nil {
+		log.Fatal("Erro ao criar middleware JWT:", err)
+	}
+	// Rotação programada da chave de assinatura (apenas assinatura assimétrica)
+	if ring := auth.KeyringFor(mw); ring != nil {
+		go ring.Start(ctx)
+	}
+
+	// Login SSO via OpenID Connect, se OIDC_ISSUER estiver configurado
+	sso, err := oidc.ProviderFromEnv(context.Background(), nil)
+	if err != nil {
+		log.Fatal("Erro ao configurar OIDC:", err)
+	}
+	mapping, err := oidc.MappingFromEnv()
+	if err != nil {
+		log.Fatal("Erro ao configurar OIDC:", err)
+	}
+
+	r := setupRouter(conn, rf, mw, sso, mapping)
+	srv := &http.Server{Addr: ":8080", Handler: r}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Erro no servidor HTTP:", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	log.Println("Encerrando a API...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.GetShutdownTimeout())
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Erro ao encerrar o servidor HTTP: %v", err)
+	}
+	audit.SetForwarders()
+	stopForwarding()
+	forwarding.Wait()
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/crypto"
+	"api-vault/internal/db"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Verifica a cadeia de hashes da auditoria de uma organização (ou de todas) e
+// aponta o primeiro elo quebrado. Com -archive, confere com AUDIT_EXPORT_KEY um
+// arquivo exportado por /audit-logs/export?archive=true. Com -sign-unsigned, assina
+// as entradas gravadas antes de AUDIT_HMAC_KEY existir. Sai com código 1 se algo não conferir.
+func main() {
+	orgID := flag.Uint("org", 0, "ID da organização; sem ele, verifica todas")
+	archive := flag.String("archive", "", "arquivo .tar.gz exportado a conferir (não acessa o banco)")
+	signUnsigned := flag.Bool("sign-unsigned", false, "assina as entradas gravadas antes da chave, se a cadeia estiver íntegra")
+	flag.Parse()
+
+	// Carrega variáveis do .env
+	_ = godotenv.Load()
+	if *archive != "" {
+		verifyArchive(*archive)
+		return
+	}
+	key, err := crypto.AuditMACKey()
+	if err != nil {
+		log.Fatal("Erro ao ler chave HMAC:", err)
+	}
+	if key == nil {
+		log.Println("AUDIT_HMAC_KEY não configurada; assinaturas não serão conferidas")
+	}
+	conn, err := db.Init()
+	if err != nil {
+		log.Fatal("Erro ao inicializar banco:", err)
+	}
+
+	orgs := []uint{*orgID}
+	if *orgID == 0 {
+		if orgs, err = audit.ChainOrgs(conn); err != nil {
+			log.Fatal("Erro ao listar organizações:", err)
+		}
+	}
+	broken := false
+	for _, org := range orgs {
+		if *signUnsigned {
+			signed, err := audit.SignUnsigned(conn, org, key)
+			if err != nil {
+				broken = true
+				log.Printf("Org %d: entradas não assinadas: %v", org, err)
+				continue
+			}
+			if signed > 0 {
+				log.Printf("Org %d: %d entradas anteriores à chave assinadas", org, signed)
+			}
+		}
+		result, err := audit.Verify(conn, org, key)
+		if err != nil {
+			log.Fatalf("Org %d: erro ao verificar: %v", org, err)
+		}
+		if !result.OK {
+			broken = true
+			log.Printf("Org %d: cadeia QUEBRADA na entrada %d (%s); %d entradas íntegras antes dela", org, result.BrokenID, result.Reason, result.Checked)
+			continue
+		}
+		log.Printf("Org %d: cadeia íntegra, %d entradas conferidas (%d anteriores ao encadeamento, %d sem assinatura)", org, result.Checked, result.Unchained, result.Unsigned)
+	}
+	if broken {
+		os.Exit(1)
+	}
+}
+
+// verifyArchive confere a assinatura do manifesto e o hash dos dados do arquivo exportado
+func verifyArchive(path string) {
+	key, err := crypto.AuditExportKey()
+	if err != nil {
+		log.Fatal("Erro ao ler chave das exportações:", err)
+	}
+	if key == nil {
+		log.Fatal("AUDIT_EXPORT_KEY não configurada; não é possível conferir a assinatura")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal("Erro ao abrir arquivo:", err)
+	}
+	defer f.Close()
+	manifest, err := audit.VerifyArchive(f, key)
+	if err != nil {
+		log.Printf("Arquivo %s INVÁLIDO: %v", path, err)
+		os.Exit(1)
+	}
+	log.Printf("Arquivo %s íntegro: org %d, %d entradas (ids %d a %d), gerado por %s em %s", path, manifest.OrgID, manifest.Rows, manifest.FirstID, manifest.LastID, manifest.GeneratedBy, manifest.GeneratedAt.Format(time.RFC3339))
+}
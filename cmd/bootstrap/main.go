@@ -0,0 +1,56 @@
+package main
+
+import (
+	"api-vault/internal/auth"
+	"api-vault/internal/db"
+	"api-vault/internal/tenant"
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+// Cria o primeiro admin de uma organização (criada se não existir). Só funciona
+// enquanto a organização não tiver nenhum admin cadastrado.
+// A senha vem de BOOTSTRAP_ADMIN_PASSWORD ou é lida da entrada padrão.
+func main() {
+	username := flag.String("username", "admin", "username do admin inicial")
+	orgName := flag.String("org", "default", "nome da organização do admin")
+	flag.Parse()
+
+	// Carrega variáveis do .env
+	_ = godotenv.Load()
+	conn, err := db.Init()
+	if err != nil {
+		log.Fatal("Erro ao inicializar banco:", err)
+	}
+
+	password := os.Getenv("BOOTSTRAP_ADMIN_PASSWORD")
+	if password == "" {
+		fmt.Fprint(os.Stderr, "Senha do admin: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			log.Fatal("Erro ao ler senha:", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	org := tenant.Organization{Name: *orgName}
+	if err := conn.Where("name = ?", *orgName).FirstOrCreate(&org).Error; err != nil {
+		log.Fatal("Erro ao obter organização:", err)
+	}
+
+	user, err := auth.CreateInitialAdmin(tenant.ForOrg(conn, org.ID), *username, password)
+	if errors.Is(err, auth.ErrAdminExists) {
+		log.Fatal("Bootstrap já realizado: ", err)
+	}
+	if err != nil {
+		log.Fatal("Erro ao criar admin:", err)
+	}
+	log.Printf("Admin %s criado (id=%d, org=%s)", user.Username, user.ID, org.Name)
+}
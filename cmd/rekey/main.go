@@ -0,0 +1,46 @@
+package main
+
+import (
+	"api-vault/internal/crypto"
+	"api-vault/internal/db"
+	"api-vault/internal/rekey"
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/joho/godotenv"
+)
+
+// Recriptografa todos os segredos com a chave mestra atual do KMS configurado.
+// Se a execução for interrompida, rodar novamente retoma do último lote salvo.
+func main() {
+	batchSize := flag.Int("batch", rekey.DefaultBatchSize, "registros por transação")
+	flag.Parse()
+
+	// Carrega variáveis do .env
+	_ = godotenv.Load()
+	provider, err := crypto.ProviderFromEnv()
+	if err != nil {
+		log.Fatal("Erro ao configurar KMS:", err)
+	}
+	crypto.SetProvider(provider)
+	conn, err := db.Init()
+	if err != nil {
+		log.Fatal("Erro ao inicializar banco:", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	job, err := rekey.Start(conn, "cli")
+	if err != nil {
+		log.Fatal("Erro ao iniciar recriptografia:", err)
+	}
+	log.Printf("Job %d: tabela=%s ultimo_id=%d", job.ID, job.Step, job.LastID)
+	if err := rekey.Run(ctx, conn, job, *batchSize); err != nil {
+		log.Fatalf("Job %d interrompido em tabela=%s ultimo_id=%d: %v", job.ID, job.Step, job.LastID, err)
+	}
+	log.Printf("Job %d concluído: processados=%d ignorados=%d falhas=%d", job.ID, job.Processed, job.Skipped, job.Failed)
+}
@@ -8,19 +8,56 @@ import (
 
 type AuditLog struct {
 	ID        uint      `gorm:"primaryKey"`
+	OrgID     uint      `gorm:"index"` // 0 para eventos de sistema (workers, CLI)
 	Timestamp time.Time `gorm:"autoCreateTime"`
+	ActorID   uint      `gorm:"index"` // 0 quando não há usuário autenticado
 	User      string    // usuário responsável (se aplicável)
-	Action    string    // ação realizada
-	Status    string    // OK ou FAIL
-	Details   string    // detalhes do evento
+	IP        string    // IP do cliente, em eventos de requisições HTTP
+	UserAgent string
+	RequestID string `gorm:"index"` // correlaciona eventos de uma mesma requisição
+	Action    string // ação realizada (ver Action)
+	Status    string // resultado: OK ou FAIL
+	// Recurso afetado, código do erro e campos alterados (ver Event)
+	ResourceType string `gorm:"index"`
+	ResourceID   string `gorm:"index"`
+	ErrorCode    string `gorm:"index"`
+	Changes      Changes
+	Details      string // detalhes do evento, em texto livre
+	// Cadeia de hashes: adulterar ou remover uma entrada quebra as seguintes
+	PrevHash string
+	Hash     string `gorm:"index"`
+	MAC      string // HMAC do hash, se AUDIT_HMAC_KEY estiver configurada
 }
 
+// SaveAuditLog grava um evento sem requisição HTTP e sem campos estruturados
 func SaveAuditLog(db *gorm.DB, user, action, status, details string) error {
-	log := AuditLog{
-		User:    user,
-		Action:  action,
-		Status:  status,
-		Details: details,
+	return SaveEvent(db, user, Event{Action: Action(action), Outcome: Outcome(status), Details: details})
+}
+
+// SaveEvent grava um evento sem requisição HTTP (workers, jobs e CLI);
+// handlers usam Record, que preenche o ator pela requisição
+func SaveEvent(db *gorm.DB, user string, e Event) error {
+	log, err := newEntry(e)
+	if err != nil {
+		return err
+	}
+	log.User = user
+	return appendEntry(db, log)
+}
+
+// newEntry converte o evento na linha da auditoria
+func newEntry(e Event) (*AuditLog, error) {
+	changes, err := e.Changes.normalize()
+	if err != nil {
+		return nil, err
 	}
-	return db.Create(&log).Error
+	return &AuditLog{
+		Action:       string(e.Action),
+		Status:       string(e.Outcome),
+		ResourceType: string(e.ResourceType),
+		ResourceID:   e.ResourceID,
+		ErrorCode:    string(e.ErrorCode),
+		Changes:      changes,
+		Details:      e.Details,
+	}, nil
 }
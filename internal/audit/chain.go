@@ -0,0 +1,263 @@
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"api-vault/internal/crypto"
+	"api-vault/internal/tenant"
+)
+
+// Tamanho do lote lido na verificação da cadeia
+const verifyBatchSize = 500
+
+// ChainHead guarda o último elo da cadeia de cada organização. A linha é
+// travada a cada inserção, serializando os eventos da mesma cadeia, e permite
+// detectar a remoção das entradas mais recentes.
+type ChainHead struct {
+	OrgID  uint `gorm:"primaryKey;autoIncrement:false"`
+	LastID uint
+	Hash   string
+}
+
+func (ChainHead) TableName() string {
+	return "audit_chain_heads"
+}
+
+// chainContent é o que o hash de uma entrada cobre; a ordem dos campos é fixa
+type chainContent struct {
+	OrgID     uint   `json:"org_id"`
+	Timestamp string `json:"timestamp"`
+	ActorID   uint   `json:"actor_id"`
+	User      string `json:"user"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	RequestID string `json:"request_id"`
+	Action    string `json:"action"`
+	Status    string `json:"status"`
+	Details   string `json:"details"`
+	PrevHash  string `json:"prev_hash"`
+	// Campos estruturados; omitidos quando vazios, o que mantém o hash das entradas anteriores a eles
+	ResourceType string  `json:"resource_type,omitempty"`
+	ResourceID   string  `json:"resource_id,omitempty"`
+	ErrorCode    string  `json:"error_code,omitempty"`
+	Changes      Changes `json:"changes,omitempty"`
+}
+
+// computeHash calcula o hash do conteúdo da entrada encadeado ao hash anterior
+func computeHash(log *AuditLog) string {
+	data, _ := json.Marshal(chainContent{
+		OrgID:     log.OrgID,
+		Timestamp: log.Timestamp.UTC().Format(time.RFC3339Nano),
+		ActorID:   log.ActorID,
+		User:      log.User,
+		IP:        log.IP,
+		UserAgent: log.UserAgent,
+		RequestID: log.RequestID,
+		Action:    log.Action,
+		Status:    log.Status,
+		Details:   log.Details,
+		PrevHash:  log.PrevHash,
+
+		ResourceType: log.ResourceType,
+		ResourceID:   log.ResourceID,
+		ErrorCode:    log.ErrorCode,
+		Changes:      log.Changes,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func computeMAC(key []byte, hash string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(hash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// appendEntry grava a entrada no fim da cadeia da organização do contexto e a
+// agenda para os sinks configurados (ver SetForwarders)
+func appendEntry(db *gorm.DB, log *AuditLog) error {
+	key, err := crypto.AuditMACKey()
+	if err != nil {
+		return err
+	}
+	log.OrgID, _ = tenant.FromContext(db.Statement.Context)
+	// Eventos de requisições sem organização vão para a cadeia de sistema
+	db = tenant.ForOrg(db, log.OrgID)
+	// Precisão de microssegundos: o que o banco devolve é o que foi assinado
+	log.Timestamp = time.Now().UTC().Truncate(time.Microsecond)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&ChainHead{OrgID: log.OrgID}).Error; err != nil {
+			return err
+		}
+		var head ChainHead
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("org_id = ?", log.OrgID).First(&head).Error; err != nil {
+			return err
+		}
+		log.PrevHash = head.Hash
+		log.Hash = computeHash(log)
+		if key != nil {
+			log.MAC = computeMAC(key, log.Hash)
+		}
+		if err := tx.Create(log).Error; err != nil {
+			return err
+		}
+		return tx.Model(&head).Where("org_id = ?", log.OrgID).Updates(map[string]interface{}{"last_id": log.ID, "hash": log.Hash}).Error
+	})
+	if err != nil {
+		return err
+	}
+	forward(log)
+	return nil
+}
+
+// VerifyResult descreve a verificação da cadeia de uma organização
+type VerifyResult struct {
+	OrgID     uint   `json:"org_id"`
+	OK        bool   `json:"ok"`
+	Checked   int    `json:"checked"`             // entradas encadeadas conferidas
+	Unchained int    `json:"unchained"`           // entradas anteriores ao encadeamento
+	Signed    bool   `json:"signed"`              // assinaturas HMAC conferidas
+	Unsigned  int    `json:"unsigned"`            // entradas encadeadas sem assinatura; com a chave, quebram a cadeia
+	BrokenID  uint   `json:"broken_id,omitempty"` // primeira entrada com elo quebrado
+	Reason    string `json:"reason,omitempty"`
+}
+
+func (r *VerifyResult) fail(id uint, reason string) {
+	r.OK = false
+	r.BrokenID = id
+	r.Reason = reason
+}
+
+// errBroken interrompe a leitura em lotes no primeiro elo quebrado
+var errBroken = errors.New("cadeia quebrada")
+
+// Motivo da falha quando há chave e entradas sem assinatura: quem tem acesso ao
+// banco pode refazer os hashes e apagar todas as assinaturas, então a ausência
+// delas não pode ser aceita como "entradas anteriores à chave"
+const reasonUnsigned = "entradas sem assinatura HMAC com AUDIT_HMAC_KEY configurada"
+
+// Verify percorre a cadeia da organização em ordem e aponta o primeiro elo quebrado:
+// conteúdo alterado, entrada removida ou reordenada, assinatura inválida ou ausente
+// e remoção das entradas mais recentes. Com chave, toda entrada encadeada precisa
+// estar assinada; sem chave, as assinaturas não são conferidas.
+func Verify(conn *gorm.DB, orgID uint, key []byte) (VerifyResult, error) {
+	result := VerifyResult{OrgID: orgID, OK: true, Signed: key != nil}
+	db := tenant.ForOrg(conn, orgID)
+	var (
+		prev          string
+		started       bool
+		signedAt      bool // a partir da primeira entrada assinada, todas precisam estar
+		firstUnsigned uint
+		batch         []AuditLog
+	)
+	err := db.Where("org_id = ?", orgID).Order("id").FindInBatches(&batch, verifyBatchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			entry := &batch[i]
+			if entry.Hash == "" {
+				if started {
+					result.fail(entry.ID, "entrada sem hash dentro da cadeia")
+					return errBroken
+				}
+				result.Unchained++
+				continue
+			}
+			started = true
+			switch {
+			case entry.PrevHash != prev:
+				result.fail(entry.ID, "hash anterior não confere: entrada anterior removida ou reordenada")
+			case computeHash(entry) != entry.Hash:
+				result.fail(entry.ID, "conteúdo alterado")
+			case key != nil && entry.MAC != "" && !hmac.Equal([]byte(computeMAC(key, entry.Hash)), []byte(entry.MAC)):
+				result.fail(entry.ID, "assinatura HMAC inválida")
+			case key != nil && entry.MAC == "" && signedAt:
+				result.fail(entry.ID, "assinatura HMAC ausente")
+			}
+			if !result.OK {
+				return errBroken
+			}
+			signedAt = signedAt || entry.MAC != ""
+			if !signedAt {
+				if firstUnsigned == 0 {
+					firstUnsigned = entry.ID
+				}
+				result.Unsigned++
+			}
+			prev = entry.Hash
+			result.Checked++
+		}
+		return nil
+	}).Error
+	if errors.Is(err, errBroken) {
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	if key != nil && result.Unsigned > 0 {
+		result.fail(firstUnsigned, reasonUnsigned)
+		return result, nil
+	}
+
+	// O último elo precisa ser o registrado no head
+	var head ChainHead
+	err = db.Where("org_id = ?", orgID).First(&head).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if started {
+			result.fail(0, "registro do último elo ausente")
+		}
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	if head.Hash != prev {
+		result.fail(head.LastID, "últimas entradas da cadeia removidas")
+	}
+	return result, nil
+}
+
+// SignUnsigned assina com key as entradas gravadas antes da configuração da
+// chave, depois de conferir que a cadeia está íntegra e que só falta a
+// assinatura delas. Quem roda atesta que o banco não foi alterado até aqui.
+// Devolve quantas entradas foram assinadas.
+func SignUnsigned(conn *gorm.DB, orgID uint, key []byte) (int, error) {
+	if key == nil {
+		return 0, errors.New("AUDIT_HMAC_KEY não configurada")
+	}
+	result, err := Verify(conn, orgID, key)
+	if err != nil || result.OK {
+		return 0, err
+	}
+	if result.Reason != reasonUnsigned {
+		return 0, fmt.Errorf("cadeia quebrada na entrada %d: %s", result.BrokenID, result.Reason)
+	}
+	db := tenant.ForOrg(conn, orgID)
+	signed := 0
+	var batch []AuditLog
+	err = db.Where("org_id = ? AND hash <> '' AND (mac IS NULL OR mac = '')", orgID).Order("id").FindInBatches(&batch, verifyBatchSize, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if err := conn.Model(&AuditLog{}).Where("id = ? AND hash = ?", batch[i].ID, batch[i].Hash).Update("mac", computeMAC(key, batch[i].Hash)).Error; err != nil {
+				return err
+			}
+			signed++
+		}
+		return nil
+	}).Error
+	return signed, err
+}
+
+// ChainOrgs lista as organizações que têm eventos de auditoria ou cadeia iniciada
+func ChainOrgs(conn *gorm.DB) ([]uint, error) {
+	var ids []uint
+	err := conn.Raw("SELECT org_id FROM audit_logs UNION SELECT org_id FROM audit_chain_heads ORDER BY org_id").Scan(&ids).Error
+	return ids, err
+}
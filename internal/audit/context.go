@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RequestIDHeader correlaciona a requisição com os eventos de auditoria que ela gerou
+const RequestIDHeader = "X-Request-ID"
+
+// Chaves no contexto do Gin
+const (
+	requestIDKey     = "audit_request_id"
+	actorIDKey       = "audit_actor_id"
+	actorUsernameKey = "audit_actor_username"
+)
+
+// Tamanho máximo do User-Agent gravado
+const maxUserAgent = 512
+
+// ID recebido de um proxy só é aproveitado se for curto e sem caracteres especiais
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Actor identifica quem originou um evento de auditoria
+type Actor struct {
+	ID        uint
+	Username  string
+	IP        string
+	UserAgent string
+	RequestID string
+}
+
+// RequestID atribui um ID a cada requisição, aproveitando o X-Request-ID de
+// quem chama quando válido, e o devolve no cabeçalho da resposta
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// SetActor registra na requisição o usuário responsável pelos próximos eventos.
+// Rotas autenticadas o recebem da identidade do JWT; login e callbacks o
+// definem quando descobrem quem é o usuário.
+func SetActor(c *gin.Context, id uint, username string) {
+	c.Set(actorIDKey, id)
+	c.Set(actorUsernameKey, username)
+}
+
+// ActorFrom monta o ator a partir da requisição
+func ActorFrom(c *gin.Context) Actor {
+	ua := c.Request.UserAgent()
+	if len(ua) > maxUserAgent {
+		ua = ua[:maxUserAgent]
+	}
+	return Actor{
+		ID:        c.GetUint(actorIDKey),
+		Username:  c.GetString(actorUsernameKey),
+		IP:        c.ClientIP(),
+		UserAgent: ua,
+		RequestID: c.GetString(requestIDKey),
+	}
+}
+
+// Record grava um evento de auditoria com o ator da requisição
+func Record(c *gin.Context, db *gorm.DB, e Event) error {
+	log, err := newEntry(e)
+	if err != nil {
+		return err
+	}
+	a := ActorFrom(c)
+	log.ActorID = a.ID
+	log.User = a.Username
+	log.IP = a.IP
+	log.UserAgent = a.UserAgent
+	log.RequestID = a.RequestID
+	return appendEntry(db, log)
+}
@@ -0,0 +1,155 @@
+package audit
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"api-vault/internal/crypto"
+)
+
+// Change é o valor anterior e o novo de um campo
+type Change struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// Changes mapeia a coluna alterada para a mudança. É gravado como JSON
+// (jsonb no Postgres, json no SQLite); vazio vira NULL.
+type Changes map[string]Change
+
+// Value implementa driver.Valuer
+func (ch Changes) Value() (driver.Value, error) {
+	if len(ch) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(ch)
+	return string(data), err
+}
+
+// Scan implementa sql.Scanner
+func (ch *Changes) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*ch = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("tipo inesperado para Changes: %T", value)
+	}
+	return json.Unmarshal(data, ch)
+}
+
+// GormDataType implementa schema.GormDataTypeInterface
+func (Changes) GormDataType() string {
+	return "json"
+}
+
+// GormDBDataType escolhe o tipo da coluna conforme o banco
+func (Changes) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	if db.Dialector.Name() == "postgres" {
+		return "jsonb"
+	}
+	return "json"
+}
+
+// changedField filtra eventos cujo diff contém a coluna
+func changedField(db *gorm.DB, field string) clause.Expr {
+	if db.Dialector.Name() == "postgres" {
+		return gorm.Expr("jsonb_exists(changes, ?)", field)
+	}
+	return gorm.Expr("json_type(changes, ?) IS NOT NULL", "$."+strconv.Quote(field))
+}
+
+// normalize devolve as mudanças como ficam depois de lidas do banco (números
+// como float64, datas como texto), para que o hash calculado na gravação
+// seja o mesmo da verificação
+func (ch Changes) normalize() (Changes, error) {
+	if len(ch) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(ch)
+	if err != nil {
+		return nil, err
+	}
+	var out Changes
+	err = json.Unmarshal(data, &out)
+	return out, err
+}
+
+// Nomes de colunas como o GORM os gera
+var columnNamer = schema.NamingStrategy{}
+
+// Diff compara duas versões de um modelo e devolve os campos alterados pelo nome
+// da coluna. Campos com a tag `audit:"secret"` aparecem mascarados, os com
+// `audit:"-"` ou `gorm:"-"` e UpdatedAt são ignorados. Para cadastros compare com
+// o valor zero do tipo; para remoções, o contrário.
+func Diff(before, after interface{}) Changes {
+	b := reflect.Indirect(reflect.ValueOf(before))
+	a := reflect.Indirect(reflect.ValueOf(after))
+	if !a.IsValid() || !b.IsValid() || a.Type() != b.Type() || a.Kind() != reflect.Struct {
+		return nil
+	}
+	changes := Changes{}
+	diffStruct(b, a, changes)
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+func diffStruct(b, a reflect.Value, changes Changes) {
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || f.Name == "UpdatedAt" || f.Tag.Get("audit") == "-" {
+			continue
+		}
+		settings := schema.ParseTagSetting(f.Tag.Get("gorm"), ";")
+		if _, ok := settings["-"]; ok {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			diffStruct(b.Field(i), a.Field(i), changes)
+			continue
+		}
+		old, new := b.Field(i).Interface(), a.Field(i).Interface()
+		if sameJSON(old, new) {
+			continue
+		}
+		name := settings["COLUMN"]
+		if name == "" {
+			name = columnNamer.ColumnName("", f.Name)
+		}
+		if f.Tag.Get("audit") == "secret" {
+			old, new = redact(b.Field(i)), redact(a.Field(i))
+		}
+		changes[name] = Change{Old: old, New: new}
+	}
+}
+
+// sameJSON compara pelo que seria gravado, o que trata datas e ponteiros
+func sameJSON(x, y interface{}) bool {
+	dx, errX := json.Marshal(x)
+	dy, errY := json.Marshal(y)
+	return errX == nil && errY == nil && bytes.Equal(dx, dy)
+}
+
+// redact mostra apenas se o segredo estava preenchido
+func redact(v reflect.Value) interface{} {
+	if v.IsZero() {
+		return ""
+	}
+	return crypto.MaskedValue
+}
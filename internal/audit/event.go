@@ -0,0 +1,189 @@
+package audit
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Action identifica o que foi feito. Os valores são os nomes já gravados na
+// auditoria, para que filtros e relatórios antigos continuem valendo.
+type Action string
+
+const (
+	// Usuários e login
+	ActionUserCreate        Action = "cadastro_usuario"
+	ActionUserUpdate        Action = "alteracao_usuario"
+	ActionUserDelete        Action = "delecao_usuario"
+	ActionUserDisable       Action = "desativacao_usuario"
+	ActionUserEnable        Action = "reativacao_usuario"
+	ActionUserRoleAssign    Action = "atribuicao_papel"
+	ActionPasswordReset     Action = "redefinicao_senha"
+	ActionPasswordChange    Action = "troca_senha"
+	ActionBootstrapAdmin    Action = "bootstrap_admin"
+	ActionLoginLock         Action = "bloqueio_login"
+	ActionLoginUnlock       Action = "desbloqueio_login"
+	ActionLoginMFA          Action = "login_mfa"
+	ActionLoginSSO          Action = "login_sso"
+	ActionSSOProvision      Action = "provisionamento_sso"
+	ActionLogout            Action = "logout"
+	ActionSessionsRevoke    Action = "revogacao_sessoes"
+	ActionMFAEnrollStart    Action = "mfa_cadastro_inicio"
+	ActionMFAEnable         Action = "mfa_ativacao"
+	ActionMFARecoveryCodes  Action = "mfa_codigos_recuperacao"
+	ActionMFADisable        Action = "mfa_desativacao"
+	ActionMFAReset          Action = "mfa_reset"
+	ActionServiceAccountAdd Action = "cadastro_conta_servico"
+	ActionAPIKeyCreate      Action = "criacao_api_key"
+	ActionAPIKeyRotate      Action = "rotacao_api_key"
+	ActionAPIKeyRevoke      Action = "revogacao_api_key"
+
+	// Papéis e grupos
+	ActionRoleCreate      Action = "cadastro_papel"
+	ActionRoleUpdate      Action = "atualizacao_papel"
+	ActionRoleDelete      Action = "delecao_papel"
+	ActionRoleMFAPolicy   Action = "politica_mfa_papel"
+	ActionGroupCreate     Action = "cadastro_grupo"
+	ActionGroupMemberAdd  Action = "inclusao_membro_grupo"
+	ActionGroupMemberDrop Action = "remocao_membro_grupo"
+
+	// Integrações, tokens e ACL
+	ActionIntegrationList   Action = "listagem_integracoes"
+	ActionIntegrationRead   Action = "consulta_integracao_id"
+	ActionIntegrationCreate Action = "cadastro_integracao"
+	ActionIntegrationUpdate Action = "atualizacao_integracao"
+	ActionIntegrationDelete Action = "delecao_integracao"
+	ActionIntegrationReveal Action = "revelacao_segredo_integracao"
+	ActionACLGrant          Action = "concessao_acl"
+	ActionACLRevoke         Action = "revogacao_acl"
+	ActionTokenList         Action = "listagem_tokens"
+	ActionTokenRead         Action = "consulta_token_id"
+	ActionTokenCreate       Action = "cadastro_token"
+	ActionTokenUpdate       Action = "atualizacao_token"
+	ActionTokenDelete       Action = "delecao_token"
+	ActionTokenReveal       Action = "revelacao_segredo_token"
+	ActionTokenUse          Action = "consulta_access_token"
+	ActionTokenRefresh      Action = "renovacao_token"
+	ActionTokenReconsent    Action = "reconsentimento_token"
+	ActionConsentStart      Action = "inicio_consentimento"
+	ActionConsentCallback   Action = "callback_consentimento"
+
+	// Chaves e auditoria
+	ActionSigningKeyRotate Action = "rotacao_chave_jwt"
+	ActionRekeyStart       Action = "rekey_inicio"
+	ActionRekeyBatch       Action = "rekey_lote"
+	ActionRekeyRecord      Action = "rekey_registro"
+	ActionRekeyFinish      Action = "rekey_fim"
+	ActionAuditVerify      Action = "verificacao_auditoria"
+	ActionAuditExport      Action = "exportacao_auditoria"
+)
+
+// Outcome é o resultado do evento, gravado na coluna status
+type Outcome string
+
+const (
+	OutcomeOK   Outcome = "OK"
+	OutcomeFail Outcome = "FAIL"
+)
+
+// ResourceType é o tipo do recurso afetado pelo evento
+type ResourceType string
+
+const (
+	ResourceUser        ResourceType = "user"
+	ResourceRole        ResourceType = "role"
+	ResourceGroup       ResourceType = "group"
+	ResourceIntegration ResourceType = "integration"
+	ResourceToken       ResourceType = "token"
+	ResourceACLEntry    ResourceType = "acl_entry"
+	ResourceSession     ResourceType = "session"
+	ResourceAPIKey      ResourceType = "api_key"
+	ResourceSigningKey  ResourceType = "signing_key"
+	ResourceRekeyJob    ResourceType = "rekey_job"
+	ResourceAuditLog    ResourceType = "audit_log"
+)
+
+// ErrorCode classifica a falha de um evento FAIL
+type ErrorCode string
+
+const (
+	CodeInvalidInput ErrorCode = "invalid_input"
+	CodeUnauthorized ErrorCode = "unauthorized"
+	CodeForbidden    ErrorCode = "forbidden"
+	CodeNotFound     ErrorCode = "not_found"
+	CodeConflict     ErrorCode = "conflict"
+	CodeLocked       ErrorCode = "locked"
+	CodeUpstream     ErrorCode = "upstream_error"
+	CodeTampered     ErrorCode = "tampered"
+	CodeInternal     ErrorCode = "internal"
+)
+
+// CodeForStatus deduz o código do erro do status HTTP já respondido
+func CodeForStatus(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return CodeInvalidInput
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests:
+		return CodeLocked
+	case http.StatusBadGateway:
+		return CodeUpstream
+	}
+	return CodeInternal
+}
+
+// Event é um evento de auditoria tipado. Details continua livre, para leitura humana;
+// os demais campos são colunas que podem ser filtradas.
+type Event struct {
+	Action       Action
+	Outcome      Outcome
+	ResourceType ResourceType
+	ResourceID   string
+	ErrorCode    ErrorCode
+	Changes      Changes // campos alterados, com segredos ocultos (ver Diff)
+	Details      string
+}
+
+// Succeeded monta um evento OK sobre o recurso; id pode ser número ou texto
+func Succeeded(action Action, resource ResourceType, id interface{}) Event {
+	return Event{Action: action, Outcome: OutcomeOK, ResourceType: resource, ResourceID: resourceID(id)}
+}
+
+// Failed monta um evento FAIL sobre o recurso com o código do erro
+func Failed(action Action, resource ResourceType, id interface{}, code ErrorCode) Event {
+	return Event{Action: action, Outcome: OutcomeFail, ResourceType: resource, ResourceID: resourceID(id), ErrorCode: code}
+}
+
+// Detailf acrescenta o texto livre do evento
+func (e Event) Detailf(format string, args ...interface{}) Event {
+	e.Details = fmt.Sprintf(format, args...)
+	return e
+}
+
+// WithChanges acrescenta os campos alterados
+func (e Event) WithChanges(changes Changes) Event {
+	e.Changes = changes
+	return e
+}
+
+// resourceID normaliza o identificador; zero e vazio viram "sem recurso"
+func resourceID(id interface{}) string {
+	switch v := id.(type) {
+	case nil:
+		return ""
+	case uint:
+		if v == 0 {
+			return ""
+		}
+	case string:
+		return strings.TrimSpace(v)
+	}
+	return fmt.Sprint(id)
+}
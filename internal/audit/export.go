@@ -0,0 +1,323 @@
+package audit
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Formatos de exportação
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// Entradas lidas do banco por vez; a exportação nunca guarda mais que um lote em memória
+const exportBatchSize = 1000
+
+// Nomes dos arquivos dentro do arquivo assinado
+const (
+	manifestName  = "manifest.json"
+	signatureName = manifestName + ".sig"
+)
+
+var (
+	ErrUnknownFormat     = errors.New("formato de exportação inválido; use csv ou ndjson")
+	ErrNoArchiveKey      = errors.New("arquivo assinado exige AUDIT_EXPORT_KEY")
+	ErrArchiveSignature  = errors.New("assinatura do manifesto não confere")
+	ErrArchiveDigest     = errors.New("conteúdo do arquivo não confere com o manifesto")
+	ErrArchiveIncomplete = errors.New("arquivo sem manifesto, assinatura ou dados")
+)
+
+// Colunas do CSV, na ordem da tabela
+var csvHeader = []string{
+	"id", "org_id", "timestamp", "actor_id", "user", "ip", "user_agent", "request_id",
+	"action", "status", "resource_type", "resource_id", "error_code", "changes", "details",
+	"prev_hash", "hash", "mac",
+}
+
+// ExportStats resume as entradas exportadas
+type ExportStats struct {
+	Rows     int64  `json:"rows"`
+	FirstID  uint   `json:"first_id,omitempty"`
+	LastID   uint   `json:"last_id,omitempty"`
+	LastHash string `json:"last_hash,omitempty"` // hash da última entrada, para ancorar na cadeia
+}
+
+// ValidFormat indica se o formato de exportação é suportado
+func ValidFormat(format string) bool {
+	return format == FormatCSV || format == FormatNDJSON
+}
+
+// Export escreve as entradas da consulta em w, em lotes pela ordem do ID (a ordem
+// da cadeia), sem carregar o resultado inteiro. flush, se informado, é chamado
+// após cada lote para que o cliente receba os dados enquanto a consulta avança.
+func Export(query *gorm.DB, format string, w io.Writer, flush func()) (ExportStats, error) {
+	var stats ExportStats
+	if !ValidFormat(format) {
+		return stats, ErrUnknownFormat
+	}
+	buf := bufio.NewWriter(w)
+	var write func(*AuditLog) error
+	var csvw *csv.Writer
+	if format == FormatCSV {
+		csvw = csv.NewWriter(buf)
+		if err := csvw.Write(csvHeader); err != nil {
+			return stats, err
+		}
+		write = func(entry *AuditLog) error { return csvw.Write(csvRecord(entry)) }
+	} else {
+		enc := json.NewEncoder(buf)
+		write = func(entry *AuditLog) error { return enc.Encode(entry) }
+	}
+
+	var batch []AuditLog
+	err := query.FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, n int) error {
+		for i := range batch {
+			if err := write(&batch[i]); err != nil {
+				return err
+			}
+			if stats.Rows == 0 {
+				stats.FirstID = batch[i].ID
+			}
+			stats.Rows++
+			stats.LastID = batch[i].ID
+			stats.LastHash = batch[i].Hash
+		}
+		if csvw != nil {
+			csvw.Flush()
+			if err := csvw.Error(); err != nil {
+				return err
+			}
+		}
+		if err := buf.Flush(); err != nil {
+			return err
+		}
+		if flush != nil {
+			flush()
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return stats, err
+	}
+	// Sem entradas o cabeçalho do CSV ainda está no buffer
+	if csvw != nil {
+		csvw.Flush()
+		if err := csvw.Error(); err != nil {
+			return stats, err
+		}
+	}
+	return stats, buf.Flush()
+}
+
+// csvRecord converte a entrada para as colunas de csvHeader
+func csvRecord(entry *AuditLog) []string {
+	changes := ""
+	if len(entry.Changes) > 0 {
+		data, _ := json.Marshal(entry.Changes)
+		changes = string(data)
+	}
+	return []string{
+		strconv.FormatUint(uint64(entry.ID), 10),
+		strconv.FormatUint(uint64(entry.OrgID), 10),
+		entry.Timestamp.UTC().Format(time.RFC3339Nano),
+		strconv.FormatUint(uint64(entry.ActorID), 10),
+		csvText(entry.User),
+		csvText(entry.IP),
+		csvText(entry.UserAgent),
+		csvText(entry.RequestID),
+		csvText(entry.Action),
+		csvText(entry.Status),
+		csvText(entry.ResourceType),
+		csvText(entry.ResourceID),
+		csvText(entry.ErrorCode),
+		csvText(changes),
+		csvText(entry.Details),
+		entry.PrevHash,
+		entry.Hash,
+		entry.MAC,
+	}
+}
+
+// csvText neutraliza texto que uma planilha interpretaria como fórmula (username,
+// User-Agent e detalhes vêm de quem chama a API): células que começam com =, +, -,
+// @, tab ou CR ganham um apóstrofo na frente. O NDJSON mantém o valor original.
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// Manifest descreve o conteúdo de um arquivo de exportação assinado
+type Manifest struct {
+	File        string    `json:"file"`
+	Format      string    `json:"format"`
+	SHA256      string    `json:"sha256"` // do arquivo de dados
+	OrgID       uint      `json:"org_id"`
+	Filter      Filter    `json:"filter"`
+	GeneratedAt time.Time `json:"generated_at"`
+	GeneratedBy string    `json:"generated_by"`
+	ExportStats
+}
+
+// Archive é uma exportação pronta para ser enviada como tar.gz: os dados, o
+// manifesto e a assinatura HMAC-SHA256 do manifesto. Os dados ficam num arquivo
+// temporário, pois o tar precisa do tamanho de cada entrada antes do conteúdo.
+type Archive struct {
+	Manifest  Manifest
+	data      *os.File
+	size      int64
+	manifest  []byte
+	signature []byte
+}
+
+// NewArchive exporta a consulta para um arquivo temporário e monta o manifesto
+// assinado com key. Chame Close para remover o arquivo temporário.
+func NewArchive(query *gorm.DB, manifest Manifest, key []byte) (*Archive, error) {
+	if len(key) == 0 {
+		return nil, ErrNoArchiveKey
+	}
+	if !ValidFormat(manifest.Format) {
+		return nil, ErrUnknownFormat
+	}
+	tmp, err := os.CreateTemp("", "audit-export-*")
+	if err != nil {
+		return nil, err
+	}
+	a := &Archive{data: tmp}
+	digest := sha256.New()
+	stats, err := Export(query, manifest.Format, io.MultiWriter(tmp, digest), nil)
+	if err == nil {
+		a.size, err = tmp.Seek(0, io.SeekCurrent)
+	}
+	if err != nil {
+		a.Close()
+		return nil, err
+	}
+	manifest.File = "audit-logs." + manifest.Format
+	manifest.SHA256 = hex.EncodeToString(digest.Sum(nil))
+	manifest.ExportStats = stats
+	a.Manifest = manifest
+	if a.manifest, err = json.MarshalIndent(manifest, "", "  "); err != nil {
+		a.Close()
+		return nil, err
+	}
+	a.signature = []byte(signManifest(key, a.manifest) + "\n")
+	return a, nil
+}
+
+// WriteTar grava o tar.gz em w: dados, manifesto e assinatura, nessa ordem
+func (a *Archive) WriteTar(w io.Writer) error {
+	if _, err := a.data.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	modTime := a.Manifest.GeneratedAt
+	files := []struct {
+		name string
+		size int64
+		body io.Reader
+	}{
+		{a.Manifest.File, a.size, a.data},
+		{manifestName, int64(len(a.manifest)), bytes.NewReader(a.manifest)},
+		{signatureName, int64(len(a.signature)), bytes.NewReader(a.signature)},
+	}
+	for _, f := range files {
+		header := &tar.Header{Name: f.name, Mode: 0o644, Size: f.size, ModTime: modTime, Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, f.body); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Close remove o arquivo temporário
+func (a *Archive) Close() error {
+	a.data.Close()
+	return os.Remove(a.data.Name())
+}
+
+// VerifyArchive confere a assinatura do manifesto com key e o SHA-256 dos dados,
+// lendo o tar.gz em sequência, sem extraí-lo
+func VerifyArchive(r io.Reader, key []byte) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	var manifestData, signature []byte
+	digests := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch header.Name {
+		case manifestName:
+			manifestData, err = io.ReadAll(io.LimitReader(tr, 1<<20))
+		case signatureName:
+			signature, err = io.ReadAll(io.LimitReader(tr, 1<<10))
+		default:
+			digest := sha256.New()
+			_, err = io.Copy(digest, tr)
+			digests[header.Name] = hex.EncodeToString(digest.Sum(nil))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if manifestData == nil || signature == nil {
+		return nil, ErrArchiveIncomplete
+	}
+	expected := signManifest(key, manifestData)
+	if !hmac.Equal([]byte(expected), bytes.TrimSpace(signature)) {
+		return nil, ErrArchiveSignature
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("manifesto inválido: %w", err)
+	}
+	digest, ok := digests[manifest.File]
+	if !ok {
+		return nil, ErrArchiveIncomplete
+	}
+	if digest != manifest.SHA256 || len(digests) != 1 {
+		return nil, ErrArchiveDigest
+	}
+	return &manifest, nil
+}
+
+// signManifest é o HMAC-SHA256 do manifesto, em hexadecimal
+func signManifest(key, manifest []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(manifest)
+	return hex.EncodeToString(mac.Sum(nil))
+}
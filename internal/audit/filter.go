@@ -0,0 +1,76 @@
+package audit
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Filter são os filtros de consulta da auditoria, os mesmos na listagem e na exportação
+type Filter struct {
+	User         string `json:"user,omitempty"`
+	Action       string `json:"action,omitempty"`
+	Status       string `json:"status,omitempty"` // OK ou FAIL; aceita também ?outcome=
+	ResourceType string `json:"resource_type,omitempty"`
+	ResourceID   string `json:"resource_id,omitempty"`
+	ErrorCode    string `json:"error_code,omitempty"`
+	Field        string `json:"field,omitempty"` // coluna presente no diff
+	ActorID      string `json:"actor_id,omitempty"`
+	RequestID    string `json:"request_id,omitempty"`
+	Start        string `json:"start,omitempty"` // data inicial (RFC3339)
+	End          string `json:"end,omitempty"`   // data final (RFC3339)
+}
+
+// filterFromQuery lê os filtros da query string
+func filterFromQuery(c *gin.Context) Filter {
+	return Filter{
+		User:         c.Query("user"),
+		Action:       c.Query("action"),
+		Status:       c.DefaultQuery("status", c.Query("outcome")),
+		ResourceType: c.Query("resource_type"),
+		ResourceID:   c.Query("resource_id"),
+		ErrorCode:    c.Query("error_code"),
+		Field:        c.Query("field"),
+		ActorID:      c.Query("actor_id"),
+		RequestID:    c.Query("request_id"),
+		Start:        c.Query("start"),
+		End:          c.Query("end"),
+	}
+}
+
+// apply acrescenta os filtros preenchidos à consulta
+func (f Filter) apply(query *gorm.DB) *gorm.DB {
+	if f.User != "" {
+		query = query.Where("user = ?", f.User)
+	}
+	if f.Action != "" {
+		query = query.Where("action = ?", f.Action)
+	}
+	if f.Status != "" {
+		query = query.Where("status = ?", f.Status)
+	}
+	if f.ResourceType != "" {
+		query = query.Where("resource_type = ?", f.ResourceType)
+	}
+	if f.ResourceID != "" {
+		query = query.Where("resource_id = ?", f.ResourceID)
+	}
+	if f.ErrorCode != "" {
+		query = query.Where("error_code = ?", f.ErrorCode)
+	}
+	if f.Field != "" {
+		query = query.Where(changedField(query, f.Field))
+	}
+	if f.ActorID != "" {
+		query = query.Where("actor_id = ?", f.ActorID)
+	}
+	if f.RequestID != "" {
+		query = query.Where("request_id = ?", f.RequestID)
+	}
+	if f.Start != "" {
+		query = query.Where("timestamp >= ?", f.Start)
+	}
+	if f.End != "" {
+		query = query.Where("timestamp <= ?", f.End)
+	}
+	return query
+}
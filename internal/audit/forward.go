@@ -0,0 +1,316 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+
+	"api-vault/internal/config"
+)
+
+// Sink envia as entradas da auditoria para um sistema externo (SIEM, syslog, webhook).
+// Send pode demorar ou falhar: só é chamado pelo Forwarder, fora das requisições.
+type Sink interface {
+	Name() string
+	Send(ctx context.Context, entry *AuditLog) error
+}
+
+// DeadLetter guarda uma entrada que um sink não recebeu; é reenviada quando ele volta
+type DeadLetter struct {
+	ID      uint   `gorm:"primaryKey"`
+	Sink    string `gorm:"not null;index"`
+	EntryID uint   `gorm:"index"`
+	OrgID   uint   `gorm:"index"`
+	Payload string `gorm:"not null"` // a entrada em JSON
+	Error   string
+	// Attempts conta os reenvios que falharam
+	Attempts int
+	// ClaimedBy e ClaimedUntil reservam a dead letter para a instância que a está
+	// reenviando; com a reserva vencida outra instância pode pegá-la
+	ClaimedBy    string
+	ClaimedUntil *time.Time `gorm:"index"`
+	// Quarantined marca um Payload ilegível, que fica na tabela para análise e não
+	// é mais reenviado
+	Quarantined bool `gorm:"not null;default:false"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (DeadLetter) TableName() string {
+	return "audit_dead_letters"
+}
+
+// Dead letters reenviadas por consulta
+const deadLetterBatchSize = 100
+
+// Forwarder entrega as entradas gravadas a um sink em segundo plano. Uma fila
+// limitada absorve picos; cada entrega é tentada MaxAttempts vezes com espera
+// crescente e o que não for entregue vai para audit_dead_letters. Depois de uma
+// entrega perdida o sink é considerado fora: as novas entradas vão direto para a
+// tabela, sem esperar, até que o reenvio periódico dela funcione.
+type Forwarder struct {
+	sink     Sink
+	conn     *gorm.DB
+	owner    string // identifica esta instância nas reservas de dead letters
+	queue    chan AuditLog
+	overflow chan AuditLog
+	down     atomic.Bool
+	lastErr  atomic.Value // string
+
+	// MaxAttempts é o número de tentativas de cada entrega
+	MaxAttempts int
+	// Backoff é a espera antes da segunda tentativa; dobra a cada nova falha
+	Backoff time.Duration
+	// Timeout limita cada envio ao sink
+	Timeout time.Duration
+	// RetryInterval é o intervalo entre reenvios das dead letters
+	RetryInterval time.Duration
+}
+
+// NewForwarder cria o Forwarder do sink com fila, tentativas e intervalo de reenvio lidos da configuração
+func NewForwarder(conn *gorm.DB, sink Sink) *Forwarder {
+	buffer := config.GetAuditSinkBuffer()
+	host, _ := os.Hostname()
+	return &Forwarder{
+		sink:          sink,
+		conn:          conn,
+		owner:         fmt.Sprintf("%s:%d", host, os.Getpid()),
+		queue:         make(chan AuditLog, buffer),
+		overflow:      make(chan AuditLog, buffer),
+		MaxAttempts:   config.GetAuditSinkMaxAttempts(),
+		Backoff:       500 * time.Millisecond,
+		Timeout:       5 * time.Second,
+		RetryInterval: config.GetAuditSinkRetryInterval(),
+	}
+}
+
+// Name identifica o sink nas dead letters e nos logs
+func (f *Forwarder) Name() string {
+	return f.sink.Name()
+}
+
+// Enqueue agenda a entrega sem bloquear quem gravou a entrada. Com a fila cheia a
+// entrada vai para a dead letter; se nem isso couber, fica só no banco da API.
+func (f *Forwarder) Enqueue(entry AuditLog) {
+	select {
+	case f.queue <- entry:
+		return
+	default:
+	}
+	select {
+	case f.overflow <- entry:
+	default:
+		log.Printf("[AUDIT] [FAIL] Encaminhamento descartado | sink=%s | id=%d | erro=fila cheia", f.Name(), entry.ID)
+	}
+}
+
+// Start entrega a fila e reenvia as dead letters até o contexto ser cancelado;
+// o que restar na fila vai para a dead letter
+func (f *Forwarder) Start(ctx context.Context) {
+	go f.writeOverflow(ctx)
+	ticker := time.NewTicker(f.RetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			f.drain(f.queue)
+			return
+		case entry := <-f.queue:
+			f.handle(ctx, entry)
+		case <-ticker.C:
+			if _, err := f.RetryDeadLetters(ctx); err != nil {
+				log.Printf("Sink %s ainda indisponível: %v", f.Name(), err)
+			}
+		}
+	}
+}
+
+func (f *Forwarder) handle(ctx context.Context, entry AuditLog) {
+	if f.down.Load() {
+		f.deadLetter(entry, 0, "sink indisponível: "+f.lastError())
+		return
+	}
+	attempts, err := f.deliver(ctx, &entry)
+	if err != nil {
+		log.Printf("[AUDIT] [FAIL] Encaminhamento | sink=%s | id=%d | tentativas=%d | erro=%v", f.Name(), entry.ID, attempts, err)
+		f.lastErr.Store(err.Error())
+		f.down.Store(true)
+		f.deadLetter(entry, attempts, err.Error())
+	}
+}
+
+// deliver tenta a entrega com espera crescente entre as tentativas
+func (f *Forwarder) deliver(ctx context.Context, entry *AuditLog) (int, error) {
+	wait := f.Backoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = f.send(ctx, entry); err == nil || attempt >= f.MaxAttempts {
+			return attempt, err
+		}
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func (f *Forwarder) send(ctx context.Context, entry *AuditLog) error {
+	ctx, cancel := context.WithTimeout(ctx, f.Timeout)
+	defer cancel()
+	return f.sink.Send(ctx, entry)
+}
+
+// RetryDeadLetters reenvia as dead letters do sink, da mais antiga para a mais
+// nova, e para na primeira falha. Cada lote é reservado antes do envio, para que
+// outra instância da API não reenvie as mesmas entradas. Quando a tabela esvazia
+// o sink volta a receber as novas entradas diretamente. Devolve quantas foram entregues.
+func (f *Forwarder) RetryDeadLetters(ctx context.Context) (int, error) {
+	sent := 0
+	for {
+		batch, err := f.claimDeadLetters(ctx)
+		if err != nil {
+			return sent, err
+		}
+		if len(batch) == 0 {
+			// As reservadas por outra instância ainda contam como pendentes
+			var pending int64
+			if err := f.pending(ctx).Count(&pending).Error; err != nil {
+				return sent, err
+			}
+			if pending == 0 && f.down.Swap(false) {
+				log.Printf("[AUDIT] [OK] Encaminhamento restabelecido | sink=%s | reenviadas=%d", f.Name(), sent)
+			}
+			return sent, nil
+		}
+		for i, dl := range batch {
+			var entry AuditLog
+			if err := json.Unmarshal([]byte(dl.Payload), &entry); err != nil {
+				log.Printf("[AUDIT] [FAIL] Dead letter ilegível | sink=%s | id=%d | erro=%v", f.Name(), dl.ID, err)
+				f.conn.Model(&dl).Updates(map[string]interface{}{"quarantined": true, "error": "payload ilegível: " + err.Error(), "claimed_by": "", "claimed_until": nil})
+				continue
+			}
+			if err := f.send(ctx, &entry); err != nil {
+				f.lastErr.Store(err.Error())
+				f.conn.Model(&dl).Updates(map[string]interface{}{"attempts": dl.Attempts + 1, "error": err.Error()})
+				f.release(batch[i:])
+				return sent, err
+			}
+			if err := f.conn.Delete(&dl).Error; err != nil {
+				return sent, err
+			}
+			sent++
+		}
+	}
+}
+
+// pending seleciona as dead letters do sink que ainda devem ser reenviadas
+func (f *Forwarder) pending(ctx context.Context) *gorm.DB {
+	return f.conn.WithContext(ctx).Model(&DeadLetter{}).Where("sink = ? AND quarantined = ?", f.Name(), false)
+}
+
+// claimDeadLetters reserva para esta instância o próximo lote livre (sem reserva ou
+// com a reserva vencida) e devolve as que ela conseguiu reservar. A reserva dura o
+// bastante para enviar o lote inteiro, cada envio limitado por Timeout.
+func (f *Forwarder) claimDeadLetters(ctx context.Context) ([]DeadLetter, error) {
+	now := time.Now()
+	free := "claimed_until IS NULL OR claimed_until < ?"
+	var ids []uint
+	if err := f.pending(ctx).Where(free, now).Order("id").Limit(deadLetterBatchSize).Pluck("id", &ids).Error; err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	until := now.Add(f.Timeout*deadLetterBatchSize + time.Minute)
+	// A condição se repete no UPDATE: se outra instância reservou entre a consulta e
+	// aqui, a linha fica com ela
+	err := f.conn.WithContext(ctx).Model(&DeadLetter{}).
+		Where("id IN ?", ids).Where(free, now).
+		Updates(map[string]interface{}{"claimed_by": f.owner, "claimed_until": until}).Error
+	if err != nil {
+		return nil, err
+	}
+	var batch []DeadLetter
+	err = f.conn.WithContext(ctx).Where("id IN ? AND claimed_by = ?", ids, f.owner).Order("id").Find(&batch).Error
+	return batch, err
+}
+
+// release devolve as reservas não enviadas, para o próximo reenvio de qualquer instância
+func (f *Forwarder) release(batch []DeadLetter) {
+	ids := make([]uint, len(batch))
+	for i, dl := range batch {
+		ids[i] = dl.ID
+	}
+	f.conn.Model(&DeadLetter{}).Where("id IN ? AND claimed_by = ?", ids, f.owner).
+		Updates(map[string]interface{}{"claimed_by": "", "claimed_until": nil})
+}
+
+// writeOverflow grava na dead letter o que não coube na fila
+func (f *Forwarder) writeOverflow(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			f.drain(f.overflow)
+			return
+		case entry := <-f.overflow:
+			f.deadLetter(entry, 0, "fila cheia")
+		}
+	}
+}
+
+// drain grava na dead letter o que ainda estiver no canal
+func (f *Forwarder) drain(ch chan AuditLog) {
+	for {
+		select {
+		case entry := <-ch:
+			f.deadLetter(entry, 0, "encerramento da API")
+		default:
+			return
+		}
+	}
+}
+
+func (f *Forwarder) deadLetter(entry AuditLog, attempts int, reason string) {
+	payload, err := json.Marshal(entry)
+	if err == nil {
+		err = f.conn.Create(&DeadLetter{Sink: f.Name(), EntryID: entry.ID, OrgID: entry.OrgID, Payload: string(payload), Error: reason, Attempts: attempts}).Error
+	}
+	if err != nil {
+		log.Printf("[AUDIT] [FAIL] Dead letter | sink=%s | id=%d | erro=%v", f.Name(), entry.ID, err)
+	}
+}
+
+func (f *Forwarder) lastError() string {
+	s, _ := f.lastErr.Load().(string)
+	return s
+}
+
+var (
+	forwardersMu sync.RWMutex
+	forwarders   []*Forwarder
+)
+
+// SetForwarders define os sinks que recebem as entradas gravadas; sem argumentos desliga o encaminhamento
+func SetForwarders(fs ...*Forwarder) {
+	forwardersMu.Lock()
+	defer forwardersMu.Unlock()
+	forwarders = fs
+}
+
+// forward agenda a entrega da entrada recém-gravada a todos os sinks
+func forward(entry *AuditLog) {
+	forwardersMu.RLock()
+	defer forwardersMu.RUnlock()
+	for _, f := range forwarders {
+		f.Enqueue(*entry)
+	}
+}
@@ -4,7 +4,14 @@
 // @Produce json
 // @Param user query string false "Usuário"
 // @Param action query string false "Ação"
-// @Param status query string false "Status"
+// @Param status query string false "Resultado (OK ou FAIL)"
+// @Param outcome query string false "Sinônimo de status"
+// @Param resource_type query string false "Tipo do recurso"
+// @Param resource_id query string false "ID do recurso"
+// @Param error_code query string false "Código do erro"
+// @Param field query string false "Coluna alterada (presente no diff)"
+// @Param actor_id query int false "ID do usuário responsável"
+// @Param request_id query string false "ID da requisição"
 // @Param start query string false "Data inicial (RFC3339)"
 // @Param end query string false "Data final (RFC3339)"
 // @Param page query int false "Página"
@@ -16,47 +23,29 @@ package audit
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+	"time"
 
+	"github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
-)
 
-func RegisterRoutes(r *gin.Engine, conn *gorm.DB) {
-	r.GET("/audit-logs", func(c *gin.Context) {
-		// Protege endpoint: apenas admin
-		role, _ := c.Get("role")
-		if role != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Acesso permitido apenas para admin"})
-			return
-		}
+	"api-vault/internal/authz"
+	"api-vault/internal/crypto"
+	"api-vault/internal/middleware"
+	"api-vault/internal/tenant"
+)
 
-		// Filtros
-		user := c.Query("user")
-		action := c.Query("action")
-		status := c.Query("status")
-		start := c.Query("start") // data inicial (RFC3339)
-		end := c.Query("end")     // data final (RFC3339)
+func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
+	// Protege endpoint: exige audit:read
+	r.GET("/audit-logs", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermAuditRead), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
 		page := c.DefaultQuery("page", "1")
 		pageSize := c.DefaultQuery("page_size", "50")
 
 		var logs []AuditLog
-		dbq := conn.Model(&AuditLog{})
-		if user != "" {
-			dbq = dbq.Where("user = ?", user)
-		}
-		if action != "" {
-			dbq = dbq.Where("action = ?", action)
-		}
-		if status != "" {
-			dbq = dbq.Where("status = ?", status)
-		}
-		if start != "" {
-			dbq = dbq.Where("timestamp >= ?", start)
-		}
-		if end != "" {
-			dbq = dbq.Where("timestamp <= ?", end)
-		}
+		dbq := filterFromQuery(c).apply(db.Model(&AuditLog{}))
 		// Paginação
 		var p, ps int
 		fmt.Sscanf(page, "%d", &p)
@@ -74,4 +63,103 @@ func RegisterRoutes(r *gin.Engine, conn *gorm.DB) {
 		}
 		c.JSON(http.StatusOK, logs)
 	})
+
+	// @Summary Exportar logs de auditoria
+	// @Description Exporta, em streaming e na ordem da cadeia, todos os logs que atendem aos filtros de /audit-logs.
+	// @Description Com archive=true devolve um tar.gz com os dados, um manifesto e a assinatura HMAC do manifesto (exige AUDIT_HMAC_KEY).
+	// @Tags auditoria
+	// @Produce text/csv,application/x-ndjson,application/gzip
+	// @Param format query string false "csv ou ndjson (padrão)"
+	// @Param archive query bool false "Gera arquivo tar.gz assinado"
+	// @Param action query string false "Ação (aceita os demais filtros de /audit-logs)"
+	// @Success 200 {file} file
+	// @Failure 400,403,409,500 {object} gin.H
+	// @Router /audit-logs/export [get]
+	r.GET("/audit-logs/export", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermAuditRead), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		format := c.DefaultQuery("format", FormatNDJSON)
+		if !ValidFormat(format) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": ErrUnknownFormat.Error()})
+			return
+		}
+		filter := filterFromQuery(c)
+		query := filter.apply(db.Model(&AuditLog{}))
+		archive := c.Query("archive") == "true"
+		now := time.Now().UTC()
+		filename := "audit-logs-" + now.Format("20060102T150405Z")
+
+		var stats ExportStats
+		var err error
+		if archive {
+			var key []byte
+			if key, err = crypto.AuditExportKey(); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if key == nil {
+				c.JSON(http.StatusConflict, gin.H{"error": ErrNoArchiveKey.Error()})
+				return
+			}
+			var a *Archive
+			a, err = NewArchive(query, Manifest{Format: format, OrgID: tenant.OrgID(c), Filter: filter, GeneratedAt: now, GeneratedBy: ActorFrom(c).Username}, key)
+			if err == nil {
+				defer a.Close()
+				stats = a.Manifest.ExportStats
+				c.Header("Content-Type", "application/gzip")
+				c.Header("Content-Disposition", `attachment; filename="`+filename+`.tar.gz"`)
+				c.Status(http.StatusOK)
+				err = a.WriteTar(c.Writer)
+			}
+		} else {
+			contentType := "application/x-ndjson"
+			if format == FormatCSV {
+				contentType = "text/csv; charset=utf-8"
+			}
+			c.Header("Content-Type", contentType)
+			c.Header("Content-Disposition", `attachment; filename="`+filename+"."+format+`"`)
+			c.Status(http.StatusOK)
+			stats, err = Export(query, format, c.Writer, c.Writer.Flush)
+		}
+		if err != nil {
+			log.Printf("[AUDIT] [FAIL] Exportação auditoria | formato=%s | linhas=%d | erro=%v", format, stats.Rows, err)
+			_ = Record(c, db, Failed(ActionAuditExport, ResourceAuditLog, nil, CodeInternal).Detailf("formato=%s arquivo=%t linhas=%d erro=%v", format, archive, stats.Rows, err))
+			// Depois do início do streaming o status já foi enviado; o cliente recebe o corpo truncado
+			if !c.Writer.Written() {
+				c.Writer.Header().Del("Content-Type")
+				c.Writer.Header().Del("Content-Disposition")
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			return
+		}
+		log.Printf("[AUDIT] [OK] Exportação auditoria | formato=%s | arquivo=%t | linhas=%d", format, archive, stats.Rows)
+		_ = Record(c, db, Succeeded(ActionAuditExport, ResourceAuditLog, nil).Detailf("formato=%s arquivo=%t linhas=%d primeiro_id=%d ultimo_id=%d", format, archive, stats.Rows, stats.FirstID, stats.LastID))
+	})
+
+	// @Summary Verificar a cadeia de auditoria
+	// @Description Percorre a cadeia de hashes da organização e aponta o primeiro elo quebrado
+	// @Tags auditoria
+	// @Produce json
+	// @Success 200 {object} VerifyResult
+	// @Failure 403,500 {object} gin.H
+	// @Router /audit-logs/verify [get]
+	r.GET("/audit-logs/verify", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermAuditRead), func(c *gin.Context) {
+		key, err := crypto.AuditMACKey()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		result, err := Verify(conn, tenant.OrgID(c), key)
+		if err != nil {
+			log.Printf("[AUDIT] [FAIL] Verificação auditoria | erro=%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		event := Succeeded(ActionAuditVerify, ResourceAuditLog, nil)
+		if !result.OK {
+			event = Failed(ActionAuditVerify, ResourceAuditLog, result.BrokenID, CodeTampered)
+		}
+		log.Printf("[AUDIT] [%s] Verificação auditoria | conferidas=%d | quebra=%d", event.Outcome, result.Checked, result.BrokenID)
+		_ = Record(c, tenant.Scoped(c, conn), event.Detailf("conferidas=%d quebra=%d motivo=%s", result.Checked, result.BrokenID, result.Reason))
+		c.JSON(http.StatusOK, result)
+	})
 }
@@ -0,0 +1,79 @@
+package auditsink
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"api-vault/internal/audit"
+)
+
+// Versão da API informada no cabeçalho CEF
+const cefVersion = "1.0"
+
+// Severidades CEF (0-10): sucesso é baixa, falha é média
+const (
+	cefSeverityOK   = 3
+	cefSeverityFail = 6
+)
+
+// No cabeçalho CEF '\' e '|' são escapados; nas extensões, '\', '=' e quebras de linha
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+// CEF formata a entrada como um evento Common Event Format (ArcSight):
+// CEF:0|fornecedor|produto|versão|id da assinatura|nome|severidade|extensões
+func CEF(entry *audit.AuditLog) string {
+	severity := cefSeverityOK
+	if entry.Status == string(audit.OutcomeFail) {
+		severity = cefSeverityFail
+	}
+	action := cefHeaderEscaper.Replace(entry.Action)
+	header := fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|", appName, appName, cefVersion, action, action, severity)
+
+	// Campos padrão do CEF; o restante vai nos campos customizados cs1..cs6 com seus rótulos
+	ext := []struct{ key, value string }{
+		{"rt", strconv.FormatInt(entry.Timestamp.UnixMilli(), 10)},
+		{"externalId", strconv.FormatUint(uint64(entry.ID), 10)},
+		{"suser", entry.User},
+		{"suid", optionalID(entry.ActorID)},
+		{"src", entry.IP},
+		{"requestClientApplication", entry.UserAgent},
+		{"outcome", entry.Status},
+		{"cs1Label", "orgId"},
+		{"cs1", strconv.FormatUint(uint64(entry.OrgID), 10)},
+		{"cs2Label", "requestId"},
+		{"cs2", entry.RequestID},
+		{"cs3Label", "resourceType"},
+		{"cs3", entry.ResourceType},
+		{"cs4Label", "resourceId"},
+		{"cs4", entry.ResourceID},
+		{"cs5Label", "errorCode"},
+		{"cs5", entry.ErrorCode},
+		{"cs6Label", "hash"},
+		{"cs6", entry.Hash},
+		{"msg", entry.Details},
+	}
+	parts := make([]string, 0, len(ext))
+	for i, e := range ext {
+		if e.value == "" {
+			continue
+		}
+		// Rótulo sem valor não é enviado
+		if strings.HasSuffix(e.key, "Label") && (i+1 >= len(ext) || ext[i+1].value == "") {
+			continue
+		}
+		parts = append(parts, e.key+"="+cefExtensionEscaper.Replace(e.value))
+	}
+	return header + strings.Join(parts, " ")
+}
+
+// optionalID devolve o ID em texto, vazio quando não há
+func optionalID(id uint) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatUint(uint64(id), 10)
+}
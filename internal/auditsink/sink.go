@@ -0,0 +1,57 @@
+// Package auditsink implementa os destinos externos da auditoria (syslog RFC 5424,
+// CEF e webhook HTTP). A fila, as tentativas e as dead letters ficam no
+// audit.Forwarder que envolve cada sink.
+package auditsink
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"api-vault/internal/audit"
+	"api-vault/internal/config"
+)
+
+// FromEnv cria os sinks configurados (AUDIT_SYSLOG_ADDR, AUDIT_WEBHOOK_URL); nenhum se não houver configuração
+func FromEnv() ([]audit.Sink, error) {
+	var sinks []audit.Sink
+	if addr := config.GetAuditSyslogAddr(); addr != "" {
+		var tlsConfig *tls.Config
+		network := config.GetAuditSyslogNetwork()
+		if network == NetworkTLS {
+			var err error
+			if tlsConfig, err = tlsConfigFromFile(config.GetAuditSyslogCAFile()); err != nil {
+				return nil, err
+			}
+		}
+		s, err := NewSyslog(network, addr, config.GetAuditSyslogFormat(), tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	if url := config.GetAuditWebhookURL(); url != "" {
+		sinks = append(sinks, NewWebhook(url, config.GetAuditWebhookSecret(), nil))
+	}
+	return sinks, nil
+}
+
+// tlsConfigFromFile aceita as CAs do arquivo PEM; sem arquivo, as do sistema
+func tlsConfigFromFile(caFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("AUDIT_SYSLOG_CA_FILE: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("AUDIT_SYSLOG_CA_FILE: nenhum certificado PEM válido")
+	}
+	cfg.RootCAs = pool
+	return cfg, nil
+}
@@ -0,0 +1,207 @@
+package auditsink
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"api-vault/internal/audit"
+)
+
+// Transportes do syslog
+const (
+	NetworkUDP = "udp"
+	NetworkTCP = "tcp"
+	NetworkTLS = "tls"
+)
+
+// Formatos da mensagem syslog
+const (
+	FormatRFC5424 = "rfc5424"
+	FormatCEF     = "cef"
+)
+
+// Identificação da API no cabeçalho syslog e no CEF
+const appName = "api-vault"
+
+// Facility authpriv: mensagens de segurança e autorização
+const facilityAuthPriv = 10
+
+// Severidades syslog usadas: sucesso é informativo, falha é aviso
+const (
+	severityWarning = 4
+	severityInfo    = 6
+)
+
+// SD-ID dos campos da entrada; 32473 é o número de empresa reservado para exemplos (RFC 5612)
+const sdID = "audit@32473"
+
+var (
+	ErrUnknownNetwork = errors.New("transporte syslog inválido; use udp, tcp ou tls")
+	ErrUnknownFormat  = errors.New("formato syslog inválido; use rfc5424 ou cef")
+)
+
+// Syslog envia cada entrada como uma mensagem RFC 5424 para um coletor. Em TCP e
+// TLS as mensagens usam o enquadramento por contagem de octetos (RFC 6587/5425)
+// e a conexão é mantida aberta, refeita na próxima entrega após qualquer erro.
+type Syslog struct {
+	Network   string
+	Addr      string
+	Format    string
+	TLSConfig *tls.Config
+	Hostname  string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslog valida o transporte e o formato; a conexão só é aberta na primeira entrega
+func NewSyslog(network, addr, format string, tlsConfig *tls.Config) (*Syslog, error) {
+	switch network {
+	case NetworkUDP, NetworkTCP, NetworkTLS:
+	default:
+		return nil, ErrUnknownNetwork
+	}
+	if format != FormatRFC5424 && format != FormatCEF {
+		return nil, ErrUnknownFormat
+	}
+	if addr == "" {
+		return nil, errors.New("endereço do syslog não informado")
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+	return &Syslog{Network: network, Addr: addr, Format: format, TLSConfig: tlsConfig, Hostname: hostname}, nil
+}
+
+// Name identifica o sink nas dead letters
+func (s *Syslog) Name() string {
+	return "syslog-" + s.Format
+}
+
+// Send escreve a mensagem da entrada no coletor
+func (s *Syslog) Send(ctx context.Context, entry *audit.AuditLog) error {
+	msg := s.Message(entry)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		conn, err := s.dial(ctx)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		s.conn.SetWriteDeadline(deadline)
+	} else {
+		s.conn.SetWriteDeadline(time.Time{})
+	}
+	frame := msg
+	if s.Network != NetworkUDP {
+		frame = strconv.Itoa(len(msg)) + " " + msg
+	}
+	if _, err := s.conn.Write([]byte(frame)); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Close fecha a conexão com o coletor
+func (s *Syslog) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *Syslog) dial(ctx context.Context) (net.Conn, error) {
+	if s.Network == NetworkTLS {
+		dialer := &tls.Dialer{Config: s.TLSConfig}
+		return dialer.DialContext(ctx, "tcp", s.Addr)
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, s.Network, s.Addr)
+}
+
+// Message monta a mensagem RFC 5424 da entrada. No formato rfc5424 os campos vão
+// como dados estruturados e os detalhes como texto; no formato cef o texto é o
+// evento CEF e não há dados estruturados.
+func (s *Syslog) Message(entry *audit.AuditLog) string {
+	severity := severityInfo
+	if entry.Status == string(audit.OutcomeFail) {
+		severity = severityWarning
+	}
+	hostname := s.Hostname
+	if hostname == "" {
+		hostname = "-"
+	}
+	header := fmt.Sprintf("<%d>1 %s %s %s - %s", facilityAuthPriv*8+severity,
+		entry.Timestamp.UTC().Format(time.RFC3339Nano), headerField(hostname, 255), appName, headerField(entry.Action, 32))
+	if s.Format == FormatCEF {
+		return header + " - " + CEF(entry)
+	}
+	msg := header + " " + structuredData(entry)
+	if entry.Details != "" {
+		msg += " " + entry.Details
+	}
+	return msg
+}
+
+// structuredData monta o elemento [audit@32473 ...] com os campos preenchidos da entrada
+func structuredData(entry *audit.AuditLog) string {
+	params := []struct{ name, value string }{
+		{"id", strconv.FormatUint(uint64(entry.ID), 10)},
+		{"org", strconv.FormatUint(uint64(entry.OrgID), 10)},
+		{"user", entry.User},
+		{"actor", strconv.FormatUint(uint64(entry.ActorID), 10)},
+		{"ip", entry.IP},
+		{"request_id", entry.RequestID},
+		{"status", entry.Status},
+		{"resource_type", entry.ResourceType},
+		{"resource_id", entry.ResourceID},
+		{"error_code", entry.ErrorCode},
+		{"hash", entry.Hash},
+	}
+	var b strings.Builder
+	b.WriteString("[" + sdID)
+	for _, p := range params {
+		if p.value == "" {
+			continue
+		}
+		b.WriteString(" " + p.name + `="` + sdEscaper.Replace(p.value) + `"`)
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// Nos valores dos dados estruturados '"', '\' e ']' são escapados com '\'
+var sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// headerField adapta o valor a um campo do cabeçalho: ASCII visível, sem
+// espaços e limitado a max caracteres; vazio vira "-"
+func headerField(value string, max int) string {
+	b := make([]byte, 0, len(value))
+	for i := 0; i < len(value) && len(b) < max; i++ {
+		if c := value[i]; c > 32 && c < 127 {
+			b = append(b, c)
+		}
+	}
+	if len(b) == 0 {
+		return "-"
+	}
+	return string(b)
+}
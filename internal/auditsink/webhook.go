@@ -0,0 +1,72 @@
+package auditsink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"api-vault/internal/audit"
+)
+
+// Webhook envia cada entrada como JSON num POST. Com Secret o corpo é assinado
+// em X-Audit-Signature (sha256=<HMAC-SHA256 em hexadecimal>), para o receptor
+// descartar o que não veio da API. Qualquer resposta fora de 2xx é uma falha.
+type Webhook struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+// NewWebhook cria o sink; client nil usa http.DefaultClient, limitado pelo timeout do Forwarder
+func NewWebhook(url, secret string, client *http.Client) *Webhook {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Webhook{URL: url, Secret: secret, Client: client}
+}
+
+// Name identifica o sink nas dead letters
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+// Send faz o POST da entrada
+func (w *Webhook) Send(ctx context.Context, entry *audit.AuditLog) error {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Audit-Event-ID", strconv.FormatUint(uint64(entry.ID), 10))
+	if w.Secret != "" {
+		req.Header.Set("X-Audit-Signature", Signature(w.Secret, body))
+	}
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook respondeu %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Signature é o valor de X-Audit-Signature para o corpo enviado
+func Signature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
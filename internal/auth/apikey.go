@@ -0,0 +1,423 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api-vault/internal/audit"
+	"api-vault/internal/authz"
+	"api-vault/internal/middleware"
+	"api-vault/internal/tenant"
+)
+
+// Formato da chave: "avk_<prefixo>_<segredo>". O prefixo é público e localiza a
+// chave; do segredo o banco guarda apenas o hash.
+const (
+	apiKeyScheme         = "avk"
+	apiKeyHeader         = "X-API-Key"
+	apiKeyTouchInterval  = time.Minute
+	apiKeyClaim          = "api_key"
+	serviceAccountMinLen = 3
+)
+
+// APIKey é uma credencial de longa duração de uma conta de serviço
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	OrgID      uint       `gorm:"index" json:"org_id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `gorm:"not null;uniqueIndex" json:"prefix"`
+	SecretHash string     `gorm:"not null" json:"-" audit:"secret"`
+	Scopes     string     `json:"scopes"` // permissões separadas por vírgula; vazio = todas do papel
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ScopeList devolve os escopos da chave como lista; nil se a chave não restringe o papel
+func (k APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return nil
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+// ErrInvalidAPIKey cobre chave malformada, desconhecida, revogada ou expirada
+var ErrInvalidAPIKey = errors.New("API key inválida ou expirada")
+
+// CreateAPIKey gera uma chave para a conta de serviço e devolve o valor em claro,
+// que só é conhecido nesse momento
+func CreateAPIKey(conn *gorm.DB, account *User, name string, scopes []string, expiresAt *time.Time) (*APIKey, string, error) {
+	if err := authz.ValidatePermissions(scopes); err != nil {
+		return nil, "", err
+	}
+	prefix := make([]byte, 6)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, "", err
+	}
+	secret, err := newOpaqueToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	key := APIKey{
+		OrgID:      account.OrgID,
+		UserID:     account.ID,
+		Name:       name,
+		Prefix:     hex.EncodeToString(prefix),
+		SecretHash: hashRefreshToken(secret),
+		Scopes:     strings.Join(scopes, ","),
+		ExpiresAt:  expiresAt,
+	}
+	if err := conn.Create(&key).Error; err != nil {
+		return nil, "", err
+	}
+	return &key, fmt.Sprintf("%s_%s_%s", apiKeyScheme, key.Prefix, secret), nil
+}
+
+// RotateAPIKey revoga a chave e emite outra com o mesmo nome, escopos e validade
+func RotateAPIKey(conn *gorm.DB, account *User, key *APIKey) (*APIKey, string, error) {
+	var (
+		next *APIKey
+		raw  string
+	)
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		if err := RevokeAPIKey(tx, key.ID); err != nil {
+			return err
+		}
+		var err error
+		next, raw, err = CreateAPIKey(tx, account, key.Name, key.ScopeList(), key.ExpiresAt)
+		return err
+	})
+	return next, raw, err
+}
+
+// RevokeAPIKey invalida a chave imediatamente
+func RevokeAPIKey(conn *gorm.DB, keyID uint) error {
+	return conn.Model(&APIKey{}).Where("id = ? AND revoked_at IS NULL", keyID).Update("revoked_at", time.Now()).Error
+}
+
+// RevokeUserAPIKeys invalida todas as chaves da conta de serviço
+func RevokeUserAPIKeys(conn *gorm.DB, userID uint) error {
+	return conn.Model(&APIKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", time.Now()).Error
+}
+
+// AuthenticateAPIKey valida a chave e devolve a conta de serviço, já com a chave e os escopos
+func AuthenticateAPIKey(conn *gorm.DB, raw string) (*User, error) {
+	parts := strings.SplitN(raw, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyScheme {
+		return nil, ErrInvalidAPIKey
+	}
+	var key APIKey
+	if err := conn.Where("prefix = ?", parts[1]).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if subtle.ConstantTimeCompare([]byte(hashRefreshToken(parts[2])), []byte(key.SecretHash)) != 1 ||
+		key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, ErrInvalidAPIKey
+	}
+	var user User
+	if err := conn.First(&user, key.UserID).Error; err != nil || !user.ServiceAccount || user.Disabled {
+		return nil, ErrInvalidAPIKey
+	}
+	// Último uso com resolução de minutos, para não escrever a cada requisição
+	conn.Model(&APIKey{}).Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", key.ID, now.Add(-apiKeyTouchInterval)).Update("last_used_at", now)
+	user.APIKeyID = key.ID
+	user.Scopes = key.ScopeList()
+	return &user, nil
+}
+
+// apiKeyFromRequest lê a chave de X-API-Key ou de "Authorization: Bearer avk_..."
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader(apiKeyHeader); key != "" {
+		return key
+	}
+	if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && strings.HasPrefix(bearer, apiKeyScheme+"_") {
+		return bearer
+	}
+	return ""
+}
+
+// APIKeyMiddleware aceita API keys nas mesmas rotas dos JWTs de usuário: a chave
+// válida é trocada por um JWT da conta de serviço, restrito aos escopos da chave,
+// que segue pelo middleware JWT e pelas checagens de permissão de sempre.
+// Deve ser instalado no engine antes do registro das rotas.
+func APIKeyMiddleware(conn *gorm.DB, mw *jwt.GinJWTMiddleware) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := apiKeyFromRequest(c)
+		if raw == "" {
+			c.Next()
+			return
+		}
+		account, err := AuthenticateAPIKey(conn, raw)
+		if err != nil {
+			auditLogger.Printf("[AUDIT] [FAIL] API key | rota=%s %s | erro=%v", c.Request.Method, c.Request.URL.Path, err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": ErrInvalidAPIKey.Error()})
+			return
+		}
+		token, _, err := IssueToken(mw, account)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Request.Header.Del(apiKeyHeader)
+		c.Request.Header.Set("Authorization", "Bearer "+token)
+		c.Next()
+	}
+}
+
+// ServiceAccountInput é o corpo para criar uma conta de serviço
+type ServiceAccountInput struct {
+	Username string `json:"username" binding:"required"`
+	Role     string `json:"role" binding:"required"`
+}
+
+// APIKeyInput é o corpo para criar uma API key
+type APIKeyInput struct {
+	Name      string   `json:"name" binding:"required"`
+	Scopes    []string `json:"scopes"`     // vazio: todas as permissões do papel da conta
+	ExpiresIn string   `json:"expires_in"` // duração Go (ex.: 2160h); vazio: sem expiração
+}
+
+// canIssueAPIKey impede que a chave dê a quem a cria permissões que ele não tem
+func canIssueAPIKey(c *gin.Context, conn *gorm.DB, account *User, scopes []string) bool {
+	perms, err := authz.PermissionsFor(tenant.Scoped(c, conn), account.Role)
+	if err != nil {
+		return false
+	}
+	if len(scopes) > 0 {
+		perms = authz.Intersect(perms, scopes)
+	}
+	return authz.CanGrant(middleware.Permissions(c, conn), perms)
+}
+
+// loadServiceAccount busca a conta de serviço da rota na organização do chamador
+func loadServiceAccount(c *gin.Context, db *gorm.DB) (*User, bool) {
+	var account User
+	if err := db.Where("service_account = ?", true).First(&account, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+		return nil, false
+	}
+	return &account, true
+}
+
+// loadAPIKey busca a chave da rota, que precisa pertencer à conta de serviço
+func loadAPIKey(c *gin.Context, db *gorm.DB, account *User) (*APIKey, bool) {
+	var key APIKey
+	if err := db.Where("user_id = ?", account.ID).First(&key, c.Param("key_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return nil, false
+	}
+	return &key, true
+}
+
+func registerServiceAccountRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
+	// @Summary Criar conta de serviço
+	// @Description Cria um principal sem senha para jobs e integrações; autentica apenas com API keys
+	// @Tags contas de serviço
+	// @Accept json
+	// @Produce json
+	// @Param account body ServiceAccountInput true "Conta de serviço"
+	// @Success 201 {object} User
+	// @Failure 400,403,409 {object} gin.H
+	// @Router /service-accounts [post]
+	r.POST("/service-accounts", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		var input ServiceAccountInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(input.Username) < serviceAccountMinLen || len(input.Username) > 32 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Username inválido"})
+			return
+		}
+		if exists, err := authz.RoleExists(db, input.Role); err != nil || !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Role inexistente: " + input.Role})
+			return
+		}
+		if !canGrantRole(c, conn, input.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Não é possível conceder um papel com permissões que você não possui"})
+			return
+		}
+		// Sem hash de senha: o login com senha nunca confere para contas de serviço
+		account := User{Username: input.Username, Role: input.Role, ServiceAccount: true}
+		if err := db.Create(&account).Error; err != nil {
+			auditLogger.Printf("[AUDIT] [FAIL] Cadastro conta de serviço | username=%s | erro=%v", input.Username, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionServiceAccountAdd, audit.ResourceUser, nil, audit.CodeConflict).Detailf("username=%s erro=%v", input.Username, err))
+			c.JSON(http.StatusConflict, gin.H{"error": "Username já existe"})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Cadastro conta de serviço | username=%s | role=%s | id=%d", account.Username, account.Role, account.ID)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionServiceAccountAdd, audit.ResourceUser, account.ID).WithChanges(audit.Diff(User{}, account)).Detailf("id=%d username=%s role=%s", account.ID, account.Username, account.Role))
+		c.JSON(http.StatusCreated, account)
+	})
+
+	// @Summary Listar contas de serviço
+	// @Tags contas de serviço
+	// @Produce json
+	// @Success 200 {array} User
+	// @Router /service-accounts [get]
+	r.GET("/service-accounts", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersRead), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		list := []User{}
+		if err := db.Where("service_account = ?", true).Order("id").Find(&list).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	})
+
+	// @Summary Criar API key
+	// @Description Gera uma chave para a conta de serviço; o valor só é exibido nesta resposta
+	// @Tags contas de serviço
+	// @Accept json
+	// @Produce json
+	// @Param id path int true "ID da conta de serviço"
+	// @Param key body APIKeyInput true "API key"
+	// @Success 201 {object} gin.H
+	// @Failure 400,403,404,500 {object} gin.H
+	// @Router /service-accounts/{id}/keys [post]
+	r.POST("/service-accounts/:id/keys", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		account, ok := loadServiceAccount(c, db)
+		if !ok {
+			return
+		}
+		var input APIKeyInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var expiresAt *time.Time
+		if input.ExpiresIn != "" {
+			ttl, err := time.ParseDuration(input.ExpiresIn)
+			if err != nil || ttl <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in inválido"})
+				return
+			}
+			at := time.Now().Add(ttl)
+			expiresAt = &at
+		}
+		if err := authz.ValidatePermissions(input.Scopes); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !canIssueAPIKey(c, conn, account, input.Scopes) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Não é possível emitir uma chave com permissões que você não possui"})
+			return
+		}
+		key, raw, err := CreateAPIKey(db, account, input.Name, input.Scopes, expiresAt)
+		if err != nil {
+			auditLogger.Printf("[AUDIT] [FAIL] Criação API key | conta=%s | erro=%v", account.Username, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionAPIKeyCreate, audit.ResourceAPIKey, nil, audit.CodeInternal).Detailf("conta=%s erro=%v", account.Username, err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Criação API key | conta=%s | prefixo=%s", account.Username, key.Prefix)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionAPIKeyCreate, audit.ResourceAPIKey, key.ID).WithChanges(audit.Diff(&APIKey{}, key)).Detailf("conta=%s id=%d prefixo=%s escopos=%s", account.Username, key.ID, key.Prefix, key.Scopes))
+		c.JSON(http.StatusCreated, gin.H{"key": raw, "api_key": key})
+	})
+
+	// @Summary Listar API keys
+	// @Description Lista as chaves da conta de serviço, inclusive revogadas; o segredo nunca é devolvido
+	// @Tags contas de serviço
+	// @Produce json
+	// @Param id path int true "ID da conta de serviço"
+	// @Success 200 {array} APIKey
+	// @Router /service-accounts/{id}/keys [get]
+	r.GET("/service-accounts/:id/keys", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersRead), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		account, ok := loadServiceAccount(c, db)
+		if !ok {
+			return
+		}
+		keys := []APIKey{}
+		if err := db.Where("user_id = ?", account.ID).Order("id").Find(&keys).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, keys)
+	})
+
+	// @Summary Rotacionar API key
+	// @Description Revoga a chave e emite outra com o mesmo nome, escopos e validade
+	// @Tags contas de serviço
+	// @Produce json
+	// @Param id path int true "ID da conta de serviço"
+	// @Param key_id path int true "ID da chave"
+	// @Success 201 {object} gin.H
+	// @Failure 403,404,409,500 {object} gin.H
+	// @Router /service-accounts/{id}/keys/{key_id}/rotate [post]
+	r.POST("/service-accounts/:id/keys/:key_id/rotate", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		account, ok := loadServiceAccount(c, db)
+		if !ok {
+			return
+		}
+		key, ok := loadAPIKey(c, db, account)
+		if !ok {
+			return
+		}
+		if key.RevokedAt != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "API key já revogada"})
+			return
+		}
+		if !canIssueAPIKey(c, conn, account, key.ScopeList()) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Não é possível emitir uma chave com permissões que você não possui"})
+			return
+		}
+		next, raw, err := RotateAPIKey(db, account, key)
+		if err != nil {
+			auditLogger.Printf("[AUDIT] [FAIL] Rotação API key | conta=%s | id=%d | erro=%v", account.Username, key.ID, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionAPIKeyRotate, audit.ResourceAPIKey, key.ID, audit.CodeInternal).Detailf("conta=%s id=%d erro=%v", account.Username, key.ID, err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Rotação API key | conta=%s | prefixo=%s -> %s", account.Username, key.Prefix, next.Prefix)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionAPIKeyRotate, audit.ResourceAPIKey, key.ID).Detailf("conta=%s id=%d->%d prefixo=%s->%s", account.Username, key.ID, next.ID, key.Prefix, next.Prefix))
+		c.JSON(http.StatusCreated, gin.H{"key": raw, "api_key": next})
+	})
+
+	// @Summary Revogar API key
+	// @Tags contas de serviço
+	// @Param id path int true "ID da conta de serviço"
+	// @Param key_id path int true "ID da chave"
+	// @Success 204 {object} nil
+	// @Failure 403,404,500 {object} gin.H
+	// @Router /service-accounts/{id}/keys/{key_id} [delete]
+	r.DELETE("/service-accounts/:id/keys/:key_id", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		account, ok := loadServiceAccount(c, db)
+		if !ok {
+			return
+		}
+		key, ok := loadAPIKey(c, db, account)
+		if !ok {
+			return
+		}
+		if err := RevokeAPIKey(db, key.ID); err != nil {
+			auditLogger.Printf("[AUDIT] [FAIL] Revogação API key | conta=%s | id=%d | erro=%v", account.Username, key.ID, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionAPIKeyRevoke, audit.ResourceAPIKey, key.ID, audit.CodeInternal).Detailf("conta=%s id=%d erro=%v", account.Username, key.ID, err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Revogação API key | conta=%s | prefixo=%s", account.Username, key.Prefix)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionAPIKeyRevoke, audit.ResourceAPIKey, key.ID).Detailf("conta=%s id=%d prefixo=%s", account.Username, key.ID, key.Prefix))
+		c.JSON(http.StatusNoContent, nil)
+	})
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api-vault/internal/audit"
+	"api-vault/internal/authz"
+	"api-vault/internal/middleware"
+	"api-vault/internal/tenant"
+)
+
+// Group agrupa usuários (ex.: um time) para concessões de acesso em lote
+type Group struct {
+	ID        uint   `gorm:"primaryKey"`
+	OrgID     uint   `gorm:"uniqueIndex:idx_groups_org_name"`
+	Name      string `gorm:"not null;uniqueIndex:idx_groups_org_name"`
+	CreatedAt time.Time
+}
+
+// GroupMember associa um usuário a um grupo
+type GroupMember struct {
+	GroupID uint `gorm:"primaryKey"`
+	UserID  uint `gorm:"primaryKey;index"`
+}
+
+// GroupIDs retorna os grupos dos quais o usuário participa
+func GroupIDs(conn *gorm.DB, userID uint) ([]uint, error) {
+	var ids []uint
+	err := conn.Model(&GroupMember{}).Where("user_id = ?", userID).Pluck("group_id", &ids).Error
+	return ids, err
+}
+
+// CurrentUser devolve o usuário do JWT da requisição (preenchido pelo IdentityHandler)
+func CurrentUser(c *gin.Context) *User {
+	if v, ok := c.Get(IdentityKey); ok {
+		if u, ok := v.(*User); ok {
+			return u
+		}
+	}
+	return &User{}
+}
+
+type GroupInput struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type GroupMemberInput struct {
+	UserID uint `json:"user_id" binding:"required"`
+}
+
+func registerGroupRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
+	// Listar grupos com seus membros (protegido, users:read)
+	// @Summary Listar grupos
+	// @Description Lista os grupos e os IDs dos usuários membros
+	// @Tags grupos
+	// @Produce json
+	// @Success 200 {array} gin.H
+	// @Failure 403,500 {object} gin.H
+	// @Router /groups [get]
+	r.GET("/groups", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersRead), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		var groups []Group
+		if err := db.Order("name").Find(&groups).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		var members []GroupMember
+		if err := db.Find(&members).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		byGroup := map[uint][]uint{}
+		for _, m := range members {
+			byGroup[m.GroupID] = append(byGroup[m.GroupID], m.UserID)
+		}
+		list := make([]gin.H, 0, len(groups))
+		for _, g := range groups {
+			userIDs := byGroup[g.ID]
+			if userIDs == nil {
+				userIDs = []uint{}
+			}
+			list = append(list, gin.H{"id": g.ID, "name": g.Name, "members": userIDs})
+		}
+		c.JSON(http.StatusOK, list)
+	})
+
+	// Criar grupo (protegido, users:write)
+	// @Summary Criar grupo
+	// @Tags grupos
+	// @Accept json
+	// @Produce json
+	// @Param group body GroupInput true "Grupo"
+	// @Success 201 {object} Group
+	// @Failure 400,403,409 {object} gin.H
+	// @Router /groups [post]
+	r.POST("/groups", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		var input GroupInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(input.Name) < 3 || len(input.Name) > 64 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Nome do grupo inválido"})
+			return
+		}
+		group := Group{Name: input.Name}
+		if err := db.Create(&group).Error; err != nil {
+			auditLogger.Printf("[AUDIT] [FAIL] Cadastro grupo | name=%s | erro=%v", input.Name, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionGroupCreate, audit.ResourceGroup, nil, audit.CodeConflict).Detailf("name=%s erro=%v", input.Name, err))
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Cadastro grupo | name=%s | id=%d", group.Name, group.ID)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionGroupCreate, audit.ResourceGroup, group.ID).WithChanges(audit.Diff(Group{}, group)).Detailf("name=%s id=%d", group.Name, group.ID))
+		c.JSON(http.StatusCreated, group)
+	})
+
+	// Adicionar membro ao grupo (protegido, users:write)
+	// @Summary Adicionar membro
+	// @Tags grupos
+	// @Accept json
+	// @Param id path int true "ID do grupo"
+	// @Param member body GroupMemberInput true "Usuário"
+	// @Success 204 {object} nil
+	// @Failure 400,403,404,500 {object} gin.H
+	// @Router /groups/{id}/members [post]
+	r.POST("/groups/:id/members", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		var input GroupMemberInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var group Group
+		if err := db.First(&group, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+			return
+		}
+		var user User
+		if err := db.First(&user, input.UserID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		member := GroupMember{GroupID: group.ID, UserID: user.ID}
+		if err := db.Where(&member).FirstOrCreate(&member).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Inclusão membro grupo | grupo=%s | user_id=%d", group.Name, user.ID)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionGroupMemberAdd, audit.ResourceGroup, group.ID).Detailf("grupo=%s user_id=%d", group.Name, user.ID))
+		c.JSON(http.StatusNoContent, nil)
+	})
+
+	// Remover membro do grupo (protegido, users:write)
+	// @Summary Remover membro
+	// @Tags grupos
+	// @Param id path int true "ID do grupo"
+	// @Param user_id path int true "ID do usuário"
+	// @Success 204 {object} nil
+	// @Failure 403,500 {object} gin.H
+	// @Router /groups/{id}/members/{user_id} [delete]
+	r.DELETE("/groups/:id/members/:user_id", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		groupID, userID := c.Param("id"), c.Param("user_id")
+		if err := db.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&GroupMember{}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Remoção membro grupo | grupo_id=%s | user_id=%s", groupID, userID)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionGroupMemberDrop, audit.ResourceGroup, groupID).Detailf("grupo_id=%s user_id=%s", groupID, userID))
+		c.JSON(http.StatusNoContent, nil)
+	})
+}
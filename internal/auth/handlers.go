@@ -1,7 +1,6 @@
 package auth
 
 import (
-	"fmt"
 	"log"
 	"net/http"
 
@@ -10,8 +9,11 @@ import (
 	"gorm.io/gorm"
 
 	"api-vault/internal/audit"
+	"api-vault/internal/authz"
+	"api-vault/internal/config"
 	"api-vault/internal/crypto"
 	"api-vault/internal/middleware"
+	"api-vault/internal/tenant"
 )
 
 // Logger customizado para auditoria
@@ -30,35 +32,64 @@ type UserInput struct {
 
 func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 	// Endpoint de login
-	r.POST("/login", mw.LoginHandler)
+	r.POST("/login", loginHandler(mw))
 
-	// Cadastro de usuário (aberto)
+	// Cadastro de usuário (admin; aberto para role user se OPEN_SIGNUP=true)
 	// @Summary Cadastro de usuário
-	// @Description Cria um novo usuário
+	// @Description Cria um novo usuário. Exige admin, exceto auto cadastro com role user quando OPEN_SIGNUP=true
 	// @Tags usuários
 	// @Accept json
 	// @Produce json
 	// @Param user body UserInput true "Dados do usuário"
 	// @Success 201 {object} User
-	// @Failure 400,500 {object} gin.H
+	// @Failure 400,401,403,500 {object} gin.H
 	// @Router /users [post]
 	r.POST("/users", func(c *gin.Context) {
+		// A autenticação é opcional aqui: só é validada se o cliente enviar o JWT
+		authenticated := false
+		if mw != nil && c.GetHeader("Authorization") != "" {
+			mw.MiddlewareFunc()(c)
+			if c.IsAborted() {
+				return
+			}
+			authenticated = true
+		}
+		// Quem cadastra define a organização; o auto cadastro vai para a organização padrão
+		db := tenant.ForOrg(conn, tenant.DefaultOrgID)
+		if authenticated {
+			db = tenant.Scoped(c, conn)
+		}
 		var input UserInput
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 		// Validações extras
-		if len(input.Password) < 6 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Senha deve ter pelo menos 6 caracteres"})
+		if err := ValidateCredentials(input.Username, input.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if len(input.Username) < 3 || len(input.Username) > 32 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Username inválido"})
+		if exists, err := authz.RoleExists(db, input.Role); err != nil || !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Role inexistente: " + input.Role})
+			return
+		}
+		// No auto cadastro o próprio usuário é o ator
+		if !authenticated {
+			audit.SetActor(c, 0, input.Username)
+		}
+		canCreate := authenticated && middleware.HasPermission(c, conn, authz.PermUsersWrite)
+		if !canCreate && !(input.Role == authz.RoleUser && config.GetOpenSignup()) {
+			auditLogger.Printf("[AUDIT] [FAIL] Cadastro usuário | username=%s | role=%s | erro=acesso negado", input.Username, input.Role)
+			if authenticated {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Permissão necessária: " + authz.PermUsersWrite})
+			} else {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Cadastro de usuários exige autenticação"})
+			}
+			_ = audit.Record(c, db, audit.Failed(audit.ActionUserCreate, audit.ResourceUser, nil, audit.CodeForStatus(c.Writer.Status())).Detailf("acesso negado role=%s", input.Role))
 			return
 		}
-		if input.Role != "user" && input.Role != "admin" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Role deve ser 'user' ou 'admin'"})
+		if canCreate && !canGrantRole(c, conn, input.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Não é possível conceder um papel com permissões que você não possui"})
 			return
 		}
 		hash, err := crypto.HashPassword(input.Password)
@@ -71,21 +102,25 @@ func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 			Password: hash,
 			Role:     input.Role,
 		}
-		if err := conn.Create(&user).Error; err != nil {
+		if err := db.Create(&user).Error; err != nil {
 			auditLogger.Printf("[AUDIT] [FAIL] Cadastro usuário | username=%s | role=%s | erro=%v", input.Username, input.Role, err)
-			_ = audit.SaveAuditLog(conn, input.Username, "cadastro_usuario", "FAIL", err.Error())
+			_ = audit.Record(c, db, audit.Failed(audit.ActionUserCreate, audit.ResourceUser, nil, userErrorCode(err)).Detailf("%v", err))
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
-		auditLogger.Printf("[AUDIT] [OK] Cadastro usuário | username=%s | role=%s | id=%d", user.Username, user.Role, user.ID)
-		_ = audit.SaveAuditLog(conn, user.Username, "cadastro_usuario", "OK", "id="+fmt.Sprint(user.ID))
+		if !authenticated {
+			audit.SetActor(c, user.ID, user.Username)
+		}
+		auditLogger.Printf("[AUDIT] [OK] Cadastro usuário | username=%s | role=%s | id=%d | ator=%s", user.Username, user.Role, user.ID, audit.ActorFrom(c).Username)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionUserCreate, audit.ResourceUser, user.ID).WithChanges(audit.Diff(User{}, user)).Detailf("alvo=%s id=%d role=%s", user.Username, user.ID, user.Role))
 		c.JSON(201, user)
 	})
 
-	// Listar usuários (protegido)
-	r.GET("/users", mw.MiddlewareFunc(), func(c *gin.Context) {
+	// Listar usuários (protegido, users:read)
+	r.GET("/users", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersRead), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
 		var list []User
-		if err := conn.Find(&list).Error; err != nil {
+		if err := db.Find(&list).Error; err != nil {
 			auditLogger.Printf("[AUDIT] [FAIL] Listagem usuários | erro=%v", err)
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
@@ -94,21 +129,129 @@ func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 		c.JSON(200, list)
 	})
 
-	// Deletar usuário (protegido, admin only)
-	r.DELETE("/users/:id", mw.MiddlewareFunc(), func(c *gin.Context) {
-		// Verifica se o usuário é admin
-		if !middleware.IsAdmin(c) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Acesso permitido apenas para admin"})
+	// Deletar usuário (protegido, users:write)
+	r.DELETE("/users/:id", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		id, ok := middleware.ParamID(c, "id")
+		if !ok {
 			return
 		}
-
-		id := c.Param("id")
-		if err := conn.Delete(&User{}, id).Error; err != nil {
-			auditLogger.Printf("[AUDIT] [FAIL] Deleção usuário | id=%s | erro=%v", id, err)
+		var user User
+		if err := db.First(&user, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if !canManageUser(c, db, &user) {
+			return
+		}
+		// Remover o usuário encerra todas as sessões e API keys dele na mesma transação
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := RevokeUserSessions(tx, user.ID); err != nil {
+				return err
+			}
+			if err := RevokeUserAPIKeys(tx, user.ID); err != nil {
+				return err
+			}
+			return tx.Delete(&user).Error
+		})
+		auditUserChange(c, db, audit.ActionUserDelete, "Deleção usuário", &user, err, audit.Diff(&user, &User{}), "")
+		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
-		auditLogger.Printf("[AUDIT] [OK] Deleção usuário | id=%s", id)
 		c.JSON(204, nil)
 	})
+
+	// Atribuir papel a usuário (protegido, users:write)
+	// @Summary Atribuir papel
+	// @Description Troca o papel de um usuário e encerra as sessões dele
+	// @Tags usuários
+	// @Accept json
+	// @Produce json
+	// @Param id path int true "ID do usuário"
+	// @Param role body RoleAssignment true "Papel"
+	// @Success 200 {object} User
+	// @Failure 400,403,404,500 {object} gin.H
+	// @Router /users/{id}/role [put]
+	r.PUT("/users/:id/role", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		id, ok := middleware.ParamID(c, "id")
+		if !ok {
+			return
+		}
+		var input RoleAssignment
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if exists, err := authz.RoleExists(db, input.Role); err != nil || !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Role inexistente: " + input.Role})
+			return
+		}
+		if !canGrantRole(c, db, input.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Não é possível conceder um papel com permissões que você não possui"})
+			return
+		}
+		var user User
+		if err := db.First(&user, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if !canManageUser(c, db, &user) {
+			return
+		}
+		before := user
+		user.Role = input.Role
+		// JWTs e refresh tokens carregam o papel antigo: trocar o papel encerra as sessões
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Save(&user).Error; err != nil {
+				return err
+			}
+			if before.Role == user.Role {
+				return nil
+			}
+			return RevokeUserSessions(tx, user.ID)
+		})
+		if err != nil {
+			auditLogger.Printf("[AUDIT] [FAIL] Atribuição papel | id=%d | role=%s | erro=%v", id, input.Role, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionUserRoleAssign, audit.ResourceUser, id, audit.CodeInternal).Detailf("id=%d role=%s erro=%v", id, input.Role, err))
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Atribuição papel | id=%d | role=%s -> %s", id, before.Role, user.Role)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionUserRoleAssign, audit.ResourceUser, id).WithChanges(audit.Diff(before, user)).Detailf("id=%d role=%s->%s", id, before.Role, user.Role))
+		c.JSON(200, user)
+	})
+
+	registerRoleRoutes(r, conn, mw)
+	registerGroupRoutes(r, conn, mw)
+	registerSessionRoutes(r, conn, mw)
+	registerMFARoutes(r, conn, mw)
+	registerLockoutRoutes(r, conn, mw)
+	registerServiceAccountRoutes(r, conn, mw)
+	registerUserRoutes(r, conn, mw)
+}
+
+// RoleAssignment é o corpo para trocar o papel de um usuário
+type RoleAssignment struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// canGrantRole impede que o usuário conceda permissões que ele mesmo não tem
+func canGrantRole(c *gin.Context, conn *gorm.DB, role string) bool {
+	perms, err := authz.PermissionsFor(tenant.Scoped(c, conn), role)
+	if err != nil {
+		return false
+	}
+	return authz.CanGrant(middleware.Permissions(c, conn), perms)
+}
+
+// canManageUser impede alterar, desativar ou remover um usuário cujo papel tem
+// permissões que o ator não possui; responde 403 quando não pode
+func canManageUser(c *gin.Context, conn *gorm.DB, user *User) bool {
+	if canGrantRole(c, conn, user.Role) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "Não é possível alterar um usuário com permissões que você não possui"})
+	return false
 }
@@ -1,27 +1,131 @@
 package auth
 
 import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
+	gojwt "github.com/golang-jwt/jwt/v4"
 	"github.com/spf13/viper"
 	"gorm.io/gorm"
+
+	"api-vault/internal/audit"
+	"api-vault/internal/authz"
+	"api-vault/internal/config"
+	"api-vault/internal/signing"
+	"api-vault/internal/tenant"
 )
 
 var IdentityKey = "id"
 
-// JWTMiddlewareWithDB recebe a instância do banco e retorna o middleware JWT
-func JWTMiddlewareWithDB(conn *gorm.DB) (*jwt.GinJWTMiddleware, error) {
+// Claims de revogação (identificador único do JWT e sessão que o emitiu) e de MFA pendente
+const (
+	jtiClaim        = "jti"
+	sessionClaim    = "sid"
+	mfaPendingClaim = "mfa_pending"
+)
+
+// Chaves no contexto do Gin: refresh token gerado no login, desafio MFA e motivos de recusa
+const (
+	refreshTokenKey = "refresh_token"
+	mfaChallengeKey = "mfa_challenge"
+	revokedKey      = "token_revoked"
+	mfaPendingKey   = "mfa_pending"
+)
+
+// Segredo HS256 usado quando JWT_SECRET não é configurado; só aceito com JWT_DEV_MODE
+const defaultJWTSecret = "changeme"
+
+// Validade dos JWTs; chaves aposentadas continuam verificando por este período
+const tokenTimeout = time.Hour
+
+// ErrDefaultJWTSecret impede subir em produção com o segredo JWT padrão
+var ErrDefaultJWTSecret = errors.New("JWT_SECRET ausente ou padrão; configure JWT_SECRET, use JWT_SIGNING_ALG assimétrico ou JWT_DEV_MODE=true")
+
+// Keyring de cada middleware com assinatura assimétrica
+var keyrings sync.Map // *jwt.GinJWTMiddleware -> *signing.Keyring
+
+// KeyringFor devolve o keyring do middleware, ou nil quando a assinatura é HS256
+func KeyringFor(mw *jwt.GinJWTMiddleware) *signing.Keyring {
+	if ring, ok := keyrings.Load(mw); ok {
+		return ring.(*signing.Keyring)
+	}
+	return nil
+}
+
+// IssueToken emite o JWT do usuário. Com keyring assina com a chave corrente e
+// inclui o kid, o que o TokenGenerator do gin-jwt não suporta.
+func IssueToken(mw *jwt.GinJWTMiddleware, data interface{}) (string, time.Time, error) {
+	ring := KeyringFor(mw)
+	if ring == nil {
+		return mw.TokenGenerator(data)
+	}
+	claims := gojwt.MapClaims{}
+	if mw.PayloadFunc != nil {
+		for key, value := range mw.PayloadFunc(data) {
+			claims[key] = value
+		}
+	}
+	now := mw.TimeFunc()
+	expire := now.Add(mw.TimeoutFunc(jwt.MapClaims(claims)))
+	claims[mw.ExpField] = expire.Unix()
+	claims["orig_iat"] = now.Unix()
+	token, err := ring.Sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expire, nil
+}
+
+// signingConfig resolve a chave HS256 ou o keyring assimétrico conforme JWT_SIGNING_ALG
+func signingConfig(conn *gorm.DB) ([]byte, *signing.Keyring, error) {
+	alg := config.GetJWTSigningAlg()
+	if signing.IsAsymmetric(alg) {
+		ring, err := signing.New(conn, alg, tokenTimeout, config.GetJWTKeyRotationInterval())
+		if err != nil {
+			return nil, nil, fmt.Errorf("erro ao carregar chaves de assinatura JWT: %w", err)
+		}
+		// O segredo HS256 não é usado; um valor aleatório garante que nada assinado com ele seja aceito
+		random := make([]byte, 32)
+		if _, err := rand.Read(random); err != nil {
+			return nil, nil, err
+		}
+		return random, ring, nil
+	}
+	if alg != "HS256" {
+		return nil, nil, fmt.Errorf("%w: %s", signing.ErrUnsupportedAlgorithm, alg)
+	}
 	viper.AutomaticEnv()
 	jwtKey := viper.GetString("JWT_SECRET")
-	if jwtKey == "" {
-		jwtKey = "changeme" // fallback seguro para dev
+	if jwtKey == "" || jwtKey == defaultJWTSecret {
+		if !config.GetJWTDevMode() {
+			return nil, nil, ErrDefaultJWTSecret
+		}
+		jwtKey = defaultJWTSecret
 	}
-	return jwt.New(&jwt.GinJWTMiddleware{
+	return []byte(jwtKey), nil, nil
+}
+
+// JWTMiddlewareWithDB recebe a instância do banco e retorna o middleware JWT
+func JWTMiddlewareWithDB(conn *gorm.DB) (*jwt.GinJWTMiddleware, error) {
+	key, ring, err := signingConfig(conn)
+	if err != nil {
+		return nil, err
+	}
+	var keyFunc func(*gojwt.Token) (interface{}, error)
+	if ring != nil {
+		keyFunc = ring.KeyFunc
+	}
+	mw, err := jwt.New(&jwt.GinJWTMiddleware{
 		Realm:       "api zone",
-		Key:         []byte(jwtKey),
-		Timeout:     time.Hour,
+		Key:         key,
+		KeyFunc:     keyFunc,
+		Timeout:     tokenTimeout,
 		MaxRefresh:  time.Hour,
 		IdentityKey: IdentityKey,
 		Authenticator: func(c *gin.Context) (interface{}, error) {
@@ -29,40 +133,171 @@ func JWTMiddlewareWithDB(conn *gorm.DB) (*jwt.GinJWTMiddleware, error) {
 			if err := c.ShouldBindJSON(&loginVals); err != nil {
 				return "", jwt.ErrMissingLoginValues
 			}
+			// Username ou IP bloqueado por excesso de falhas: nem confere a senha
+			if err := checkLoginLock(c, conn, loginVals.Username); err != nil {
+				return nil, err
+			}
 			user, err := AuthenticateUser(conn, loginVals.Username, loginVals.Password)
+			if errors.Is(err, ErrUserDisabled) {
+				return nil, err
+			}
 			if err != nil {
+				registerLoginFailure(c, conn, loginVals.Username)
 				return nil, jwt.ErrFailedAuthentication
 			}
-			return user, nil
+			// Senha certa zera as falhas do username; as do IP só expiram. Com MFA
+			// só o segundo fator zera, senão cada novo desafio renovaria os palpites do TOTP
+			if !user.MFAEnabled {
+				if err := clearLoginFailures(conn, userLockKey(user.Username)); err != nil {
+					return nil, err
+				}
+			}
+			return finishLogin(c, conn, user)
 		},
 		PayloadFunc: func(data interface{}) jwt.MapClaims {
 			if u, ok := data.(*User); ok {
-				return jwt.MapClaims{
+				jti, _ := newOpaqueToken(16)
+				claims := jwt.MapClaims{
 					IdentityKey: u.ID,
 					"username":  u.Username,
 					"role":      u.Role,
+					// Toda consulta da requisição é filtrada por esta organização
+					tenant.ClaimKey: u.OrgID,
+					jtiClaim:        jti,
+				}
+				if u.SessionID != 0 {
+					claims[sessionClaim] = u.SessionID
+				}
+				if u.MFAPending {
+					claims[mfaPendingClaim] = true
+				}
+				if u.APIKeyID != 0 {
+					claims[apiKeyClaim] = u.APIKeyID
 				}
+				if u.Scopes != nil {
+					claims[authz.ScopesClaim] = u.Scopes
+				}
+				return claims
 			}
 			return jwt.MapClaims{}
 		},
 		IdentityHandler: func(c *gin.Context) interface{} {
 			claims := jwt.ExtractClaims(c)
 			role, _ := claims["role"].(string)
-			return &User{ID: uint(claims[IdentityKey].(float64)), Username: claims["username"].(string), Role: role}
+			orgID, _ := claims[tenant.ClaimKey].(float64)
+			sessionID, _ := claims[sessionClaim].(float64)
+			mfaPending, _ := claims[mfaPendingClaim].(bool)
+			user := &User{ID: uint(claims[IdentityKey].(float64)), Username: claims["username"].(string), Role: role, OrgID: uint(orgID), SessionID: uint(sessionID), MFAPending: mfaPending}
+			// Todo evento auditado pela requisição é atribuído a este usuário
+			audit.SetActor(c, user.ID, user.Username)
+			return user
 		},
 		Authorizator: func(data interface{}, c *gin.Context) bool {
-			if _, ok := data.(*User); ok {
-				return true
+			u, ok := data.(*User)
+			if !ok {
+				return false
+			}
+			// JWTs de logout (denylist) ou de sessões revogadas são recusados
+			claims := jwt.ExtractClaims(c)
+			jti, _ := claims[jtiClaim].(string)
+			issuedAt, _ := claims["orig_iat"].(float64)
+			if tokenRevoked(conn, jti, u.SessionID, u.ID, int64(issuedAt)) {
+				c.Set(revokedKey, true)
+				return false
+			}
+			// Papel exige MFA: até cadastrar o TOTP só as rotas de cadastro ficam liberadas
+			if u.MFAPending && !mfaEnrollmentRoutes[c.FullPath()] {
+				c.Set(mfaPendingKey, true)
+				return false
 			}
-			return false
+			return true
+		},
+		LoginResponse: func(c *gin.Context, code int, token string, expire time.Time) {
+			refresh, _ := c.Get(refreshTokenKey)
+			c.JSON(code, gin.H{
+				"code":          code,
+				"token":         token,
+				"expire":        expire.Format(time.RFC3339),
+				"refresh_token": refresh,
+			})
 		},
 		Unauthorized: func(c *gin.Context, code int, message string) {
+			// Revogação invalida a credencial: 401 para o cliente renovar ou refazer o login
+			if c.GetBool(revokedKey) {
+				code, message = 401, "Token revogado"
+			}
+			if c.GetBool(mfaPendingKey) {
+				message = "MFA obrigatório para o seu papel; cadastre o TOTP em /mfa/totp/enroll"
+			}
 			c.JSON(code, gin.H{"error": message})
 		},
 		TokenLookup:   "header: Authorization, query: token, cookie: jwt",
 		TokenHeadName: "Bearer",
 		TimeFunc:      time.Now,
 	})
+	if err != nil {
+		return nil, err
+	}
+	if ring != nil {
+		keyrings.Store(mw, ring)
+	}
+	return mw, nil
+}
+
+// loginHandler substitui o LoginHandler do gin-jwt para emitir o JWT por IssueToken
+func loginHandler(mw *jwt.GinJWTMiddleware) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, err := mw.Authenticator(c)
+		respondLogin(c, mw, data, err)
+	}
+}
+
+// CompleteLogin conclui o login de um usuário já autenticado fora do /login (ex.:
+// SSO), com o mesmo segundo fator, sessão e resposta do login por senha
+func CompleteLogin(c *gin.Context, conn *gorm.DB, mw *jwt.GinJWTMiddleware, user *User) {
+	data, err := finishLogin(c, conn, user)
+	respondLogin(c, mw, data, err)
+}
+
+// finishLogin abre o desafio MFA ou a sessão de um usuário cuja credencial já conferiu
+func finishLogin(c *gin.Context, conn *gorm.DB, user *User) (interface{}, error) {
+	audit.SetActor(c, user.ID, user.Username)
+	// Com TOTP ativo a credencial só abre o desafio; o JWT sai em /login/mfa
+	if user.MFAEnabled {
+		challenge, expires, err := CreateMFAChallenge(conn, user)
+		if err != nil {
+			return nil, err
+		}
+		c.Set(mfaChallengeKey, gin.H{"mfa_required": true, "challenge": challenge, "expires_at": expires.Format(time.RFC3339)})
+		return nil, ErrMFARequired
+	}
+	if err := startSession(c, conn, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// respondLogin responde o resultado do login: desafio MFA, bloqueio, erro ou JWT
+func respondLogin(c *gin.Context, mw *jwt.GinJWTMiddleware, data interface{}, err error) {
+	if errors.Is(err, ErrMFARequired) {
+		challenge, _ := c.Get(mfaChallengeKey)
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+	if errors.Is(err, ErrLoginLocked) {
+		lockedResponse(c)
+		return
+	}
+	if err != nil {
+		mw.Unauthorized(c, http.StatusUnauthorized, mw.HTTPStatusMessageFunc(err, c))
+		return
+	}
+	token, expire, err := IssueToken(mw, data)
+	if err != nil {
+		mw.Unauthorized(c, http.StatusUnauthorized, mw.HTTPStatusMessageFunc(jwt.ErrFailedTokenCreation, c))
+		return
+	}
+	mw.LoginResponse(c, http.StatusOK, token, expire)
 }
 
 // Login struct para autenticação
@@ -71,9 +306,19 @@ type Login struct {
 	Password string `json:"password" binding:"required"`
 }
 
-// Função auxiliar para verificar se o usuário autenticado é admin
-func IsAdmin(c *gin.Context) bool {
-	claims := jwt.ExtractClaims(c)
-	role, _ := claims["role"].(string)
-	return role == "admin"
+// startSession abre a sessão do login, marcando o JWT como pendente de MFA se o
+// papel exigir TOTP ainda não cadastrado, e guarda o refresh token para a resposta
+func startSession(c *gin.Context, conn *gorm.DB, user *User) error {
+	pending, err := mfaEnrollmentPending(conn, user)
+	if err != nil {
+		return err
+	}
+	user.MFAPending = pending
+	session, refresh, err := CreateSession(conn, user)
+	if err != nil {
+		return err
+	}
+	user.SessionID = session.ID
+	c.Set(refreshTokenKey, refresh)
+	return nil
 }
@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"api-vault/internal/audit"
+	"api-vault/internal/authz"
+	"api-vault/internal/config"
+	"api-vault/internal/middleware"
+	"api-vault/internal/tenant"
+)
+
+// LoginAttempt conta as senhas erradas de um username ou de um IP. A chave é
+// o username e não o usuário para que nomes inexistentes se comportem igual.
+type LoginAttempt struct {
+	Key         string `gorm:"primaryKey"` // "user:<username>" ou "ip:<endereço>"
+	Failures    int    `gorm:"not null;default:0"`
+	LockedUntil *time.Time
+	LastFailure time.Time
+}
+
+// ErrLoginLocked indica que o username ou o IP está bloqueado por excesso de falhas
+var ErrLoginLocked = errors.New("muitas tentativas de login")
+
+// lockoutKey guarda no contexto quanto falta para o bloqueio acabar
+const lockoutKey = "login_locked_for"
+
+func userLockKey(username string) string { return "user:" + username }
+func ipLockKey(ip string) string         { return "ip:" + ip }
+
+// loginLockedFor retorna o maior tempo de bloqueio restante entre as chaves; 0 se nenhuma está bloqueada
+func loginLockedFor(conn *gorm.DB, now time.Time, keys ...string) (time.Duration, error) {
+	var attempts []LoginAttempt
+	if err := conn.Where("key IN ? AND locked_until > ?", keys, now).Find(&attempts).Error; err != nil {
+		return 0, err
+	}
+	var wait time.Duration
+	for _, a := range attempts {
+		if d := a.LockedUntil.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// recordLoginFailure soma uma falha à chave e, a partir do limite, bloqueia por
+// LOGIN_LOCKOUT_BASE dobrando a cada nova falha até LOGIN_LOCKOUT_MAX. Falhas
+// mais antigas que LOGIN_LOCKOUT_MAX são esquecidas. Retorna a duração do bloqueio aplicado.
+func recordLoginFailure(conn *gorm.DB, key string, limit int, now time.Time) (time.Duration, error) {
+	base, ceiling := config.GetLoginLockoutBase(), config.GetLoginLockoutMax()
+	var lockFor time.Duration
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&LoginAttempt{Key: key, LastFailure: now}).Error; err != nil {
+			return err
+		}
+		// Incremento no próprio UPDATE para não perder falhas concorrentes
+		stale := now.Add(-ceiling)
+		err := tx.Model(&LoginAttempt{}).Where("key = ?", key).Updates(map[string]interface{}{
+			"failures":     gorm.Expr("CASE WHEN last_failure < ? THEN 1 ELSE failures + 1 END", stale),
+			"last_failure": now,
+		}).Error
+		if err != nil {
+			return err
+		}
+		var attempt LoginAttempt
+		if err := tx.First(&attempt, "key = ?", key).Error; err != nil {
+			return err
+		}
+		if limit <= 0 || attempt.Failures < limit {
+			return nil
+		}
+		lockFor = ceiling
+		if shift := attempt.Failures - limit; shift < 30 && base<<shift < ceiling {
+			lockFor = base << shift
+		}
+		return tx.Model(&LoginAttempt{}).Where("key = ?", key).Update("locked_until", now.Add(lockFor)).Error
+	})
+	return lockFor, err
+}
+
+// clearLoginFailures zera os contadores das chaves
+func clearLoginFailures(conn *gorm.DB, keys ...string) error {
+	return conn.Where("key IN ?", keys).Delete(&LoginAttempt{}).Error
+}
+
+// checkLoginLock recusa o login enquanto o username ou o IP estiver bloqueado
+func checkLoginLock(c *gin.Context, conn *gorm.DB, username string) error {
+	wait, err := loginLockedFor(conn, time.Now(), userLockKey(username), ipLockKey(c.ClientIP()))
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		c.Set(lockoutKey, wait)
+		return ErrLoginLocked
+	}
+	return nil
+}
+
+// registerLoginFailure conta a senha errada para o username e o IP, auditando os bloqueios
+func registerLoginFailure(c *gin.Context, conn *gorm.DB, username string) {
+	ip := c.ClientIP()
+	now := time.Now()
+	for _, k := range []struct {
+		key   string
+		limit int
+	}{
+		{userLockKey(username), config.GetLoginMaxAttempts()},
+		{ipLockKey(ip), config.GetLoginIPMaxAttempts()},
+	} {
+		lockFor, err := recordLoginFailure(conn, k.key, k.limit, now)
+		if err != nil {
+			auditLogger.Printf("[AUDIT] [FAIL] Contagem de falhas de login | chave=%s | erro=%v", k.key, err)
+			continue
+		}
+		if lockFor == 0 {
+			continue
+		}
+		// O evento vai para a organização do usuário, se ele existir
+		db := conn
+		var user User
+		if conn.Where("username = ?", username).First(&user).Error == nil {
+			db = tenant.ForOrg(conn, user.OrgID)
+		}
+		audit.SetActor(c, user.ID, username)
+		auditLogger.Printf("[AUDIT] [FAIL] Bloqueio de login | chave=%s | ip=%s | duração=%s", k.key, ip, lockFor)
+		_ = audit.Record(c, db, audit.Failed(audit.ActionLoginLock, audit.ResourceUser, user.ID, audit.CodeLocked).Detailf("chave=%s ip=%s duracao=%s", k.key, ip, lockFor))
+	}
+}
+
+// UnlockUser zera as falhas e o bloqueio de login do username
+func UnlockUser(conn *gorm.DB, username string) error {
+	return clearLoginFailures(conn, userLockKey(username))
+}
+
+// lockedResponse responde 429 com Retry-After para logins bloqueados
+func lockedResponse(c *gin.Context) {
+	wait := c.GetDuration(lockoutKey)
+	c.Header("Retry-After", fmt.Sprintf("%d", int(wait.Round(time.Second)/time.Second)+1))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Muitas tentativas de login; tente novamente mais tarde"})
+}
+
+func registerLockoutRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
+	// @Summary Desbloqueia o login de um usuário
+	// @Description Zera as falhas de senha e encerra o bloqueio do username; bloqueios por IP expiram sozinhos
+	// @Tags users
+	// @Security BearerAuth
+	// @Param id path int true "ID do usuário"
+	// @Success 204 {object} nil
+	// @Failure 400,403,404,500 {object} gin.H
+	// @Router /users/{id}/lockout [delete]
+	r.DELETE("/users/:id/lockout", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		user, ok := loadUser(c, db)
+		if !ok {
+			return
+		}
+		// Contadores não pertencem a uma organização; o usuário já foi checado acima
+		if err := UnlockUser(conn, user.Username); err != nil {
+			auditLogger.Printf("[AUDIT] [FAIL] Desbloqueio de login | id=%d | erro=%v", user.ID, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionLoginUnlock, audit.ResourceUser, user.ID, audit.CodeInternal).Detailf("id=%d erro=%v", user.ID, err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Desbloqueio de login | id=%d | username=%s", user.ID, user.Username)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionLoginUnlock, audit.ResourceUser, user.ID).Detailf("id=%d username=%s", user.ID, user.Username))
+		c.JSON(http.StatusNoContent, nil)
+	})
+}
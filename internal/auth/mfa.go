@@ -0,0 +1,500 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api-vault/internal/audit"
+	"api-vault/internal/authz"
+	"api-vault/internal/crypto"
+	"api-vault/internal/middleware"
+	"api-vault/internal/tenant"
+	"api-vault/internal/totp"
+)
+
+// Emissor exibido nos aplicativos autenticadores
+const mfaIssuer = "api-vault"
+
+// Validade e tentativas do desafio entre a senha e o código TOTP
+const (
+	mfaChallengeTTL         = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
+	recoveryCodeCount       = 10
+)
+
+var (
+	// ErrMFARequired indica que a senha confere e o login aguarda o segundo fator
+	ErrMFARequired = errors.New("segundo fator necessário")
+	// ErrInvalidMFACode cobre código TOTP ou de recuperação inválido ou já usado
+	ErrInvalidMFACode = errors.New("código MFA inválido")
+	// ErrInvalidMFAChallenge cobre desafio desconhecido, expirado ou sem tentativas
+	ErrInvalidMFAChallenge = errors.New("desafio MFA inválido ou expirado")
+)
+
+// RecoveryCode é um código de uso único para entrar sem o autenticador; guardado como hash
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// MFAChallenge liga a etapa de senha à etapa do código no login em dois passos
+type MFAChallenge struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	TokenHash string `gorm:"not null;uniqueIndex"`
+	Attempts  int
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// mfaSecretField vincula a semente TOTP cifrada ao usuário
+func mfaSecretField(userID uint) crypto.Field {
+	return crypto.Field{Table: "users", Column: "mfa_secret", RecordID: userID}
+}
+
+// mfaEnrollmentPending informa se o papel do usuário exige MFA e ele ainda não cadastrou o TOTP
+func mfaEnrollmentPending(conn *gorm.DB, user *User) (bool, error) {
+	if user.MFAEnabled {
+		return false, nil
+	}
+	return authz.RequiresMFA(tenant.ForOrg(conn, user.OrgID), user.Role)
+}
+
+// CreateMFAChallenge abre o desafio do segundo fator e devolve o identificador em claro
+func CreateMFAChallenge(conn *gorm.DB, user *User) (string, time.Time, error) {
+	token, err := newOpaqueToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	challenge := MFAChallenge{UserID: user.ID, TokenHash: hashRefreshToken(token), ExpiresAt: time.Now().Add(mfaChallengeTTL)}
+	if err := conn.Create(&challenge).Error; err != nil {
+		return "", time.Time{}, err
+	}
+	return token, challenge.ExpiresAt, nil
+}
+
+// CompleteMFAChallenge confere o código do desafio e devolve o usuário; o desafio
+// é consumido no sucesso e descartado após mfaChallengeMaxAttempts erros
+func CompleteMFAChallenge(conn *gorm.DB, token, code string) (*User, error) {
+	var challenge MFAChallenge
+	if err := conn.Where("token_hash = ?", hashRefreshToken(token)).First(&challenge).Error; err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+	if time.Now().After(challenge.ExpiresAt) || challenge.Attempts >= mfaChallengeMaxAttempts {
+		conn.Delete(&challenge)
+		return nil, ErrInvalidMFAChallenge
+	}
+	var user User
+	if err := conn.First(&user, challenge.UserID).Error; err != nil || user.Disabled {
+		return nil, ErrInvalidMFAChallenge
+	}
+	if err := VerifySecondFactor(conn, &user, code, true); err != nil {
+		conn.Model(&challenge).Update("attempts", gorm.Expr("attempts + 1"))
+		return &user, err
+	}
+	conn.Delete(&challenge)
+	return &user, nil
+}
+
+// mfaChallengeUsername devolve o username do desafio ainda válido, para conferir o
+// bloqueio de login antes do código
+func mfaChallengeUsername(conn *gorm.DB, token string) (string, bool) {
+	var challenge MFAChallenge
+	if err := conn.Where("token_hash = ?", hashRefreshToken(token)).First(&challenge).Error; err != nil {
+		return "", false
+	}
+	var user User
+	if err := conn.Select("id", "username").First(&user, challenge.UserID).Error; err != nil {
+		return "", false
+	}
+	return user.Username, true
+}
+
+// VerifySecondFactor aceita o código TOTP atual ou, se permitido, um código de
+// recuperação. Cada código vale uma única vez.
+func VerifySecondFactor(conn *gorm.DB, user *User, code string, allowRecovery bool) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return verifyTOTP(conn, user, code)
+	}
+	if !allowRecovery {
+		return ErrInvalidMFACode
+	}
+	now := time.Now()
+	res := conn.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashRecoveryCode(code)).
+		Update("used_at", &now)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+func verifyTOTP(conn *gorm.DB, user *User, code string) error {
+	if user.MFASecret == "" {
+		return ErrInvalidMFACode
+	}
+	secret, err := crypto.DecryptField(user.MFASecret, mfaSecretField(user.ID))
+	if err != nil {
+		return err
+	}
+	step, ok := totp.Verify(secret, code, time.Now())
+	if !ok || step <= user.MFALastStep {
+		return ErrInvalidMFACode
+	}
+	// A condição no último passo impede que o mesmo código seja aceito duas vezes em paralelo
+	res := conn.Model(&User{}).Where("id = ? AND mfa_last_step < ?", user.ID, step).Update("mfa_last_step", step)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrInvalidMFACode
+	}
+	user.MFALastStep = step
+	return nil
+}
+
+// hashRecoveryCode ignora maiúsculas, espaços e hífens digitados pelo usuário
+func hashRecoveryCode(code string) string {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// replaceRecoveryCodes invalida os códigos anteriores e devolve os novos em claro
+func replaceRecoveryCodes(conn *gorm.DB, userID uint) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+		code := raw[:5] + "-" + raw[5:]
+		codes = append(codes, code)
+		records = append(records, RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(code)})
+	}
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&records).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// disableMFA remove a semente e os códigos de recuperação do usuário
+func disableMFA(conn *gorm.DB, userID uint) error {
+	return conn.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"mfa_enabled": false, "mfa_secret": "", "mfa_last_step": 0}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error
+	})
+}
+
+// MFACodeInput é o corpo das operações que exigem o código atual
+type MFACodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFALoginInput é o corpo do segundo passo do login
+type MFALoginInput struct {
+	Challenge string `json:"challenge" binding:"required"`
+	Code      string `json:"code" binding:"required"`
+}
+
+// mfaEnrollmentRoutes são as únicas rotas liberadas para quem ainda precisa cadastrar o TOTP
+var mfaEnrollmentRoutes = map[string]bool{
+	"/mfa/totp/enroll":  true,
+	"/mfa/totp/confirm": true,
+	"/logout":           true,
+}
+
+func registerMFARoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
+	// Segundo passo do login: troca o desafio e o código pelo JWT
+	// @Summary Login com MFA
+	// @Description Confere o código TOTP (ou de recuperação) do desafio devolvido por /login
+	// @Tags auth
+	// @Accept json
+	// @Produce json
+	// @Param login body MFALoginInput true "Desafio e código"
+	// @Success 200 {object} gin.H
+	// @Failure 400,401,429,500 {object} gin.H
+	// @Router /login/mfa [post]
+	r.POST("/login/mfa", func(c *gin.Context) {
+		var input MFALoginInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// O bloqueio por falhas vale também para o segundo fator
+		if username, ok := mfaChallengeUsername(conn, input.Challenge); ok {
+			if err := checkLoginLock(c, conn, username); errors.Is(err, ErrLoginLocked) {
+				auditLogger.Printf("[AUDIT] [FAIL] Login MFA | user=%s | erro=%v", username, err)
+				lockedResponse(c)
+				return
+			} else if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		user, err := CompleteMFAChallenge(conn, input.Challenge, input.Code)
+		if err != nil {
+			username := ""
+			if user != nil && errors.Is(err, ErrInvalidMFACode) {
+				// Código errado conta como senha errada: vários desafios não somam mais palpites
+				registerLoginFailure(c, conn, user.Username)
+			}
+			if user != nil {
+				username = user.Username
+				audit.SetActor(c, user.ID, user.Username)
+				_ = audit.Record(c, tenant.ForOrg(conn, user.OrgID), audit.Failed(audit.ActionLoginMFA, audit.ResourceUser, user.ID, audit.CodeUnauthorized).Detailf("%v", err))
+			}
+			auditLogger.Printf("[AUDIT] [FAIL] Login MFA | user=%s | erro=%v", username, err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		audit.SetActor(c, user.ID, user.Username)
+		if err := clearLoginFailures(conn, userLockKey(user.Username)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := startSession(c, conn, user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		token, expire, err := IssueToken(mw, user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Login MFA | user=%s", user.Username)
+		_ = audit.Record(c, tenant.ForOrg(conn, user.OrgID), audit.Succeeded(audit.ActionLoginMFA, audit.ResourceUser, user.ID).Detailf("sessao=%d", user.SessionID))
+		mw.LoginResponse(c, http.StatusOK, token, expire)
+	})
+
+	// Iniciar cadastro do TOTP (autenticado)
+	// @Summary Cadastrar TOTP
+	// @Description Gera a semente TOTP e a URI otpauth:// para o QR code; só vale após /mfa/totp/confirm
+	// @Tags mfa
+	// @Produce json
+	// @Success 200 {object} gin.H
+	// @Failure 409,500 {object} gin.H
+	// @Router /mfa/totp/enroll [post]
+	r.POST("/mfa/totp/enroll", mw.MiddlewareFunc(), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		var user User
+		if err := db.First(&user, CurrentUser(c).ID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if user.MFAEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": "MFA já ativo; desative antes de cadastrar outro autenticador"})
+			return
+		}
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		encrypted, err := crypto.EncryptField(secret, mfaSecretField(user.ID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Erro ao criptografar semente TOTP"})
+			return
+		}
+		if err := db.Model(&user).Update("mfa_secret", encrypted).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Cadastro TOTP iniciado | user=%s", user.Username)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionMFAEnrollStart, audit.ResourceUser, user.ID).Detailf("id=%d", user.ID))
+		c.JSON(http.StatusOK, gin.H{
+			"secret":           secret,
+			"provisioning_uri": totp.ProvisioningURI(mfaIssuer, user.Username, secret),
+		})
+	})
+
+	// Confirmar cadastro do TOTP (autenticado)
+	// @Summary Confirmar TOTP
+	// @Description Ativa o MFA com o primeiro código do autenticador e devolve os códigos de recuperação (exibidos uma única vez)
+	// @Tags mfa
+	// @Accept json
+	// @Produce json
+	// @Param code body MFACodeInput true "Código TOTP"
+	// @Success 200 {object} gin.H
+	// @Failure 400,401,409,500 {object} gin.H
+	// @Router /mfa/totp/confirm [post]
+	r.POST("/mfa/totp/confirm", mw.MiddlewareFunc(), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		var input MFACodeInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var user User
+		if err := db.First(&user, CurrentUser(c).ID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if user.MFAEnabled || user.MFASecret == "" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Nenhum cadastro TOTP pendente"})
+			return
+		}
+		if err := VerifySecondFactor(db, &user, input.Code, false); err != nil {
+			auditLogger.Printf("[AUDIT] [FAIL] Confirmação TOTP | user=%s | erro=%v", user.Username, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionMFAEnable, audit.ResourceUser, user.ID, audit.CodeUnauthorized).Detailf("%v", err))
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		before := user
+		if err := db.Model(&user).Update("mfa_enabled", true).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		codes, err := replaceRecoveryCodes(db, user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] MFA ativado | user=%s", user.Username)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionMFAEnable, audit.ResourceUser, user.ID).WithChanges(audit.Diff(before, user)).Detailf("id=%d", user.ID))
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	})
+
+	// Gerar novos códigos de recuperação (autenticado)
+	// @Summary Regerar códigos de recuperação
+	// @Description Invalida os códigos de recuperação anteriores; exige o código TOTP atual
+	// @Tags mfa
+	// @Accept json
+	// @Produce json
+	// @Param code body MFACodeInput true "Código TOTP"
+	// @Success 200 {object} gin.H
+	// @Failure 400,401,409,500 {object} gin.H
+	// @Router /mfa/recovery-codes [post]
+	r.POST("/mfa/recovery-codes", mw.MiddlewareFunc(), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		var input MFACodeInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var user User
+		if err := db.First(&user, CurrentUser(c).ID).Error; err != nil || !user.MFAEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": "MFA não está ativo"})
+			return
+		}
+		if err := VerifySecondFactor(db, &user, input.Code, false); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		codes, err := replaceRecoveryCodes(db, user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Códigos de recuperação regerados | user=%s", user.Username)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionMFARecoveryCodes, audit.ResourceUser, user.ID).Detailf("id=%d", user.ID))
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	})
+
+	// Desativar o próprio MFA (autenticado)
+	// @Summary Desativar TOTP
+	// @Description Remove o autenticador e os códigos de recuperação; não permitido se o papel exige MFA
+	// @Tags mfa
+	// @Accept json
+	// @Param code body MFACodeInput true "Código TOTP ou de recuperação"
+	// @Success 204 {object} nil
+	// @Failure 400,401,409,500 {object} gin.H
+	// @Router /mfa/totp [delete]
+	r.DELETE("/mfa/totp", mw.MiddlewareFunc(), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		var input MFACodeInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var user User
+		if err := db.First(&user, CurrentUser(c).ID).Error; err != nil || !user.MFAEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": "MFA não está ativo"})
+			return
+		}
+		required, err := authz.RequiresMFA(db, user.Role)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if required {
+			c.JSON(http.StatusConflict, gin.H{"error": "O papel " + user.Role + " exige MFA"})
+			return
+		}
+		if err := VerifySecondFactor(db, &user, input.Code, true); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err := disableMFA(db, user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] MFA desativado | user=%s", user.Username)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionMFADisable, audit.ResourceUser, user.ID).Detailf("id=%d", user.ID))
+		c.JSON(http.StatusNoContent, nil)
+	})
+
+	// Resetar o MFA de um usuário que perdeu o autenticador (protegido, users:write)
+	// @Summary Resetar MFA
+	// @Description Remove o TOTP e os códigos de recuperação do usuário e encerra as sessões dele
+	// @Tags mfa
+	// @Param id path int true "ID do usuário"
+	// @Success 204 {object} nil
+	// @Failure 400,403,404,500 {object} gin.H
+	// @Router /users/{id}/mfa [delete]
+	r.DELETE("/users/:id/mfa", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		user, ok := loadUser(c, db)
+		if !ok {
+			return
+		}
+		// Sem o MFA, quem tem a senha entra como o usuário: não vale para papéis acima do seu
+		if !canManageUser(c, db, user) {
+			return
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := disableMFA(tx, user.ID); err != nil {
+				return err
+			}
+			return RevokeUserSessions(tx, user.ID)
+		})
+		if err != nil {
+			auditLogger.Printf("[AUDIT] [FAIL] Reset MFA | id=%d | erro=%v", user.ID, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionMFAReset, audit.ResourceUser, user.ID, audit.CodeInternal).Detailf("id=%d erro=%v", user.ID, err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Reset MFA | id=%d | username=%s", user.ID, user.Username)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionMFAReset, audit.ResourceUser, user.ID).Detailf("id=%d username=%s", user.ID, user.Username))
+		c.JSON(http.StatusNoContent, nil)
+	})
+}
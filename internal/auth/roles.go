@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api-vault/internal/audit"
+	"api-vault/internal/authz"
+	"api-vault/internal/middleware"
+	"api-vault/internal/tenant"
+)
+
+// RoleInput é o corpo para criar ou alterar um papel customizado
+type RoleInput struct {
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+func registerRoleRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
+	// Listar papéis e permissões (protegido, roles:read)
+	// @Summary Listar papéis
+	// @Description Lista os papéis embutidos e customizados com suas permissões
+	// @Tags papéis
+	// @Produce json
+	// @Success 200 {object} gin.H
+	// @Failure 403,500 {object} gin.H
+	// @Router /roles [get]
+	r.GET("/roles", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermRolesRead), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		var custom []authz.Role
+		if err := db.Order("name").Find(&custom).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		mfaRoles, err := authz.MFARoles(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"builtin":      rolesResponse(authz.BuiltinRoles()),
+			"custom":       rolesResponse(custom),
+			"permissions":  authz.AllPermissions,
+			"mfa_required": mfaRoles,
+		})
+	})
+
+	// Exigir MFA para um papel (protegido, roles:write)
+	// @Summary Exigir MFA por papel
+	// @Description Liga ou desliga a exigência de TOTP para os usuários do papel (embutido ou customizado)
+	// @Tags papéis
+	// @Accept json
+	// @Produce json
+	// @Param name path string true "Nome do papel"
+	// @Param policy body RoleMFAInput true "Exigência"
+	// @Success 200 {object} gin.H
+	// @Failure 400,403,404,500 {object} gin.H
+	// @Router /roles/{name}/mfa [put]
+	r.PUT("/roles/:name/mfa", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermRolesWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		name := c.Param("name")
+		var input RoleMFAInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		exists, err := authz.RoleExists(db, name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !exists {
+			c.JSON(http.StatusNotFound, gin.H{"error": authz.ErrRoleNotFound.Error()})
+			return
+		}
+		if err := authz.SetMFARequired(db, name, *input.Required); err != nil {
+			auditLogger.Printf("[AUDIT] [FAIL] Política MFA papel | name=%s | erro=%v", name, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionRoleMFAPolicy, audit.ResourceRole, name, audit.CodeInternal).Detailf("name=%s erro=%v", name, err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Política MFA papel | name=%s | obrigatorio=%t", name, *input.Required)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionRoleMFAPolicy, audit.ResourceRole, name).Detailf("name=%s obrigatorio=%t", name, *input.Required))
+		c.JSON(http.StatusOK, gin.H{"name": name, "mfa_required": *input.Required})
+	})
+
+	// Criar papel customizado (protegido, roles:write)
+	// @Summary Criar papel
+	// @Description Cria um papel customizado com permissões nomeadas
+	// @Tags papéis
+	// @Accept json
+	// @Produce json
+	// @Param role body RoleInput true "Papel"
+	// @Success 201 {object} gin.H
+	// @Failure 400,403,409,500 {object} gin.H
+	// @Router /roles [post]
+	r.POST("/roles", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermRolesWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		var input RoleInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(input.Name) < 3 || len(input.Name) > 32 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Nome do papel inválido"})
+			return
+		}
+		if authz.IsBuiltin(input.Name) {
+			c.JSON(http.StatusConflict, gin.H{"error": authz.ErrBuiltinRole.Error()})
+			return
+		}
+		role := authz.Role{Name: input.Name}
+		if err := role.SetPermissions(input.Permissions); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !authz.CanGrant(middleware.Permissions(c, db), role.PermissionList()) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Não é possível conceder permissões que você não possui"})
+			return
+		}
+		if err := db.Create(&role).Error; err != nil {
+			auditLogger.Printf("[AUDIT] [FAIL] Cadastro papel | name=%s | erro=%v", input.Name, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionRoleCreate, audit.ResourceRole, input.Name, audit.CodeConflict).Detailf("name=%s erro=%v", input.Name, err))
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Cadastro papel | name=%s | permissoes=%s", role.Name, role.Permissions)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionRoleCreate, audit.ResourceRole, role.Name).WithChanges(audit.Diff(authz.Role{}, role)).Detailf("name=%s permissoes=%s", role.Name, role.Permissions))
+		c.JSON(http.StatusCreated, roleResponse(role))
+	})
+
+	// Alterar permissões de um papel customizado (protegido, roles:write)
+	// @Summary Alterar papel
+	// @Description Substitui as permissões de um papel customizado
+	// @Tags papéis
+	// @Accept json
+	// @Produce json
+	// @Param name path string true "Nome do papel"
+	// @Param role body RoleInput true "Permissões"
+	// @Success 200 {object} gin.H
+	// @Failure 400,403,404,409,500 {object} gin.H
+	// @Router /roles/{name} [put]
+	r.PUT("/roles/:name", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermRolesWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		name := c.Param("name")
+		if authz.IsBuiltin(name) {
+			c.JSON(http.StatusConflict, gin.H{"error": authz.ErrBuiltinRole.Error()})
+			return
+		}
+		var input RoleInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var role authz.Role
+		if err := db.Where("name = ?", name).First(&role).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": authz.ErrRoleNotFound.Error()})
+			return
+		}
+		before := role
+		if err := role.SetPermissions(input.Permissions); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !authz.CanGrant(middleware.Permissions(c, db), role.PermissionList()) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Não é possível conceder permissões que você não possui"})
+			return
+		}
+		if err := db.Save(&role).Error; err != nil {
+			auditLogger.Printf("[AUDIT] [FAIL] Atualização papel | name=%s | erro=%v", name, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionRoleUpdate, audit.ResourceRole, name, audit.CodeInternal).Detailf("name=%s erro=%v", name, err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Atualização papel | name=%s | permissoes=%s", role.Name, role.Permissions)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionRoleUpdate, audit.ResourceRole, role.Name).WithChanges(audit.Diff(before, role)).Detailf("name=%s permissoes=%s", role.Name, role.Permissions))
+		c.JSON(http.StatusOK, roleResponse(role))
+	})
+
+	// Remover papel customizado sem usuários (protegido, roles:write)
+	// @Summary Remover papel
+	// @Description Remove um papel customizado que não esteja atribuído a nenhum usuário
+	// @Tags papéis
+	// @Param name path string true "Nome do papel"
+	// @Success 204 {object} nil
+	// @Failure 403,404,409,500 {object} gin.H
+	// @Router /roles/{name} [delete]
+	r.DELETE("/roles/:name", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermRolesWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		name := c.Param("name")
+		if authz.IsBuiltin(name) {
+			c.JSON(http.StatusConflict, gin.H{"error": authz.ErrBuiltinRole.Error()})
+			return
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var inUse int64
+			if err := tx.Model(&User{}).Where("role = ?", name).Count(&inUse).Error; err != nil {
+				return err
+			}
+			if inUse > 0 {
+				return errRoleInUse
+			}
+			res := tx.Where("name = ?", name).Delete(&authz.Role{})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return authz.ErrRoleNotFound
+			}
+			return nil
+		})
+		if err != nil {
+			auditLogger.Printf("[AUDIT] [FAIL] Deleção papel | name=%s | erro=%v", name, err)
+			switch {
+			case errors.Is(err, authz.ErrRoleNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			case errors.Is(err, errRoleInUse):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			}
+			_ = audit.Record(c, db, audit.Failed(audit.ActionRoleDelete, audit.ResourceRole, name, audit.CodeForStatus(c.Writer.Status())).Detailf("name=%s erro=%v", name, err))
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Deleção papel | name=%s", name)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionRoleDelete, audit.ResourceRole, name).Detailf("name=%s", name))
+		c.JSON(http.StatusNoContent, nil)
+	})
+}
+
+// RoleMFAInput liga ou desliga a exigência de MFA de um papel
+type RoleMFAInput struct {
+	Required *bool `json:"required" binding:"required"`
+}
+
+var errRoleInUse = errors.New("papel atribuído a usuários")
+
+func roleResponse(role authz.Role) gin.H {
+	return gin.H{"name": role.Name, "permissions": role.PermissionList()}
+}
+
+func rolesResponse(roles []authz.Role) []gin.H {
+	list := make([]gin.H, 0, len(roles))
+	for _, role := range roles {
+		list = append(list, roleResponse(role))
+	}
+	return list
+}
@@ -1,22 +1,95 @@
 package auth
 
 import (
+	"api-vault/internal/audit"
 	"api-vault/internal/crypto"
 	"errors"
+	"sync"
 
 	"gorm.io/gorm"
 )
 
+// ErrInvalidCredentials é a única resposta para username inexistente ou senha errada
+var ErrInvalidCredentials = errors.New("usuário ou senha inválidos")
+
+// dummyHash é comparado quando o username não existe, para que a resposta leve o
+// mesmo tempo de uma senha errada e não revele quais usernames existem
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := crypto.HashPassword("api-vault-dummy-password")
+	return hash
+})
+
+// ErrUserDisabled indica usuário desativado por um admin; só é revelado a quem acerta a senha
+var ErrUserDisabled = errors.New("usuário desativado")
+
 // AuthenticateUser valida usuário/senha e retorna o usuário se válido
 func AuthenticateUser(conn *gorm.DB, username, password string) (*User, error) {
 	var user User
 	result := conn.Where("username = ?", username).First(&user)
-	if result.Error != nil {
-		return nil, errors.New("usuário não encontrado")
+	// Contas de serviço e usuários criados pelo SSO não têm senha; respondem como username inexistente
+	if result.Error != nil || user.ServiceAccount || user.Password == "" {
+		crypto.CheckPasswordHash(password, dummyHash())
+		return nil, ErrInvalidCredentials
 	}
 	// Compara o hash da senha usando pacote crypto
 	if !crypto.CheckPasswordHash(password, user.Password) {
-		return nil, errors.New("senha incorreta")
+		return nil, ErrInvalidCredentials
+	}
+	if user.Disabled {
+		return nil, ErrUserDisabled
+	}
+	return &user, nil
+}
+
+// ErrAdminExists indica que o bootstrap já foi feito e não pode ser repetido
+var ErrAdminExists = errors.New("já existe um admin cadastrado")
+
+// ValidateCredentials aplica as regras de username e senha usadas no cadastro
+func ValidateCredentials(username, password string) error {
+	if len(password) < 6 {
+		return errors.New("Senha deve ter pelo menos 6 caracteres")
+	}
+	if len(username) < 3 || len(username) > 32 {
+		return errors.New("Username inválido")
+	}
+	return nil
+}
+
+// HasAdmin informa se já existe algum usuário com role admin
+func HasAdmin(conn *gorm.DB) (bool, error) {
+	var count int64
+	if err := conn.Model(&User{}).Where("role = ?", "admin").Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// CreateInitialAdmin cria o primeiro admin; falha com ErrAdminExists se já houver um
+func CreateInitialAdmin(conn *gorm.DB, username, password string) (*User, error) {
+	if err := ValidateCredentials(username, password); err != nil {
+		return nil, err
+	}
+	hash, err := crypto.HashPassword(password)
+	if err != nil {
+		return nil, errors.New("erro ao gerar hash da senha")
+	}
+	user := User{Username: username, Password: hash, Role: "admin"}
+	err = conn.Transaction(func(tx *gorm.DB) error {
+		exists, err := HasAdmin(tx)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrAdminExists
+		}
+		return tx.Create(&user).Error
+	})
+	if err != nil {
+		auditLogger.Printf("[AUDIT] [FAIL] Bootstrap admin | username=%s | erro=%v", username, err)
+		_ = audit.SaveEvent(conn, username, audit.Failed(audit.ActionBootstrapAdmin, audit.ResourceUser, nil, audit.CodeInternal).Detailf("%v", err))
+		return nil, err
 	}
+	auditLogger.Printf("[AUDIT] [OK] Bootstrap admin | username=%s | id=%d", user.Username, user.ID)
+	_ = audit.SaveEvent(conn, user.Username, audit.Succeeded(audit.ActionBootstrapAdmin, audit.ResourceUser, user.ID).Detailf("id=%d", user.ID))
 	return &user, nil
 }
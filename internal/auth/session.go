@@ -0,0 +1,284 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api-vault/internal/audit"
+	"api-vault/internal/authz"
+	"api-vault/internal/config"
+	"api-vault/internal/middleware"
+	"api-vault/internal/tenant"
+)
+
+// Session é um login ativo; o refresh token dela é guardado apenas como hash
+type Session struct {
+	ID          uint   `gorm:"primaryKey"`
+	UserID      uint   `gorm:"not null;index"`
+	OrgID       uint   `gorm:"index"`
+	RefreshHash string `gorm:"not null;uniqueIndex"`
+	ExpiresAt   time.Time
+	RevokedAt   *time.Time
+	CreatedAt   time.Time
+	LastUsedAt  time.Time
+}
+
+// RevokedToken é a denylist de JWTs revogados antes de expirar, por JTI
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// ErrInvalidRefreshToken cobre refresh token desconhecido, expirado ou de sessão revogada
+var ErrInvalidRefreshToken = errors.New("refresh token inválido ou expirado")
+
+// newOpaqueToken gera n bytes aleatórios codificados em base64url sem padding
+func newOpaqueToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashRefreshToken é o que fica no banco; o valor original só é conhecido pelo cliente
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession abre uma sessão para o usuário e devolve o refresh token em claro
+func CreateSession(conn *gorm.DB, user *User) (*Session, string, error) {
+	refresh, err := newOpaqueToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	session := Session{
+		UserID:      user.ID,
+		OrgID:       user.OrgID,
+		RefreshHash: hashRefreshToken(refresh),
+		ExpiresAt:   now.Add(config.GetRefreshTokenTTL()),
+		LastUsedAt:  now,
+	}
+	if err := conn.Create(&session).Error; err != nil {
+		return nil, "", err
+	}
+	return &session, refresh, nil
+}
+
+// RotateSession troca o refresh token da sessão por um novo (uso único) e devolve o usuário dono
+func RotateSession(conn *gorm.DB, refresh string) (*User, *Session, string, error) {
+	next, err := newOpaqueToken(32)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	var session Session
+	var user User
+	err = conn.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("refresh_hash = ?", hashRefreshToken(refresh)).First(&session).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+		if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+		if err := tx.First(&user, session.UserID).Error; err != nil || user.Disabled {
+			return ErrInvalidRefreshToken
+		}
+		// A condição no hash antigo evita que duas renovações concorrentes usem o mesmo token
+		res := tx.Model(&Session{}).
+			Where("id = ? AND refresh_hash = ?", session.ID, session.RefreshHash).
+			Updates(map[string]interface{}{"refresh_hash": hashRefreshToken(next), "last_used_at": time.Now()})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvalidRefreshToken
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return &user, &session, next, nil
+}
+
+// RevokeSession encerra uma sessão; o refresh token dela deixa de funcionar
+// e os JWTs emitidos por ela são recusados pelo middleware
+func RevokeSession(conn *gorm.DB, sessionID uint) error {
+	return conn.Model(&Session{}).Where("id = ? AND revoked_at IS NULL", sessionID).Update("revoked_at", time.Now()).Error
+}
+
+// RevokeUserSessions encerra todas as sessões do usuário (remoção ou desativação)
+// e marca o instante, para recusar também os JWTs sem sessão emitidos antes dele
+func RevokeUserSessions(conn *gorm.DB, userID uint) error {
+	now := time.Now()
+	if err := conn.Model(&Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	// O iat do JWT tem resolução de segundos: quem entra no mesmo segundo continua válido
+	return conn.Model(&User{}).Where("id = ?", userID).Update("sessions_revoked_at", now.Truncate(time.Second)).Error
+}
+
+// RevokeJTI coloca o JWT na denylist até ele expirar e limpa as entradas já vencidas
+func RevokeJTI(conn *gorm.DB, jti string, expiresAt time.Time) error {
+	if err := conn.Where("expires_at < ?", time.Now()).Delete(&RevokedToken{}).Error; err != nil {
+		return err
+	}
+	return conn.Where(RevokedToken{JTI: jti}).Attrs(RevokedToken{ExpiresAt: expiresAt}).FirstOrCreate(&RevokedToken{}).Error
+}
+
+// tokenRevoked informa se o JWT foi revogado pelo JTI, pela sessão que o emitiu ou
+// por uma revogação de todas as sessões do usuário depois de issuedAt (Unix).
+// Erros de banco contam como revogado.
+func tokenRevoked(conn *gorm.DB, jti string, sessionID, userID uint, issuedAt int64) bool {
+	if jti != "" {
+		var count int64
+		if err := conn.Model(&RevokedToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil || count > 0 {
+			return true
+		}
+	}
+	if sessionID != 0 {
+		var session Session
+		if err := conn.First(&session, sessionID).Error; err != nil {
+			return true
+		}
+		if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+			return true
+		}
+	}
+	var user User
+	err := conn.Select("id", "sessions_revoked_at").First(&user, userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return user.SessionsRevokedAt != nil && issuedAt < user.SessionsRevokedAt.Unix()
+}
+
+// RefreshInput é o corpo de POST /auth/refresh
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+func registerSessionRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
+	// Renovar JWT com refresh token (público; o refresh token é de uso único)
+	// @Summary Renovar sessão
+	// @Description Troca o refresh token por um novo JWT e um novo refresh token
+	// @Tags sessões
+	// @Accept json
+	// @Produce json
+	// @Param refresh body RefreshInput true "Refresh token"
+	// @Success 200 {object} gin.H
+	// @Failure 400,401,500 {object} gin.H
+	// @Router /auth/refresh [post]
+	r.POST("/auth/refresh", func(c *gin.Context) {
+		var input RefreshInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		user, session, refresh, err := RotateSession(conn, input.RefreshToken)
+		if err != nil {
+			auditLogger.Printf("[AUDIT] [FAIL] Renovação sessão | erro=%v", err)
+			if errors.Is(err, ErrInvalidRefreshToken) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		user.SessionID = session.ID
+		if user.MFAPending, err = mfaEnrollmentPending(conn, user); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		token, expire, err := IssueToken(mw, user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Renovação sessão | user=%s | sessao=%d", user.Username, session.ID)
+		c.JSON(http.StatusOK, gin.H{
+			"code":          http.StatusOK,
+			"token":         token,
+			"expire":        expire.Format(time.RFC3339),
+			"refresh_token": refresh,
+		})
+	})
+
+	// Logout: revoga o JWT atual e a sessão dele
+	// @Summary Logout
+	// @Description Coloca o JWT na denylist e encerra a sessão, invalidando o refresh token
+	// @Tags sessões
+	// @Success 204 {object} nil
+	// @Failure 401,500 {object} gin.H
+	// @Router /logout [post]
+	r.POST("/logout", mw.MiddlewareFunc(), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		claims := jwt.ExtractClaims(c)
+		user := CurrentUser(c)
+		jti, _ := claims[jtiClaim].(string)
+		exp, _ := claims["exp"].(float64)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if jti != "" {
+				if err := RevokeJTI(tx, jti, time.Unix(int64(exp), 0)); err != nil {
+					return err
+				}
+			}
+			if user.SessionID != 0 {
+				return RevokeSession(tx, user.SessionID)
+			}
+			return nil
+		})
+		if err != nil {
+			auditLogger.Printf("[AUDIT] [FAIL] Logout | user=%s | erro=%v", user.Username, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionLogout, audit.ResourceSession, user.SessionID, audit.CodeInternal).Detailf("%v", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Logout | user=%s | sessao=%d", user.Username, user.SessionID)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionLogout, audit.ResourceSession, user.SessionID).Detailf("sessao=%d", user.SessionID))
+		c.JSON(http.StatusNoContent, nil)
+	})
+
+	// Revogar todas as sessões de um usuário (protegido, users:write)
+	// @Summary Revogar sessões
+	// @Description Encerra todas as sessões do usuário; os JWTs delas deixam de ser aceitos
+	// @Tags sessões
+	// @Param id path int true "ID do usuário"
+	// @Success 204 {object} nil
+	// @Failure 400,403,404,500 {object} gin.H
+	// @Router /users/{id}/sessions [delete]
+	r.DELETE("/users/:id/sessions", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		user, ok := loadUser(c, db)
+		if !ok {
+			return
+		}
+		if err := RevokeUserSessions(db, user.ID); err != nil {
+			auditLogger.Printf("[AUDIT] [FAIL] Revogação sessões | id=%d | erro=%v", user.ID, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionSessionsRevoke, audit.ResourceUser, user.ID, audit.CodeInternal).Detailf("id=%d erro=%v", user.ID, err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		auditLogger.Printf("[AUDIT] [OK] Revogação sessões | id=%d | username=%s", user.ID, user.Username)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionSessionsRevoke, audit.ResourceUser, user.ID).Detailf("id=%d username=%s", user.ID, user.Username))
+		c.JSON(http.StatusNoContent, nil)
+	})
+}
@@ -1,8 +1,29 @@
 package auth
 
+import "time"
+
 type User struct {
 	ID       uint   `gorm:"primaryKey"`
 	Username string `gorm:"not null;unique"`
-	Password string `gorm:"not null"`
-	Role     string `gorm:"not null"` // admin, user
+	Password string `gorm:"not null" json:"-" audit:"secret"` // hash bcrypt; nunca serializado
+	Role     string `gorm:"not null"`                         // admin, user ou papel customizado
+	OrgID    uint   `gorm:"index"`
+	// Conta de serviço: sem senha, autentica apenas com API keys
+	ServiceAccount bool `gorm:"not null;default:false"`
+	// Desativado: não entra por senha, SSO, refresh ou API key
+	Disabled bool `gorm:"not null;default:false"`
+	// TOTP: ativo só após a confirmação do primeiro código
+	MFAEnabled  bool   `gorm:"not null;default:false"`
+	MFASecret   string `json:"-" audit:"secret"` // semente cifrada, vinculada ao ID
+	MFALastStep uint64 `json:"-"`                // último passo TOTP aceito, contra reutilização do código
+	// Última revogação de todas as sessões: JWTs emitidos antes dela são recusados,
+	// inclusive os sem sessão (API keys, emitidos antes das sessões)
+	SessionsRevokedAt *time.Time `json:"-"`
+	// Sessão do JWT atual; não é persistido
+	SessionID uint `gorm:"-" json:"-"`
+	// Papel exige MFA e o TOTP ainda não foi cadastrado; não é persistido
+	MFAPending bool `gorm:"-" json:"-"`
+	// API key usada na requisição e os escopos dela; não são persistidos
+	APIKeyID uint     `gorm:"-" json:"-"`
+	Scopes   []string `gorm:"-" json:"-"`
 }
@@ -0,0 +1,355 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api-vault/internal/audit"
+	"api-vault/internal/authz"
+	"api-vault/internal/crypto"
+	"api-vault/internal/middleware"
+	"api-vault/internal/tenant"
+)
+
+// UserPatch é o corpo de PATCH /users/:id; campos ausentes não mudam
+type UserPatch struct {
+	Username *string `json:"username"`
+	Role     *string `json:"role"`
+}
+
+// PasswordReset é o corpo para um admin definir a senha de outro usuário
+type PasswordReset struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// PasswordChange é o corpo para o próprio usuário trocar a senha
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// auditUserChange registra a alteração de um usuário com quem fez (ator da requisição), em quem (target)
+// e os campos alterados
+func auditUserChange(c *gin.Context, db *gorm.DB, action audit.Action, label string, target *User, err error, changes audit.Changes, details string) {
+	actor := audit.ActorFrom(c).Username
+	if err != nil {
+		auditLogger.Printf("[AUDIT] [FAIL] %s | ator=%s | alvo=%s | id=%d | erro=%v", label, actor, target.Username, target.ID, err)
+		_ = audit.Record(c, db, audit.Failed(action, audit.ResourceUser, target.ID, userErrorCode(err)).Detailf("alvo=%s id=%d erro=%v", target.Username, target.ID, err))
+		return
+	}
+	auditLogger.Printf("[AUDIT] [OK] %s | ator=%s | alvo=%s | id=%d %s", label, actor, target.Username, target.ID, details)
+	_ = audit.Record(c, db, audit.Succeeded(action, audit.ResourceUser, target.ID).WithChanges(changes).Detailf("alvo=%s id=%d %s", target.Username, target.ID, details))
+}
+
+// userErrorCode classifica a falha de uma alteração de usuário
+func userErrorCode(err error) audit.ErrorCode {
+	switch {
+	case errors.Is(err, ErrInvalidCredentials):
+		return audit.CodeUnauthorized
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return audit.CodeConflict
+	}
+	return audit.CodeInternal
+}
+
+// loadUser busca o usuário da rota na organização do chamador
+func loadUser(c *gin.Context, db *gorm.DB) (*User, bool) {
+	id, ok := middleware.ParamID(c, "id")
+	if !ok {
+		return nil, false
+	}
+	var user User
+	if err := db.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+// setDisabled desativa ou reativa o usuário; desativar encerra as sessões e revoga as API keys
+func setDisabled(db *gorm.DB, user *User, disabled bool) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("disabled", disabled).Error; err != nil {
+			return err
+		}
+		if !disabled {
+			return nil
+		}
+		if err := RevokeUserSessions(tx, user.ID); err != nil {
+			return err
+		}
+		return RevokeUserAPIKeys(tx, user.ID)
+	})
+}
+
+// setPassword grava o hash da nova senha e encerra as sessões do usuário, exceto keepSession
+func setPassword(db *gorm.DB, user *User, password string, keepSession uint) error {
+	hash, err := crypto.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("password", hash).Error; err != nil {
+			return err
+		}
+		return tx.Model(&Session{}).
+			Where("user_id = ? AND id <> ? AND revoked_at IS NULL", user.ID, keepSession).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+func registerUserRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
+	// @Summary Usuário autenticado
+	// @Description Dados e permissões efetivas de quem chama
+	// @Tags usuários
+	// @Produce json
+	// @Success 200 {object} gin.H
+	// @Router /me [get]
+	r.GET("/me", mw.MiddlewareFunc(), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		var user User
+		if err := db.First(&user, CurrentUser(c).ID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"user": user, "permissions": middleware.Permissions(c, conn)})
+	})
+
+	// @Summary Trocar a própria senha
+	// @Description Exige a senha atual; encerra as demais sessões do usuário
+	// @Tags usuários
+	// @Accept json
+	// @Param password body PasswordChange true "Senhas"
+	// @Success 204 {object} nil
+	// @Failure 400,401,409,500 {object} gin.H
+	// @Router /me/password [put]
+	r.PUT("/me/password", mw.MiddlewareFunc(), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		current := CurrentUser(c)
+		var input PasswordChange
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		var user User
+		if err := db.First(&user, current.ID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if user.Password == "" {
+			c.JSON(http.StatusConflict, gin.H{"error": "Usuário sem senha local"})
+			return
+		}
+		if !crypto.CheckPasswordHash(input.CurrentPassword, user.Password) {
+			auditUserChange(c, db, audit.ActionPasswordChange, "Troca senha", &user, ErrInvalidCredentials, nil, "")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Senha atual incorreta"})
+			return
+		}
+		if err := ValidateCredentials(user.Username, input.NewPassword); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		before := user
+		err := setPassword(db, &user, input.NewPassword, current.SessionID)
+		auditUserChange(c, db, audit.ActionPasswordChange, "Troca senha", &user, err, audit.Diff(before, user), "")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNoContent, nil)
+	})
+
+	// @Summary Detalhar usuário
+	// @Tags usuários
+	// @Produce json
+	// @Param id path int true "ID do usuário"
+	// @Success 200 {object} User
+	// @Failure 404 {object} gin.H
+	// @Router /users/{id} [get]
+	r.GET("/users/:id", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersRead), func(c *gin.Context) {
+		user, ok := loadUser(c, tenant.Scoped(c, conn))
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, user)
+	})
+
+	// @Summary Alterar usuário
+	// @Description Altera username e/ou papel; trocar o papel encerra as sessões do usuário
+	// @Tags usuários
+	// @Accept json
+	// @Produce json
+	// @Param id path int true "ID do usuário"
+	// @Param user body UserPatch true "Campos a alterar"
+	// @Success 200 {object} User
+	// @Failure 400,403,404,409 {object} gin.H
+	// @Router /users/{id} [patch]
+	r.PATCH("/users/:id", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		user, ok := loadUser(c, db)
+		if !ok {
+			return
+		}
+		if !canManageUser(c, db, user) {
+			return
+		}
+		var input UserPatch
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		changes := map[string]interface{}{}
+		details := ""
+		if input.Username != nil && *input.Username != user.Username {
+			if len(*input.Username) < 3 || len(*input.Username) > 32 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Username inválido"})
+				return
+			}
+			changes["username"] = *input.Username
+			details += fmt.Sprintf("username=%s->%s ", user.Username, *input.Username)
+		}
+		if input.Role != nil && *input.Role != user.Role {
+			if exists, err := authz.RoleExists(db, *input.Role); err != nil || !exists {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Role inexistente: " + *input.Role})
+				return
+			}
+			if !canGrantRole(c, db, *input.Role) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Não é possível conceder um papel com permissões que você não possui"})
+				return
+			}
+			changes["role"] = *input.Role
+			details += fmt.Sprintf("role=%s->%s ", user.Role, *input.Role)
+		}
+		if len(changes) == 0 {
+			c.JSON(http.StatusOK, user)
+			return
+		}
+		target := *user
+		// JWTs e refresh tokens carregam o papel antigo: trocar o papel encerra as sessões
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(user).Updates(changes).Error; err != nil {
+				return err
+			}
+			if _, ok := changes["role"]; ok {
+				return RevokeUserSessions(tx, user.ID)
+			}
+			return nil
+		})
+		if err != nil {
+			auditUserChange(c, db, audit.ActionUserUpdate, "Alteração usuário", &target, err, nil, "")
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		auditUserChange(c, db, audit.ActionUserUpdate, "Alteração usuário", &target, nil, audit.Diff(&target, user), strings.TrimSpace(details))
+		c.JSON(http.StatusOK, user)
+	})
+
+	// @Summary Desativar usuário
+	// @Description Bloqueia login, refresh e API keys; encerra as sessões
+	// @Tags usuários
+	// @Param id path int true "ID do usuário"
+	// @Success 204 {object} nil
+	// @Failure 403,404,409,500 {object} gin.H
+	// @Router /users/{id}/disable [post]
+	r.POST("/users/:id/disable", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		user, ok := loadUser(c, db)
+		if !ok {
+			return
+		}
+		if !canManageUser(c, db, user) {
+			return
+		}
+		actor := CurrentUser(c)
+		if user.ID == actor.ID {
+			c.JSON(http.StatusConflict, gin.H{"error": "Não é possível desativar o próprio usuário"})
+			return
+		}
+		before := *user
+		err := setDisabled(db, user, true)
+		auditUserChange(c, db, audit.ActionUserDisable, "Desativação usuário", user, err, audit.Diff(&before, user), "")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNoContent, nil)
+	})
+
+	// @Summary Reativar usuário
+	// @Tags usuários
+	// @Param id path int true "ID do usuário"
+	// @Success 204 {object} nil
+	// @Failure 403,404,500 {object} gin.H
+	// @Router /users/{id}/enable [post]
+	r.POST("/users/:id/enable", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		user, ok := loadUser(c, db)
+		if !ok {
+			return
+		}
+		if !canManageUser(c, db, user) {
+			return
+		}
+		before := *user
+		err := setDisabled(db, user, false)
+		auditUserChange(c, db, audit.ActionUserEnable, "Reativação usuário", user, err, audit.Diff(&before, user), "")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNoContent, nil)
+	})
+
+	// @Summary Redefinir senha de usuário
+	// @Description Admin define uma nova senha; encerra as sessões e o bloqueio de login do usuário
+	// @Tags usuários
+	// @Accept json
+	// @Param id path int true "ID do usuário"
+	// @Param password body PasswordReset true "Nova senha"
+	// @Success 204 {object} nil
+	// @Failure 400,403,404,409,500 {object} gin.H
+	// @Router /users/{id}/password [put]
+	r.PUT("/users/:id/password", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermUsersWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		user, ok := loadUser(c, db)
+		if !ok {
+			return
+		}
+		var input PasswordReset
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if user.ServiceAccount {
+			c.JSON(http.StatusConflict, gin.H{"error": "Contas de serviço não têm senha"})
+			return
+		}
+		// Quem redefine a senha passa a poder entrar como o usuário: não vale para papéis acima do seu
+		if !canGrantRole(c, db, user.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Não é possível redefinir a senha de um papel com permissões que você não possui"})
+			return
+		}
+		if err := ValidateCredentials(user.Username, input.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		before := *user
+		err := setPassword(db, user, input.Password, 0)
+		if err == nil {
+			err = UnlockUser(conn, user.Username)
+		}
+		auditUserChange(c, db, audit.ActionPasswordReset, "Redefinição senha", user, err, audit.Diff(&before, user), "")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNoContent, nil)
+	})
+}
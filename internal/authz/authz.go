@@ -0,0 +1,195 @@
+package authz
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Permissões nomeadas verificadas pelas rotas
+const (
+	PermIntegrationsRead   = "integrations:read"
+	PermIntegrationsWrite  = "integrations:write"
+	PermIntegrationsDelete = "integrations:delete"
+	PermIntegrationsReveal = "integrations:reveal"
+	PermIntegrationsAll    = "integrations:all" // ignora as ACLs por integração
+	PermTokensRead         = "tokens:read"
+	PermTokensWrite        = "tokens:write"
+	PermTokensDelete       = "tokens:delete"
+	PermTokensReveal       = "tokens:reveal"
+	PermTokensUse          = "tokens:use" // obter access token decifrado para chamar o parceiro
+	PermUsersRead          = "users:read"
+	PermUsersWrite         = "users:write"
+	PermRolesRead          = "roles:read"
+	PermRolesWrite         = "roles:write"
+	PermAuditRead          = "audit:read"
+	PermKeysRotate         = "keys:rotate" // de sistema: atua sobre todas as organizações
+)
+
+// AllPermissions lista as permissões que os papéis de uma organização podem conceder
+var AllPermissions = []string{
+	PermIntegrationsRead, PermIntegrationsWrite, PermIntegrationsDelete, PermIntegrationsReveal, PermIntegrationsAll,
+	PermTokensRead, PermTokensWrite, PermTokensDelete, PermTokensReveal, PermTokensUse,
+	PermUsersRead, PermUsersWrite,
+	PermRolesRead, PermRolesWrite,
+	PermAuditRead,
+}
+
+// SystemPermissions agem sobre os dados de todas as organizações (re-cifragem,
+// chave de assinatura dos JWTs). Não entram em papéis: só o admin da
+// organização de sistema (SYSTEM_ORG_ID) as recebe.
+var SystemPermissions = []string{PermKeysRotate}
+
+// ScopesClaim é a claim do JWT que restringe as permissões do papel (API keys com escopo)
+const ScopesClaim = "scopes"
+
+// Papéis embutidos; não ficam no banco e não podem ser alterados
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+var builtinRoles = map[string][]string{
+	RoleAdmin: AllPermissions,
+	RoleUser: {
+		PermIntegrationsRead, PermIntegrationsWrite,
+		PermTokensRead, PermTokensWrite, PermTokensUse,
+	},
+}
+
+var (
+	ErrRoleNotFound      = errors.New("papel não encontrado")
+	ErrBuiltinRole       = errors.New("papel embutido não pode ser alterado")
+	ErrUnknownPermission = errors.New("permissão desconhecida")
+	ErrSystemPermission  = errors.New("permissão de sistema não pode ser concedida a papéis")
+)
+
+// Role é um papel customizado com um conjunto de permissões
+type Role struct {
+	ID          uint   `gorm:"primaryKey"`
+	OrgID       uint   `gorm:"uniqueIndex:idx_roles_org_name"`
+	Name        string `gorm:"not null;uniqueIndex:idx_roles_org_name"`
+	Permissions string `gorm:"not null"` // separadas por vírgula
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// PermissionList devolve as permissões do papel como lista
+func (r Role) PermissionList() []string {
+	if r.Permissions == "" {
+		return []string{}
+	}
+	return strings.Split(r.Permissions, ",")
+}
+
+// SetPermissions valida e grava a lista de permissões do papel
+func (r *Role) SetPermissions(perms []string) error {
+	if err := ValidatePermissions(perms); err != nil {
+		return err
+	}
+	unique := map[string]bool{}
+	list := []string{}
+	for _, p := range perms {
+		if !unique[p] {
+			unique[p] = true
+			list = append(list, p)
+		}
+	}
+	sort.Strings(list)
+	r.Permissions = strings.Join(list, ",")
+	return nil
+}
+
+// ValidatePermissions garante que todas as permissões existem
+func ValidatePermissions(perms []string) error {
+	for _, p := range perms {
+		if Contains(SystemPermissions, p) {
+			return fmt.Errorf("%w: %s", ErrSystemPermission, p)
+		}
+		if !isKnown(p) {
+			return fmt.Errorf("%w: %s", ErrUnknownPermission, p)
+		}
+	}
+	return nil
+}
+
+// IsBuiltin informa se o nome pertence a um papel embutido
+func IsBuiltin(name string) bool {
+	_, ok := builtinRoles[name]
+	return ok
+}
+
+// BuiltinRoles devolve os papéis embutidos no mesmo formato dos customizados
+func BuiltinRoles() []Role {
+	list := []Role{}
+	for name, perms := range builtinRoles {
+		role := Role{Name: name}
+		_ = role.SetPermissions(perms)
+		list = append(list, role)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// PermissionsFor resolve as permissões de um papel, embutido ou customizado
+func PermissionsFor(conn *gorm.DB, roleName string) ([]string, error) {
+	if perms, ok := builtinRoles[roleName]; ok {
+		return perms, nil
+	}
+	var role Role
+	if err := conn.Where("name = ?", roleName).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	return role.PermissionList(), nil
+}
+
+// RoleExists informa se o papel pode ser atribuído a usuários
+func RoleExists(conn *gorm.DB, roleName string) (bool, error) {
+	_, err := PermissionsFor(conn, roleName)
+	if errors.Is(err, ErrRoleNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Contains informa se a lista concede a permissão
+func Contains(perms []string, perm string) bool {
+	for _, p := range perms {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// Intersect devolve as permissões de perms que também estão em scopes
+func Intersect(perms, scopes []string) []string {
+	list := []string{}
+	for _, p := range perms {
+		if Contains(scopes, p) {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+// CanGrant impede escalonamento: só se concede um papel cujas permissões o concedente já tem
+func CanGrant(granter, granted []string) bool {
+	for _, p := range granted {
+		if !Contains(granter, p) {
+			return false
+		}
+	}
+	return true
+}
+
+func isKnown(perm string) bool {
+	return Contains(AllPermissions, perm)
+}
@@ -0,0 +1,39 @@
+package authz
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// MFAPolicy marca um papel (embutido ou customizado) cujos usuários precisam de TOTP
+type MFAPolicy struct {
+	OrgID uint   `gorm:"primaryKey;autoIncrement:false"`
+	Role  string `gorm:"primaryKey"`
+}
+
+// RequiresMFA informa se o papel exige MFA na organização da conexão
+func RequiresMFA(conn *gorm.DB, roleName string) (bool, error) {
+	var policy MFAPolicy
+	err := conn.Where("role = ?", roleName).First(&policy).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SetMFARequired liga ou desliga a exigência de MFA para o papel
+func SetMFARequired(conn *gorm.DB, roleName string, required bool) error {
+	if !required {
+		return conn.Where("role = ?", roleName).Delete(&MFAPolicy{}).Error
+	}
+	policy := MFAPolicy{Role: roleName}
+	return conn.Where("role = ?", roleName).FirstOrCreate(&policy).Error
+}
+
+// MFARoles lista os papéis que exigem MFA
+func MFARoles(conn *gorm.DB) ([]string, error) {
+	roles := []string{}
+	err := conn.Model(&MFAPolicy{}).Order("role").Pluck("role", &roles).Error
+	return roles, err
+}
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"strings"
+	"time"
+
 	"github.com/spf13/viper"
 )
 
@@ -9,3 +12,238 @@ func GetPostgresDSN() string {
 	viper.AutomaticEnv()
 	return viper.GetString("POSTGRES_DSN")
 }
+
+// GetTokenRefreshInterval retorna de quanto em quanto tempo o refresher procura tokens a renovar
+func GetTokenRefreshInterval() time.Duration {
+	viper.SetDefault("TOKEN_REFRESH_INTERVAL", "1m")
+	viper.AutomaticEnv()
+	return viper.GetDuration("TOKEN_REFRESH_INTERVAL")
+}
+
+// GetTokenRefreshLead retorna com quanta antecedência do ExpiresAt um token deve ser renovado
+func GetTokenRefreshLead() time.Duration {
+	viper.SetDefault("TOKEN_REFRESH_LEAD", "5m")
+	viper.AutomaticEnv()
+	return viper.GetDuration("TOKEN_REFRESH_LEAD")
+}
+
+// GetTokenRefreshTimeout retorna o tempo máximo de uma renovação sob demanda, que não depende da requisição que a iniciou
+func GetTokenRefreshTimeout() time.Duration {
+	viper.SetDefault("TOKEN_REFRESH_TIMEOUT", "30s")
+	viper.AutomaticEnv()
+	return viper.GetDuration("TOKEN_REFRESH_TIMEOUT")
+}
+
+// GetOAuthRedirectURL retorna a URL de callback registrada nos provedores OAuth
+func GetOAuthRedirectURL() string {
+	viper.SetDefault("OAUTH_REDIRECT_URL", "http://localhost:8080/oauth/callback")
+	viper.AutomaticEnv()
+	return viper.GetString("OAUTH_REDIRECT_URL")
+}
+
+// GetOpenSignup indica se POST /users aceita cadastro sem autenticação (apenas role user)
+func GetOpenSignup() bool {
+	viper.SetDefault("OPEN_SIGNUP", false)
+	viper.AutomaticEnv()
+	return viper.GetBool("OPEN_SIGNUP")
+}
+
+// GetRefreshTokenTTL retorna por quanto tempo uma sessão pode ser renovada sem novo login
+func GetRefreshTokenTTL() time.Duration {
+	viper.SetDefault("REFRESH_TOKEN_TTL", "720h")
+	viper.AutomaticEnv()
+	return viper.GetDuration("REFRESH_TOKEN_TTL")
+}
+
+// GetJWTSigningAlg retorna o algoritmo de assinatura dos JWTs: HS256 (JWT_SECRET), RS256, ES256 ou EdDSA
+func GetJWTSigningAlg() string {
+	viper.SetDefault("JWT_SIGNING_ALG", "HS256")
+	viper.AutomaticEnv()
+	return viper.GetString("JWT_SIGNING_ALG")
+}
+
+// GetJWTDevMode permite subir com o JWT_SECRET padrão; apenas para desenvolvimento e testes
+func GetJWTDevMode() bool {
+	viper.SetDefault("JWT_DEV_MODE", false)
+	viper.AutomaticEnv()
+	return viper.GetBool("JWT_DEV_MODE")
+}
+
+// GetJWTKeyRotationInterval retorna a idade a partir da qual a chave de assinatura JWT é trocada
+func GetJWTKeyRotationInterval() time.Duration {
+	viper.SetDefault("JWT_KEY_ROTATION_INTERVAL", "720h")
+	viper.AutomaticEnv()
+	return viper.GetDuration("JWT_KEY_ROTATION_INTERVAL")
+}
+
+// GetLoginMaxAttempts retorna quantas senhas erradas seguidas bloqueiam um username
+func GetLoginMaxAttempts() int {
+	viper.SetDefault("LOGIN_MAX_ATTEMPTS", 5)
+	viper.AutomaticEnv()
+	return viper.GetInt("LOGIN_MAX_ATTEMPTS")
+}
+
+// GetLoginIPMaxAttempts retorna quantas falhas de login bloqueiam um IP, somando todos os usernames
+func GetLoginIPMaxAttempts() int {
+	viper.SetDefault("LOGIN_IP_MAX_ATTEMPTS", 20)
+	viper.AutomaticEnv()
+	return viper.GetInt("LOGIN_IP_MAX_ATTEMPTS")
+}
+
+// GetLoginLockoutBase retorna o primeiro bloqueio; cada nova falha após o limite dobra a duração
+func GetLoginLockoutBase() time.Duration {
+	viper.SetDefault("LOGIN_LOCKOUT_BASE", "1m")
+	viper.AutomaticEnv()
+	return viper.GetDuration("LOGIN_LOCKOUT_BASE")
+}
+
+// GetLoginLockoutMax retorna o teto do bloqueio e o tempo sem falhas que zera o contador
+func GetLoginLockoutMax() time.Duration {
+	viper.SetDefault("LOGIN_LOCKOUT_MAX", "1h")
+	viper.AutomaticEnv()
+	return viper.GetDuration("LOGIN_LOCKOUT_MAX")
+}
+
+// GetTrustedProxies retorna os proxies (IPs ou CIDRs, separados por vírgula) cujo X-Forwarded-For é aceito
+func GetTrustedProxies() []string {
+	viper.AutomaticEnv()
+	var proxies []string
+	for _, p := range strings.Split(viper.GetString("TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
+	}
+	return proxies
+}
+
+// GetOIDCIssuer retorna o issuer do provedor OpenID Connect, exatamente como ele o publica
+// (com ou sem barra final); vazio desliga o login SSO
+func GetOIDCIssuer() string {
+	viper.AutomaticEnv()
+	return viper.GetString("OIDC_ISSUER")
+}
+
+// GetOIDCClientID retorna o client_id da API no provedor OIDC
+func GetOIDCClientID() string {
+	viper.AutomaticEnv()
+	return viper.GetString("OIDC_CLIENT_ID")
+}
+
+// GetOIDCClientSecret retorna o client_secret da API no provedor OIDC
+func GetOIDCClientSecret() string {
+	viper.AutomaticEnv()
+	return viper.GetString("OIDC_CLIENT_SECRET")
+}
+
+// GetOIDCRedirectURL retorna a URL de callback do login SSO registrada no provedor
+func GetOIDCRedirectURL() string {
+	viper.SetDefault("OIDC_REDIRECT_URL", "http://localhost:8080/auth/oidc/callback")
+	viper.AutomaticEnv()
+	return viper.GetString("OIDC_REDIRECT_URL")
+}
+
+// GetOIDCScopes retorna os escopos pedidos ao provedor OIDC
+func GetOIDCScopes() string {
+	viper.SetDefault("OIDC_SCOPES", "openid profile email")
+	viper.AutomaticEnv()
+	return viper.GetString("OIDC_SCOPES")
+}
+
+// GetOIDCUsernameClaim retorna a claim do ID token usada como username local
+func GetOIDCUsernameClaim() string {
+	viper.SetDefault("OIDC_USERNAME_CLAIM", "preferred_username")
+	viper.AutomaticEnv()
+	return viper.GetString("OIDC_USERNAME_CLAIM")
+}
+
+// GetOIDCGroupsClaim retorna a claim do ID token com os grupos do usuário
+func GetOIDCGroupsClaim() string {
+	viper.SetDefault("OIDC_GROUPS_CLAIM", "groups")
+	viper.AutomaticEnv()
+	return viper.GetString("OIDC_GROUPS_CLAIM")
+}
+
+// GetOIDCRoleMapping retorna o mapeamento "grupo=papel" separado por vírgula; a ordem define a prioridade
+func GetOIDCRoleMapping() string {
+	viper.AutomaticEnv()
+	return viper.GetString("OIDC_ROLE_MAPPING")
+}
+
+// GetOIDCDefaultRole retorna o papel de quem não está em nenhum grupo mapeado; sem ele o login é recusado
+func GetOIDCDefaultRole() string {
+	viper.AutomaticEnv()
+	return viper.GetString("OIDC_DEFAULT_ROLE")
+}
+
+// GetAuditSyslogAddr retorna o host:porta do coletor syslog que recebe a auditoria; vazio desliga o sink
+func GetAuditSyslogAddr() string {
+	viper.AutomaticEnv()
+	return viper.GetString("AUDIT_SYSLOG_ADDR")
+}
+
+// GetAuditSyslogNetwork retorna o transporte do syslog: udp, tcp ou tls
+func GetAuditSyslogNetwork() string {
+	viper.SetDefault("AUDIT_SYSLOG_NETWORK", "udp")
+	viper.AutomaticEnv()
+	return viper.GetString("AUDIT_SYSLOG_NETWORK")
+}
+
+// GetAuditSyslogFormat retorna o formato da mensagem syslog: rfc5424 ou cef
+func GetAuditSyslogFormat() string {
+	viper.SetDefault("AUDIT_SYSLOG_FORMAT", "rfc5424")
+	viper.AutomaticEnv()
+	return viper.GetString("AUDIT_SYSLOG_FORMAT")
+}
+
+// GetAuditSyslogCAFile retorna o PEM das CAs aceitas no syslog via TLS; vazio usa as CAs do sistema
+func GetAuditSyslogCAFile() string {
+	viper.AutomaticEnv()
+	return viper.GetString("AUDIT_SYSLOG_CA_FILE")
+}
+
+// GetAuditWebhookURL retorna a URL que recebe cada entrada da auditoria via POST; vazio desliga o sink
+func GetAuditWebhookURL() string {
+	viper.AutomaticEnv()
+	return viper.GetString("AUDIT_WEBHOOK_URL")
+}
+
+// GetAuditWebhookSecret retorna o segredo do HMAC enviado em X-Audit-Signature; vazio não assina
+func GetAuditWebhookSecret() string {
+	viper.AutomaticEnv()
+	return viper.GetString("AUDIT_WEBHOOK_SECRET")
+}
+
+// GetAuditSinkBuffer retorna quantas entradas cada sink enfileira antes de desviá-las para a dead letter
+func GetAuditSinkBuffer() int {
+	viper.SetDefault("AUDIT_SINK_BUFFER", 1000)
+	viper.AutomaticEnv()
+	return viper.GetInt("AUDIT_SINK_BUFFER")
+}
+
+// GetAuditSinkMaxAttempts retorna quantas vezes cada entrega é tentada antes de ir para a dead letter
+func GetAuditSinkMaxAttempts() int {
+	viper.SetDefault("AUDIT_SINK_MAX_ATTEMPTS", 5)
+	viper.AutomaticEnv()
+	return viper.GetInt("AUDIT_SINK_MAX_ATTEMPTS")
+}
+
+// GetAuditSinkRetryInterval retorna de quanto em quanto tempo as dead letters são reenviadas
+func GetAuditSinkRetryInterval() time.Duration {
+	viper.SetDefault("AUDIT_SINK_RETRY_INTERVAL", "1m")
+	viper.AutomaticEnv()
+	return viper.GetDuration("AUDIT_SINK_RETRY_INTERVAL")
+}
+
+// GetSystemOrgID retorna a organização cujo admin recebe as permissões de sistema (keys:rotate)
+func GetSystemOrgID() uint {
+	viper.SetDefault("SYSTEM_ORG_ID", 1)
+	viper.AutomaticEnv()
+	return viper.GetUint("SYSTEM_ORG_ID")
+}
+
+// GetShutdownTimeout retorna quanto tempo o encerramento espera as requisições em andamento
+func GetShutdownTimeout() time.Duration {
+	viper.SetDefault("SHUTDOWN_TIMEOUT", "30s")
+	viper.AutomaticEnv()
+	return viper.GetDuration("SHUTDOWN_TIMEOUT")
+}
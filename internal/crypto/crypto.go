@@ -1,11 +1,13 @@
 package crypto
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"sync/atomic"
 
-	"crypto/aes"
-	"crypto/cipher"
+	"bytes"
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
@@ -31,7 +33,41 @@ func CheckPasswordHash(password, hash string) bool {
 	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
 }
 
-// getEncryptionKey retorna a chave de criptografia do ambiente
+// Formatos versionados: "<versão>:<id da chave mestra>:<chave de dados cifrada>:<dados cifrados>"
+const (
+	envelopeV1 = "v1" // sem dados associados
+	envelopeV2 = "v2" // vinculado a tabela, coluna e registro via dados associados do AES-GCM
+)
+
+var (
+	// ErrFieldRequired indica um cipherText vinculado que foi aberto sem informar o Field
+	ErrFieldRequired = errors.New("cipherText vinculado a um registro; use DecryptField")
+	// ErrUnboundCipherText indica um cipherText sem vínculo quando CRYPTO_REQUIRE_AAD está ativo
+	ErrUnboundCipherText = errors.New("cipherText sem vínculo ao registro; execute a recriptografia")
+)
+
+// MaskedValue substitui segredos nas respostas que não são de revelação explícita
+const MaskedValue = "********"
+
+// Unchanged indica que o segredo recebido numa atualização mantém o valor gravado:
+// campo omitido ou a máscara devolvida pela consulta
+func Unchanged(value string) bool {
+	return value == "" || value == MaskedValue
+}
+
+// Field identifica a coluna e o registro a que um segredo pertence. Usado como dados
+// associados, impede que um cipherText seja copiado para outra linha ou coluna.
+type Field struct {
+	Table    string
+	Column   string
+	RecordID uint
+}
+
+func (f Field) associatedData() []byte {
+	return []byte(fmt.Sprintf("%s:%s:%d", f.Table, f.Column, f.RecordID))
+}
+
+// getEncryptionKey retorna a chave legada do ambiente, usada nos cipherTexts sem versão
 func getEncryptionKey() ([]byte, error) {
 	key := os.Getenv("DATA_ENCRYPTION_KEY")
 	if len(key) != 32 {
@@ -40,54 +76,191 @@ func getEncryptionKey() ([]byte, error) {
 	return []byte(key), nil
 }
 
-// Encrypt criptografa texto plano usando AES-GCM
+// AuditMACKey retorna a chave HMAC que assina a cadeia de auditoria (AUDIT_HMAC_KEY,
+// 32 bytes em texto ou base64); nil quando não configurada
+func AuditMACKey() ([]byte, error) {
+	value := os.Getenv("AUDIT_HMAC_KEY")
+	if value == "" {
+		return nil, nil
+	}
+	key, err := parseMasterKey(value)
+	if err != nil {
+		return nil, fmt.Errorf("AUDIT_HMAC_KEY: %w", err)
+	}
+	return key, nil
+}
+
+// AuditExportKey retorna a chave HMAC que assina os manifestos das exportações de
+// auditoria (AUDIT_EXPORT_KEY, 32 bytes em texto ou base64); nil quando não configurada.
+// Os arquivos saem da API e são conferidos por terceiros, por isso não podem usar
+// AUDIT_HMAC_KEY: quem confere um arquivo não deve conseguir refazer a cadeia.
+func AuditExportKey() ([]byte, error) {
+	value := os.Getenv("AUDIT_EXPORT_KEY")
+	if value == "" {
+		return nil, nil
+	}
+	key, err := parseMasterKey(value)
+	if err != nil {
+		return nil, fmt.Errorf("AUDIT_EXPORT_KEY: %w", err)
+	}
+	if chain, err := AuditMACKey(); err == nil && bytes.Equal(key, chain) {
+		return nil, errors.New("AUDIT_EXPORT_KEY deve ser diferente de AUDIT_HMAC_KEY")
+	}
+	return key, nil
+}
+
+// Encrypt criptografa texto plano com envelope encryption: uma chave de dados
+// aleatória por registro (AES-GCM), cifrada pela chave mestra atual do KeyProvider
 func Encrypt(plainText string) (string, error) {
-	key, err := getEncryptionKey()
+	return encryptEnvelope(envelopeV1, plainText, nil)
+}
+
+// EncryptField criptografa como Encrypt, vinculando o resultado ao campo informado
+func EncryptField(plainText string, field Field) (string, error) {
+	return encryptEnvelope(envelopeV2, plainText, field.associatedData())
+}
+
+// Decrypt decriptografa texto cifrado sem vínculo, no formato versionado ou no legado sem versão
+func Decrypt(cipherText string) (string, error) {
+	switch version(cipherText) {
+	case envelopeV1:
+		return decryptEnvelope(cipherText, nil)
+	case envelopeV2:
+		return "", ErrFieldRequired
+	default:
+		return decryptLegacy(cipherText)
+	}
+}
+
+// boundOnly é ligado quando uma recriptografia terminou sem falhas: a partir
+// daí todo segredo de coluna vinculada já está no formato v2
+var boundOnly atomic.Bool
+
+// SetRequireAAD liga ou desliga a recusa de segredos sem vínculo em DecryptField
+func SetRequireAAD(required bool) {
+	boundOnly.Store(required)
+}
+
+// requireAAD aplica CRYPTO_REQUIRE_AAD quando definido; sem ele, vale SetRequireAAD
+func requireAAD() bool {
+	switch os.Getenv("CRYPTO_REQUIRE_AAD") {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return boundOnly.Load()
+}
+
+// DecryptField decriptografa um segredo do campo informado. Valores ainda sem vínculo
+// são aceitos enquanto a migração não terminou (ver SetRequireAAD); CRYPTO_REQUIRE_AAD
+// força a recusa (true) ou a aceitação (false).
+func DecryptField(cipherText string, field Field) (string, error) {
+	if version(cipherText) == envelopeV2 {
+		return decryptEnvelope(cipherText, field.associatedData())
+	}
+	if requireAAD() {
+		return "", ErrUnboundCipherText
+	}
+	return Decrypt(cipherText)
+}
+
+func encryptEnvelope(envelope, plainText string, additionalData []byte) (string, error) {
+	provider := currentProvider()
+	keyID, err := provider.CurrentKeyID()
 	if err != nil {
 		return "", err
 	}
-	block, err := aes.NewCipher(key)
-	if err != nil {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
 		return "", err
 	}
-	gcm, err := cipher.NewGCM(block)
+	wrappedKey, err := provider.WrapKey(keyID, dataKey)
 	if err != nil {
 		return "", err
 	}
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+	cipherData, err := seal(dataKey, []byte(plainText), additionalData)
+	if err != nil {
 		return "", err
 	}
-	cipherText := gcm.Seal(nonce, nonce, []byte(plainText), nil)
-	return base64.StdEncoding.EncodeToString(cipherText), nil
+	return strings.Join([]string{
+		envelope,
+		keyID,
+		base64.StdEncoding.EncodeToString(wrappedKey),
+		base64.StdEncoding.EncodeToString(cipherData),
+	}, ":"), nil
 }
 
-// Decrypt decriptografa texto cifrado usando AES-GCM
-func Decrypt(cipherText string) (string, error) {
-	key, err := getEncryptionKey()
+func decryptEnvelope(cipherText string, additionalData []byte) (string, error) {
+	parts := strings.Split(cipherText, ":")
+	if len(parts) != 4 {
+		return "", errors.New("cipherText em formato inválido")
+	}
+	keyID := parts[1]
+	wrappedKey, err := base64.StdEncoding.DecodeString(parts[2])
 	if err != nil {
 		return "", err
 	}
-	data, err := base64.StdEncoding.DecodeString(cipherText)
+	cipherData, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := currentProvider().UnwrapKey(keyID, wrappedKey)
 	if err != nil {
 		return "", err
 	}
-	block, err := aes.NewCipher(key)
+	plainText, err := open(dataKey, cipherData, additionalData)
 	if err != nil {
 		return "", err
 	}
-	gcm, err := cipher.NewGCM(block)
+	return string(plainText), nil
+}
+
+// decryptLegacy decriptografa o formato original (base64 de nonce+dados) com a DATA_ENCRYPTION_KEY
+func decryptLegacy(cipherText string) (string, error) {
+	key, err := getEncryptionKey()
 	if err != nil {
 		return "", err
 	}
-	nonceSize := gcm.NonceSize()
-	if len(data) < nonceSize {
-		return "", errors.New("cipherText muito curto")
+	data, err := base64.StdEncoding.DecodeString(cipherText)
+	if err != nil {
+		return "", err
 	}
-	nonce, cipherData := data[:nonceSize], data[nonceSize:]
-	plainText, err := gcm.Open(nil, nonce, cipherData, nil)
+	plainText, err := open(key, data, nil)
 	if err != nil {
 		return "", err
 	}
 	return string(plainText), nil
 }
+
+// version retorna a versão do formato do cipherText ("" para o legado)
+func version(cipherText string) string {
+	for _, v := range []string{envelopeV1, envelopeV2} {
+		if strings.HasPrefix(cipherText, v+":") {
+			return v
+		}
+	}
+	return ""
+}
+
+// IsBound indica se o cipherText está vinculado a um campo (formato v2)
+func IsBound(cipherText string) bool {
+	return version(cipherText) == envelopeV2
+}
+
+// KeyID retorna o ID da chave mestra que protege o cipherText ("" para o formato legado)
+func KeyID(cipherText string) string {
+	if version(cipherText) == "" {
+		return ""
+	}
+	parts := strings.SplitN(cipherText, ":", 3)
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[1]
+}
+
+// CurrentKeyID retorna o ID da chave mestra usada para cifrar novos dados
+func CurrentKeyID() (string, error) {
+	return currentProvider().CurrentKeyID()
+}
@@ -0,0 +1,131 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ID usado para a DATA_ENCRYPTION_KEY quando MASTER_KEYS não está configurada
+const defaultKeyID = "default"
+
+// Keyring reúne as chaves mestras conhecidas e indica qual delas protege novos dados.
+// Durante uma rotação várias chaves ficam ativas: a atual cifra, todas decifram.
+type Keyring struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+// LoadKeyring monta o keyring a partir do ambiente.
+// MASTER_KEYS tem o formato "id1:chave1,id2:chave2", com chaves de 32 bytes (texto ou base64),
+// e MASTER_KEY_ID escolhe a chave atual (padrão: a última da lista).
+// Sem MASTER_KEYS, a DATA_ENCRYPTION_KEY é usada como única chave mestra.
+func LoadKeyring() (*Keyring, error) {
+	kr := &Keyring{Keys: map[string][]byte{}}
+	if legacy := os.Getenv("DATA_ENCRYPTION_KEY"); len(legacy) == 32 {
+		kr.Keys[defaultKeyID] = []byte(legacy)
+		kr.Current = defaultKeyID
+	}
+
+	if spec := strings.TrimSpace(os.Getenv("MASTER_KEYS")); spec != "" {
+		for _, entry := range strings.Split(spec, ",") {
+			id, value, ok := strings.Cut(strings.TrimSpace(entry), ":")
+			if !ok || id == "" || strings.ContainsAny(id, ":.") {
+				return nil, fmt.Errorf("MASTER_KEYS: entrada inválida %q", entry)
+			}
+			key, err := parseMasterKey(value)
+			if err != nil {
+				return nil, fmt.Errorf("MASTER_KEYS: chave %q: %w", id, err)
+			}
+			kr.Keys[id] = key
+			kr.Current = id
+		}
+	}
+	if current := os.Getenv("MASTER_KEY_ID"); current != "" {
+		kr.Current = current
+	}
+
+	if kr.Current == "" {
+		return nil, errors.New("DATA_ENCRYPTION_KEY deve ter 32 bytes")
+	}
+	if _, ok := kr.Keys[kr.Current]; !ok {
+		return nil, fmt.Errorf("chave mestra atual %q não encontrada", kr.Current)
+	}
+	return kr, nil
+}
+
+// parseMasterKey aceita 32 bytes em texto puro ou codificados em base64
+func parseMasterKey(value string) ([]byte, error) {
+	if len(value) == 32 {
+		return []byte(value), nil
+	}
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("chave deve ter 32 bytes")
+	}
+	return key, nil
+}
+
+// CurrentKeyID implementa KeyProvider
+func (kr *Keyring) CurrentKeyID() (string, error) {
+	return kr.Current, nil
+}
+
+// WrapKey cifra uma chave de dados com a chave mestra indicada
+func (kr *Keyring) WrapKey(keyID string, dataKey []byte) ([]byte, error) {
+	master, ok := kr.Keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("chave mestra %q não encontrada", keyID)
+	}
+	return seal(master, dataKey, []byte(keyID))
+}
+
+// UnwrapKey decifra uma chave de dados com a chave mestra indicada
+func (kr *Keyring) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	master, ok := kr.Keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("chave mestra %q não encontrada", keyID)
+	}
+	return open(master, wrapped, []byte(keyID))
+}
+
+// seal cifra com AES-GCM e prefixa o nonce ao resultado
+func seal(key, plain, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plain, additionalData), nil
+}
+
+// open decifra um conteúdo produzido por seal
+func open(key, data, additionalData []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonceSize := gcm.NonceSize()
+	if len(data) < nonceSize {
+		return nil, errors.New("cipherText muito curto")
+	}
+	nonce, cipherData := data[:nonceSize], data[nonceSize:]
+	return gcm.Open(nil, nonce, cipherData, additionalData)
+}
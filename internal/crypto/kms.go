@@ -0,0 +1,120 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// KeyProvider protege as chaves de dados do envelope encryption.
+// Cada implementação decide onde ficam as chaves mestras (ambiente, arquivos, KMS remoto).
+type KeyProvider interface {
+	// CurrentKeyID retorna o ID da chave mestra usada para novos dados
+	CurrentKeyID() (string, error)
+	// WrapKey cifra uma chave de dados com a chave mestra indicada
+	WrapKey(keyID string, dataKey []byte) ([]byte, error)
+	// UnwrapKey decifra uma chave de dados cifrada por WrapKey
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+var (
+	providerMu sync.RWMutex
+	configured KeyProvider
+)
+
+// SetProvider define o KeyProvider usado por Encrypt/Decrypt; nil volta ao padrão (ambiente)
+func SetProvider(p KeyProvider) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	configured = p
+}
+
+func currentProvider() KeyProvider {
+	providerMu.RLock()
+	defer providerMu.RUnlock()
+	if configured != nil {
+		return configured
+	}
+	return EnvProvider{}
+}
+
+// ProviderFromEnv cria o KeyProvider escolhido em KMS_PROVIDER (env, file ou vault)
+func ProviderFromEnv() (KeyProvider, error) {
+	switch os.Getenv("KMS_PROVIDER") {
+	case "", "env":
+		return EnvProvider{}, nil
+	case "file":
+		return LoadKeyringFromDir(os.Getenv("KMS_KEY_DIR"))
+	case "vault":
+		return NewVaultTransitProvider(os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN"), os.Getenv("VAULT_TRANSIT_KEY"), nil)
+	default:
+		return nil, fmt.Errorf("KMS_PROVIDER desconhecido: %s", os.Getenv("KMS_PROVIDER"))
+	}
+}
+
+// EnvProvider lê as chaves mestras do ambiente a cada uso (MASTER_KEYS / DATA_ENCRYPTION_KEY)
+type EnvProvider struct{}
+
+func (EnvProvider) CurrentKeyID() (string, error) {
+	kr, err := LoadKeyring()
+	if err != nil {
+		return "", err
+	}
+	return kr.Current, nil
+}
+
+func (EnvProvider) WrapKey(keyID string, dataKey []byte) ([]byte, error) {
+	kr, err := LoadKeyring()
+	if err != nil {
+		return nil, err
+	}
+	return kr.WrapKey(keyID, dataKey)
+}
+
+func (EnvProvider) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	kr, err := LoadKeyring()
+	if err != nil {
+		return nil, err
+	}
+	return kr.UnwrapKey(keyID, wrapped)
+}
+
+// LoadKeyringFromDir monta um keyring a partir de um diretório: cada arquivo "<id>.key"
+// contém uma chave mestra (32 bytes em texto ou base64) e o arquivo "current" guarda o ID atual
+func LoadKeyringFromDir(dir string) (*Keyring, error) {
+	if dir == "" {
+		return nil, errors.New("KMS_KEY_DIR não configurado")
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.key"))
+	if err != nil {
+		return nil, err
+	}
+	kr := &Keyring{Keys: map[string][]byte{}}
+	for _, f := range files {
+		id := strings.TrimSuffix(filepath.Base(f), ".key")
+		if id == "" || strings.ContainsAny(id, ":.") {
+			return nil, fmt.Errorf("nome de chave inválido: %s", f)
+		}
+		raw, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		key, err := parseMasterKey(strings.TrimSpace(string(raw)))
+		if err != nil {
+			return nil, fmt.Errorf("arquivo %s: %w", f, err)
+		}
+		kr.Keys[id] = key
+	}
+	current, err := os.ReadFile(filepath.Join(dir, "current"))
+	if err != nil {
+		return nil, fmt.Errorf("arquivo current não encontrado em %s: %w", dir, err)
+	}
+	kr.Current = strings.TrimSpace(string(current))
+	if _, ok := kr.Keys[kr.Current]; !ok {
+		return nil, fmt.Errorf("chave mestra atual %q não encontrada", kr.Current)
+	}
+	return kr, nil
+}
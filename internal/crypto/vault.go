@@ -0,0 +1,150 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// transitKeyName restringe o nome da chave transit, que vai no caminho da URL
+var transitKeyName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// VaultTransitProvider delega a proteção das chaves de dados a um serviço no estilo
+// do Vault transit: a chave mestra nunca sai do servidor, que apenas cifra/decifra.
+// O ID da chave é "<nome>.v<versão>", para que a recriptografia perceba uma rotação
+// de versão no Vault; IDs só com o nome vêm de antes dessa convenção.
+type VaultTransitProvider struct {
+	addr       string
+	token      string
+	keyName    string
+	httpClient *http.Client
+}
+
+// NewVaultTransitProvider cria o provider para a chave transit keyName em addr
+func NewVaultTransitProvider(addr, token, keyName string, httpClient *http.Client) (*VaultTransitProvider, error) {
+	if addr == "" || keyName == "" {
+		return nil, errors.New("VAULT_ADDR e VAULT_TRANSIT_KEY obrigatórios")
+	}
+	if !transitKeyName.MatchString(keyName) {
+		return nil, errors.New("VAULT_TRANSIT_KEY inválida")
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &VaultTransitProvider{addr: strings.TrimRight(addr, "/"), token: token, keyName: keyName, httpClient: httpClient}, nil
+}
+
+// CurrentKeyID retorna o nome da chave transit com a versão mais recente no servidor
+func (v *VaultTransitProvider) CurrentKeyID() (string, error) {
+	var resp struct {
+		Data struct {
+			LatestVersion int `json:"latest_version"`
+		} `json:"data"`
+	}
+	if err := v.call(http.MethodGet, "keys", v.keyName, nil, &resp); err != nil {
+		return "", err
+	}
+	if resp.Data.LatestVersion <= 0 {
+		return "", errors.New("vault: resposta sem latest_version")
+	}
+	return fmt.Sprintf("%s.v%d", v.keyName, resp.Data.LatestVersion), nil
+}
+
+func (v *VaultTransitProvider) WrapKey(keyID string, dataKey []byte) ([]byte, error) {
+	name, version, err := parseTransitKeyID(keyID)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	body := map[string]interface{}{"plaintext": base64.StdEncoding.EncodeToString(dataKey)}
+	// Fixa a versão do ID, caso o Vault tenha rotacionado desde CurrentKeyID
+	if version > 0 {
+		body["key_version"] = version
+	}
+	if err := v.call(http.MethodPost, "encrypt", name, body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data.Ciphertext == "" {
+		return nil, errors.New("vault: resposta sem ciphertext")
+	}
+	return []byte(resp.Data.Ciphertext), nil
+}
+
+func (v *VaultTransitProvider) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	// A versão usada na cifragem vem no próprio ciphertext ("vault:vN:...")
+	name, _, err := parseTransitKeyID(keyID)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	body := map[string]interface{}{"ciphertext": string(wrapped)}
+	if err := v.call(http.MethodPost, "decrypt", name, body, &resp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+}
+
+// parseTransitKeyID separa "<nome>.v<versão>" (versão 0 quando ausente). O ID vem do
+// cipherText gravado no banco e não pode levar a outro caminho do Vault.
+func parseTransitKeyID(keyID string) (string, int, error) {
+	name, suffix, versioned := strings.Cut(keyID, ".")
+	if !transitKeyName.MatchString(name) {
+		return "", 0, fmt.Errorf("vault: ID de chave inválido: %q", keyID)
+	}
+	if !versioned {
+		return name, 0, nil
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(suffix, "v"))
+	if err != nil || version <= 0 || suffix != "v"+strconv.Itoa(version) {
+		return "", 0, fmt.Errorf("vault: ID de chave inválido: %q", keyID)
+	}
+	return name, version, nil
+}
+
+// call executa <método> /v1/transit/<operação>/<chave> e decodifica a resposta
+func (v *VaultTransitProvider) call(method, operation, name string, body interface{}, out interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/v1/transit/%s/%s", v.addr, operation, url.PathEscape(name)), payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", v.token)
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("vault: %s falhou (%d): %s", operation, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, out)
+}
@@ -3,7 +3,13 @@ package db
 import (
 	"api-vault/internal/audit"
 	"api-vault/internal/auth"
+	"api-vault/internal/authz"
 	"api-vault/internal/integrations"
+	"api-vault/internal/oauth"
+	"api-vault/internal/oidc"
+	"api-vault/internal/rekey"
+	"api-vault/internal/signing"
+	"api-vault/internal/tenant"
 	"api-vault/internal/tokens"
 	"log"
 	"os"
@@ -21,9 +27,16 @@ func Init() (*gorm.DB, error) {
 		return nil, err
 	}
 	// Migração de todos os modelos
-	if err := db.AutoMigrate(&integrations.Integration{}, &tokens.Token{}, &auth.User{}, &audit.AuditLog{}); err != nil {
+	if err := db.AutoMigrate(&integrations.Integration{}, &tokens.Token{}, &auth.User{}, &authz.Role{}, &auth.Group{}, &auth.GroupMember{}, &integrations.ACLEntry{}, &audit.AuditLog{}, &audit.ChainHead{}, &audit.DeadLetter{}, &oauth.AuthorizationRequest{}, &rekey.Job{}, &tenant.Organization{}, &auth.Session{}, &auth.RevokedToken{}, &signing.SigningKey{}, &auth.RecoveryCode{}, &auth.MFAChallenge{}, &auth.LoginAttempt{}, &auth.APIKey{}, &authz.MFAPolicy{}, &oidc.LoginRequest{}, &oidc.Identity{}); err != nil {
 		log.Fatal("Erro ao migrar tabelas:", err)
 	}
+	// Filtro automático por organização em toda consulta feita com contexto de tenant
+	if err := tenant.Register(db); err != nil {
+		return nil, err
+	}
+	if err := tenant.EnsureDefault(db, "users", "integrations", "tokens", "audit_logs", "roles", "groups"); err != nil {
+		return nil, err
+	}
 	DB = db
 	return db, nil
 }
@@ -0,0 +1,163 @@
+package integrations
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api-vault/internal/auth"
+	"api-vault/internal/authz"
+	"api-vault/internal/middleware"
+)
+
+// Níveis de acesso a uma integração; cada nível inclui os anteriores
+const (
+	AccessRead   = "read"   // ver a integração e seus tokens (mascarados)
+	AccessUse    = "use"    // obter access token válido
+	AccessReveal = "reveal" // revelar segredos
+	AccessManage = "manage" // alterar, remover, autorizar e gerenciar a ACL
+)
+
+var accessRank = map[string]int{AccessRead: 1, AccessUse: 2, AccessReveal: 3, AccessManage: 4}
+
+// Tipos de sujeito de uma entrada de ACL
+const (
+	SubjectUser  = "user"
+	SubjectGroup = "group"
+)
+
+// ErrInvalidLevel indica nível de acesso desconhecido numa concessão
+var ErrInvalidLevel = errors.New("nível de acesso inválido")
+
+// ACLEntry concede um nível de acesso a uma integração para um usuário ou grupo
+type ACLEntry struct {
+	ID            uint   `gorm:"primaryKey"`
+	IntegrationID uint   `gorm:"not null;index"`
+	SubjectType   string `gorm:"not null"`
+	SubjectID     uint   `gorm:"not null"`
+	Level         string `gorm:"not null"`
+	CreatedAt     time.Time
+}
+
+func (ACLEntry) TableName() string {
+	return "integration_acl"
+}
+
+// ValidLevel informa se o nível de acesso existe
+func ValidLevel(level string) bool {
+	_, ok := accessRank[level]
+	return ok
+}
+
+// Caller identifica quem faz a requisição para avaliação das ACLs
+type Caller struct {
+	UserID   uint
+	GroupIDs []uint
+	All      bool // integrations:all ignora as ACLs
+}
+
+// CallerFromContext monta o Caller a partir do JWT e dos grupos do usuário
+func CallerFromContext(c *gin.Context, conn *gorm.DB) (Caller, error) {
+	user := auth.CurrentUser(c)
+	caller := Caller{UserID: user.ID, All: middleware.HasPermission(c, conn, authz.PermIntegrationsAll)}
+	if caller.All {
+		return caller, nil
+	}
+	groups, err := auth.GroupIDs(conn, user.ID)
+	if err != nil {
+		return caller, err
+	}
+	caller.GroupIDs = groups
+	return caller, nil
+}
+
+// levelsFrom lista os níveis que satisfazem o nível mínimo pedido
+func levelsFrom(min string) []string {
+	var levels []string
+	for level, rank := range accessRank {
+		if rank >= accessRank[min] {
+			levels = append(levels, level)
+		}
+	}
+	return levels
+}
+
+// VisibleScope filtra integrações em que o chamador tem pelo menos o nível pedido
+func VisibleScope(conn *gorm.DB, caller Caller, level string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if caller.All {
+			return db
+		}
+		granted := conn.Session(&gorm.Session{NewDB: true}).Model(&ACLEntry{}).Select("integration_id").
+			Where("level IN ?", levelsFrom(level)).
+			Where(conn.Session(&gorm.Session{NewDB: true}).
+				Where("subject_type = ? AND subject_id = ?", SubjectUser, caller.UserID).
+				Or("subject_type = ? AND subject_id IN ?", SubjectGroup, caller.GroupIDs))
+		return db.Where("integrations.owner_id = ? OR integrations.id IN (?)", caller.UserID, granted)
+	}
+}
+
+// VisibleIDs é a subconsulta de IDs de integrações visíveis, para filtrar tabelas relacionadas
+func VisibleIDs(conn *gorm.DB, caller Caller, level string) *gorm.DB {
+	return conn.Session(&gorm.Session{NewDB: true}).Model(&Integration{}).Select("integrations.id").Scopes(VisibleScope(conn, caller, level))
+}
+
+// AccessLevel calcula o maior nível do chamador na integração ("" se nenhum)
+func AccessLevel(conn *gorm.DB, caller Caller, integration *Integration) (string, error) {
+	if caller.All || (integration.OwnerID != 0 && integration.OwnerID == caller.UserID) {
+		return AccessManage, nil
+	}
+	var entries []ACLEntry
+	err := conn.Where("integration_id = ?", integration.ID).
+		Where(conn.Session(&gorm.Session{NewDB: true}).
+			Where("subject_type = ? AND subject_id = ?", SubjectUser, caller.UserID).
+			Or("subject_type = ? AND subject_id IN ?", SubjectGroup, caller.GroupIDs)).
+		Find(&entries).Error
+	if err != nil {
+		return "", err
+	}
+	best := ""
+	for _, e := range entries {
+		if accessRank[e.Level] > accessRank[best] {
+			best = e.Level
+		}
+	}
+	return best, nil
+}
+
+// Allows informa se o nível obtido satisfaz o nível exigido
+func Allows(granted, required string) bool {
+	return granted != "" && accessRank[granted] >= accessRank[required]
+}
+
+// RequireAccess carrega a integração e exige o nível pedido. Em caso de falha já
+// responde: 404 se não existe ou o chamador não pode vê-la, 403 se o nível é insuficiente.
+func RequireAccess(c *gin.Context, conn *gorm.DB, id uint, level string) (*Integration, bool) {
+	var integration Integration
+	if err := conn.First(&integration, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Integration not found"})
+		return nil, false
+	}
+	caller, err := CallerFromContext(c, conn)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	granted, err := AccessLevel(conn, caller, &integration)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if granted == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Integration not found"})
+		return nil, false
+	}
+	if !Allows(granted, level) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Acesso " + level + " necessário na integração"})
+		return nil, false
+	}
+	return &integration, true
+}
@@ -1,18 +1,30 @@
 package integrations
 
 import (
+	"errors"
 	"fmt"
 	"log"
 
-	"github.com/appleboy/gin-jwt/v2"
+	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
 	"api-vault/internal/audit"
+	"api-vault/internal/auth"
+	"api-vault/internal/authz"
 	"api-vault/internal/crypto"
 	"api-vault/internal/middleware"
+	"api-vault/internal/tenant"
 )
 
+// Tamanho mínimo da justificativa exigida para revelar um segredo
+const minRevealReasonLength = 10
+
+// RevealInput é o corpo exigido para revelar segredos
+type RevealInput struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
 func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 
 	// Listar todas as integrações (protegido)
@@ -23,22 +35,25 @@ func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 	// @Success 200 {array} Integration
 	// @Failure 500 {object} gin.H
 	// @Router /integrations [get]
-	r.GET("/integrations", mw.MiddlewareFunc(), func(c *gin.Context) {
+	r.GET("/integrations", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermIntegrationsRead), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		caller, err := CallerFromContext(c, db)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
 		var list []Integration
-		if err := conn.Find(&list).Error; err != nil {
+		if err := db.Scopes(VisibleScope(db, caller, AccessRead)).Find(&list).Error; err != nil {
 			log.Printf("[AUDIT] [FAIL] Listagem integrações | erro=%v", err)
-			_ = audit.SaveAuditLog(conn, "", "listagem_integracoes", "FAIL", err.Error())
+			_ = audit.Record(c, db, audit.Failed(audit.ActionIntegrationList, audit.ResourceIntegration, nil, audit.CodeInternal).Detailf("%v", err))
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
 		for i := range list {
-			secret, err := crypto.Decrypt(list[i].ClientSecret)
-			if err == nil {
-				list[i].ClientSecret = secret
-			}
+			MaskSecret(&list[i])
 		}
 		log.Printf("[AUDIT] [OK] Listagem integrações | total=%d", len(list))
-		_ = audit.SaveAuditLog(conn, "", "listagem_integracoes", "OK", fmt.Sprintf("total=%d", len(list)))
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionIntegrationList, audit.ResourceIntegration, nil).Detailf("total=%d", len(list)))
 		c.JSON(200, list)
 	})
 
@@ -51,41 +66,44 @@ func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 	// @Success 200 {object} Integration
 	// @Failure 404,500 {object} gin.H
 	// @Router /integrations/{id} [get]
-	r.GET("/integrations/:id", mw.MiddlewareFunc(), func(c *gin.Context) {
-		var integration Integration
-		id := c.Param("id")
-		if err := conn.First(&integration, id).Error; err != nil {
-			log.Printf("[AUDIT] [FAIL] Consulta integração por ID | id=%s | erro=%v", id, err)
-			_ = audit.SaveAuditLog(conn, "", "consulta_integracao_id", "FAIL", fmt.Sprintf("id=%s erro=%v", id, err))
-			c.JSON(404, gin.H{"error": "Integration not found"})
+	r.GET("/integrations/:id", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermIntegrationsRead), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		id, ok := middleware.ParamID(c, "id")
+		if !ok {
 			return
 		}
-		secret, err := crypto.Decrypt(integration.ClientSecret)
-		if err == nil {
-			integration.ClientSecret = secret
+		integration, ok := RequireAccess(c, db, id, AccessRead)
+		if !ok {
+			log.Printf("[AUDIT] [FAIL] Consulta integração por ID | id=%d | status=%d", id, c.Writer.Status())
+			_ = audit.Record(c, db, audit.Failed(audit.ActionIntegrationRead, audit.ResourceIntegration, id, audit.CodeForStatus(c.Writer.Status())).Detailf("id=%d status=%d", id, c.Writer.Status()))
+			return
 		}
-		log.Printf("[AUDIT] [OK] Consulta integração por ID | id=%s", id)
-		_ = audit.SaveAuditLog(conn, "", "consulta_integracao_id", "OK", fmt.Sprintf("id=%s", id))
+		MaskSecret(integration)
+		log.Printf("[AUDIT] [OK] Consulta integração por ID | id=%d", id)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionIntegrationRead, audit.ResourceIntegration, id).Detailf("id=%d", id))
 		c.JSON(200, integration)
 	})
 
 	// Atualizar integração (protegido)
 	// @Summary Atualizar integração
-	// @Description Atualiza uma integração existente
+	// @Description Atualiza uma integração existente. ClientSecret vazio ou mascarado mantém o segredo atual; trocar TokenURL ou AuthURL exige um ClientSecret novo ou integrations:reveal.
 	// @Tags integrações
 	// @Accept json
 	// @Produce json
 	// @Param id path int true "ID da integração"
 	// @Param integration body Integration true "Dados da integração"
 	// @Success 200 {object} Integration
-	// @Failure 400,404,500 {object} gin.H
+	// @Failure 400,403,404,500 {object} gin.H
 	// @Router /integrations/{id} [put]
-	r.PUT("/integrations/:id", mw.MiddlewareFunc(), func(c *gin.Context) {
-		var integration Integration
-		id := c.Param("id")
-		if err := conn.First(&integration, id).Error; err != nil {
-			log.Printf("Erro ao buscar integração para atualizar: %v\n", err)
-			c.JSON(404, gin.H{"error": "Integration not found"})
+	r.PUT("/integrations/:id", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermIntegrationsWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		id, ok := middleware.ParamID(c, "id")
+		if !ok {
+			return
+		}
+		integration, ok := RequireAccess(c, db, id, AccessManage)
+		if !ok {
+			log.Printf("Integração %d indisponível para atualizar: status=%d\n", id, c.Writer.Status())
 			return
 		}
 		var input Integration
@@ -93,32 +111,47 @@ func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 			c.JSON(400, gin.H{"error": err.Error()})
 			return
 		}
-		encryptedSecret, err := crypto.Encrypt(input.ClientSecret)
-		if err != nil {
-			c.JSON(500, gin.H{"error": "Erro ao criptografar ClientSecret"})
+		if err := validateEndpoints(input.AuthType, input.TokenURL, input.AuthURL); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		// O segredo mantido é enviado ao TokenURL a cada renovação: apontar a integração
+		// para outro servidor sem informar o segredo equivale a revelá-lo
+		repointed := input.TokenURL != integration.TokenURL || input.AuthURL != integration.AuthURL
+		if repointed && crypto.Unchanged(input.ClientSecret) && !middleware.HasPermission(c, db, authz.PermIntegrationsReveal) {
+			log.Printf("[AUDIT] [FAIL] Atualização integração | id=%d | erro=troca de URL sem ClientSecret", id)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionIntegrationUpdate, audit.ResourceIntegration, id, audit.CodeForbidden).Detailf("id=%d erro=troca de URL sem ClientSecret", id))
+			c.JSON(403, gin.H{"error": "Trocar TokenURL ou AuthURL exige informar o ClientSecret ou a permissão " + authz.PermIntegrationsReveal})
 			return
 		}
+		before := *integration
+		// Sem ClientSecret novo (omitido ou mascarado, como vem do GET) o cifrado é mantido
+		if !crypto.Unchanged(input.ClientSecret) {
+			if err := EncryptSecret(integration, input.ClientSecret); err != nil {
+				c.JSON(500, gin.H{"error": "Erro ao criptografar ClientSecret"})
+				return
+			}
+		}
 		integration.Name = input.Name
 		integration.AuthType = input.AuthType
 		integration.ClientID = input.ClientID
-		integration.ClientSecret = encryptedSecret
 		integration.TokenURL = input.TokenURL
-		if err := conn.Save(&integration).Error; err != nil {
-			log.Printf("[AUDIT] [FAIL] Atualização integração | id=%s | erro=%v", id, err)
-			_ = audit.SaveAuditLog(conn, "", "atualizacao_integracao", "FAIL", fmt.Sprintf("id=%s erro=%v", id, err))
+		integration.AuthURL = input.AuthURL
+		integration.Scopes = input.Scopes
+		if err := db.Save(integration).Error; err != nil {
+			log.Printf("[AUDIT] [FAIL] Atualização integração | id=%d | erro=%v", id, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionIntegrationUpdate, audit.ResourceIntegration, id, audit.CodeInternal).Detailf("id=%d erro=%v", id, err))
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
-		secret, err := crypto.Decrypt(integration.ClientSecret)
-		if err == nil {
-			integration.ClientSecret = secret
-		}
-		log.Printf("[AUDIT] [OK] Atualização integração | id=%s", id)
-		_ = audit.SaveAuditLog(conn, "", "atualizacao_integracao", "OK", fmt.Sprintf("id=%s", id))
+		changes := audit.Diff(before, integration)
+		MaskSecret(integration)
+		log.Printf("[AUDIT] [OK] Atualização integração | id=%d", id)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionIntegrationUpdate, audit.ResourceIntegration, id).WithChanges(changes).Detailf("id=%d", id))
 		c.JSON(200, integration)
 	})
 
-	// Deletar integração (protegido)
+	// Deletar integração (protegido, integrations:delete)
 	// @Summary Deletar integração
 	// @Description Remove uma integração
 	// @Tags integrações
@@ -126,38 +159,31 @@ func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 	// @Success 204 {object} nil
 	// @Failure 403,500 {object} gin.H
 	// @Router /integrations/{id} [delete]
-	r.DELETE("/integrations/:id", mw.MiddlewareFunc(), func(c *gin.Context) {
-		if !middleware.IsAdmin(c) {
-			c.JSON(403, gin.H{"error": "Acesso permitido apenas para admin"})
+	r.DELETE("/integrations/:id", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermIntegrationsDelete), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		id, ok := middleware.ParamID(c, "id")
+		if !ok {
 			return
 		}
-		id := c.Param("id")
-		if err := conn.Delete(&Integration{}, id).Error; err != nil {
-			log.Printf("[AUDIT] [FAIL] Deleção integração | id=%s | erro=%v", id, err)
-			_ = audit.SaveAuditLog(conn, "", "delecao_integracao", "FAIL", fmt.Sprintf("id=%s erro=%v", id, err))
-			c.JSON(500, gin.H{"error": err.Error()})
+		integration, ok := RequireAccess(c, db, id, AccessManage)
+		if !ok {
 			return
 		}
-		log.Printf("[AUDIT] [OK] Deleção integração | id=%s", id)
-		_ = audit.SaveAuditLog(conn, "", "delecao_integracao", "OK", fmt.Sprintf("id=%s", id))
-		c.JSON(204, nil)
-	})
-	// @Summary Testar integrações
-	// @Description Endpoint de teste para integrações
-	// @Tags integrações
-	// @Produce json
-	// @Success 200 {array} Integration
-	// @Failure 500 {object} gin.H
-	// @Router /integrations/test [get]
-	r.GET("/integrations/test", func(c *gin.Context) {
-		var list []Integration
-		if err := conn.Find(&list).Error; err != nil {
-			log.Printf("Erro ao consultar integrações: %v\n", err)
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("integration_id = ?", id).Delete(&ACLEntry{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&Integration{}, id).Error
+		})
+		if err != nil {
+			log.Printf("[AUDIT] [FAIL] Deleção integração | id=%d | erro=%v", id, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionIntegrationDelete, audit.ResourceIntegration, id, audit.CodeInternal).Detailf("id=%d erro=%v", id, err))
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
-		log.Printf("Retornando %d integrações salvas\n", len(list))
-		c.JSON(200, list)
+		log.Printf("[AUDIT] [OK] Deleção integração | id=%d", id)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionIntegrationDelete, audit.ResourceIntegration, id).WithChanges(audit.Diff(integration, &Integration{})).Detailf("id=%d", id))
+		c.JSON(204, nil)
 	})
 
 	// @Summary Cadastro de integração
@@ -169,7 +195,8 @@ func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 	// @Success 201 {object} Integration
 	// @Failure 400,500 {object} gin.H
 	// @Router /integrations [post]
-	r.POST("/integrations", mw.MiddlewareFunc(), func(c *gin.Context) {
+	r.POST("/integrations", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermIntegrationsWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
 		log.Println("Tentando fazer o bind do JSON recebido...")
 		type IntegrationInput struct {
 			Name         string `json:"name" binding:"required"`
@@ -177,6 +204,8 @@ func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 			ClientID     string `json:"client_id" binding:"required"`
 			ClientSecret string `json:"client_secret" binding:"required"`
 			TokenURL     string `json:"token_url" binding:"required"`
+			AuthURL      string `json:"auth_url"`
+			Scopes       string `json:"scopes"`
 		}
 
 		var input IntegrationInput
@@ -198,42 +227,231 @@ func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 			c.JSON(400, gin.H{"error": "ClientID e ClientSecret devem ter pelo menos 3 caracteres"})
 			return
 		}
-		if len(input.TokenURL) < 10 || !(input.TokenURL[:4] == "http") {
-			c.JSON(400, gin.H{"error": "TokenURL inválida"})
+		if err := validateEndpoints(input.AuthType, input.TokenURL, input.AuthURL); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
 			return
 		}
 
-		log.Printf("Bind do JSON realizado com sucesso: %+v\n", input)
-
-		encryptedSecret, err := crypto.Encrypt(input.ClientSecret)
-		if err != nil {
-			c.JSON(500, gin.H{"error": "Erro ao criptografar ClientSecret"})
-			return
-		}
+		log.Printf("Bind do JSON realizado com sucesso: name=%s auth_type=%s\n", input.Name, input.AuthType)
 
 		log.Println("Montando struct Integration...")
 		integration := Integration{
-			Name:         input.Name,
-			AuthType:     input.AuthType,
-			ClientID:     input.ClientID,
-			ClientSecret: encryptedSecret,
-			TokenURL:     input.TokenURL,
+			Name:     input.Name,
+			AuthType: input.AuthType,
+			ClientID: input.ClientID,
+			TokenURL: input.TokenURL,
+			AuthURL:  input.AuthURL,
+			Scopes:   input.Scopes,
+			OwnerID:  auth.CurrentUser(c).ID,
 		}
 		log.Printf("Struct Integration montada: %+v\n", integration)
 
 		log.Println("Persistindo Integration no banco...")
-		if err := conn.Create(&integration).Error; err != nil {
+		// O ClientSecret é vinculado ao ID, então é cifrado após o insert na mesma transação
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&integration).Error; err != nil {
+				return err
+			}
+			if err := EncryptSecret(&integration, input.ClientSecret); err != nil {
+				return err
+			}
+			return tx.Model(&integration).Update("client_secret", integration.ClientSecret).Error
+		})
+		if err != nil {
 			log.Printf("[AUDIT] [FAIL] Cadastro integração | name=%s | erro=%v", input.Name, err)
-			_ = audit.SaveAuditLog(conn, "", "cadastro_integracao", "FAIL", fmt.Sprintf("name=%s erro=%v", input.Name, err))
+			_ = audit.Record(c, db, audit.Failed(audit.ActionIntegrationCreate, audit.ResourceIntegration, nil, audit.CodeInternal).Detailf("name=%s erro=%v", input.Name, err))
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
-		secret, err := crypto.Decrypt(integration.ClientSecret)
-		if err == nil {
-			integration.ClientSecret = secret
-		}
+		changes := audit.Diff(Integration{}, integration)
+		MaskSecret(&integration)
 		log.Printf("[AUDIT] [OK] Cadastro integração | name=%s | id=%d", integration.Name, integration.ID)
-		_ = audit.SaveAuditLog(conn, "", "cadastro_integracao", "OK", fmt.Sprintf("name=%s id=%d", integration.Name, integration.ID))
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionIntegrationCreate, audit.ResourceIntegration, integration.ID).WithChanges(changes).Detailf("name=%s id=%d", integration.Name, integration.ID))
 		c.JSON(201, integration)
 	})
+
+	// Revelar ClientSecret (protegido, integrations:reveal, exige justificativa)
+	// @Summary Revelar segredo da integração
+	// @Description Retorna o ClientSecret em texto puro e registra a justificativa na auditoria
+	// @Tags integrações
+	// @Accept json
+	// @Produce json
+	// @Param id path int true "ID da integração"
+	// @Param reveal body RevealInput true "Justificativa"
+	// @Success 200 {object} gin.H
+	// @Failure 400,403,404,500 {object} gin.H
+	// @Router /integrations/{id}/reveal [post]
+	r.POST("/integrations/:id/reveal", mw.MiddlewareFunc(), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		username, _ := jwt.ExtractClaims(c)["username"].(string)
+		id, ok := middleware.ParamID(c, "id")
+		if !ok {
+			return
+		}
+		if !middleware.HasPermission(c, db, authz.PermIntegrationsReveal) {
+			log.Printf("[AUDIT] [FAIL] Revelação segredo integração | id=%d | user=%s | erro=acesso negado", id, username)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionIntegrationReveal, audit.ResourceIntegration, id, audit.CodeForbidden).Detailf("id=%d erro=acesso negado", id))
+			c.JSON(403, gin.H{"error": "Permissão necessária: " + authz.PermIntegrationsReveal})
+			return
+		}
+		var input RevealInput
+		if err := c.ShouldBindJSON(&input); err != nil || len(input.Reason) < minRevealReasonLength {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Justificativa obrigatória com pelo menos %d caracteres", minRevealReasonLength)})
+			return
+		}
+		integration, ok := RequireAccess(c, db, id, AccessReveal)
+		if !ok {
+			return
+		}
+		secret, err := DecryptSecret(integration)
+		if err != nil {
+			log.Printf("[AUDIT] [FAIL] Revelação segredo integração | id=%d | user=%s | erro=%v", id, username, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionIntegrationReveal, audit.ResourceIntegration, id, audit.CodeInternal).Detailf("id=%d motivo=%q erro=%v", id, input.Reason, err))
+			c.JSON(500, gin.H{"error": "Erro ao decriptografar ClientSecret"})
+			return
+		}
+		log.Printf("[AUDIT] [OK] Revelação segredo integração | id=%d | user=%s | motivo=%q", id, username, input.Reason)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionIntegrationReveal, audit.ResourceIntegration, id).Detailf("id=%d motivo=%q", id, input.Reason))
+		c.JSON(200, gin.H{"id": integration.ID, "client_secret": secret})
+	})
+
+	// Listar ACL da integração (protegido, acesso manage)
+	// @Summary Listar ACL
+	// @Description Lista o dono e as entradas de ACL de uma integração
+	// @Tags integrações
+	// @Produce json
+	// @Param id path int true "ID da integração"
+	// @Success 200 {object} gin.H
+	// @Failure 403,404,500 {object} gin.H
+	// @Router /integrations/{id}/acl [get]
+	r.GET("/integrations/:id/acl", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermIntegrationsRead), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		id, ok := middleware.ParamID(c, "id")
+		if !ok {
+			return
+		}
+		integration, ok := RequireAccess(c, db, id, AccessManage)
+		if !ok {
+			return
+		}
+		var entries []ACLEntry
+		if err := db.Where("integration_id = ?", integration.ID).Order("id").Find(&entries).Error; err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, gin.H{"owner_id": integration.OwnerID, "entries": entries})
+	})
+
+	// Conceder acesso à integração (protegido, acesso manage)
+	// @Summary Conceder acesso
+	// @Description Concede read, use, reveal ou manage a um usuário ou grupo; substitui a concessão anterior do mesmo sujeito
+	// @Tags integrações
+	// @Accept json
+	// @Produce json
+	// @Param id path int true "ID da integração"
+	// @Param entry body ACLInput true "Concessão"
+	// @Success 201 {object} ACLEntry
+	// @Failure 400,403,404,500 {object} gin.H
+	// @Router /integrations/{id}/acl [post]
+	r.POST("/integrations/:id/acl", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermIntegrationsWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		id, ok := middleware.ParamID(c, "id")
+		if !ok {
+			return
+		}
+		integration, ok := RequireAccess(c, db, id, AccessManage)
+		if !ok {
+			return
+		}
+		var input ACLInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if !ValidLevel(input.Level) {
+			c.JSON(400, gin.H{"error": ErrInvalidLevel.Error()})
+			return
+		}
+		var subject interface{}
+		switch input.SubjectType {
+		case SubjectUser:
+			subject = &auth.User{}
+		case SubjectGroup:
+			subject = &auth.Group{}
+		default:
+			c.JSON(400, gin.H{"error": "subject_type deve ser 'user' ou 'group'"})
+			return
+		}
+		if err := db.First(subject, input.SubjectID).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Subject not found"})
+			return
+		}
+		entry := ACLEntry{IntegrationID: integration.ID, SubjectType: input.SubjectType, SubjectID: input.SubjectID, Level: input.Level}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("integration_id = ? AND subject_type = ? AND subject_id = ?", entry.IntegrationID, entry.SubjectType, entry.SubjectID).Delete(&ACLEntry{}).Error; err != nil {
+				return err
+			}
+			return tx.Create(&entry).Error
+		})
+		if err != nil {
+			log.Printf("[AUDIT] [FAIL] Concessão ACL | integration_id=%d | erro=%v", id, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionACLGrant, audit.ResourceIntegration, id, audit.CodeInternal).Detailf("integration_id=%d erro=%v", id, err))
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("[AUDIT] [OK] Concessão ACL | integration_id=%d | %s=%d | nivel=%s", id, entry.SubjectType, entry.SubjectID, entry.Level)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionACLGrant, audit.ResourceACLEntry, entry.ID).WithChanges(audit.Diff(ACLEntry{}, entry)).Detailf("integration_id=%d %s=%d nivel=%s", id, entry.SubjectType, entry.SubjectID, entry.Level))
+		c.JSON(201, entry)
+	})
+
+	// Revogar acesso à integração (protegido, acesso manage)
+	// @Summary Revogar acesso
+	// @Tags integrações
+	// @Param id path int true "ID da integração"
+	// @Param entry_id path int true "ID da entrada de ACL"
+	// @Success 204 {object} nil
+	// @Failure 403,404,500 {object} gin.H
+	// @Router /integrations/{id}/acl/{entry_id} [delete]
+	r.DELETE("/integrations/:id/acl/:entry_id", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermIntegrationsWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		id, ok := middleware.ParamID(c, "id")
+		if !ok {
+			return
+		}
+		entryID := c.Param("entry_id")
+		integration, ok := RequireAccess(c, db, id, AccessManage)
+		if !ok {
+			return
+		}
+		res := db.Where("id = ? AND integration_id = ?", entryID, integration.ID).Delete(&ACLEntry{})
+		if res.Error != nil {
+			c.JSON(500, gin.H{"error": res.Error.Error()})
+			return
+		}
+		if res.RowsAffected == 0 {
+			c.JSON(404, gin.H{"error": "ACL entry not found"})
+			return
+		}
+		log.Printf("[AUDIT] [OK] Revogação ACL | integration_id=%d | entrada=%s", id, entryID)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionACLRevoke, audit.ResourceACLEntry, entryID).Detailf("integration_id=%d entrada=%s", id, entryID))
+		c.JSON(204, nil)
+	})
+}
+
+// ACLInput é o corpo para conceder acesso a uma integração
+type ACLInput struct {
+	SubjectType string `json:"subject_type" binding:"required"`
+	SubjectID   uint   `json:"subject_id" binding:"required"`
+	Level       string `json:"level" binding:"required"`
+}
+
+// validateEndpoints confere as URLs do provedor no cadastro e na atualização
+func validateEndpoints(authType, tokenURL, authURL string) error {
+	if len(tokenURL) < 10 || !(tokenURL[:4] == "http") {
+		return errors.New("TokenURL inválida")
+	}
+	if authType == "authorization_code" && (len(authURL) < 10 || !(authURL[:4] == "http")) {
+		return errors.New("AuthURL obrigatória e válida para authorization_code")
+	}
+	return nil
 }
@@ -2,9 +2,13 @@ package integrations
 
 type Integration struct {
 	ID           uint   `gorm:"primaryKey"`
-	Name         string `gorm:"not null;unique"`
+	OrgID        uint   `gorm:"uniqueIndex:idx_integrations_org_name"`
+	Name         string `gorm:"not null;uniqueIndex:idx_integrations_org_name"`
 	AuthType     string `gorm:"not null"`
 	ClientID     string `gorm:"not null"`
-	ClientSecret string `gorm:"not null"`
+	ClientSecret string `gorm:"not null" audit:"secret"`
 	TokenURL     string `gorm:"not null"`
+	AuthURL      string // endpoint de autorização (apenas authorization_code)
+	Scopes       string // escopos separados por espaço solicitados no consentimento
+	OwnerID      uint   `gorm:"index"` // usuário dono; tem acesso manage
 }
@@ -0,0 +1,28 @@
+package integrations
+
+import "api-vault/internal/crypto"
+
+// SecretField identifica o ClientSecret da integração nos dados associados da criptografia
+func SecretField(id uint) crypto.Field {
+	return crypto.Field{Table: "integrations", Column: "client_secret", RecordID: id}
+}
+
+// EncryptSecret cifra o ClientSecret vinculado ao ID da integração (que já deve existir)
+func EncryptSecret(integration *Integration, plainSecret string) error {
+	secret, err := crypto.EncryptField(plainSecret, SecretField(integration.ID))
+	if err != nil {
+		return err
+	}
+	integration.ClientSecret = secret
+	return nil
+}
+
+// DecryptSecret retorna o ClientSecret da integração em texto plano
+func DecryptSecret(integration *Integration) (string, error) {
+	return crypto.DecryptField(integration.ClientSecret, SecretField(integration.ID))
+}
+
+// MaskSecret oculta o ClientSecret antes de devolver a integração em respostas comuns
+func MaskSecret(integration *Integration) {
+	integration.ClientSecret = crypto.MaskedValue
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ParamID lê um ID numérico da rota; se não for um, já responde 400.
+// Nunca passe c.Param direto ao First/Delete do GORM: uma string como chave
+// primária vai para o SQL sem parâmetro, antes do filtro de organização.
+func ParamID(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -1,13 +1,68 @@
 package middleware
 
 import (
+	"log"
+	"net/http"
+
 	"github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api-vault/internal/authz"
+	"api-vault/internal/config"
+	"api-vault/internal/tenant"
 )
 
-// IsAdmin verifica se o usuário autenticado é admin
-func IsAdmin(c *gin.Context) bool {
+// Chave no contexto do Gin com as permissões já resolvidas da requisição
+const permissionsKey = "permissions"
+
+// Permissions resolve (uma vez por requisição) as permissões do papel presente no JWT
+func Permissions(c *gin.Context, conn *gorm.DB) []string {
+	if v, ok := c.Get(permissionsKey); ok {
+		return v.([]string)
+	}
 	claims := jwt.ExtractClaims(c)
 	role, _ := claims["role"].(string)
-	return role == "admin"
+	// Papéis customizados pertencem à organização do usuário
+	perms, err := authz.PermissionsFor(tenant.Scoped(c, conn), role)
+	if err != nil {
+		perms = []string{}
+	}
+	// Só o admin da organização de sistema age sobre todas as organizações
+	if role == authz.RoleAdmin && tenant.OrgID(c) == config.GetSystemOrgID() {
+		perms = append(append([]string{}, perms...), authz.SystemPermissions...)
+	}
+	// API key com escopo: só as permissões do papel que a chave também concede
+	if raw, ok := claims[authz.ScopesClaim].([]interface{}); ok {
+		scopes := make([]string, 0, len(raw))
+		for _, s := range raw {
+			if scope, ok := s.(string); ok {
+				scopes = append(scopes, scope)
+			}
+		}
+		perms = authz.Intersect(perms, scopes)
+	}
+	c.Set(permissionsKey, perms)
+	return perms
+}
+
+// HasPermission verifica se o usuário autenticado possui a permissão
+func HasPermission(c *gin.Context, conn *gorm.DB, perm string) bool {
+	return authz.Contains(Permissions(c, conn), perm)
+}
+
+// RequirePermission bloqueia a rota com 403 se faltar alguma das permissões.
+// Deve ser usado depois do middleware JWT.
+func RequirePermission(conn *gorm.DB, perms ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, perm := range perms {
+			if !HasPermission(c, conn, perm) {
+				username, _ := jwt.ExtractClaims(c)["username"].(string)
+				log.Printf("[AUDIT] [FAIL] Acesso negado | user=%s | permissao=%s | rota=%s %s", username, perm, c.Request.Method, c.FullPath())
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Permissão necessária: " + perm})
+				return
+			}
+		}
+		c.Next()
+	}
 }
@@ -0,0 +1,119 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TokenResponse representa a resposta do endpoint de token (RFC 6749, seção 5.1)
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Scope        string `json:"scope"`
+	IDToken      string `json:"id_token"` // apenas OpenID Connect
+}
+
+// Error representa uma resposta de erro do endpoint de token (RFC 6749, seção 5.2)
+type Error struct {
+	StatusCode  int    `json:"-"`
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *Error) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("oauth: %s (%d): %s", e.Code, e.StatusCode, e.Description)
+	}
+	return fmt.Sprintf("oauth: %s (%d)", e.Code, e.StatusCode)
+}
+
+// Client conversa com o endpoint de token das integrações
+type Client struct {
+	HTTPClient *http.Client
+}
+
+// NewClient cria um cliente OAuth; se httpClient for nil usa um cliente com timeout padrão
+func NewClient(httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 15 * time.Second}
+	}
+	return &Client{HTTPClient: httpClient}
+}
+
+// ClientCredentials solicita um novo access token usando o grant client_credentials
+func (cl *Client) ClientCredentials(ctx context.Context, tokenURL, clientID, clientSecret string) (*TokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	return cl.postForm(ctx, tokenURL, clientID, clientSecret, form)
+}
+
+// RefreshToken troca um refresh token por um novo access token (RFC 6749, seção 6)
+func (cl *Client) RefreshToken(ctx context.Context, tokenURL, clientID, clientSecret, refreshToken string) (*TokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+	return cl.postForm(ctx, tokenURL, clientID, clientSecret, form)
+}
+
+// ExchangeCode troca o código de autorização pelo token, enviando o code_verifier do PKCE (RFC 7636)
+func (cl *Client) ExchangeCode(ctx context.Context, tokenURL, clientID, clientSecret, code, redirectURI, codeVerifier string) (*TokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("code_verifier", codeVerifier)
+	return cl.postForm(ctx, tokenURL, clientID, clientSecret, form)
+}
+
+// IsInvalidGrant indica se o servidor rejeitou o grant (ex.: refresh token revogado ou expirado)
+func IsInvalidGrant(err error) bool {
+	var oauthErr *Error
+	return errors.As(err, &oauthErr) && oauthErr.Code == "invalid_grant"
+}
+
+// postForm envia o formulário ao endpoint de token autenticando o cliente via HTTP Basic
+func (cl *Client) postForm(ctx context.Context, tokenURL, clientID, clientSecret string, form url.Values) (*TokenResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+
+	resp, err := cl.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		oauthErr := &Error{StatusCode: resp.StatusCode}
+		if json.Unmarshal(body, oauthErr) != nil || oauthErr.Code == "" {
+			oauthErr.Code = "http_error"
+		}
+		return nil, oauthErr
+	}
+
+	var token TokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("oauth: resposta inválida do endpoint de token: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("oauth: resposta sem access_token")
+	}
+	return &token, nil
+}
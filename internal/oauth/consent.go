@@ -0,0 +1,160 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"gorm.io/gorm"
+
+	"api-vault/internal/crypto"
+	"api-vault/internal/integrations"
+	"api-vault/internal/tokens"
+)
+
+// Tempo que o usuário tem para concluir o consentimento no provedor
+const authorizationRequestTTL = 10 * time.Minute
+
+// ErrInvalidState indica state desconhecido, já usado ou expirado no callback
+var ErrInvalidState = errors.New("state inválido ou expirado")
+
+// AuthorizationRequest guarda o state e o code_verifier de um consentimento em andamento
+type AuthorizationRequest struct {
+	ID            uint      `gorm:"primaryKey"`
+	State         string    `gorm:"not null;uniqueIndex"`
+	CodeVerifier  string    `gorm:"not null"` // criptografado
+	IntegrationID uint      `gorm:"index"`
+	User          string    // usuário que iniciou o consentimento
+	ExpiresAt     time.Time `gorm:"not null"`
+	CreatedAt     time.Time
+}
+
+// codeVerifierField identifica o code_verifier do consentimento nos dados associados da criptografia
+func codeVerifierField(id uint) crypto.Field {
+	return crypto.Field{Table: "authorization_requests", Column: "code_verifier", RecordID: id}
+}
+
+// StartAuthorization registra um novo consentimento e retorna a URL de autorização do provedor
+func StartAuthorization(conn *gorm.DB, integration *integrations.Integration, user, redirectURI string) (string, *AuthorizationRequest, error) {
+	if integration.AuthType != "authorization_code" {
+		return "", nil, errors.New("integração não usa authorization_code")
+	}
+	authURL, err := url.Parse(integration.AuthURL)
+	if err != nil || integration.AuthURL == "" {
+		return "", nil, errors.New("AuthURL inválida")
+	}
+	state, err := NewState()
+	if err != nil {
+		return "", nil, err
+	}
+	verifier, err := NewCodeVerifier()
+	if err != nil {
+		return "", nil, err
+	}
+	req := AuthorizationRequest{
+		State:         state,
+		IntegrationID: integration.ID,
+		User:          user,
+		ExpiresAt:     time.Now().Add(authorizationRequestTTL),
+	}
+	// O code_verifier é vinculado ao ID do registro, conhecido só depois do insert
+	err = conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&req).Error; err != nil {
+			return err
+		}
+		encryptedVerifier, err := crypto.EncryptField(verifier, codeVerifierField(req.ID))
+		if err != nil {
+			return errors.New("erro ao criptografar code_verifier")
+		}
+		req.CodeVerifier = encryptedVerifier
+		return tx.Model(&req).Update("code_verifier", req.CodeVerifier).Error
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	q := authURL.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", integration.ClientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("state", state)
+	q.Set("code_challenge", CodeChallengeS256(verifier))
+	q.Set("code_challenge_method", "S256")
+	if integration.Scopes != "" {
+		q.Set("scope", integration.Scopes)
+	}
+	authURL.RawQuery = q.Encode()
+	return authURL.String(), &req, nil
+}
+
+// CompleteAuthorization consome o state, troca o código no TokenURL e persiste o token da integração
+func CompleteAuthorization(ctx context.Context, conn *gorm.DB, client *Client, state, code, redirectURI string) (*AuthorizationRequest, *tokens.Token, error) {
+	var req AuthorizationRequest
+	if err := conn.WithContext(ctx).Where("state = ?", state).First(&req).Error; err != nil {
+		return nil, nil, ErrInvalidState
+	}
+	// O state vale uma única vez, mesmo que a troca falhe
+	if res := conn.WithContext(ctx).Delete(&req); res.Error != nil || res.RowsAffected == 0 {
+		return nil, nil, ErrInvalidState
+	}
+	if time.Now().After(req.ExpiresAt) {
+		return &req, nil, ErrInvalidState
+	}
+
+	var integration integrations.Integration
+	if err := conn.WithContext(ctx).First(&integration, req.IntegrationID).Error; err != nil {
+		return &req, nil, fmt.Errorf("integração não encontrada: %w", err)
+	}
+	verifier, err := crypto.DecryptField(req.CodeVerifier, codeVerifierField(req.ID))
+	if err != nil {
+		return &req, nil, fmt.Errorf("erro ao decriptografar code_verifier: %w", err)
+	}
+	clientSecret, err := integrations.DecryptSecret(&integration)
+	if err != nil {
+		return &req, nil, fmt.Errorf("erro ao decriptografar ClientSecret: %w", err)
+	}
+
+	resp, err := client.ExchangeCode(ctx, integration.TokenURL, integration.ClientID, clientSecret, code, redirectURI, verifier)
+	if err != nil {
+		return &req, nil, err
+	}
+	token, err := saveToken(conn.WithContext(ctx), &integration, resp)
+	return &req, token, err
+}
+
+// saveToken grava o resultado da troca no token atual da integração, ou cria um novo
+func saveToken(conn *gorm.DB, integration *integrations.Integration, resp *TokenResponse) (*tokens.Token, error) {
+	expiresIn := time.Duration(resp.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		expiresIn = time.Hour
+	}
+
+	var token tokens.Token
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("integration_id = ?", integration.ID).Order("expires_at desc").First(&token).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Os segredos são vinculados ao ID, então o registro é criado antes de cifrá-los
+			// O callback não tem JWT: a organização vem da integração
+			token = tokens.Token{IntegrationID: integration.ID, OrgID: integration.OrgID, ExpiresAt: time.Now()}
+			err = tx.Create(&token).Error
+		}
+		if err != nil {
+			return err
+		}
+		if err := tokens.EncryptAccessToken(&token, resp.AccessToken); err != nil {
+			return errors.New("erro ao criptografar AccessToken")
+		}
+		if err := tokens.EncryptRefreshToken(&token, resp.RefreshToken); err != nil {
+			return errors.New("erro ao criptografar RefreshToken")
+		}
+		token.ExpiresAt = time.Now().Add(expiresIn)
+		token.Status = tokens.StatusActive
+		return tx.Save(&token).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
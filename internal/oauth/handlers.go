@@ -0,0 +1,113 @@
+package oauth
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api-vault/internal/audit"
+	"api-vault/internal/authz"
+	"api-vault/internal/config"
+	"api-vault/internal/integrations"
+	"api-vault/internal/middleware"
+	"api-vault/internal/tenant"
+)
+
+func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware, client *Client) {
+	// Iniciar consentimento OAuth (protegido)
+	// @Summary Iniciar consentimento OAuth
+	// @Description Gera a URL de autorização (state + PKCE) de uma integração authorization_code
+	// @Tags oauth
+	// @Produce json
+	// @Param id path int true "ID da integração"
+	// @Success 200 {object} gin.H
+	// @Failure 400,403,404,500 {object} gin.H
+	// @Router /integrations/{id}/authorize [post]
+	r.POST("/integrations/:id/authorize", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermIntegrationsWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		id, ok := middleware.ParamID(c, "id")
+		if !ok {
+			return
+		}
+		integration, ok := integrations.RequireAccess(c, db, id, integrations.AccessManage)
+		if !ok {
+			return
+		}
+		username, _ := jwt.ExtractClaims(c)["username"].(string)
+		authorizeURL, req, err := StartAuthorization(db, integration, username, config.GetOAuthRedirectURL())
+		if err != nil {
+			log.Printf("[AUDIT] [FAIL] Início consentimento | integration_id=%d | erro=%v", id, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionConsentStart, audit.ResourceIntegration, id, audit.CodeInvalidInput).Detailf("integration_id=%d erro=%v", id, err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("[AUDIT] [OK] Início consentimento | integration_id=%d", id)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionConsentStart, audit.ResourceIntegration, id).Detailf("integration_id=%d", id))
+		c.JSON(http.StatusOK, gin.H{
+			"authorize_url": authorizeURL,
+			"state":         req.State,
+			"expires_at":    req.ExpiresAt,
+		})
+	})
+
+	// Callback OAuth (aberto: chamado pelo navegador ao voltar do provedor)
+	// @Summary Callback OAuth
+	// @Description Troca o código de autorização pelo token e o persiste na integração
+	// @Tags oauth
+	// @Produce json
+	// @Param state query string true "State retornado pelo provedor"
+	// @Param code query string false "Código de autorização"
+	// @Param error query string false "Erro retornado pelo provedor"
+	// @Success 200 {object} gin.H
+	// @Failure 400,502 {object} gin.H
+	// @Router /oauth/callback [get]
+	r.GET("/oauth/callback", func(c *gin.Context) {
+		state := c.Query("state")
+		code := c.Query("code")
+		if providerErr := c.Query("error"); providerErr != "" {
+			// Descarta o state para que não possa ser reaproveitado
+			conn.Where("state = ?", state).Delete(&AuthorizationRequest{})
+			log.Printf("[AUDIT] [FAIL] Callback consentimento | erro=%s", providerErr)
+			_ = audit.Record(c, conn, audit.Failed(audit.ActionConsentCallback, audit.ResourceToken, nil, audit.CodeUpstream).Detailf("erro=%s descricao=%s", providerErr, c.Query("error_description")))
+			c.JSON(http.StatusBadRequest, gin.H{"error": providerErr, "error_description": c.Query("error_description")})
+			return
+		}
+		if state == "" || code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "state e code obrigatórios"})
+			return
+		}
+
+		req, token, err := CompleteAuthorization(c.Request.Context(), conn, client, state, code, config.GetOAuthRedirectURL())
+		if err != nil {
+			if req != nil {
+				// O callback não é autenticado: o responsável é quem iniciou o consentimento
+				audit.SetActor(c, 0, req.User)
+			}
+			log.Printf("[AUDIT] [FAIL] Callback consentimento | erro=%v", err)
+			code := audit.CodeUpstream
+			if errors.Is(err, ErrInvalidState) {
+				code = audit.CodeInvalidInput
+			}
+			_ = audit.Record(c, conn, audit.Failed(audit.ActionConsentCallback, audit.ResourceToken, nil, code).Detailf("erro=%v", err))
+			if errors.Is(err, ErrInvalidState) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		audit.SetActor(c, 0, req.User)
+		log.Printf("[AUDIT] [OK] Callback consentimento | integration_id=%d | token_id=%d", token.IntegrationID, token.ID)
+		_ = audit.Record(c, conn, audit.Succeeded(audit.ActionConsentCallback, audit.ResourceToken, token.ID).Detailf("integration_id=%d token_id=%d", token.IntegrationID, token.ID))
+		c.JSON(http.StatusOK, gin.H{
+			"message":        "Autorização concluída",
+			"integration_id": token.IntegrationID,
+			"token_id":       token.ID,
+			"expires_at":     token.ExpiresAt,
+		})
+	})
+}
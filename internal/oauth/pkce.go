@@ -0,0 +1,32 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// randomString gera n bytes aleatórios codificados em base64url sem padding
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewState gera o parâmetro state usado contra CSRF no fluxo de autorização
+func NewState() (string, error) {
+	return randomString(24)
+}
+
+// NewCodeVerifier gera um code_verifier PKCE com 43 caracteres (RFC 7636, seção 4.1)
+func NewCodeVerifier() (string, error) {
+	return randomString(32)
+}
+
+// CodeChallengeS256 calcula o code_challenge do método S256 para o verifier informado
+func CodeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
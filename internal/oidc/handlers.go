@@ -0,0 +1,121 @@
+package oidc
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api-vault/internal/audit"
+	"api-vault/internal/auth"
+	"api-vault/internal/oauth"
+	"api-vault/internal/tenant"
+)
+
+func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware, provider *Provider, mapping Mapping) {
+	// Iniciar login SSO (aberto)
+	// @Summary Login SSO
+	// @Description Redireciona ao provedor OpenID Connect (authorization code + PKCE)
+	// @Tags sessões
+	// @Success 302
+	// @Failure 500 {object} gin.H
+	// @Router /auth/oidc/login [get]
+	r.GET("/auth/oidc/login", func(c *gin.Context) {
+		authorizeURL, req, err := provider.StartLogin(conn)
+		if err != nil {
+			log.Printf("[AUDIT] [FAIL] Início login SSO | erro=%v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// O state também fica num cookie do navegador que iniciou o login: um callback
+		// com o state de outra pessoa (login CSRF) não tem o cookie correspondente
+		setStateCookie(c, provider, req.State, int(loginRequestTTL.Seconds()))
+		c.Redirect(http.StatusFound, authorizeURL)
+	})
+
+	// Callback do login SSO (aberto: chamado pelo navegador ao voltar do provedor)
+	// @Summary Callback do login SSO
+	// @Description Valida o ID token, provisiona o usuário e emite o JWT como o /login
+	// @Tags sessões
+	// @Produce json
+	// @Param state query string true "State retornado pelo provedor"
+	// @Param code query string false "Código de autorização"
+	// @Param error query string false "Erro retornado pelo provedor"
+	// @Success 200 {object} gin.H
+	// @Failure 400,401,403,502 {object} gin.H
+	// @Router /auth/oidc/callback [get]
+	r.GET("/auth/oidc/callback", func(c *gin.Context) {
+		state := c.Query("state")
+		code := c.Query("code")
+		cookie, _ := c.Cookie(stateCookie)
+		setStateCookie(c, provider, "", -1)
+		sameBrowser := state != "" && subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) == 1
+		if providerErr := c.Query("error"); providerErr != "" {
+			// Descarta o state para que não possa ser reaproveitado
+			if sameBrowser {
+				conn.Where("state = ?", state).Delete(&LoginRequest{})
+			}
+			log.Printf("[AUDIT] [FAIL] Login SSO | erro=%s", providerErr)
+			_ = audit.Record(c, conn, audit.Failed(audit.ActionLoginSSO, audit.ResourceUser, nil, audit.CodeUpstream).Detailf("erro=%s descricao=%s", providerErr, c.Query("error_description")))
+			c.JSON(http.StatusBadRequest, gin.H{"error": providerErr, "error_description": c.Query("error_description")})
+			return
+		}
+		if state == "" || code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "state e code obrigatórios"})
+			return
+		}
+		if !sameBrowser {
+			log.Printf("[AUDIT] [FAIL] Login SSO | erro=state sem o cookie do navegador que iniciou o login")
+			_ = audit.Record(c, conn, audit.Failed(audit.ActionLoginSSO, audit.ResourceUser, nil, audit.CodeInvalidInput).Detailf("erro=state sem cookie correspondente"))
+			c.JSON(http.StatusBadRequest, gin.H{"error": oauth.ErrInvalidState.Error()})
+			return
+		}
+
+		claims, err := provider.HandleCallback(c.Request.Context(), conn, state, code)
+		if err != nil {
+			log.Printf("[AUDIT] [FAIL] Login SSO | erro=%v", err)
+			switch {
+			case errors.Is(err, oauth.ErrInvalidState):
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			case errors.Is(err, ErrInvalidIDToken):
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			}
+			_ = audit.Record(c, conn, audit.Failed(audit.ActionLoginSSO, audit.ResourceUser, nil, audit.CodeForStatus(c.Writer.Status())).Detailf("erro=%v", err))
+			return
+		}
+		subject, _ := claims["sub"].(string)
+		user, created, err := Provision(conn, provider.Issuer, mapping, claims)
+		if err != nil {
+			log.Printf("[AUDIT] [FAIL] Login SSO | sub=%s | erro=%v", subject, err)
+			_ = audit.Record(c, conn, audit.Failed(audit.ActionLoginSSO, audit.ResourceUser, nil, audit.CodeForbidden).Detailf("sub=%s erro=%v", subject, err))
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		db := tenant.ForOrg(conn, user.OrgID)
+		audit.SetActor(c, user.ID, user.Username)
+		if created {
+			log.Printf("[AUDIT] [OK] Provisionamento SSO | username=%s | role=%s | id=%d", user.Username, user.Role, user.ID)
+			_ = audit.Record(c, db, audit.Succeeded(audit.ActionSSOProvision, audit.ResourceUser, user.ID).WithChanges(audit.Diff(auth.User{}, user)).Detailf("id=%d sub=%s role=%s", user.ID, subject, user.Role))
+		}
+		log.Printf("[AUDIT] [OK] Login SSO | username=%s | role=%s", user.Username, user.Role)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionLoginSSO, audit.ResourceUser, user.ID).Detailf("sub=%s role=%s", subject, user.Role))
+		auth.CompleteLogin(c, conn, mw, user)
+	})
+}
+
+// Cookie com o state do login SSO em andamento
+const stateCookie = "oidc_state"
+
+// setStateCookie grava (ou apaga, com maxAge negativo) o cookie do state. SameSite=Lax
+// deixa o cookie acompanhar o redirecionamento de volta do provedor.
+func setStateCookie(c *gin.Context, provider *Provider, state string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(stateCookie, state, maxAge, "/auth/oidc", "", strings.HasPrefix(provider.RedirectURL, "https://"), true)
+}
@@ -0,0 +1,266 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+
+	"api-vault/internal/auth"
+	"api-vault/internal/authz"
+	"api-vault/internal/config"
+	"api-vault/internal/crypto"
+	"api-vault/internal/oauth"
+	"api-vault/internal/tenant"
+)
+
+// Tempo que o usuário tem para concluir o login no provedor
+const loginRequestTTL = 10 * time.Minute
+
+var (
+	// ErrNoRole indica que nenhum grupo do usuário está mapeado e não há papel padrão
+	ErrNoRole = errors.New("nenhum papel mapeado para os grupos do usuário")
+	// ErrUsernameTaken indica que o username do provedor pertence a um usuário local não vinculado
+	ErrUsernameTaken = errors.New("username já pertence a um usuário local")
+)
+
+// LoginRequest guarda state, nonce e code_verifier de um login SSO em andamento
+type LoginRequest struct {
+	ID           uint      `gorm:"primaryKey"`
+	State        string    `gorm:"not null;uniqueIndex"`
+	Nonce        string    `gorm:"not null"`
+	CodeVerifier string    `gorm:"not null"` // criptografado
+	ExpiresAt    time.Time `gorm:"not null"`
+	CreatedAt    time.Time
+}
+
+// codeVerifierField identifica o code_verifier do login nos dados associados da criptografia
+func codeVerifierField(id uint) crypto.Field {
+	return crypto.Field{Table: "login_requests", Column: "code_verifier", RecordID: id}
+}
+
+// Identity vincula um usuário local ao sujeito (sub) de um issuer OIDC
+type Identity struct {
+	ID          uint   `gorm:"primaryKey"`
+	Issuer      string `gorm:"not null;uniqueIndex:idx_oidc_identity"`
+	Subject     string `gorm:"not null;uniqueIndex:idx_oidc_identity"`
+	UserID      uint   `gorm:"not null;index"`
+	CreatedAt   time.Time
+	LastLoginAt time.Time
+}
+
+// StartLogin registra o login em andamento e retorna a URL de autorização do provedor
+func (p *Provider) StartLogin(conn *gorm.DB) (string, *LoginRequest, error) {
+	authURL, err := url.Parse(p.AuthorizationEndpoint)
+	if err != nil {
+		return "", nil, err
+	}
+	state, err := oauth.NewState()
+	if err != nil {
+		return "", nil, err
+	}
+	nonce, err := oauth.NewState()
+	if err != nil {
+		return "", nil, err
+	}
+	verifier, err := oauth.NewCodeVerifier()
+	if err != nil {
+		return "", nil, err
+	}
+	req := LoginRequest{
+		State:     state,
+		Nonce:     nonce,
+		ExpiresAt: p.Now().Add(loginRequestTTL),
+	}
+	// O code_verifier é vinculado ao ID do registro, conhecido só depois do insert
+	err = conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&req).Error; err != nil {
+			return err
+		}
+		encryptedVerifier, err := crypto.EncryptField(verifier, codeVerifierField(req.ID))
+		if err != nil {
+			return errors.New("erro ao criptografar code_verifier")
+		}
+		req.CodeVerifier = encryptedVerifier
+		return tx.Model(&req).Update("code_verifier", req.CodeVerifier).Error
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	q := authURL.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURL)
+	q.Set("scope", p.Scopes)
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", oauth.CodeChallengeS256(verifier))
+	q.Set("code_challenge_method", "S256")
+	authURL.RawQuery = q.Encode()
+	return authURL.String(), &req, nil
+}
+
+// HandleCallback consome o state, troca o código no provedor e valida o ID token
+func (p *Provider) HandleCallback(ctx context.Context, conn *gorm.DB, state, code string) (jwt.MapClaims, error) {
+	var req LoginRequest
+	if err := conn.WithContext(ctx).Where("state = ?", state).First(&req).Error; err != nil {
+		return nil, oauth.ErrInvalidState
+	}
+	// O state vale uma única vez, mesmo que a troca falhe
+	if res := conn.WithContext(ctx).Delete(&req); res.Error != nil || res.RowsAffected == 0 {
+		return nil, oauth.ErrInvalidState
+	}
+	if p.Now().After(req.ExpiresAt) {
+		return nil, oauth.ErrInvalidState
+	}
+	verifier, err := crypto.DecryptField(req.CodeVerifier, codeVerifierField(req.ID))
+	if err != nil {
+		return nil, fmt.Errorf("erro ao decriptografar code_verifier: %w", err)
+	}
+	resp, err := p.Client.ExchangeCode(ctx, p.TokenEndpoint, p.ClientID, p.ClientSecret, code, p.RedirectURL, verifier)
+	if err != nil {
+		return nil, err
+	}
+	if resp.IDToken == "" {
+		return nil, fmt.Errorf("%w: ausente na resposta do provedor", ErrInvalidIDToken)
+	}
+	return p.VerifyIDToken(ctx, resp.IDToken, req.Nonce)
+}
+
+// RoleRule associa um grupo do provedor a um papel local
+type RoleRule struct {
+	Group string
+	Role  string
+}
+
+// Mapping define como as claims do ID token viram usuário e papel locais
+type Mapping struct {
+	UsernameClaim string
+	GroupsClaim   string
+	Rules         []RoleRule // a primeira regra cujo grupo o usuário tem define o papel
+	DefaultRole   string     // vazio: recusa quem não está em nenhum grupo mapeado
+	OrgID         uint       // organização dos usuários provisionados
+}
+
+// MappingFromEnv lê o mapeamento de OIDC_USERNAME_CLAIM, OIDC_GROUPS_CLAIM,
+// OIDC_ROLE_MAPPING ("grupo=papel,...") e OIDC_DEFAULT_ROLE
+func MappingFromEnv() (Mapping, error) {
+	m := Mapping{
+		UsernameClaim: config.GetOIDCUsernameClaim(),
+		GroupsClaim:   config.GetOIDCGroupsClaim(),
+		DefaultRole:   config.GetOIDCDefaultRole(),
+		OrgID:         tenant.DefaultOrgID,
+	}
+	for _, pair := range strings.Split(config.GetOIDCRoleMapping(), ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(group) == "" || strings.TrimSpace(role) == "" {
+			return m, fmt.Errorf("OIDC_ROLE_MAPPING inválido: %q", pair)
+		}
+		m.Rules = append(m.Rules, RoleRule{Group: strings.TrimSpace(group), Role: strings.TrimSpace(role)})
+	}
+	return m, nil
+}
+
+// groups lê a claim de grupos, que pode ser lista ou texto único
+func (m Mapping) groups(claims jwt.MapClaims) []string {
+	switch v := claims[m.GroupsClaim].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// RoleFor resolve o papel local pelos grupos das claims
+func (m Mapping) RoleFor(claims jwt.MapClaims) (string, error) {
+	groups := m.groups(claims)
+	for _, rule := range m.Rules {
+		if authz.Contains(groups, rule.Group) {
+			return rule.Role, nil
+		}
+	}
+	if m.DefaultRole == "" {
+		return "", ErrNoRole
+	}
+	return m.DefaultRole, nil
+}
+
+// Provision encontra ou cria (just-in-time) o usuário local do sujeito e
+// sincroniza o papel com os grupos a cada login. O vínculo é pelo sub, nunca
+// pelo username: um usuário local existente não é assumido pelo SSO.
+func Provision(conn *gorm.DB, issuer string, m Mapping, claims jwt.MapClaims) (*auth.User, bool, error) {
+	subject, _ := claims["sub"].(string)
+	role, err := m.RoleFor(claims)
+	if err != nil {
+		return nil, false, err
+	}
+	var (
+		user    auth.User
+		created bool
+	)
+	err = conn.Transaction(func(tx *gorm.DB) error {
+		var identity Identity
+		err := tx.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil {
+			if err := tx.First(&user, identity.UserID).Error; err != nil {
+				return err
+			}
+			if user.Disabled {
+				return auth.ErrUserDisabled
+			}
+		} else {
+			username, _ := claims[m.UsernameClaim].(string)
+			if len(username) < 3 || len(username) > 32 {
+				return fmt.Errorf("claim %s inválida para username: %q", m.UsernameClaim, username)
+			}
+			var count int64
+			if err := tx.Model(&auth.User{}).Where("username = ?", username).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrUsernameTaken
+			}
+			// Sem senha local: o usuário só entra pelo SSO
+			user = auth.User{Username: username, Role: role, OrgID: m.OrgID}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			identity = Identity{Issuer: issuer, Subject: subject, UserID: user.ID}
+			created = true
+		}
+		if exists, err := authz.RoleExists(tenant.ForOrg(tx, user.OrgID), role); err != nil || !exists {
+			return fmt.Errorf("papel mapeado inexistente: %s", role)
+		}
+		if user.Role != role {
+			user.Role = role
+			if err := tx.Model(&user).Update("role", role).Error; err != nil {
+				return err
+			}
+		}
+		identity.LastLoginAt = time.Now()
+		return tx.Save(&identity).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &user, created, nil
+}
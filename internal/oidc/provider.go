@@ -0,0 +1,200 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+
+	"api-vault/internal/config"
+	"api-vault/internal/oauth"
+	"api-vault/internal/signing"
+)
+
+// Intervalo mínimo entre buscas do JWKS disparadas por kid desconhecido
+const jwksRefetchInterval = 30 * time.Second
+
+// Algoritmos aceitos na assinatura do ID token; "none" e HMAC nunca são aceitos
+var idTokenAlgorithms = []string{signing.AlgRS256, signing.AlgES256, signing.AlgEdDSA}
+
+// ErrInvalidIDToken cobre ID token com assinatura, issuer, audiência, validade ou nonce inválidos
+var ErrInvalidIDToken = errors.New("ID token inválido")
+
+// Provider é o provedor OpenID Connect (IdP) configurado, com os endpoints da descoberta
+type Provider struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       string
+
+	AuthorizationEndpoint string
+	TokenEndpoint         string
+	JWKSURI               string
+
+	Client     *oauth.Client
+	HTTPClient *http.Client
+	Now        func() time.Time
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	lastFetch time.Time
+}
+
+// discoveryDocument é o subconjunto usado de /.well-known/openid-configuration
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// ProviderFromEnv descobre o provedor configurado em OIDC_ISSUER; nil se o SSO não estiver configurado
+func ProviderFromEnv(ctx context.Context, httpClient *http.Client) (*Provider, error) {
+	issuer := config.GetOIDCIssuer()
+	if issuer == "" {
+		return nil, nil
+	}
+	p := &Provider{
+		Issuer:       issuer,
+		ClientID:     config.GetOIDCClientID(),
+		ClientSecret: config.GetOIDCClientSecret(),
+		RedirectURL:  config.GetOIDCRedirectURL(),
+		Scopes:       config.GetOIDCScopes(),
+	}
+	if p.ClientID == "" {
+		return nil, errors.New("OIDC_CLIENT_ID obrigatório com OIDC_ISSUER")
+	}
+	return p, p.Discover(ctx, httpClient)
+}
+
+// Discover busca os endpoints do provedor na descoberta OIDC e confere o issuer
+func (p *Provider) Discover(ctx context.Context, httpClient *http.Client) error {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 15 * time.Second}
+	}
+	p.HTTPClient = httpClient
+	p.Client = oauth.NewClient(httpClient)
+	if p.Now == nil {
+		p.Now = time.Now
+	}
+	var doc discoveryDocument
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", &doc); err != nil {
+		return fmt.Errorf("descoberta OIDC: %w", err)
+	}
+	// O issuer da descoberta precisa ser exatamente o configurado (OIDC Discovery, seção 4.3),
+	// pois é comparado sem normalização com o iss dos ID tokens e gravado nas identidades
+	if doc.Issuer != p.Issuer {
+		return fmt.Errorf("descoberta OIDC: issuer %q difere do configurado %q", doc.Issuer, p.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return errors.New("descoberta OIDC: endpoints ausentes")
+	}
+	p.AuthorizationEndpoint = doc.AuthorizationEndpoint
+	p.TokenEndpoint = doc.TokenEndpoint
+	p.JWKSURI = doc.JWKSURI
+	return nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// fetchKeys recarrega o JWKS do provedor; chaves em formato não suportado são ignoradas
+func (p *Provider) fetchKeys(ctx context.Context) error {
+	var set struct {
+		Keys []signing.JWK `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.JWKSURI, &set); err != nil {
+		return err
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if pub, err := jwk.PublicKey(); err == nil {
+			keys[jwk.Kid] = pub
+		}
+	}
+	p.keys = keys
+	p.lastFetch = p.Now()
+	return nil
+}
+
+// key devolve a chave pública do kid, recarregando o JWKS (com limite de frequência)
+// quando o provedor rotaciona as chaves
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.RLock()
+	pub, ok := p.keys[kid]
+	fresh := p.Now().Sub(p.lastFetch) < jwksRefetchInterval
+	p.mu.RUnlock()
+	if ok {
+		return pub, nil
+	}
+	if fresh {
+		return nil, fmt.Errorf("%w: kid desconhecido", ErrInvalidIDToken)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pub, ok := p.keys[kid]; ok {
+		return pub, nil
+	}
+	if err := p.fetchKeys(ctx); err != nil {
+		return nil, fmt.Errorf("JWKS do provedor: %w", err)
+	}
+	if pub, ok := p.keys[kid]; ok {
+		return pub, nil
+	}
+	return nil, fmt.Errorf("%w: kid desconhecido", ErrInvalidIDToken)
+}
+
+// VerifyIDToken valida assinatura, issuer, audiência, validade e nonce do ID token
+// (OIDC Core, seção 3.1.3.7) e devolve as claims
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	parser := jwt.NewParser(jwt.WithValidMethods(idTokenAlgorithms), jwt.WithoutClaimsValidation())
+	_, err := parser.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	now := p.Now().Unix()
+	switch {
+	case !claims.VerifyIssuer(p.Issuer, true):
+		return nil, fmt.Errorf("%w: issuer", ErrInvalidIDToken)
+	case !claims.VerifyAudience(p.ClientID, true):
+		return nil, fmt.Errorf("%w: audiência", ErrInvalidIDToken)
+	case !claims.VerifyExpiresAt(now, true):
+		return nil, fmt.Errorf("%w: expirado", ErrInvalidIDToken)
+	case !claims.VerifyNotBefore(now, false):
+		return nil, fmt.Errorf("%w: ainda não válido", ErrInvalidIDToken)
+	}
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, fmt.Errorf("%w: nonce", ErrInvalidIDToken)
+	}
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, fmt.Errorf("%w: sub ausente", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
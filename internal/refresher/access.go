@@ -0,0 +1,119 @@
+package refresher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"api-vault/internal/integrations"
+	"api-vault/internal/tokens"
+)
+
+// ErrNoToken indica que a integração ainda não possui token e não pode obter um sozinha
+var ErrNoToken = errors.New("integração sem token; autorização necessária")
+
+// AccessToken retorna um access token válido e decriptografado da integração.
+// Se o token em cache estiver vencido ou dentro de Lead, renova na hora; chamadas
+// simultâneas para a mesma integração compartilham uma única renovação.
+func (r *Refresher) AccessToken(ctx context.Context, integrationID uint) (string, time.Time, error) {
+	token, err := r.currentToken(ctx, integrationID)
+	if err != nil && !errors.Is(err, ErrNoToken) {
+		return "", time.Time{}, err
+	}
+	if err == nil && r.isFresh(token) {
+		return r.decryptAccess(token)
+	}
+
+	v, err, _ := r.group.Do(strconv.FormatUint(uint64(integrationID), 10), func() (interface{}, error) {
+		// A renovação é de todos os chamadores: o cancelamento da requisição que a
+		// iniciou não pode derrubá-la para os demais
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.Timeout)
+		defer cancel()
+		// Outro chamador pode ter renovado enquanto aguardávamos
+		token, err := r.currentToken(ctx, integrationID)
+		if errors.Is(err, ErrNoToken) {
+			return r.issueToken(ctx, integrationID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if r.isFresh(token) {
+			return token, nil
+		}
+		if err := r.Refresh(ctx, token); err != nil {
+			return nil, err
+		}
+		return token, nil
+	})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return r.decryptAccess(v.(*tokens.Token))
+}
+
+// currentToken busca o token mais recente da integração
+func (r *Refresher) currentToken(ctx context.Context, integrationID uint) (*tokens.Token, error) {
+	var token tokens.Token
+	err := r.conn.WithContext(ctx).Where("integration_id = ?", integrationID).Order("expires_at desc").First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNoToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token.Status == tokens.StatusReconsentRequired {
+		return nil, ErrReconsentRequired
+	}
+	return &token, nil
+}
+
+// issueToken obtém o primeiro token de uma integração client_credentials
+func (r *Refresher) issueToken(ctx context.Context, integrationID uint) (*tokens.Token, error) {
+	var integration integrations.Integration
+	if err := r.conn.WithContext(ctx).First(&integration, integrationID).Error; err != nil {
+		return nil, err
+	}
+	if integration.AuthType != "client_credentials" {
+		return nil, ErrNoToken
+	}
+	// Cria o registro já vencido e deixa o fluxo normal de renovação preenchê-lo
+	token := tokens.Token{
+		IntegrationID: integrationID,
+		OrgID:         integration.OrgID,
+		ExpiresAt:     r.Now(),
+		Status:        tokens.StatusActive,
+	}
+	err := r.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&token).Error; err != nil {
+			return err
+		}
+		if err := tokens.EncryptRefreshToken(&token, ""); err != nil {
+			return errors.New("erro ao criptografar RefreshToken")
+		}
+		return tx.Model(&token).Update("refresh_token", token.RefreshToken).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Refresh(ctx, &token); err != nil {
+		r.conn.Delete(&tokens.Token{}, token.ID)
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *Refresher) isFresh(token *tokens.Token) bool {
+	return token.ExpiresAt.After(r.Now().Add(r.Lead))
+}
+
+func (r *Refresher) decryptAccess(token *tokens.Token) (string, time.Time, error) {
+	access, err := tokens.DecryptAccessToken(token)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("erro ao decriptografar AccessToken: %w", err)
+	}
+	return access, token.ExpiresAt, nil
+}
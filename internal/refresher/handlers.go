@@ -0,0 +1,63 @@
+package refresher
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api-vault/internal/audit"
+	"api-vault/internal/authz"
+	"api-vault/internal/integrations"
+	"api-vault/internal/middleware"
+	"api-vault/internal/tenant"
+)
+
+func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware, rf *Refresher) {
+	// Obter access token válido (protegido)
+	// @Summary Obter access token válido
+	// @Description Retorna um access token válido da integração, renovando-o se estiver vencido ou perto de vencer
+	// @Tags integrações
+	// @Produce json
+	// @Param id path int true "ID da integração"
+	// @Success 200 {object} gin.H
+	// @Failure 400,403,404,409,502 {object} gin.H
+	// @Router /integrations/{id}/access-token [get]
+	r.GET("/integrations/:id/access-token", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermTokensUse), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		id := c.Param("id")
+		integrationID, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ID inválido"})
+			return
+		}
+		if _, ok := integrations.RequireAccess(c, db, uint(integrationID), integrations.AccessUse); !ok {
+			return
+		}
+		access, expiresAt, err := rf.AccessToken(c.Request.Context(), uint(integrationID))
+		if err != nil {
+			log.Printf("[AUDIT] [FAIL] Consulta access token | integration_id=%s | erro=%v", id, err)
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"error": "Integration not found"})
+			case errors.Is(err, ErrNoToken), errors.Is(err, ErrReconsentRequired):
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			default:
+				c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			}
+			_ = audit.Record(c, db, audit.Failed(audit.ActionTokenUse, audit.ResourceIntegration, id, audit.CodeForStatus(c.Writer.Status())).Detailf("integration_id=%s erro=%v", id, err))
+			return
+		}
+		log.Printf("[AUDIT] [OK] Consulta access token | integration_id=%s", id)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionTokenUse, audit.ResourceIntegration, id).Detailf("integration_id=%s", id))
+		c.JSON(http.StatusOK, gin.H{
+			"access_token": access,
+			"token_type":   "Bearer",
+			"expires_at":   expiresAt,
+		})
+	})
+}
@@ -0,0 +1,194 @@
+package refresher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"gorm.io/gorm"
+
+	"api-vault/internal/audit"
+	"api-vault/internal/config"
+	"api-vault/internal/integrations"
+	"api-vault/internal/oauth"
+	"api-vault/internal/tokens"
+)
+
+// Usuário registrado na auditoria para as renovações automáticas
+const auditUser = "refresher"
+
+// Validade assumida quando o endpoint de token não informa expires_in
+const defaultTokenTTL = time.Hour
+
+// ErrReconsentRequired indica que o refresh token foi rejeitado e o token precisa de nova autorização
+var ErrReconsentRequired = errors.New("refresh token inválido; nova autorização necessária")
+
+// Refresher renova em segundo plano os tokens próximos de expirar
+type Refresher struct {
+	conn   *gorm.DB
+	client *oauth.Client
+	// group garante uma única renovação em andamento por integração
+	group singleflight.Group
+
+	// Interval é o intervalo entre varreduras
+	Interval time.Duration
+	// Lead é a antecedência em relação ao ExpiresAt para renovar
+	Lead time.Duration
+	// Timeout limita a renovação sob demanda compartilhada pelos chamadores de AccessToken
+	Timeout time.Duration
+	// Now permite controlar o relógio nos testes
+	Now func() time.Time
+}
+
+// New cria um Refresher com intervalo e antecedência lidos da configuração
+func New(conn *gorm.DB, client *oauth.Client) *Refresher {
+	if client == nil {
+		client = oauth.NewClient(nil)
+	}
+	return &Refresher{
+		conn:     conn,
+		client:   client,
+		Interval: config.GetTokenRefreshInterval(),
+		Lead:     config.GetTokenRefreshLead(),
+		Timeout:  config.GetTokenRefreshTimeout(),
+		Now:      time.Now,
+	}
+}
+
+// Start executa varreduras periódicas até o contexto ser cancelado
+func (r *Refresher) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		if err := r.RunOnce(ctx); err != nil {
+			log.Printf("Erro na varredura de tokens: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce renova todos os tokens ativos que vencem dentro de Lead
+func (r *Refresher) RunOnce(ctx context.Context) error {
+	var due []tokens.Token
+	err := r.conn.WithContext(ctx).
+		Joins("JOIN integrations ON integrations.id = tokens.integration_id").
+		Where("integrations.auth_type IN ? AND tokens.status = ? AND tokens.expires_at <= ?",
+			[]string{"client_credentials", "authorization_code"}, tokens.StatusActive, r.Now().Add(r.Lead)).
+		Find(&due).Error
+	if err != nil {
+		return err
+	}
+	for i := range due {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// Falhas individuais já ficam na auditoria; segue para o próximo token
+		id := due[i].ID
+		_, _, _ = r.group.Do(strconv.FormatUint(uint64(due[i].IntegrationID), 10), func() (interface{}, error) {
+			// A lista foi lida antes do laço: outra instância ou um AccessToken
+			// pode ter renovado (e rotacionado o refresh token) desde então
+			var token tokens.Token
+			if err := r.conn.WithContext(ctx).First(&token, id).Error; err != nil {
+				return nil, err
+			}
+			if token.Status != tokens.StatusActive {
+				return nil, ErrReconsentRequired
+			}
+			if r.isFresh(&token) {
+				return &token, nil
+			}
+			return &token, r.Refresh(ctx, &token)
+		})
+	}
+	return nil
+}
+
+// Refresh obtém um novo access token para o token informado e persiste o resultado
+func (r *Refresher) Refresh(ctx context.Context, token *tokens.Token) error {
+	err := r.refresh(ctx, token)
+	if errors.Is(err, ErrReconsentRequired) {
+		log.Printf("[AUDIT] [FAIL] Token requer reconsentimento | id=%d | integration_id=%d | erro=%v", token.ID, token.IntegrationID, err)
+		_ = audit.SaveEvent(r.conn, auditUser, audit.Failed(audit.ActionTokenReconsent, audit.ResourceToken, token.ID, audit.CodeUpstream).Detailf("id=%d integration_id=%d erro=%v", token.ID, token.IntegrationID, err))
+		return err
+	}
+	if err != nil {
+		log.Printf("[AUDIT] [FAIL] Renovação token | id=%d | integration_id=%d | erro=%v", token.ID, token.IntegrationID, err)
+		_ = audit.SaveEvent(r.conn, auditUser, audit.Failed(audit.ActionTokenRefresh, audit.ResourceToken, token.ID, audit.CodeUpstream).Detailf("id=%d integration_id=%d erro=%v", token.ID, token.IntegrationID, err))
+		return err
+	}
+	log.Printf("[AUDIT] [OK] Renovação token | id=%d | integration_id=%d", token.ID, token.IntegrationID)
+	_ = audit.SaveEvent(r.conn, auditUser, audit.Succeeded(audit.ActionTokenRefresh, audit.ResourceToken, token.ID).Detailf("id=%d integration_id=%d expires_at=%s", token.ID, token.IntegrationID, token.ExpiresAt.Format(time.RFC3339)))
+	return nil
+}
+
+func (r *Refresher) refresh(ctx context.Context, token *tokens.Token) error {
+	var integration integrations.Integration
+	if err := r.conn.WithContext(ctx).First(&integration, token.IntegrationID).Error; err != nil {
+		return fmt.Errorf("integração não encontrada: %w", err)
+	}
+	clientSecret, err := integrations.DecryptSecret(&integration)
+	if err != nil {
+		return fmt.Errorf("erro ao decriptografar ClientSecret: %w", err)
+	}
+
+	var resp *oauth.TokenResponse
+	switch integration.AuthType {
+	case "client_credentials":
+		resp, err = r.client.ClientCredentials(ctx, integration.TokenURL, integration.ClientID, clientSecret)
+	case "authorization_code":
+		refreshToken, decErr := tokens.DecryptRefreshToken(token)
+		if decErr != nil {
+			return fmt.Errorf("erro ao decriptografar RefreshToken: %w", decErr)
+		}
+		if refreshToken == "" {
+			return r.markReconsentRequired(ctx, token, "refresh token ausente")
+		}
+		resp, err = r.client.RefreshToken(ctx, integration.TokenURL, integration.ClientID, clientSecret, refreshToken)
+		if oauth.IsInvalidGrant(err) {
+			return r.markReconsentRequired(ctx, token, err.Error())
+		}
+	default:
+		return fmt.Errorf("auth_type %q não suporta renovação", integration.AuthType)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tokens.EncryptAccessToken(token, resp.AccessToken); err != nil {
+		return errors.New("erro ao criptografar AccessToken")
+	}
+	// Servidores que rotacionam o refresh token devolvem um novo; caso contrário mantém o atual
+	if resp.RefreshToken != "" {
+		if err := tokens.EncryptRefreshToken(token, resp.RefreshToken); err != nil {
+			return errors.New("erro ao criptografar RefreshToken")
+		}
+	}
+	token.ExpiresAt = expiresAt(r.Now(), resp.ExpiresIn)
+	token.Status = tokens.StatusActive
+	return r.conn.WithContext(ctx).Save(token).Error
+}
+
+// markReconsentRequired tira o token da renovação automática até uma nova autorização
+func (r *Refresher) markReconsentRequired(ctx context.Context, token *tokens.Token, reason string) error {
+	token.Status = tokens.StatusReconsentRequired
+	if err := r.conn.WithContext(ctx).Model(token).Update("status", token.Status).Error; err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s", ErrReconsentRequired, reason)
+}
+
+// expiresAt converte o expires_in (segundos) da resposta em instante absoluto
+func expiresAt(now time.Time, expiresIn int64) time.Time {
+	if expiresIn <= 0 {
+		return now.Add(defaultTokenTTL)
+	}
+	return now.Add(time.Duration(expiresIn) * time.Second)
+}
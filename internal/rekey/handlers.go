@@ -0,0 +1,62 @@
+package rekey
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api-vault/internal/authz"
+	"api-vault/internal/middleware"
+)
+
+func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
+	// Iniciar ou retomar recriptografia (protegido, keys:rotate)
+	// @Summary Recriptografar segredos
+	// @Description Inicia (ou retoma) a recriptografia de todos os segredos com a chave mestra atual
+	// @Tags admin
+	// @Produce json
+	// @Success 202 {object} Job
+	// @Failure 403,409,500 {object} gin.H
+	// @Router /admin/rekey [post]
+	r.POST("/admin/rekey", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermKeysRotate), func(c *gin.Context) {
+		username, _ := jwt.ExtractClaims(c)["username"].(string)
+		job, err := Start(conn, username)
+		if errors.Is(err, ErrJobRunning) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Recriptografia já em andamento"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		go func(job Job) {
+			if err := Run(context.Background(), conn, &job, DefaultBatchSize); err != nil {
+				log.Printf("Erro na recriptografia: %v", err)
+			}
+		}(*job)
+		c.JSON(http.StatusAccepted, job)
+	})
+
+	// Consultar job de recriptografia (protegido, keys:rotate)
+	// @Summary Consultar recriptografia
+	// @Description Retorna o progresso de um job de recriptografia
+	// @Tags admin
+	// @Produce json
+	// @Param id path int true "ID do job"
+	// @Success 200 {object} Job
+	// @Failure 403,404 {object} gin.H
+	// @Router /admin/rekey/{id} [get]
+	r.GET("/admin/rekey/:id", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermKeysRotate), func(c *gin.Context) {
+		var job Job
+		if err := conn.First(&job, c.Param("id")).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	})
+}
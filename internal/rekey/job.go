@@ -0,0 +1,303 @@
+package rekey
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"api-vault/internal/audit"
+	"api-vault/internal/crypto"
+)
+
+// Situações de um job de recriptografia
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed" // interrompido; pode ser retomado
+)
+
+// Tamanho padrão do lote processado em cada transação
+const DefaultBatchSize = 100
+
+// Um job em execução grava o progresso a cada lote; sem gravação por esse tempo
+// (processo encerrado no meio do job) ele pode ser retomado por outra instância
+const staleAfter = 10 * time.Minute
+
+// ErrJobRunning indica que outro processo já executa a recriptografia
+var ErrJobRunning = errors.New("recriptografia já em andamento")
+
+// Job registra o progresso da recriptografia para permitir retomada
+type Job struct {
+	ID         uint   `gorm:"primaryKey"`
+	Status     string `gorm:"not null;index"`
+	Step       string // tabela em processamento
+	LastID     uint   // último ID concluído na tabela atual
+	KeyID      string // chave mestra de destino
+	Processed  int    // valores recriptografados
+	Skipped    int    // valores que já usavam a chave atual
+	Failed     int    // valores que não puderam ser decifrados
+	Conflicts  int    // registros alterados durante o lote; relidos no lote seguinte
+	StartedBy  string
+	LastError  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	FinishedAt *time.Time
+}
+
+func (Job) TableName() string {
+	return "rekey_jobs"
+}
+
+// target descreve uma tabela e as colunas cifradas que ela guarda
+type target struct {
+	table   string
+	columns []string
+	filter  string // restringe às linhas que têm segredo, quando a coluna é opcional
+}
+
+// Ordem em que as tabelas são percorridas
+var targets = []target{
+	{table: "integrations", columns: []string{"client_secret"}},
+	{table: "tokens", columns: []string{"access_token", "refresh_token"}},
+	{table: "signing_keys", columns: []string{"private_key"}},
+	{table: "users", columns: []string{"mfa_secret"}, filter: "mfa_secret <> ''"},
+}
+
+// Start retoma o último job não concluído ou cria um novo, já marcado como em
+// execução. A retomada só acontece se a atualização condicional da situação
+// afetar a linha, de modo que duas instâncias não executam o mesmo job;
+// ErrJobRunning se outro processo o executa.
+func Start(conn *gorm.DB, user string) (*Job, error) {
+	var job Job
+	err := conn.Where("status IN ?", []string{StatusRunning, StatusFailed}).Order("id desc").First(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		job = Job{Status: StatusRunning, Step: targets[0].table, StartedBy: user}
+		if err := conn.Create(&job).Error; err != nil {
+			return nil, err
+		}
+		return &job, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	res := conn.Model(&Job{}).
+		Where("id = ? AND (status = ? OR (status = ? AND updated_at < ?))", job.ID, StatusFailed, StatusRunning, now.Add(-staleAfter)).
+		Updates(map[string]interface{}{"status": StatusRunning, "updated_at": now})
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrJobRunning
+	}
+	job.Status = StatusRunning
+	job.UpdatedAt = now
+	return &job, nil
+}
+
+// Run percorre todos os segredos em lotes transacionais, decifrando com a chave
+// de origem e cifrando com a chave atual, vinculado à tabela/coluna/registro.
+// O cursor é salvo junto com cada lote.
+func Run(ctx context.Context, conn *gorm.DB, job *Job, batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	keyID, err := crypto.CurrentKeyID()
+	if err != nil {
+		return fail(conn, job, err)
+	}
+	job.KeyID = keyID
+	job.Status = StatusRunning
+	job.LastError = ""
+	if err := conn.Save(job).Error; err != nil {
+		return err
+	}
+	log.Printf("[AUDIT] [OK] Início recriptografia | job=%d | chave=%s | tabela=%s | ultimo_id=%d", job.ID, keyID, job.Step, job.LastID)
+	_ = audit.SaveEvent(conn, job.StartedBy, audit.Succeeded(audit.ActionRekeyStart, audit.ResourceRekeyJob, job.ID).Detailf("job=%d chave=%s tabela=%s ultimo_id=%d", job.ID, keyID, job.Step, job.LastID))
+
+	for i := stepIndex(job.Step); i < len(targets); i++ {
+		t := targets[i]
+		if job.Step != t.table {
+			job.Step = t.table
+			job.LastID = 0
+		}
+		for {
+			if err := ctx.Err(); err != nil {
+				return fail(conn, job, err)
+			}
+			n, conflicts, err := runBatch(conn, job, t, keyID, batchSize)
+			if err != nil {
+				return fail(conn, job, err)
+			}
+			if n < batchSize && conflicts == 0 {
+				break
+			}
+		}
+	}
+
+	now := time.Now()
+	job.Status = StatusCompleted
+	job.FinishedAt = &now
+	if err := conn.Save(job).Error; err != nil {
+		return err
+	}
+	if job.Failed == 0 {
+		crypto.SetRequireAAD(true)
+	}
+	log.Printf("[AUDIT] [OK] Fim recriptografia | job=%d | processados=%d | ignorados=%d | falhas=%d | conflitos=%d", job.ID, job.Processed, job.Skipped, job.Failed, job.Conflicts)
+	_ = audit.SaveEvent(conn, job.StartedBy, audit.Succeeded(audit.ActionRekeyFinish, audit.ResourceRekeyJob, job.ID).Detailf("job=%d processados=%d ignorados=%d falhas=%d conflitos=%d", job.ID, job.Processed, job.Skipped, job.Failed, job.Conflicts))
+	return nil
+}
+
+// runBatch recriptografa um lote da tabela e avança o cursor na mesma transação.
+// Cada UPDATE exige que a coluna ainda tenha o valor lido: se uma escrita
+// concorrente a alterou, o registro conta como conflito, o cursor para antes
+// dele e o próximo lote o relê em vez de sobrescrever o valor novo.
+func runBatch(conn *gorm.DB, job *Job, t target, keyID string, batchSize int) (int, int, error) {
+	var rows []map[string]interface{}
+	progress := *job
+	var failures []string
+	conflicts := 0
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		// Table() ignora o soft delete: tokens removidos também guardam segredos
+		query := tx.Table(t.table).Select(append([]string{"id"}, t.columns...)).Where("id > ?", job.LastID)
+		if t.filter != "" {
+			query = query.Where(t.filter)
+		}
+		err := query.Order("id").Limit(batchSize).Find(&rows).Error
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			id := toUint(row["id"])
+			// Contagem do registro, aplicada só se o UPDATE não conflitar
+			var processed, skipped int
+			var rowFailures []string
+			updates := map[string]interface{}{}
+			update := tx.Table(t.table).Where("id = ?", id)
+			for _, col := range t.columns {
+				value := toString(row[col])
+				field := crypto.Field{Table: t.table, Column: col, RecordID: id}
+				if crypto.IsBound(value) && crypto.KeyID(value) == keyID {
+					skipped++
+					continue
+				}
+				plain, err := decrypt(value, field)
+				if err != nil {
+					rowFailures = append(rowFailures, fmt.Sprintf("tabela=%s id=%d coluna=%s erro=%v", t.table, id, col, err))
+					continue
+				}
+				reencrypted, err := crypto.EncryptField(plain, field)
+				if err != nil {
+					return err
+				}
+				updates[col] = reencrypted
+				update = update.Where(col+" = ?", value)
+				processed++
+			}
+			if len(updates) > 0 {
+				res := update.UpdateColumns(updates)
+				if res.Error != nil {
+					return res.Error
+				}
+				if res.RowsAffected == 0 {
+					conflicts++
+					break
+				}
+			}
+			progress.Processed += processed
+			progress.Skipped += skipped
+			progress.Failed += len(rowFailures)
+			failures = append(failures, rowFailures...)
+			progress.LastID = id
+		}
+		progress.Conflicts += conflicts
+		return tx.Model(&Job{ID: job.ID}).Updates(map[string]interface{}{
+			"step":      t.table,
+			"last_id":   progress.LastID,
+			"processed": progress.Processed,
+			"skipped":   progress.Skipped,
+			"failed":    progress.Failed,
+			"conflicts": progress.Conflicts,
+		}).Error
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	*job = progress
+	job.Step = t.table
+	for _, f := range failures {
+		log.Printf("[AUDIT] [FAIL] Recriptografia registro | job=%d | %s", job.ID, f)
+		_ = audit.SaveEvent(conn, job.StartedBy, audit.Failed(audit.ActionRekeyRecord, audit.ResourceRekeyJob, job.ID, audit.CodeInternal).Detailf("job=%d %s", job.ID, f))
+	}
+	if len(rows) > 0 {
+		_ = audit.SaveEvent(conn, job.StartedBy, audit.Succeeded(audit.ActionRekeyBatch, audit.ResourceRekeyJob, job.ID).Detailf("job=%d tabela=%s ultimo_id=%d processados=%d conflitos=%d", job.ID, t.table, job.LastID, job.Processed, conflicts))
+	}
+	return len(rows), conflicts, nil
+}
+
+// Migrated indica se alguma recriptografia terminou sem falhas, isto é, se todos
+// os segredos das colunas vinculadas já estão no formato v2
+func Migrated(conn *gorm.DB) (bool, error) {
+	var count int64
+	err := conn.Model(&Job{}).Where("status = ? AND failed = 0", StatusCompleted).Count(&count).Error
+	return count > 0, err
+}
+
+// fail marca o job como interrompido, preservando o cursor para retomada
+func fail(conn *gorm.DB, job *Job, cause error) error {
+	job.Status = StatusFailed
+	job.LastError = cause.Error()
+	_ = conn.Model(&Job{ID: job.ID}).Updates(map[string]interface{}{"status": job.Status, "last_error": job.LastError}).Error
+	log.Printf("[AUDIT] [FAIL] Recriptografia interrompida | job=%d | tabela=%s | ultimo_id=%d | erro=%v", job.ID, job.Step, job.LastID, cause)
+	_ = audit.SaveEvent(conn, job.StartedBy, audit.Failed(audit.ActionRekeyFinish, audit.ResourceRekeyJob, job.ID, audit.CodeInternal).Detailf("job=%d tabela=%s ultimo_id=%d erro=%v", job.ID, job.Step, job.LastID, cause))
+	return cause
+}
+
+// decrypt abre valores vinculados ou não; os sem vínculo (legados) são migrados
+// mesmo com a recusa de DecryptField ativa
+func decrypt(value string, field crypto.Field) (string, error) {
+	if crypto.IsBound(value) {
+		return crypto.DecryptField(value, field)
+	}
+	return crypto.Decrypt(value)
+}
+
+func stepIndex(step string) int {
+	for i, t := range targets {
+		if t.table == step {
+			return i
+		}
+	}
+	return 0
+}
+
+func toUint(v interface{}) uint {
+	switch n := v.(type) {
+	case int64:
+		return uint(n)
+	case int32:
+		return uint(n)
+	case int:
+		return uint(n)
+	case uint:
+		return n
+	case uint64:
+		return uint(n)
+	}
+	return 0
+}
+
+func toString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case []byte:
+		return string(s)
+	}
+	return ""
+}
@@ -0,0 +1,59 @@
+package signing
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api-vault/internal/audit"
+	"api-vault/internal/authz"
+	"api-vault/internal/middleware"
+)
+
+// RegisterRoutes publica o JWKS e a rotação manual. Com ring nil (HS256) o JWKS é vazio.
+func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware, ring *Keyring) {
+	// Chaves públicas de verificação dos JWTs (público)
+	// @Summary JWKS
+	// @Description Chaves públicas que verificam os JWTs emitidos, identificadas por kid
+	// @Tags auth
+	// @Produce json
+	// @Success 200 {object} gin.H
+	// @Router /.well-known/jwks.json [get]
+	r.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		keys := []JWK{}
+		if ring != nil {
+			keys = ring.JWKS()
+		}
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, gin.H{"keys": keys})
+	})
+
+	// Rotacionar a chave de assinatura JWT (protegido, keys:rotate)
+	// @Summary Rotacionar chave JWT
+	// @Description Gera uma nova chave de assinatura; a anterior continua verificando os JWTs já emitidos
+	// @Tags admin
+	// @Produce json
+	// @Success 201 {object} gin.H
+	// @Failure 403,409,500 {object} gin.H
+	// @Router /admin/jwt-keys/rotate [post]
+	r.POST("/admin/jwt-keys/rotate", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermKeysRotate), func(c *gin.Context) {
+		username, _ := jwt.ExtractClaims(c)["username"].(string)
+		if ring == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Assinatura HS256 não usa chaves rotacionáveis; configure JWT_SIGNING_ALG"})
+			return
+		}
+		key, err := ring.Rotate()
+		if err != nil {
+			log.Printf("[AUDIT] [FAIL] Rotação chave JWT | user=%s | erro=%v", username, err)
+			_ = audit.Record(c, conn, audit.Failed(audit.ActionSigningKeyRotate, audit.ResourceSigningKey, nil, audit.CodeInternal).Detailf("%v", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("[AUDIT] [OK] Rotação chave JWT | user=%s | kid=%s", username, key.KID)
+		_ = audit.Record(c, conn, audit.Succeeded(audit.ActionSigningKeyRotate, audit.ResourceSigningKey, key.KID).Detailf("kid=%s", key.KID))
+		c.JSON(http.StatusCreated, gin.H{"kid": key.KID, "algorithm": key.Algorithm, "created_at": key.CreatedAt})
+	})
+}
@@ -0,0 +1,448 @@
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+
+	vaultcrypto "api-vault/internal/crypto"
+)
+
+// Algoritmos assimétricos suportados para assinar JWTs
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Intervalo mínimo entre recargas do banco disparadas por kid desconhecido
+const reloadThrottle = 30 * time.Second
+
+var (
+	// ErrUnsupportedAlgorithm indica um algoritmo fora de RS256, ES256 e EdDSA
+	ErrUnsupportedAlgorithm = errors.New("algoritmo de assinatura não suportado")
+	// ErrUnknownKey indica um JWT com kid ausente, desconhecido ou já fora da janela de verificação
+	ErrUnknownKey = errors.New("chave de assinatura desconhecida ou expirada")
+
+	// errRotationLost indica que outra instância aposentou a chave antes desta
+	errRotationLost = errors.New("chave corrente já foi trocada por outra instância")
+)
+
+// IsAsymmetric informa se o algoritmo é um dos assinados com chave privada do keyring
+func IsAsymmetric(alg string) bool {
+	switch alg {
+	case AlgRS256, AlgES256, AlgEdDSA:
+		return true
+	}
+	return false
+}
+
+// SigningKey é um par de chaves de assinatura de JWT. A chave privada (PKCS#8)
+// fica cifrada com a chave mestra, vinculada ao ID do registro.
+type SigningKey struct {
+	ID         uint   `gorm:"primaryKey"`
+	KID        string `gorm:"not null;uniqueIndex"`
+	Algorithm  string `gorm:"not null"`
+	PrivateKey string `gorm:"not null"`
+	PublicKey  string `gorm:"not null"` // PKIX DER em base64
+	CreatedAt  time.Time
+	RetiredAt  *time.Time // deixa de assinar; ainda verifica até RetiredAt + Grace
+}
+
+// privateKeyField vincula a chave privada cifrada à linha da tabela
+func privateKeyField(id uint) vaultcrypto.Field {
+	return vaultcrypto.Field{Table: "signing_keys", Column: "private_key", RecordID: id}
+}
+
+// loadedKey é uma chave já decifrada em memória
+type loadedKey struct {
+	record  SigningKey
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// Keyring assina JWTs com a chave corrente e verifica com todas as chaves ainda válidas
+type Keyring struct {
+	conn *gorm.DB
+	alg  string
+
+	mu         sync.RWMutex
+	current    *loadedKey
+	keys       map[string]*loadedKey
+	lastReload time.Time
+
+	// Grace é por quanto tempo uma chave aposentada continua verificando (validade do JWT)
+	Grace time.Duration
+	// RotationInterval é a idade a partir da qual a chave corrente é trocada
+	RotationInterval time.Duration
+	// CheckInterval é o intervalo entre verificações do worker de rotação
+	CheckInterval time.Duration
+	// Now permite controlar o relógio nos testes
+	Now func() time.Time
+}
+
+// New cria o keyring do algoritmo informado e carrega as chaves do banco,
+// gerando a primeira se ainda não houver nenhuma
+func New(conn *gorm.DB, alg string, grace, rotationInterval time.Duration) (*Keyring, error) {
+	if !IsAsymmetric(alg) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, alg)
+	}
+	k := &Keyring{
+		conn:             conn,
+		alg:              alg,
+		keys:             map[string]*loadedKey{},
+		Grace:            grace,
+		RotationInterval: rotationInterval,
+		CheckInterval:    time.Hour,
+		Now:              time.Now,
+	}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	if k.Current() == nil {
+		if _, err := k.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// Algorithm devolve o algoritmo usado pelo keyring
+func (k *Keyring) Algorithm() string {
+	return k.alg
+}
+
+// Current devolve a chave que assina os novos JWTs (nil se não houver)
+func (k *Keyring) Current() *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.current == nil {
+		return nil
+	}
+	record := k.current.record
+	return &record
+}
+
+// Reload lê do banco as chaves do algoritmo que ainda verificam; chaves
+// criadas por outra instância passam a ser aceitas
+func (k *Keyring) Reload() error {
+	cutoff := k.Now().Add(-k.Grace)
+	var records []SigningKey
+	err := k.conn.Where("algorithm = ? AND (retired_at IS NULL OR retired_at > ?)", k.alg, cutoff).
+		Order("created_at, id").Find(&records).Error
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]*loadedKey, len(records))
+	var current *loadedKey
+	for _, record := range records {
+		loaded, err := k.decode(record)
+		if err != nil {
+			return fmt.Errorf("chave %s: %w", record.KID, err)
+		}
+		keys[record.KID] = loaded
+		// A mais nova ainda não aposentada assina
+		if record.RetiredAt == nil {
+			current = loaded
+		}
+	}
+	k.mu.Lock()
+	k.keys, k.current, k.lastReload = keys, current, k.Now()
+	k.mu.Unlock()
+	return nil
+}
+
+// Rotate gera uma nova chave, passa a assinar com ela e aposenta a anterior,
+// que continua verificando por Grace
+func (k *Keyring) Rotate() (*SigningKey, error) {
+	return k.rotate(nil)
+}
+
+// rotate faz a rotação; com replaces, só aposenta se ela ainda for a chave corrente
+// no banco e devolve errRotationLost se outra instância já a tiver trocado
+func (k *Keyring) rotate(replaces *SigningKey) (*SigningKey, error) {
+	private, err := generate(k.alg)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	kid, err := newKID()
+	if err != nil {
+		return nil, err
+	}
+	record := SigningKey{KID: kid, Algorithm: k.alg, PrivateKey: "-", PublicKey: base64.StdEncoding.EncodeToString(pub), CreatedAt: k.Now()}
+	err = k.conn.Transaction(func(tx *gorm.DB) error {
+		// A chave privada é vinculada ao ID, então o registro é criado antes de cifrá-la
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+		cipherText, err := vaultcrypto.EncryptField(base64.StdEncoding.EncodeToString(der), privateKeyField(record.ID))
+		if err != nil {
+			return err
+		}
+		record.PrivateKey = cipherText
+		if err := tx.Model(&record).Update("private_key", cipherText).Error; err != nil {
+			return err
+		}
+		if replaces != nil {
+			result := tx.Model(&SigningKey{}).
+				Where("id = ? AND retired_at IS NULL", replaces.ID).
+				Update("retired_at", k.Now())
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errRotationLost
+			}
+		}
+		return tx.Model(&SigningKey{}).
+			Where("algorithm = ? AND id <> ? AND retired_at IS NULL", k.alg, record.ID).
+			Update("retired_at", k.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := k.Reload(); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// RotateIfDue troca a chave corrente se ela for mais antiga que RotationInterval.
+// Com várias instâncias, só a primeira a aposentar a chave vencida faz a troca;
+// as demais passam a usar a chave que ela gerou.
+func (k *Keyring) RotateIfDue() (bool, error) {
+	// Outra instância pode já ter rotacionado desde a última leitura
+	if err := k.Reload(); err != nil {
+		return false, err
+	}
+	current := k.Current()
+	if current != nil && k.Now().Sub(current.CreatedAt) < k.RotationInterval {
+		return false, nil
+	}
+	_, err := k.rotate(current)
+	if errors.Is(err, errRotationLost) {
+		return false, k.Reload()
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Start executa a rotação programada até o contexto ser cancelado
+func (k *Keyring) Start(ctx context.Context) {
+	ticker := time.NewTicker(k.CheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		rotated, err := k.RotateIfDue()
+		if err != nil {
+			log.Printf("Erro na rotação da chave de assinatura JWT: %v", err)
+			continue
+		}
+		if rotated {
+			log.Printf("[AUDIT] [OK] Rotação chave JWT | kid=%s", k.Current().KID)
+		}
+	}
+}
+
+// Sign assina as claims com a chave corrente, identificada no header kid
+func (k *Keyring) Sign(claims jwt.MapClaims) (string, error) {
+	k.mu.RLock()
+	current := k.current
+	k.mu.RUnlock()
+	if current == nil {
+		return "", ErrUnknownKey
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(k.alg), claims)
+	token.Header["kid"] = current.record.KID
+	return token.SignedString(current.private)
+}
+
+// KeyFunc resolve a chave pública pelo kid do JWT, exigindo o algoritmo do keyring
+func (k *Keyring) KeyFunc(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != k.alg {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, token.Method.Alg())
+	}
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, ErrUnknownKey
+	}
+	key := k.lookup(kid)
+	if key == nil && k.Now().Sub(k.lastReloadAt()) > reloadThrottle {
+		if err := k.Reload(); err != nil {
+			return nil, err
+		}
+		key = k.lookup(kid)
+	}
+	if key == nil || !k.verifies(key.record) {
+		return nil, ErrUnknownKey
+	}
+	return key.public, nil
+}
+
+func (k *Keyring) lookup(kid string) *loadedKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.keys[kid]
+}
+
+func (k *Keyring) lastReloadAt() time.Time {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.lastReload
+}
+
+// verifies informa se a chave ainda está dentro da janela de verificação
+func (k *Keyring) verifies(record SigningKey) bool {
+	return record.RetiredAt == nil || k.Now().Before(record.RetiredAt.Add(k.Grace))
+}
+
+func (k *Keyring) decode(record SigningKey) (*loadedKey, error) {
+	plain, err := vaultcrypto.DecryptField(record.PrivateKey, privateKeyField(record.ID))
+	if err != nil {
+		return nil, err
+	}
+	der, err := base64.StdEncoding.DecodeString(plain)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	return &loadedKey{record: record, private: signer, public: signer.Public()}, nil
+}
+
+// generate cria uma chave privada do algoritmo pedido
+func generate(alg string) (crypto.Signer, error) {
+	switch alg {
+	case AlgRS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case AlgES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		return private, err
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlgorithm, alg)
+}
+
+func newKID() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// JWK é a representação pública de uma chave (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS devolve as chaves públicas que ainda verificam, para validação por terceiros
+func (k *Keyring) JWKS() []JWK {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	list := make([]JWK, 0, len(k.keys))
+	for _, key := range k.keys {
+		if !k.verifies(key.record) {
+			continue
+		}
+		jwk := JWK{Kid: key.record.KID, Alg: key.record.Algorithm, Use: "sig"}
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			jwk.Kty, jwk.Crv = "EC", pub.Curve.Params().Name
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+			jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+		case ed25519.PublicKey:
+			jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		list = append(list, jwk)
+	}
+	return list
+}
+
+// PublicKey reconstrói a chave pública do JWK, para verificar JWTs de terceiros (ex.: ID tokens OIDC)
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch {
+	case j.Kty == "RSA":
+		n, err := decode(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(j.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case j.Kty == "EC" && j.Crv == "P-256":
+		x, err := decode(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("ponto fora da curva P-256")
+		}
+		return pub, nil
+	case j.Kty == "OKP" && j.Crv == "Ed25519":
+		x, err := decode(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("chave Ed25519 inválida")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("%w: kty=%s crv=%s", ErrUnsupportedAlgorithm, j.Kty, j.Crv)
+}
@@ -0,0 +1,180 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Coluna que identifica a organização dona do registro
+const orgColumn = "org_id"
+
+// Claim do JWT com a organização do usuário
+const ClaimKey = "org_id"
+
+// Organização criada na migração; recebe os dados anteriores ao multi-tenant
+// e os auto cadastros (OPEN_SIGNUP)
+const DefaultOrgID uint = 1
+
+// Organization isola usuários, integrações, tokens e auditoria de uma unidade de negócio
+type Organization struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"not null;uniqueIndex"`
+	CreatedAt time.Time
+}
+
+type ctxKey struct{}
+
+// noOrgKey marca o contexto de uma requisição sem organização: nada é lido nem gravado
+type noOrgKey struct{}
+
+// ErrNoOrg recusa gravações feitas por requisições sem organização
+var ErrNoOrg = errors.New("requisição sem organização")
+
+// WithOrg marca o contexto com a organização; consultas feitas com ele são filtradas
+func WithOrg(ctx context.Context, orgID uint) context.Context {
+	return context.WithValue(ctx, ctxKey{}, orgID)
+}
+
+// FromContext devolve a organização do contexto, se houver
+func FromContext(ctx context.Context) (uint, bool) {
+	orgID, ok := ctx.Value(ctxKey{}).(uint)
+	return orgID, ok
+}
+
+// OrgID lê a organização das claims do JWT da requisição; 0 se ausente,
+// o que não corresponde a nenhuma organização real
+func OrgID(c *gin.Context) uint {
+	if v, ok := jwt.ExtractClaims(c)[ClaimKey].(float64); ok {
+		return uint(v)
+	}
+	return 0
+}
+
+// Scoped devolve a conexão restrita à organização do usuário autenticado. Sem
+// organização nas claims (rota sem JWT) a conexão não enxerga nenhum registro
+// e recusa inserts, em vez de cair no modo sem filtro dos workers.
+func Scoped(c *gin.Context, conn *gorm.DB) *gorm.DB {
+	orgID := OrgID(c)
+	if orgID == 0 {
+		ctx := conn.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		return conn.WithContext(context.WithValue(ctx, noOrgKey{}, true))
+	}
+	return ForOrg(conn, orgID)
+}
+
+// denied indica uma requisição sem organização, a menos que ForOrg tenha definido uma depois
+func denied(ctx context.Context) bool {
+	if _, ok := FromContext(ctx); ok {
+		return false
+	}
+	v, _ := ctx.Value(noOrgKey{}).(bool)
+	return v
+}
+
+// ForOrg devolve a conexão restrita a uma organização
+func ForOrg(conn *gorm.DB, orgID uint) *gorm.DB {
+	ctx := conn.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return conn.WithContext(WithOrg(ctx, orgID))
+}
+
+// Register instala os callbacks que filtram por org_id toda consulta, alteração e
+// remoção feita com contexto de organização, e preenchem org_id nos inserts.
+// Sem organização no contexto (workers, CLI) nada é filtrado; requisições sem
+// organização (ver Scoped) não enxergam nada.
+func Register(db *gorm.DB) error {
+	cb := db.Callback()
+	return errors.Join(
+		cb.Query().Before("gorm:query").Register("tenant:query", filter),
+		cb.Row().Before("gorm:row").Register("tenant:row", filter),
+		cb.Update().Before("gorm:update").Register("tenant:update", filter),
+		cb.Delete().Before("gorm:delete").Register("tenant:delete", filter),
+		cb.Create().Before("gorm:create").Register("tenant:create", assign),
+	)
+}
+
+func filter(db *gorm.DB) {
+	if db.Statement.Schema == nil {
+		return
+	}
+	if _, ok := db.Statement.Schema.FieldsByDBName[orgColumn]; !ok {
+		return
+	}
+	if denied(db.Statement.Context) {
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "1 = 0"}}})
+		return
+	}
+	orgID, ok := FromContext(db.Statement.Context)
+	if !ok {
+		return
+	}
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: db.Statement.Table, Name: orgColumn}, Value: orgID},
+	}})
+}
+
+func assign(db *gorm.DB) {
+	if db.Statement.Schema == nil {
+		return
+	}
+	field, ok := db.Statement.Schema.FieldsByDBName[orgColumn]
+	if !ok {
+		return
+	}
+	if denied(db.Statement.Context) {
+		_ = db.AddError(ErrNoOrg)
+		return
+	}
+	orgID, ok := FromContext(db.Statement.Context)
+	if !ok {
+		return
+	}
+	ctx := db.Statement.Context
+	set := func(rv reflect.Value) {
+		if _, zero := field.ValueOf(ctx, rv); zero {
+			_ = field.Set(ctx, rv, orgID)
+		}
+	}
+	rv := reflect.Indirect(db.Statement.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			set(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		set(rv)
+	}
+}
+
+// EnsureDefault cria a organização padrão e, apenas na criação, move para ela os
+// registros anteriores ao multi-tenant. Eventos de sistema gravados depois (org 0)
+// permanecem fora de qualquer organização.
+func EnsureDefault(conn *gorm.DB, tables ...string) error {
+	org := Organization{ID: DefaultOrgID, Name: "default"}
+	res := conn.Where(Organization{ID: DefaultOrgID}).FirstOrCreate(&org)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil
+	}
+	for _, table := range tables {
+		err := conn.Table(table).Where("org_id IS NULL OR org_id = 0").Update("org_id", DefaultOrgID).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package tokens
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"api-vault/internal/integrations"
+)
+
+// requireTokenAccess carrega o token e exige o nível pedido na integração dele;
+// tokens herdam a ACL da integração a que pertencem.
+// Em caso de falha já responde: 404 se o chamador não pode ver o token, 403 se o nível é insuficiente.
+func requireTokenAccess(c *gin.Context, conn *gorm.DB, id uint, level string) (*Token, bool) {
+	var token Token
+	if err := conn.First(&token, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return nil, false
+	}
+	if !requireIntegrationAccess(c, conn, token.IntegrationID, level, "Token not found") {
+		return nil, false
+	}
+	return &token, true
+}
+
+// requireIntegrationAccess exige o nível pedido na integração, respondendo notFound se ela não for visível
+func requireIntegrationAccess(c *gin.Context, conn *gorm.DB, integrationID uint, level, notFound string) bool {
+	caller, err := integrations.CallerFromContext(c, conn)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	// Integração removida: só quem ignora ACLs ainda enxerga os tokens órfãos
+	integration := integrations.Integration{ID: integrationID}
+	if err := conn.First(&integration, integrationID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	granted, err := integrations.AccessLevel(conn, caller, &integration)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if granted == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+		return false
+	}
+	if !integrations.Allows(granted, level) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Acesso " + level + " necessário na integração"})
+		return false
+	}
+	return true
+}
+
+// visibleTokens limita a consulta aos tokens de integrações que o chamador pode ver
+func visibleTokens(c *gin.Context, conn *gorm.DB) (*gorm.DB, error) {
+	caller, err := integrations.CallerFromContext(c, conn)
+	if err != nil {
+		return nil, err
+	}
+	if caller.All {
+		return conn, nil
+	}
+	return conn.Where("integration_id IN (?)", integrations.VisibleIDs(conn, caller, integrations.AccessRead)), nil
+}
@@ -6,22 +6,33 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/appleboy/gin-jwt/v2"
+	jwt "github.com/appleboy/gin-jwt/v2"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 
 	"api-vault/internal/audit"
+	"api-vault/internal/authz"
 	"api-vault/internal/crypto"
+	"api-vault/internal/integrations"
 	"api-vault/internal/middleware"
+	"api-vault/internal/tenant"
 )
 
 type TokenInput struct {
 	IntegrationID uint      `json:"integration_id" binding:"required"`
-	AccessToken   string    `json:"access_token" binding:"required"`
-	RefreshToken  string    `json:"refresh_token" binding:"required"`
+	AccessToken   string    `json:"access_token"`  // vazio ou mascarado mantém o atual na atualização
+	RefreshToken  string    `json:"refresh_token"` // idem
 	ExpiresAt     time.Time `json:"expires_at" binding:"required"`
 }
 
+// Tamanho mínimo da justificativa exigida para revelar um segredo
+const minRevealReasonLength = 10
+
+// RevealInput é o corpo exigido para revelar segredos
+type RevealInput struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
 func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 	// Listar todos os tokens (protegido)
 	// @Summary Listar tokens
@@ -31,26 +42,25 @@ func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 	// @Success 200 {array} Token
 	// @Failure 500 {object} gin.H
 	// @Router /tokens [get]
-	r.GET("/tokens", mw.MiddlewareFunc(), func(c *gin.Context) {
+	r.GET("/tokens", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermTokensRead), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		query, err := visibleTokens(c, db)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
 		var list []Token
-		if err := conn.Find(&list).Error; err != nil {
+		if err := query.Find(&list).Error; err != nil {
 			log.Printf("[AUDIT] [FAIL] Listagem tokens | erro=%v", err)
-			_ = audit.SaveAuditLog(conn, "", "listagem_tokens", "FAIL", err.Error())
+			_ = audit.Record(c, db, audit.Failed(audit.ActionTokenList, audit.ResourceToken, nil, audit.CodeInternal).Detailf("%v", err))
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
 		for i := range list {
-			access, err := crypto.Decrypt(list[i].AccessToken)
-			if err == nil {
-				list[i].AccessToken = access
-			}
-			refresh, err := crypto.Decrypt(list[i].RefreshToken)
-			if err == nil {
-				list[i].RefreshToken = refresh
-			}
+			MaskSecrets(&list[i])
 		}
 		log.Printf("[AUDIT] [OK] Listagem tokens | total=%d", len(list))
-		_ = audit.SaveAuditLog(conn, "", "listagem_tokens", "OK", fmt.Sprintf("total=%d", len(list)))
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionTokenList, audit.ResourceToken, nil).Detailf("total=%d", len(list)))
 		c.JSON(200, list)
 	})
 
@@ -63,25 +73,21 @@ func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 	// @Success 200 {object} Token
 	// @Failure 404,500 {object} gin.H
 	// @Router /tokens/{id} [get]
-	r.GET("/tokens/:id", mw.MiddlewareFunc(), func(c *gin.Context) {
-		var token Token
-		id := c.Param("id")
-		if err := conn.First(&token, id).Error; err != nil {
-			log.Printf("[AUDIT] [FAIL] Consulta token por ID | id=%s | erro=%v", id, err)
-			_ = audit.SaveAuditLog(conn, "", "consulta_token_id", "FAIL", fmt.Sprintf("id=%s erro=%v", id, err))
-			c.JSON(404, gin.H{"error": "Token not found"})
+	r.GET("/tokens/:id", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermTokensRead), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		id, ok := middleware.ParamID(c, "id")
+		if !ok {
 			return
 		}
-		access, err := crypto.Decrypt(token.AccessToken)
-		if err == nil {
-			token.AccessToken = access
-		}
-		refresh, err := crypto.Decrypt(token.RefreshToken)
-		if err == nil {
-			token.RefreshToken = refresh
+		token, ok := requireTokenAccess(c, db, id, integrations.AccessRead)
+		if !ok {
+			log.Printf("[AUDIT] [FAIL] Consulta token por ID | id=%d | status=%d", id, c.Writer.Status())
+			_ = audit.Record(c, db, audit.Failed(audit.ActionTokenRead, audit.ResourceToken, id, audit.CodeForStatus(c.Writer.Status())).Detailf("id=%d status=%d", id, c.Writer.Status()))
+			return
 		}
-		log.Printf("[AUDIT] [OK] Consulta token por ID | id=%s", id)
-		_ = audit.SaveAuditLog(conn, "", "consulta_token_id", "OK", fmt.Sprintf("id=%s", id))
+		MaskSecrets(token)
+		log.Printf("[AUDIT] [OK] Consulta token por ID | id=%d", id)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionTokenRead, audit.ResourceToken, id).Detailf("id=%d", id))
 		c.JSON(200, token)
 	})
 
@@ -95,7 +101,8 @@ func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 	// @Success 201 {object} Token
 	// @Failure 400,500 {object} gin.H
 	// @Router /tokens [post]
-	r.POST("/tokens", mw.MiddlewareFunc(), func(c *gin.Context) {
+	r.POST("/tokens", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermTokensWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
 		var input TokenInput
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -106,7 +113,7 @@ func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 			c.JSON(400, gin.H{"error": "IntegrationID obrigatório"})
 			return
 		}
-		if len(input.AccessToken) < 6 || len(input.RefreshToken) < 6 {
+		if len(input.AccessToken) < 6 || len(input.RefreshToken) < 6 || crypto.Unchanged(input.AccessToken) || crypto.Unchanged(input.RefreshToken) {
 			c.JSON(400, gin.H{"error": "AccessToken e RefreshToken devem ter pelo menos 6 caracteres"})
 			return
 		}
@@ -114,38 +121,37 @@ func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 			c.JSON(400, gin.H{"error": "ExpiresAt obrigatório e deve ser uma data válida"})
 			return
 		}
-		encryptedAccess, err := crypto.Encrypt(input.AccessToken)
-		if err != nil {
-			c.JSON(500, gin.H{"error": "Erro ao criptografar AccessToken"})
-			return
-		}
-		encryptedRefresh, err := crypto.Encrypt(input.RefreshToken)
-		if err != nil {
-			c.JSON(500, gin.H{"error": "Erro ao criptografar RefreshToken"})
+		// A integração precisa existir na organização; o caso de tokens órfãos não se aplica à criação
+		if _, ok := integrations.RequireAccess(c, db, input.IntegrationID, integrations.AccessManage); !ok {
 			return
 		}
 		token := Token{
 			IntegrationID: input.IntegrationID,
-			AccessToken:   encryptedAccess,
-			RefreshToken:  encryptedRefresh,
 			ExpiresAt:     input.ExpiresAt,
 		}
-		if err := conn.Create(&token).Error; err != nil {
+		// Os segredos são vinculados ao ID, então são cifrados após o insert na mesma transação
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&token).Error; err != nil {
+				return err
+			}
+			if err := EncryptAccessToken(&token, input.AccessToken); err != nil {
+				return err
+			}
+			if err := EncryptRefreshToken(&token, input.RefreshToken); err != nil {
+				return err
+			}
+			return tx.Model(&token).Updates(map[string]interface{}{"access_token": token.AccessToken, "refresh_token": token.RefreshToken}).Error
+		})
+		if err != nil {
 			log.Printf("[AUDIT] [FAIL] Cadastro token | integration_id=%d | erro=%v", input.IntegrationID, err)
-			_ = audit.SaveAuditLog(conn, "", "cadastro_token", "FAIL", fmt.Sprintf("integration_id=%d erro=%v", input.IntegrationID, err))
+			_ = audit.Record(c, db, audit.Failed(audit.ActionTokenCreate, audit.ResourceToken, nil, audit.CodeInternal).Detailf("integration_id=%d erro=%v", input.IntegrationID, err))
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
-		access, err := crypto.Decrypt(token.AccessToken)
-		if err == nil {
-			token.AccessToken = access
-		}
-		refresh, err := crypto.Decrypt(token.RefreshToken)
-		if err == nil {
-			token.RefreshToken = refresh
-		}
+		changes := audit.Diff(Token{}, token)
+		MaskSecrets(&token)
 		log.Printf("[AUDIT] [OK] Cadastro token | id=%d | integration_id=%d", token.ID, token.IntegrationID)
-		_ = audit.SaveAuditLog(conn, "", "cadastro_token", "OK", fmt.Sprintf("id=%d integration_id=%d", token.ID, token.IntegrationID))
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionTokenCreate, audit.ResourceToken, token.ID).WithChanges(changes).Detailf("id=%d integration_id=%d", token.ID, token.IntegrationID))
 		c.JSON(201, token)
 	})
 
@@ -160,12 +166,15 @@ func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 	// @Success 200 {object} Token
 	// @Failure 400,404,500 {object} gin.H
 	// @Router /tokens/{id} [put]
-	r.PUT("/tokens/:id", mw.MiddlewareFunc(), func(c *gin.Context) {
-		var token Token
-		id := c.Param("id")
-		if err := conn.First(&token, id).Error; err != nil {
-			log.Printf("Erro ao buscar token para atualizar: %v\n", err)
-			c.JSON(404, gin.H{"error": "Token not found"})
+	r.PUT("/tokens/:id", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermTokensWrite), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		id, ok := middleware.ParamID(c, "id")
+		if !ok {
+			return
+		}
+		token, ok := requireTokenAccess(c, db, id, integrations.AccessManage)
+		if !ok {
+			log.Printf("Token %d indisponível para atualizar: status=%d\n", id, c.Writer.Status())
 			return
 		}
 		var input TokenInput
@@ -173,40 +182,44 @@ func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 			c.JSON(400, gin.H{"error": err.Error()})
 			return
 		}
-		encryptedAccess, err := crypto.Encrypt(input.AccessToken)
-		if err != nil {
-			c.JSON(500, gin.H{"error": "Erro ao criptografar AccessToken"})
-			return
+		// Mover o token para outra integração exige manage também no destino
+		if input.IntegrationID != token.IntegrationID {
+			if _, ok := integrations.RequireAccess(c, db, input.IntegrationID, integrations.AccessManage); !ok {
+				return
+			}
 		}
-		encryptedRefresh, err := crypto.Encrypt(input.RefreshToken)
-		if err != nil {
-			c.JSON(500, gin.H{"error": "Erro ao criptografar RefreshToken"})
-			return
+		before := *token
+		// Segredos omitidos ou mascarados (como vêm do GET) mantêm o cifrado atual
+		if !crypto.Unchanged(input.AccessToken) {
+			if err := EncryptAccessToken(token, input.AccessToken); err != nil {
+				c.JSON(500, gin.H{"error": "Erro ao criptografar AccessToken"})
+				return
+			}
+		}
+		if !crypto.Unchanged(input.RefreshToken) {
+			if err := EncryptRefreshToken(token, input.RefreshToken); err != nil {
+				c.JSON(500, gin.H{"error": "Erro ao criptografar RefreshToken"})
+				return
+			}
+			// Um novo refresh token informado manualmente reativa a renovação automática
+			token.Status = StatusActive
 		}
 		token.IntegrationID = input.IntegrationID
-		token.AccessToken = encryptedAccess
-		token.RefreshToken = encryptedRefresh
 		token.ExpiresAt = input.ExpiresAt
-		if err := conn.Save(&token).Error; err != nil {
-			log.Printf("[AUDIT] [FAIL] Atualização token | id=%s | erro=%v", id, err)
-			_ = audit.SaveAuditLog(conn, "", "atualizacao_token", "FAIL", fmt.Sprintf("id=%s erro=%v", id, err))
+		if err := db.Save(token).Error; err != nil {
+			log.Printf("[AUDIT] [FAIL] Atualização token | id=%d | erro=%v", id, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionTokenUpdate, audit.ResourceToken, id, audit.CodeInternal).Detailf("id=%d erro=%v", id, err))
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
-		access, err := crypto.Decrypt(token.AccessToken)
-		if err == nil {
-			token.AccessToken = access
-		}
-		refresh, err := crypto.Decrypt(token.RefreshToken)
-		if err == nil {
-			token.RefreshToken = refresh
-		}
-		log.Printf("[AUDIT] [OK] Atualização token | id=%s", id)
-		_ = audit.SaveAuditLog(conn, "", "atualizacao_token", "OK", fmt.Sprintf("id=%s", id))
+		changes := audit.Diff(before, token)
+		MaskSecrets(token)
+		log.Printf("[AUDIT] [OK] Atualização token | id=%d", id)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionTokenUpdate, audit.ResourceToken, id).WithChanges(changes).Detailf("id=%d", id))
 		c.JSON(200, token)
 	})
 
-	// Deletar token (protegido)
+	// Deletar token (protegido, tokens:delete)
 	// @Summary Deletar token
 	// @Description Remove um token
 	// @Tags tokens
@@ -214,20 +227,73 @@ func RegisterRoutes(r *gin.Engine, conn *gorm.DB, mw *jwt.GinJWTMiddleware) {
 	// @Success 204 {object} nil
 	// @Failure 403,500 {object} gin.H
 	// @Router /tokens/{id} [delete]
-	r.DELETE("/tokens/:id", mw.MiddlewareFunc(), func(c *gin.Context) {
-		if !middleware.IsAdmin(c) {
-			c.JSON(403, gin.H{"error": "Acesso permitido apenas para admin"})
+	r.DELETE("/tokens/:id", mw.MiddlewareFunc(), middleware.RequirePermission(conn, authz.PermTokensDelete), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		id, ok := middleware.ParamID(c, "id")
+		if !ok {
+			return
+		}
+		token, ok := requireTokenAccess(c, db, id, integrations.AccessManage)
+		if !ok {
 			return
 		}
-		id := c.Param("id")
-		if err := conn.Delete(&Token{}, id).Error; err != nil {
-			log.Printf("[AUDIT] [FAIL] Deleção token | id=%s | erro=%v", id, err)
-			_ = audit.SaveAuditLog(conn, "", "delecao_token", "FAIL", fmt.Sprintf("id=%s erro=%v", id, err))
+		if err := db.Delete(&Token{}, id).Error; err != nil {
+			log.Printf("[AUDIT] [FAIL] Deleção token | id=%d | erro=%v", id, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionTokenDelete, audit.ResourceToken, id, audit.CodeInternal).Detailf("id=%d erro=%v", id, err))
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
-		log.Printf("[AUDIT] [OK] Deleção token | id=%s", id)
-		_ = audit.SaveAuditLog(conn, "", "delecao_token", "OK", fmt.Sprintf("id=%s", id))
+		log.Printf("[AUDIT] [OK] Deleção token | id=%d", id)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionTokenDelete, audit.ResourceToken, id).WithChanges(audit.Diff(token, &Token{})).Detailf("id=%d", id))
 		c.JSON(204, nil)
 	})
+
+	// Revelar AccessToken e RefreshToken (protegido, tokens:reveal, exige justificativa)
+	// @Summary Revelar segredos do token
+	// @Description Retorna AccessToken e RefreshToken em texto puro e registra a justificativa na auditoria
+	// @Tags tokens
+	// @Accept json
+	// @Produce json
+	// @Param id path int true "ID do token"
+	// @Param reveal body RevealInput true "Justificativa"
+	// @Success 200 {object} gin.H
+	// @Failure 400,403,404,500 {object} gin.H
+	// @Router /tokens/{id}/reveal [post]
+	r.POST("/tokens/:id/reveal", mw.MiddlewareFunc(), func(c *gin.Context) {
+		db := tenant.Scoped(c, conn)
+		username, _ := jwt.ExtractClaims(c)["username"].(string)
+		id, ok := middleware.ParamID(c, "id")
+		if !ok {
+			return
+		}
+		if !middleware.HasPermission(c, db, authz.PermTokensReveal) {
+			log.Printf("[AUDIT] [FAIL] Revelação segredo token | id=%d | user=%s | erro=acesso negado", id, username)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionTokenReveal, audit.ResourceToken, id, audit.CodeForbidden).Detailf("id=%d erro=acesso negado", id))
+			c.JSON(403, gin.H{"error": "Permissão necessária: " + authz.PermTokensReveal})
+			return
+		}
+		var input RevealInput
+		if err := c.ShouldBindJSON(&input); err != nil || len(input.Reason) < minRevealReasonLength {
+			c.JSON(400, gin.H{"error": fmt.Sprintf("Justificativa obrigatória com pelo menos %d caracteres", minRevealReasonLength)})
+			return
+		}
+		token, ok := requireTokenAccess(c, db, id, integrations.AccessReveal)
+		if !ok {
+			return
+		}
+		access, err := DecryptAccessToken(token)
+		var refresh string
+		if err == nil {
+			refresh, err = DecryptRefreshToken(token)
+		}
+		if err != nil {
+			log.Printf("[AUDIT] [FAIL] Revelação segredo token | id=%d | user=%s | erro=%v", id, username, err)
+			_ = audit.Record(c, db, audit.Failed(audit.ActionTokenReveal, audit.ResourceToken, id, audit.CodeInternal).Detailf("id=%d motivo=%q erro=%v", id, input.Reason, err))
+			c.JSON(500, gin.H{"error": "Erro ao decriptografar token"})
+			return
+		}
+		log.Printf("[AUDIT] [OK] Revelação segredo token | id=%d | user=%s | motivo=%q", id, username, input.Reason)
+		_ = audit.Record(c, db, audit.Succeeded(audit.ActionTokenReveal, audit.ResourceToken, id).Detailf("id=%d motivo=%q", id, input.Reason))
+		c.JSON(200, gin.H{"id": token.ID, "access_token": access, "refresh_token": refresh})
+	})
 }
@@ -0,0 +1,49 @@
+package tokens
+
+import "api-vault/internal/crypto"
+
+// AccessTokenField identifica o AccessToken do token nos dados associados da criptografia
+func AccessTokenField(id uint) crypto.Field {
+	return crypto.Field{Table: "tokens", Column: "access_token", RecordID: id}
+}
+
+// RefreshTokenField identifica o RefreshToken do token nos dados associados da criptografia
+func RefreshTokenField(id uint) crypto.Field {
+	return crypto.Field{Table: "tokens", Column: "refresh_token", RecordID: id}
+}
+
+// EncryptAccessToken cifra o AccessToken vinculado ao ID do token (que já deve existir)
+func EncryptAccessToken(token *Token, plain string) error {
+	access, err := crypto.EncryptField(plain, AccessTokenField(token.ID))
+	if err != nil {
+		return err
+	}
+	token.AccessToken = access
+	return nil
+}
+
+// EncryptRefreshToken cifra o RefreshToken vinculado ao ID do token (que já deve existir)
+func EncryptRefreshToken(token *Token, plain string) error {
+	refresh, err := crypto.EncryptField(plain, RefreshTokenField(token.ID))
+	if err != nil {
+		return err
+	}
+	token.RefreshToken = refresh
+	return nil
+}
+
+// DecryptAccessToken retorna o AccessToken em texto plano
+func DecryptAccessToken(token *Token) (string, error) {
+	return crypto.DecryptField(token.AccessToken, AccessTokenField(token.ID))
+}
+
+// DecryptRefreshToken retorna o RefreshToken em texto plano
+func DecryptRefreshToken(token *Token) (string, error) {
+	return crypto.DecryptField(token.RefreshToken, RefreshTokenField(token.ID))
+}
+
+// MaskSecrets oculta AccessToken e RefreshToken antes de devolver o token em respostas comuns
+func MaskSecrets(token *Token) {
+	token.AccessToken = crypto.MaskedValue
+	token.RefreshToken = crypto.MaskedValue
+}
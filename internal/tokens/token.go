@@ -6,12 +6,20 @@ import (
 	"gorm.io/gorm"
 )
 
+// Situações possíveis de um token
+const (
+	StatusActive            = "active"             // renovável normalmente
+	StatusReconsentRequired = "reconsent_required" // refresh token inválido; exige nova autorização
+)
+
 type Token struct {
 	ID            uint      `gorm:"primaryKey"`
+	OrgID         uint      `gorm:"index"`
 	IntegrationID uint      `gorm:"index"`
-	AccessToken   string    `gorm:"not null"`
-	RefreshToken  string    `gorm:"not null"`
+	AccessToken   string    `gorm:"not null" audit:"secret"`
+	RefreshToken  string    `gorm:"not null" audit:"secret"`
 	ExpiresAt     time.Time `gorm:"not null"`
+	Status        string    `gorm:"not null;default:active;index"`
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 	DeletedAt     gorm.DeletedAt `gorm:"index"`
@@ -0,0 +1,85 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Parâmetros do RFC 6238 aceitos por todos os aplicativos autenticadores
+const (
+	Digits = 6
+	Period = 30 * time.Second
+	// Skew é quantos passos antes/depois do atual são aceitos (relógio do celular)
+	Skew = 1
+)
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret cria uma semente aleatória de 160 bits em base32
+func GenerateSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(b), nil
+}
+
+// Step devolve o contador de tempo do instante
+func Step(t time.Time) uint64 {
+	return uint64(t.Unix()) / uint64(Period/time.Second)
+}
+
+// Code calcula o código do contador (HOTP, RFC 4226, com HMAC-SHA1)
+func Code(secret string, step uint64) (string, error) {
+	key, err := encoding.DecodeString(secret)
+	if err != nil {
+		return "", fmt.Errorf("semente TOTP inválida: %w", err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], step)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", Digits, value%1000000), nil
+}
+
+// Verify confere o código dentro da janela de Skew passos e devolve o passo
+// correspondente, que deve ser guardado para impedir reutilização do mesmo código
+func Verify(secret, code string, t time.Time) (uint64, bool) {
+	if len(code) != Digits {
+		return 0, false
+	}
+	now := Step(t)
+	for delta := -Skew; delta <= Skew; delta++ {
+		step := uint64(int64(now) + int64(delta))
+		expected, err := Code(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// ProvisioningURI monta a URI otpauth:// lida pelos autenticadores (normalmente exibida como QR code)
+func ProvisioningURI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(int(Period/time.Second)))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
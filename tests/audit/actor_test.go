@@ -0,0 +1,80 @@
+package audit_test
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/auth"
+	"api-vault/internal/integrations"
+	"api-vault/internal/tokens"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestHandlersRecordRequestActor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("DATA_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	t.Setenv("JWT_DEV_MODE", "true") // segredo HS256 padrão
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Erro ao abrir banco em memória: %v", err)
+	}
+	db.AutoMigrate(&integrations.Integration{}, &integrations.ACLEntry{}, &auth.GroupMember{}, &tokens.Token{}, &audit.AuditLog{}, &audit.ChainHead{}, &auth.User{}, &auth.Session{}, &auth.RevokedToken{})
+	mw, err := auth.JWTMiddlewareWithDB(db)
+	if err != nil {
+		t.Fatalf("Erro ao criar middleware JWT: %v", err)
+	}
+	userJWT, _, _ := mw.TokenGenerator(&auth.User{ID: 7, Username: "maria", Role: "user"})
+	adminJWT, _, _ := mw.TokenGenerator(&auth.User{ID: 1, Username: "admin", Role: "admin"})
+
+	r := gin.New()
+	r.Use(audit.RequestID())
+	integrations.RegisterRoutes(r, db, mw)
+	tokens.RegisterRoutes(r, db, mw)
+	audit.RegisterRoutes(r, db, mw)
+
+	send := func(method, path, jwtToken, requestID, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+jwtToken)
+		req.Header.Set("User-Agent", "cli-vault/1.2")
+		if requestID != "" {
+			req.Header.Set(audit.RequestIDHeader, requestID)
+		}
+		req.RemoteAddr = "203.0.113.9:5000"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("POST", "/integrations", userJWT, "req-123", `{"name":"erp","auth_type":"client_credentials","client_id":"cid","client_secret":"segredo","token_url":"https://erp.example.com/token"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Cadastro de integração falhou: %d %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get(audit.RequestIDHeader) != "req-123" {
+		t.Errorf("X-Request-ID recebido deveria ser devolvido, obtido %q", w.Header().Get(audit.RequestIDHeader))
+	}
+	var entry audit.AuditLog
+	db.Where("action = ?", "cadastro_integracao").First(&entry)
+	if entry.ActorID != 7 || entry.User != "maria" || entry.IP != "203.0.113.9" || entry.UserAgent != "cli-vault/1.2" || entry.RequestID != "req-123" {
+		t.Errorf("Evento sem o ator da requisição: %+v", entry)
+	}
+
+	// Sem X-Request-ID (ou com um inválido) a API gera um
+	w = send("GET", "/tokens", userJWT, "inválido com espaço", "")
+	generated := w.Header().Get(audit.RequestIDHeader)
+	if len(generated) != 32 {
+		t.Fatalf("Deveria gerar um ID de requisição, obtido %q", generated)
+	}
+	w = send("GET", "/audit-logs?request_id="+generated, adminJWT, "", "")
+	var logs []audit.AuditLog
+	json.Unmarshal(w.Body.Bytes(), &logs)
+	if len(logs) != 1 || logs[0].Action != "listagem_tokens" || logs[0].User != "maria" {
+		t.Errorf("Filtro por request_id deveria achar a listagem de tokens, obtido %+v", logs)
+	}
+}
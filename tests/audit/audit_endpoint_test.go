@@ -2,6 +2,8 @@ package audit_test
 
 import (
 	"api-vault/internal/audit"
+	"api-vault/internal/auth"
+	"api-vault/internal/authz"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -19,22 +21,27 @@ func TestAuditLogsEndpoint_AdminAccessAndFilters(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Erro ao abrir banco em memória: %v", err)
 	}
-	db.AutoMigrate(&audit.AuditLog{})
+	db.AutoMigrate(&audit.AuditLog{}, &audit.ChainHead{}, &authz.Role{}, &auth.User{}, &auth.Session{}, &auth.RevokedToken{})
 
 	// Insere alguns logs
 	_ = audit.SaveAuditLog(db, "admin", "login", "OK", "sucesso")
 	_ = audit.SaveAuditLog(db, "admin", "delete_user", "FAIL", "erro X")
 	_ = audit.SaveAuditLog(db, "user1", "login", "OK", "sucesso")
 
+	t.Setenv("JWT_DEV_MODE", "true") // segredo HS256 padrão
+	mw, err := auth.JWTMiddlewareWithDB(db)
+	if err != nil {
+		t.Fatalf("Erro ao criar middleware JWT: %v", err)
+	}
+	adminJWT, _, _ := mw.TokenGenerator(&auth.User{ID: 1, Username: "admin", Role: "admin"})
+	userJWT, _, _ := mw.TokenGenerator(&auth.User{ID: 2, Username: "user1", Role: "user"})
+
 	r := gin.New()
-	r.Use(func(c *gin.Context) {
-		c.Set("role", "admin") // Simula admin
-		c.Next()
-	})
-	audit.RegisterRoutes(r, db)
+	audit.RegisterRoutes(r, db, mw)
 
 	// Testa filtro por usuário
 	req, _ := http.NewRequest("GET", "/audit-logs?user=admin", nil)
+	req.Header.Set("Authorization", "Bearer "+adminJWT)
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	if w.Code != http.StatusOK {
@@ -50,6 +57,7 @@ func TestAuditLogsEndpoint_AdminAccessAndFilters(t *testing.T) {
 
 	// Testa filtro por ação
 	req2, _ := http.NewRequest("GET", "/audit-logs?action=delete_user", nil)
+	req2.Header.Set("Authorization", "Bearer "+adminJWT)
 	w2 := httptest.NewRecorder()
 	r.ServeHTTP(w2, req2)
 	var logs2 []audit.AuditLog
@@ -58,17 +66,25 @@ func TestAuditLogsEndpoint_AdminAccessAndFilters(t *testing.T) {
 		t.Errorf("Filtro por ação falhou")
 	}
 
-	// Testa acesso negado para não-admin
-	r2 := gin.New()
-	r2.Use(func(c *gin.Context) {
-		c.Set("role", "user") // Simula não-admin
-		c.Next()
-	})
-	audit.RegisterRoutes(r2, db)
+	// Testa acesso negado para quem não tem audit:read
 	req3, _ := http.NewRequest("GET", "/audit-logs", nil)
+	req3.Header.Set("Authorization", "Bearer "+userJWT)
 	w3 := httptest.NewRecorder()
-	r2.ServeHTTP(w3, req3)
+	r.ServeHTTP(w3, req3)
 	if w3.Code != http.StatusForbidden {
 		t.Errorf("Acesso não-admin deveria ser proibido, obtido %d", w3.Code)
 	}
+
+	// Papel customizado com audit:read consegue consultar
+	role := authz.Role{Name: "auditor"}
+	_ = role.SetPermissions([]string{authz.PermAuditRead})
+	db.Create(&role)
+	auditorJWT, _, _ := mw.TokenGenerator(&auth.User{ID: 3, Username: "auditor1", Role: "auditor"})
+	req4, _ := http.NewRequest("GET", "/audit-logs", nil)
+	req4.Header.Set("Authorization", "Bearer "+auditorJWT)
+	w4 := httptest.NewRecorder()
+	r.ServeHTTP(w4, req4)
+	if w4.Code != http.StatusOK {
+		t.Errorf("Papel com audit:read deveria consultar auditoria, obtido %d", w4.Code)
+	}
 }
@@ -0,0 +1,208 @@
+package audit_test
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/auth"
+	"api-vault/internal/authz"
+	"api-vault/internal/tenant"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupChainDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Erro ao abrir banco em memória: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&audit.AuditLog{}, &audit.ChainHead{}, &authz.Role{}, &auth.User{}, &auth.Session{}, &auth.RevokedToken{})
+	org := tenant.ForOrg(db, tenant.DefaultOrgID)
+	for _, action := range []string{"login", "revelacao_segredo_token", "delecao_usuario", "logout"} {
+		if err := audit.SaveAuditLog(org, "admin", action, "OK", "detalhes de "+action); err != nil {
+			t.Fatalf("Erro ao gravar auditoria: %v", err)
+		}
+	}
+	// Eventos de sistema formam outra cadeia
+	_ = audit.SaveAuditLog(db, "", "renovacao_token", "OK", "id=1")
+	return db
+}
+
+func TestAuditChainVerifies(t *testing.T) {
+	db := setupChainDB(t)
+	for _, org := range []uint{tenant.DefaultOrgID, 0} {
+		result, err := audit.Verify(db, org, nil)
+		if err != nil || !result.OK {
+			t.Fatalf("Cadeia da org %d deveria estar íntegra: %+v %v", org, result, err)
+		}
+	}
+	result, _ := audit.Verify(db, tenant.DefaultOrgID, nil)
+	if result.Checked != 4 {
+		t.Errorf("Esperadas 4 entradas conferidas, obtidas %d", result.Checked)
+	}
+	if orgs, _ := audit.ChainOrgs(db); len(orgs) != 2 {
+		t.Errorf("Esperadas 2 cadeias, obtidas %v", orgs)
+	}
+}
+
+func TestAuditChainDetectsTampering(t *testing.T) {
+	cases := map[string]struct {
+		tamper   func(db *gorm.DB)
+		brokenID uint
+	}{
+		"conteúdo alterado": {func(db *gorm.DB) {
+			db.Model(&audit.AuditLog{}).Where("id = ?", 2).Update("details", "nada aconteceu")
+		}, 2},
+		"entrada removida": {func(db *gorm.DB) {
+			db.Delete(&audit.AuditLog{}, 2)
+		}, 3},
+		"últimas removidas": {func(db *gorm.DB) {
+			db.Delete(&audit.AuditLog{}, 4)
+		}, 4},
+		"ator trocado": {func(db *gorm.DB) {
+			db.Model(&audit.AuditLog{}).Where("id = ?", 3).Update("user", "outro")
+		}, 3},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			db := setupChainDB(t)
+			tc.tamper(db)
+			result, err := audit.Verify(db, tenant.DefaultOrgID, nil)
+			if err != nil {
+				t.Fatalf("Erro na verificação: %v", err)
+			}
+			if result.OK || result.BrokenID != tc.brokenID {
+				t.Errorf("Esperada quebra na entrada %d, obtido %+v", tc.brokenID, result)
+			}
+		})
+	}
+}
+
+func TestAuditChainHMAC(t *testing.T) {
+	t.Setenv("AUDIT_HMAC_KEY", "chave-hmac-da-auditoria-32-bytes")
+	db := setupChainDB(t)
+	key := []byte("chave-hmac-da-auditoria-32-bytes")
+	if result, _ := audit.Verify(db, tenant.DefaultOrgID, key); !result.OK || !result.Signed || result.Unsigned != 0 {
+		t.Fatalf("Cadeia assinada deveria estar íntegra: %+v", result)
+	}
+	if result, _ := audit.Verify(db, tenant.DefaultOrgID, []byte("outra-chave-com-trinta-e-dois-by")); result.OK || result.BrokenID != 1 {
+		t.Errorf("Chave diferente deveria invalidar a primeira assinatura: %+v", result)
+	}
+	// Sem a chave não dá para refazer a assinatura de uma entrada
+	db.Model(&audit.AuditLog{}).Where("id = ?", 3).Update("mac", "")
+	if result, _ := audit.Verify(db, tenant.DefaultOrgID, key); result.OK || result.BrokenID != 3 {
+		t.Errorf("Assinatura removida deveria quebrar a cadeia: %+v", result)
+	}
+}
+
+// chainContent reproduz o conteúdo coberto pelo hash, para refazer a cadeia como faria quem tem acesso ao banco
+type chainContent struct {
+	OrgID        uint          `json:"org_id"`
+	Timestamp    string        `json:"timestamp"`
+	ActorID      uint          `json:"actor_id"`
+	User         string        `json:"user"`
+	IP           string        `json:"ip"`
+	UserAgent    string        `json:"user_agent"`
+	RequestID    string        `json:"request_id"`
+	Action       string        `json:"action"`
+	Status       string        `json:"status"`
+	Details      string        `json:"details"`
+	PrevHash     string        `json:"prev_hash"`
+	ResourceType string        `json:"resource_type,omitempty"`
+	ResourceID   string        `json:"resource_id,omitempty"`
+	ErrorCode    string        `json:"error_code,omitempty"`
+	Changes      audit.Changes `json:"changes,omitempty"`
+}
+
+// rehashWithoutMACs refaz os hashes da cadeia da organização, apaga todas as assinaturas e atualiza o head
+func rehashWithoutMACs(t *testing.T, db *gorm.DB, orgID uint) {
+	var entries []audit.AuditLog
+	db.Where("org_id = ?", orgID).Order("id").Find(&entries)
+	prev := ""
+	for _, e := range entries {
+		data, _ := json.Marshal(chainContent{e.OrgID, e.Timestamp.UTC().Format(time.RFC3339Nano), e.ActorID, e.User, e.IP, e.UserAgent, e.RequestID, e.Action, e.Status, e.Details, prev, e.ResourceType, e.ResourceID, e.ErrorCode, e.Changes})
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])
+		db.Model(&audit.AuditLog{}).Where("id = ?", e.ID).Updates(map[string]interface{}{"prev_hash": prev, "hash": hash, "mac": ""})
+		prev = hash
+	}
+	db.Model(&audit.ChainHead{}).Where("org_id = ?", orgID).Update("hash", prev)
+	if result, _ := audit.Verify(db, orgID, nil); !result.OK {
+		t.Fatalf("Cadeia refeita deveria passar sem a chave: %+v", result)
+	}
+}
+
+func TestAuditChainHMACRequiresEverySignature(t *testing.T) {
+	key := []byte("chave-hmac-da-auditoria-32-bytes")
+	t.Setenv("AUDIT_HMAC_KEY", string(key))
+	db := setupChainDB(t)
+	db.Model(&audit.AuditLog{}).Where("id = ?", 2).Update("details", "nada aconteceu")
+	rehashWithoutMACs(t, db, tenant.DefaultOrgID)
+	result, _ := audit.Verify(db, tenant.DefaultOrgID, key)
+	if result.OK || result.BrokenID != 1 || result.Unsigned != 4 {
+		t.Fatalf("Cadeia refeita sem assinaturas não pode passar com a chave: %+v", result)
+	}
+}
+
+func TestAuditChainSignUnsigned(t *testing.T) {
+	db := setupChainDB(t) // gravada antes da chave existir
+	key := []byte("chave-hmac-da-auditoria-32-bytes")
+	if result, _ := audit.Verify(db, tenant.DefaultOrgID, key); result.OK || result.Unsigned != 4 {
+		t.Fatalf("Entradas sem assinatura deveriam quebrar a verificação com a chave: %+v", result)
+	}
+	if n, err := audit.SignUnsigned(db, tenant.DefaultOrgID, key); err != nil || n != 4 {
+		t.Fatalf("Esperadas 4 entradas assinadas: %d %v", n, err)
+	}
+	if result, _ := audit.Verify(db, tenant.DefaultOrgID, key); !result.OK || result.Unsigned != 0 {
+		t.Errorf("Cadeia assinada deveria estar íntegra: %+v", result)
+	}
+	// Cadeia adulterada não é assinada
+	db2 := setupChainDB(t)
+	db2.Model(&audit.AuditLog{}).Where("id = ?", 2).Update("details", "nada aconteceu")
+	if n, err := audit.SignUnsigned(db2, tenant.DefaultOrgID, key); err == nil || n != 0 {
+		t.Errorf("Cadeia quebrada não deveria ser assinada: %d %v", n, err)
+	}
+}
+
+func TestAuditVerifyEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_DEV_MODE", "true") // segredo HS256 padrão
+	db := setupChainDB(t)
+	mw, err := auth.JWTMiddlewareWithDB(db)
+	if err != nil {
+		t.Fatalf("Erro ao criar middleware JWT: %v", err)
+	}
+	adminJWT, _, _ := mw.TokenGenerator(&auth.User{ID: 1, Username: "admin", Role: "admin", OrgID: tenant.DefaultOrgID})
+	r := gin.New()
+	audit.RegisterRoutes(r, db, mw)
+
+	verify := func() audit.VerifyResult {
+		req := httptest.NewRequest("GET", "/audit-logs/verify", nil)
+		req.Header.Set("Authorization", "Bearer "+adminJWT)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Verificação falhou: %d %s", w.Code, w.Body.String())
+		}
+		var result audit.VerifyResult
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return result
+	}
+	if result := verify(); !result.OK || result.Checked != 4 {
+		t.Fatalf("Cadeia deveria estar íntegra: %+v", result)
+	}
+	// A própria verificação entra na cadeia
+	db.Model(&audit.AuditLog{}).Where("id = ?", 1).Update("status", "FAIL")
+	if result := verify(); result.OK || result.BrokenID != 1 {
+		t.Errorf("Alteração deveria ser apontada na entrada 1: %+v", result)
+	}
+}
@@ -0,0 +1,121 @@
+package audit_test
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/auth"
+	"api-vault/internal/crypto"
+	"api-vault/internal/integrations"
+	"api-vault/internal/tenant"
+	"api-vault/internal/tokens"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestStructuredEventsAndFilters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("DATA_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	t.Setenv("JWT_DEV_MODE", "true") // segredo HS256 padrão
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Erro ao abrir banco em memória: %v", err)
+	}
+	db.AutoMigrate(&integrations.Integration{}, &integrations.ACLEntry{}, &auth.GroupMember{}, &tokens.Token{}, &audit.AuditLog{}, &audit.ChainHead{}, &auth.User{}, &auth.Session{}, &auth.RevokedToken{})
+	mw, err := auth.JWTMiddlewareWithDB(db)
+	if err != nil {
+		t.Fatalf("Erro ao criar middleware JWT: %v", err)
+	}
+	adminJWT, _, _ := mw.TokenGenerator(&auth.User{ID: 1, Username: "admin", Role: "admin", OrgID: tenant.DefaultOrgID})
+
+	r := gin.New()
+	integrations.RegisterRoutes(r, db, mw)
+	tokens.RegisterRoutes(r, db, mw)
+	audit.RegisterRoutes(r, db, mw)
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+adminJWT)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	search := func(query string) []audit.AuditLog {
+		w := send("GET", "/audit-logs?"+query, "")
+		if strings.Contains(w.Body.String(), "segredo-") {
+			t.Fatalf("Segredo exposto na auditoria: %s", w.Body.String())
+		}
+		var logs []audit.AuditLog
+		json.Unmarshal(w.Body.Bytes(), &logs)
+		return logs
+	}
+
+	w := send("POST", "/integrations", `{"name":"erp","auth_type":"client_credentials","client_id":"cid","client_secret":"segredo-1","token_url":"https://erp.example.com/token"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Cadastro de integração falhou: %d %s", w.Code, w.Body.String())
+	}
+	var created integrations.Integration
+	json.Unmarshal(w.Body.Bytes(), &created)
+	w = send("PUT", fmt.Sprintf("/integrations/%d", created.ID), `{"Name":"erp-novo","AuthType":"client_credentials","ClientID":"cid","ClientSecret":"segredo-2","TokenURL":"https://erp.example.com/token"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Atualização de integração falhou: %d %s", w.Code, w.Body.String())
+	}
+	send("GET", "/tokens/999", "")
+
+	logs := search("resource_type=integration&action=atualizacao_integracao")
+	if len(logs) != 1 || logs[0].ResourceID != fmt.Sprint(created.ID) {
+		t.Fatalf("Esperada uma atualização da integração %d, obtido %+v", created.ID, logs)
+	}
+	changes := logs[0].Changes
+	if name := changes["name"]; name.Old != "erp" || name.New != "erp-novo" {
+		t.Errorf("Diff do nome incorreto: %+v", changes)
+	}
+	if secret := changes["client_secret"]; secret.Old != crypto.MaskedValue || secret.New != crypto.MaskedValue {
+		t.Errorf("Segredo alterado deveria aparecer mascarado: %+v", changes)
+	}
+	if _, ok := changes["client_id"]; ok {
+		t.Errorf("Campo não alterado no diff: %+v", changes)
+	}
+
+	if logs := search("field=client_secret"); len(logs) != 2 {
+		t.Errorf("Cadastro e atualização alteram client_secret, obtido %d eventos", len(logs))
+	}
+	if logs := search("field=token_url"); len(logs) != 1 || logs[0].Action != "cadastro_integracao" {
+		t.Errorf("Só o cadastro altera token_url, obtido %+v", logs)
+	}
+	if logs := search(fmt.Sprintf("resource_type=integration&resource_id=%d", created.ID)); len(logs) != 2 {
+		t.Errorf("Esperados 2 eventos da integração, obtidos %d", len(logs))
+	}
+	logs = search("error_code=not_found&outcome=FAIL")
+	if len(logs) != 1 || logs[0].Action != "consulta_token_id" || logs[0].ResourceType != "token" || logs[0].ResourceID != "999" {
+		t.Errorf("Filtro por error_code deveria achar a consulta do token inexistente, obtido %+v", logs)
+	}
+
+	// Os diffs fazem parte do hash da cadeia
+	if result, err := audit.Verify(db, tenant.DefaultOrgID, nil); err != nil || !result.OK {
+		t.Fatalf("Cadeia com diffs deveria estar íntegra: %+v %v", result, err)
+	}
+	db.Exec("UPDATE audit_logs SET changes = ? WHERE action = ?", `{"name":{"old":"x","new":"y"}}`, "atualizacao_integracao")
+	if result, _ := audit.Verify(db, tenant.DefaultOrgID, nil); result.OK {
+		t.Errorf("Diff adulterado deveria quebrar a cadeia: %+v", result)
+	}
+}
+
+func TestDiffRedactsSecrets(t *testing.T) {
+	before := integrations.Integration{Name: "erp", ClientSecret: ""}
+	after := integrations.Integration{Name: "erp", ClientSecret: "cifrado"}
+	changes := audit.Diff(before, &after)
+	if len(changes) != 1 || changes["client_secret"].Old != "" || changes["client_secret"].New != crypto.MaskedValue {
+		t.Errorf("Segredo preenchido deveria aparecer só como mascarado: %+v", changes)
+	}
+	if audit.Diff(after, after) != nil {
+		t.Error("Versões iguais não deveriam gerar diff")
+	}
+}
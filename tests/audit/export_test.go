@@ -0,0 +1,222 @@
+package audit_test
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/auth"
+	"api-vault/internal/authz"
+	"api-vault/internal/tenant"
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const exportKey = "chave-das-exportacoes-32-bytes!!"
+
+// setupExport grava mais entradas que um lote da exportação, uma em cada três com falha
+func setupExport(t *testing.T, total int) (*gin.Engine, *gorm.DB, string) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_DEV_MODE", "true") // segredo HS256 padrão
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Erro ao abrir banco em memória: %v", err)
+	}
+	if err := tenant.Register(db); err != nil {
+		t.Fatalf("Erro ao registrar callbacks de tenant: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&audit.AuditLog{}, &audit.ChainHead{}, &authz.Role{}, &auth.User{}, &auth.Session{}, &auth.RevokedToken{})
+	org := tenant.ForOrg(db, tenant.DefaultOrgID)
+	err = org.Transaction(func(tx *gorm.DB) error {
+		for i := 1; i <= total; i++ {
+			status := "OK"
+			if i%3 == 0 {
+				status = "FAIL"
+			}
+			if err := audit.SaveAuditLog(tx, "admin", "login", status, fmt.Sprintf("tentativa %d, \"com\" vírgula", i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Erro ao gravar auditoria: %v", err)
+	}
+	// Outra organização não aparece na exportação
+	_ = audit.SaveAuditLog(tenant.ForOrg(db, 2), "outro", "login", "OK", "org 2")
+
+	mw, err := auth.JWTMiddlewareWithDB(db)
+	if err != nil {
+		t.Fatalf("Erro ao criar middleware JWT: %v", err)
+	}
+	adminJWT, _, _ := mw.TokenGenerator(&auth.User{ID: 1, Username: "admin", Role: "admin", OrgID: tenant.DefaultOrgID})
+	r := gin.New()
+	audit.RegisterRoutes(r, db, mw)
+	return r, db, adminJWT
+}
+
+func export(r *gin.Engine, jwtToken, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/audit-logs/export?"+query, nil)
+	req.Header.Set("Authorization", "Bearer "+jwtToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuditExportNDJSONAndCSV(t *testing.T) {
+	const total = 2500
+	r, db, adminJWT := setupExport(t, total)
+
+	w := export(r, adminJWT, "")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("Exportação NDJSON falhou: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	var lastID uint
+	rows := 0
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var entry audit.AuditLog
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("Linha NDJSON inválida: %v", err)
+		}
+		if entry.ID <= lastID || entry.OrgID != tenant.DefaultOrgID {
+			t.Fatalf("Entrada fora de ordem ou de outra organização: %+v", entry)
+		}
+		lastID = entry.ID
+		rows++
+	}
+	if rows != total {
+		t.Errorf("Esperadas %d entradas, exportadas %d", total, rows)
+	}
+
+	// Os filtros da listagem valem na exportação
+	w = export(r, adminJWT, "format=csv&outcome=FAIL")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("Exportação CSV falhou: %d %s", w.Code, w.Body.String())
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("CSV inválido: %v", err)
+	}
+	if len(records) != total/3+1 || records[0][0] != "id" || records[1][9] != "FAIL" || records[1][14] != "tentativa 3, \"com\" vírgula" {
+		t.Errorf("CSV inesperado: %d linhas, primeira %v", len(records), records[1])
+	}
+
+	var exports []audit.AuditLog
+	db.Where("action = ?", "exportacao_auditoria").Order("id").Find(&exports)
+	if len(exports) != 2 || exports[0].Details != fmt.Sprintf("formato=ndjson arquivo=false linhas=%d primeiro_id=1 ultimo_id=%d", total, total) {
+		t.Errorf("Exportações deveriam entrar na auditoria: %+v", exports)
+	}
+
+	if w := export(r, adminJWT, "format=xml"); w.Code != http.StatusBadRequest {
+		t.Errorf("Formato desconhecido deveria dar 400, obtido %d", w.Code)
+	}
+}
+
+func TestAuditExportCSVNeutralizesFormulas(t *testing.T) {
+	r, db, adminJWT := setupExport(t, 1)
+	formula := `=HYPERLINK("http://evil.example","clique")`
+	_ = audit.SaveAuditLog(tenant.ForOrg(db, tenant.DefaultOrgID), "@SUM(A1)", "login", "FAIL", formula)
+
+	w := export(r, adminJWT, "format=csv&outcome=FAIL")
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil || len(records) != 2 {
+		t.Fatalf("CSV inesperado: %v (%v)", records, err)
+	}
+	if records[1][4] != "'@SUM(A1)" || records[1][14] != "'"+formula {
+		t.Errorf("Células com fórmula deveriam ganhar apóstrofo: %v", records[1])
+	}
+
+	// O NDJSON mantém o valor original, que é o que o hash cobre
+	var entry audit.AuditLog
+	json.Unmarshal(bytes.TrimSpace(export(r, adminJWT, "outcome=FAIL").Body.Bytes()), &entry)
+	if entry.User != "@SUM(A1)" || entry.Details != formula {
+		t.Errorf("NDJSON não deveria alterar os valores: %+v", entry)
+	}
+}
+
+func TestAuditExportSignedArchive(t *testing.T) {
+	r, _, adminJWT := setupExport(t, 10)
+	if w := export(r, adminJWT, "archive=true"); w.Code != http.StatusConflict {
+		t.Fatalf("Arquivo sem AUDIT_EXPORT_KEY deveria dar 409, obtido %d", w.Code)
+	}
+	// A chave da cadeia não assina arquivos
+	t.Setenv("AUDIT_HMAC_KEY", "chave-hmac-da-auditoria-32-bytes")
+	if w := export(r, adminJWT, "archive=true"); w.Code != http.StatusConflict {
+		t.Fatalf("AUDIT_HMAC_KEY não deveria assinar arquivos, obtido %d", w.Code)
+	}
+	t.Setenv("AUDIT_EXPORT_KEY", "chave-hmac-da-auditoria-32-bytes")
+	if w := export(r, adminJWT, "archive=true"); w.Code != http.StatusInternalServerError {
+		t.Fatalf("AUDIT_EXPORT_KEY igual a AUDIT_HMAC_KEY deveria ser recusada, obtido %d", w.Code)
+	}
+
+	t.Setenv("AUDIT_EXPORT_KEY", exportKey)
+	w := export(r, adminJWT, "archive=true&format=csv&outcome=OK")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/gzip" {
+		t.Fatalf("Exportação do arquivo falhou: %d %s", w.Code, w.Body.String())
+	}
+	archive := w.Body.Bytes()
+	manifest, err := audit.VerifyArchive(bytes.NewReader(archive), []byte(exportKey))
+	if err != nil {
+		t.Fatalf("Arquivo deveria ser válido: %v", err)
+	}
+	if manifest.File != "audit-logs.csv" || manifest.Rows != 7 || manifest.Filter.Status != "OK" || manifest.GeneratedBy != "admin" || manifest.OrgID != tenant.DefaultOrgID {
+		t.Errorf("Manifesto inesperado: %+v", manifest)
+	}
+
+	for _, other := range []string{"outra-chave-com-trinta-e-dois-by", "chave-hmac-da-auditoria-32-bytes"} {
+		if _, err := audit.VerifyArchive(bytes.NewReader(archive), []byte(other)); !errors.Is(err, audit.ErrArchiveSignature) {
+			t.Errorf("Chave diferente deveria invalidar a assinatura: %v", err)
+		}
+	}
+	tampered := rewriteArchive(t, archive, "audit-logs.csv", func(data []byte) []byte {
+		return bytes.Replace(data, []byte("tentativa 1,"), []byte("tentativa 9,"), 1)
+	})
+	if _, err := audit.VerifyArchive(bytes.NewReader(tampered), []byte(exportKey)); !errors.Is(err, audit.ErrArchiveDigest) {
+		t.Errorf("Dados alterados deveriam ser detectados: %v", err)
+	}
+}
+
+// rewriteArchive refaz o tar.gz alterando o conteúdo de um dos arquivos
+func rewriteArchive(t *testing.T, archive []byte, name string, change func([]byte) []byte) []byte {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("gzip inválido: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	var out bytes.Buffer
+	gzw := gzip.NewWriter(&out)
+	tw := tar.NewWriter(gzw)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("tar inválido: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		if header.Name == name {
+			data = change(data)
+			header.Size = int64(len(data))
+		}
+		tw.WriteHeader(header)
+		tw.Write(data)
+	}
+	tw.Close()
+	gzw.Close()
+	return out.Bytes()
+}
@@ -0,0 +1,420 @@
+package auditsink_test
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/auditsink"
+	"api-vault/internal/tenant"
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func sampleEntry() *audit.AuditLog {
+	return &audit.AuditLog{
+		ID:           42,
+		OrgID:        tenant.DefaultOrgID,
+		Timestamp:    time.Date(2024, 5, 1, 12, 30, 0, 123000000, time.UTC),
+		ActorID:      7,
+		User:         "admin",
+		IP:           "10.0.0.1",
+		UserAgent:    "curl/8.0",
+		RequestID:    "req-1",
+		Action:       "consulta_token_id",
+		Status:       "FAIL",
+		ResourceType: "token",
+		ResourceID:   "9]9",
+		ErrorCode:    "not_found",
+		Details:      "token \"x\" não encontrado\nid=9|a",
+		Hash:         "abc",
+	}
+}
+
+func TestSyslogRFC5424OverUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Erro ao abrir listener UDP: %v", err)
+	}
+	defer pc.Close()
+	sink, err := auditsink.NewSyslog(auditsink.NetworkUDP, pc.LocalAddr().String(), auditsink.FormatRFC5424, nil)
+	if err != nil {
+		t.Fatalf("Erro ao criar sink: %v", err)
+	}
+	defer sink.Close()
+	sink.Hostname = "vault-1"
+	if err := sink.Send(context.Background(), sampleEntry()); err != nil {
+		t.Fatalf("Envio UDP falhou: %v", err)
+	}
+	buf := make([]byte, 4096)
+	pc.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("Mensagem não chegou: %v", err)
+	}
+	// authpriv (10) * 8 + warning (4) = 84
+	expected := `<84>1 2024-05-01T12:30:00.123Z vault-1 api-vault - consulta_token_id [audit@32473 id="42" org="1" user="admin" actor="7" ip="10.0.0.1" request_id="req-1" status="FAIL" resource_type="token" resource_id="9\]9" error_code="not_found" hash="abc"] token "x" não encontrado` + "\nid=9|a"
+	if got := string(buf[:n]); got != expected {
+		t.Errorf("Mensagem RFC 5424 inesperada:\n%s\nesperada:\n%s", got, expected)
+	}
+}
+
+func TestCEFFormat(t *testing.T) {
+	entry := sampleEntry()
+	entry.Action = "acao|com\\barra"
+	entry.ErrorCode = ""
+	got := auditsink.CEF(entry)
+	expected := `CEF:0|api-vault|api-vault|1.0|acao\|com\\barra|acao\|com\\barra|6|rt=1714566600123 externalId=42 suser=admin suid=7 src=10.0.0.1 requestClientApplication=curl/8.0 outcome=FAIL cs1Label=orgId cs1=1 cs2Label=requestId cs2=req-1 cs3Label=resourceType cs3=token cs4Label=resourceId cs4=9]9 cs6Label=hash cs6=abc msg=token "x" não encontrado\nid\=9|a`
+	if got != expected {
+		t.Errorf("CEF inesperado:\n%s\nesperado:\n%s", got, expected)
+	}
+}
+
+// readFrames lê mensagens com enquadramento por contagem de octetos
+func readFrames(conn net.Conn, count int) ([]string, error) {
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	r := bufio.NewReader(conn)
+	var frames []string
+	for len(frames) < count {
+		size, err := r.ReadString(' ')
+		if err != nil {
+			return frames, err
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(size))
+		if err != nil {
+			return frames, fmt.Errorf("tamanho de quadro inválido %q", size)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return frames, err
+		}
+		frames = append(frames, string(msg))
+	}
+	return frames, nil
+}
+
+func TestSyslogCEFOverTCPAndTLS(t *testing.T) {
+	cert, pool := selfSignedCert(t)
+	listeners := map[string]net.Listener{}
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Erro ao abrir listener TCP: %v", err)
+	}
+	listeners[auditsink.NetworkTCP] = tcp
+	tlsl, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatalf("Erro ao abrir listener TLS: %v", err)
+	}
+	listeners[auditsink.NetworkTLS] = tlsl
+
+	for network, l := range listeners {
+		t.Run(network, func(t *testing.T) {
+			defer l.Close()
+			sink, err := auditsink.NewSyslog(network, l.Addr().String(), auditsink.FormatCEF, &tls.Config{RootCAs: pool, ServerName: "127.0.0.1"})
+			if err != nil {
+				t.Fatalf("Erro ao criar sink: %v", err)
+			}
+			defer sink.Close()
+			// O coletor lê na goroutine: no TLS o handshake só termina quando o servidor lê
+			type result struct {
+				frames []string
+				err    error
+			}
+			received := make(chan result, 1)
+			go func() {
+				conn, err := l.Accept()
+				if err != nil {
+					received <- result{err: err}
+					return
+				}
+				defer conn.Close()
+				frames, err := readFrames(conn, 2)
+				received <- result{frames, err}
+			}()
+			// Duas entregas usam a mesma conexão
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			entry := sampleEntry()
+			for i := 0; i < 2; i++ {
+				entry.ID = uint(i + 1)
+				if err := sink.Send(ctx, entry); err != nil {
+					t.Fatalf("Envio %s falhou: %v", network, err)
+				}
+			}
+			res := <-received
+			if res.err != nil {
+				t.Fatalf("Coletor não recebeu as mensagens: %v", res.err)
+			}
+			frames := res.frames
+			for i, frame := range frames {
+				prefix := "<84>1 2024-05-01T12:30:00.123Z "
+				if !strings.HasPrefix(frame, prefix) || !strings.Contains(frame, " consulta_token_id - CEF:0|api-vault|") || !strings.Contains(frame, fmt.Sprintf("externalId=%d ", i+1)) {
+					t.Errorf("Quadro %d inesperado: %s", i, frame)
+				}
+			}
+		})
+	}
+
+	if _, err := auditsink.NewSyslog("sctp", "127.0.0.1:514", auditsink.FormatCEF, nil); err != auditsink.ErrUnknownNetwork {
+		t.Errorf("Transporte desconhecido deveria ser recusado: %v", err)
+	}
+}
+
+// selfSignedCert gera o certificado do coletor TLS e o pool que confia nele
+func selfSignedCert(t *testing.T) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Erro ao gerar chave: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "coletor"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Erro ao criar certificado: %v", err)
+	}
+	parsed, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(parsed)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// webhookServer recebe as entradas; enquanto failing estiver ligado responde 503
+type webhookServer struct {
+	*httptest.Server
+	failing atomic.Bool
+	hits    atomic.Int32
+	release chan struct{} // se não nil, segura cada requisição até ser fechado
+
+	mu       sync.Mutex
+	received []audit.AuditLog
+}
+
+func newWebhookServer(t *testing.T, secret string) *webhookServer {
+	ws := &webhookServer{}
+	ws.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws.hits.Add(1)
+		if ws.release != nil {
+			<-ws.release
+		}
+		if ws.failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		if secret != "" && r.Header.Get("X-Audit-Signature") != auditsink.Signature(secret, body) {
+			t.Errorf("Assinatura do webhook inválida: %s", r.Header.Get("X-Audit-Signature"))
+		}
+		var entry audit.AuditLog
+		json.Unmarshal(body, &entry)
+		if r.Header.Get("X-Audit-Event-ID") != strconv.FormatUint(uint64(entry.ID), 10) {
+			t.Errorf("X-Audit-Event-ID não confere com a entrada %d", entry.ID)
+		}
+		ws.mu.Lock()
+		ws.received = append(ws.received, entry)
+		ws.mu.Unlock()
+	}))
+	return ws
+}
+
+func (ws *webhookServer) ids() []uint {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	var ids []uint
+	for _, entry := range ws.received {
+		ids = append(ids, entry.ID)
+	}
+	return ids
+}
+
+func setupForwarding(t *testing.T, sink audit.Sink) (*gorm.DB, *audit.Forwarder) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Erro ao abrir banco em memória: %v", err)
+	}
+	if err := tenant.Register(db); err != nil {
+		t.Fatalf("Erro ao registrar callbacks de tenant: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&audit.AuditLog{}, &audit.ChainHead{}, &audit.DeadLetter{})
+
+	f := audit.NewForwarder(db, sink)
+	f.Backoff = time.Millisecond
+	f.RetryInterval = time.Hour // reenvio chamado pelo teste
+	ctx, cancel := context.WithCancel(context.Background())
+	go f.Start(ctx)
+	audit.SetForwarders(f)
+	t.Cleanup(func() {
+		audit.SetForwarders()
+		cancel()
+	})
+	return db, f
+}
+
+// waitFor espera a condição ficar verdadeira
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Tempo esgotado esperando %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func deadLetters(db *gorm.DB) []audit.DeadLetter {
+	var dls []audit.DeadLetter
+	db.Order("id").Find(&dls)
+	return dls
+}
+
+func TestWebhookForwardingDeadLettersAndReplay(t *testing.T) {
+	const secret = "segredo-do-webhook"
+	t.Setenv("AUDIT_SINK_MAX_ATTEMPTS", "3")
+	ws := newWebhookServer(t, secret)
+	defer ws.Close()
+	db, f := setupForwarding(t, auditsink.NewWebhook(ws.URL, secret, nil))
+	org := tenant.ForOrg(db, tenant.DefaultOrgID)
+
+	audit.SaveAuditLog(org, "admin", "login", "OK", "primeiro")
+	waitFor(t, "a primeira entrega", func() bool { return len(ws.ids()) == 1 })
+
+	// SIEM fora: a entrega é tentada MaxAttempts vezes e vira dead letter; as
+	// seguintes vão direto para a tabela, sem novas tentativas
+	ws.failing.Store(true)
+	for i := 2; i <= 4; i++ {
+		audit.SaveAuditLog(org, "admin", "login", "FAIL", fmt.Sprintf("entrada %d", i))
+	}
+	waitFor(t, "as dead letters", func() bool { return len(deadLetters(db)) == 3 })
+	dls := deadLetters(db)
+	if dls[0].Sink != "webhook" || dls[0].EntryID != 2 || dls[0].Attempts != 3 || dls[0].OrgID != tenant.DefaultOrgID || !strings.Contains(dls[0].Error, "503") {
+		t.Errorf("Dead letter inesperada: %+v", dls[0])
+	}
+	if hits := ws.hits.Load(); hits != 4 {
+		t.Errorf("Esperadas 4 requisições (1 entrega + 3 tentativas), obtidas %d", hits)
+	}
+
+	if sent, err := f.RetryDeadLetters(context.Background()); err == nil || sent != 0 {
+		t.Errorf("Reenvio com o SIEM fora deveria falhar: %d %v", sent, err)
+	}
+	if dls := deadLetters(db); dls[0].Attempts != 4 || len(dls) != 3 {
+		t.Errorf("Falha no reenvio deveria contar a tentativa: %+v", dls[0])
+	}
+
+	// SIEM de volta: as dead letters são reenviadas em ordem e removidas
+	ws.failing.Store(false)
+	sent, err := f.RetryDeadLetters(context.Background())
+	if err != nil || sent != 3 || len(deadLetters(db)) != 0 {
+		t.Fatalf("Reenvio deveria entregar as 3 dead letters: %d %v", sent, err)
+	}
+	audit.SaveAuditLog(org, "admin", "login", "OK", "depois da volta")
+	waitFor(t, "a entrega após a volta", func() bool { return len(ws.ids()) == 5 })
+	if ids := fmt.Sprint(ws.ids()); ids != "[1 2 3 4 5]" {
+		t.Errorf("Entradas fora de ordem no SIEM: %s", ids)
+	}
+	ws.mu.Lock()
+	replayed := ws.received[1]
+	ws.mu.Unlock()
+	if replayed.Details != "entrada 2" || replayed.Hash == "" || replayed.OrgID != tenant.DefaultOrgID {
+		t.Errorf("Dead letter reenviada sem os dados da entrada: %+v", replayed)
+	}
+}
+
+func TestDeadLetterReplayClaimsAndQuarantines(t *testing.T) {
+	ws := newWebhookServer(t, "")
+	defer ws.Close()
+	db, f := setupForwarding(t, auditsink.NewWebhook(ws.URL, "", nil))
+	dead := func(id uint, claimedBy string, until *time.Time) audit.DeadLetter {
+		payload, _ := json.Marshal(audit.AuditLog{ID: id, OrgID: tenant.DefaultOrgID, Details: fmt.Sprintf("entrada %d", id)})
+		return audit.DeadLetter{Sink: "webhook", EntryID: id, OrgID: tenant.DefaultOrgID, Payload: string(payload), ClaimedBy: claimedBy, ClaimedUntil: until}
+	}
+	future, past := time.Now().Add(time.Hour), time.Now().Add(-time.Minute)
+	rows := []audit.DeadLetter{
+		dead(1, "", nil),
+		{Sink: "webhook", EntryID: 2, Payload: "{ilegível"},
+		dead(3, "outra-instancia:1", &future), // outra instância está reenviando
+		dead(4, "outra-instancia:1", &past),   // reserva vencida: a instância caiu
+	}
+	for i := range rows {
+		db.Create(&rows[i])
+	}
+
+	sent, err := f.RetryDeadLetters(context.Background())
+	if err != nil || sent != 2 {
+		t.Fatalf("Esperadas 2 dead letters reenviadas, obtido %d (%v)", sent, err)
+	}
+	if ids := fmt.Sprint(ws.ids()); ids != "[1 4]" {
+		t.Errorf("Só as dead letters livres deveriam ser reenviadas, obtido %s", ids)
+	}
+	dls := deadLetters(db)
+	if len(dls) != 2 || dls[0].EntryID != 2 || !dls[0].Quarantined || dls[0].ClaimedBy != "" || !strings.Contains(dls[0].Error, "ilegível") {
+		t.Fatalf("Payload ilegível deveria ficar de lado: %+v", dls)
+	}
+	if dls[1].EntryID != 3 || dls[1].ClaimedBy != "outra-instancia:1" {
+		t.Errorf("Reserva de outra instância não deveria ser tocada: %+v", dls[1])
+	}
+
+	// A ilegível não volta a ser tentada
+	db.Delete(&dls[1])
+	if sent, err := f.RetryDeadLetters(context.Background()); err != nil || sent != 0 || len(ws.ids()) != 2 {
+		t.Errorf("Dead letter em quarentena não deveria ser reenviada: %d %v", sent, err)
+	}
+}
+
+func TestSlowSinkDoesNotBlockAuditLog(t *testing.T) {
+	t.Setenv("AUDIT_SINK_BUFFER", "2")
+	ws := newWebhookServer(t, "")
+	ws.release = make(chan struct{})
+	defer ws.Close()
+	defer close(ws.release)
+	db, _ := setupForwarding(t, auditsink.NewWebhook(ws.URL, "", nil))
+	org := tenant.ForOrg(db, tenant.DefaultOrgID)
+
+	// A primeira entrega fica presa no SIEM; as seguintes enchem a fila e o excedente vira dead letter
+	start := time.Now()
+	for i := 1; i <= 10; i++ {
+		if err := audit.SaveAuditLog(org, "admin", "login", "OK", fmt.Sprintf("entrada %d", i)); err != nil {
+			t.Fatalf("Gravação da auditoria falhou: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("SIEM lento bloqueou a gravação da auditoria por %s", elapsed)
+	}
+	var count int64
+	db.Model(&audit.AuditLog{}).Count(&count)
+	if count != 10 {
+		t.Errorf("Todas as entradas deveriam estar no banco, obtidas %d", count)
+	}
+	waitFor(t, "o excedente na dead letter", func() bool { return len(deadLetters(db)) > 0 })
+	for _, dl := range deadLetters(db) {
+		if dl.Error != "fila cheia" {
+			t.Errorf("Excedente deveria ser marcado como fila cheia: %+v", dl)
+		}
+	}
+}
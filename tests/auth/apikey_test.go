@@ -0,0 +1,135 @@
+package auth_test
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/auth"
+	"api-vault/internal/authz"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupAPIKeyRouter(t *testing.T) (*gin.Engine, string) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Erro ao abrir banco em memória: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&auth.User{}, &audit.AuditLog{}, &audit.ChainHead{}, &auth.Session{}, &auth.RevokedToken{}, &auth.LoginAttempt{}, &auth.APIKey{}, &authz.MFAPolicy{})
+	t.Setenv("JWT_DEV_MODE", "true") // segredo HS256 padrão
+	mw, err := auth.JWTMiddlewareWithDB(db)
+	if err != nil {
+		t.Fatalf("Erro ao criar middleware JWT: %v", err)
+	}
+	admin, err := auth.CreateInitialAdmin(db, "root", "root1234")
+	if err != nil {
+		t.Fatalf("Bootstrap do admin falhou: %v", err)
+	}
+	adminJWT, _, _ := mw.TokenGenerator(admin)
+	r := gin.New()
+	r.Use(auth.APIKeyMiddleware(db, mw))
+	auth.RegisterRoutes(r, db, mw)
+	return r, adminJWT
+}
+
+type apiKeyResponse struct {
+	Key    string      `json:"key"`
+	APIKey auth.APIKey `json:"api_key"`
+}
+
+func createAPIKey(t *testing.T, r *gin.Engine, adminJWT, path, body string) apiKeyResponse {
+	w := doRequest(r, "POST", path, adminJWT, body)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Criação da API key falhou: %d %s", w.Code, w.Body.String())
+	}
+	var resp apiKeyResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp
+}
+
+func withAPIKey(r *gin.Engine, method, path, key string) int {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("X-API-Key", key)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestServiceAccountAPIKeys(t *testing.T) {
+	r, adminJWT := setupAPIKeyRouter(t)
+	if w := doRequest(r, "POST", "/service-accounts", adminJWT, `{"username":"svc-batch","role":"admin"}`); w.Code != http.StatusCreated {
+		t.Fatalf("Criação da conta de serviço falhou: %d %s", w.Code, w.Body.String())
+	}
+	// Conta de serviço não faz login com senha
+	if w := doRequest(r, "POST", "/login", "", `{"username":"svc-batch","password":"qualquer1"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("Login de conta de serviço deveria falhar, obtido %d", w.Code)
+	}
+
+	full := createAPIKey(t, r, adminJWT, "/service-accounts/2/keys", `{"name":"batch"}`)
+	if w := doRequest(r, "GET", "/users", full.Key, ""); w.Code != http.StatusOK {
+		t.Errorf("API key como Bearer deveria ser aceita, obtido %d", w.Code)
+	}
+
+	// Escopo restringe o papel da conta
+	scoped := createAPIKey(t, r, adminJWT, "/service-accounts/2/keys", `{"name":"leitura","scopes":["users:read"]}`)
+	if code := withAPIKey(r, "GET", "/users", scoped.Key); code != http.StatusOK {
+		t.Errorf("Chave com users:read deveria listar usuários, obtido %d", code)
+	}
+	if code := withAPIKey(r, "GET", "/roles", scoped.Key); code != http.StatusForbidden {
+		t.Errorf("Chave sem roles:read deveria receber 403, obtido %d", code)
+	}
+
+	// Rotação invalida a chave anterior
+	w := doRequest(r, "POST", "/service-accounts/2/keys/"+fmt.Sprint(scoped.APIKey.ID)+"/rotate", adminJWT, "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Rotação falhou: %d %s", w.Code, w.Body.String())
+	}
+	var rotated apiKeyResponse
+	json.Unmarshal(w.Body.Bytes(), &rotated)
+	if code := withAPIKey(r, "GET", "/users", scoped.Key); code != http.StatusUnauthorized {
+		t.Errorf("Chave rotacionada deveria ser recusada, obtido %d", code)
+	}
+	if code := withAPIKey(r, "GET", "/users", rotated.Key); code != http.StatusOK || rotated.APIKey.Scopes != "users:read" {
+		t.Errorf("Nova chave deveria valer com os mesmos escopos, obtido %d %q", code, rotated.APIKey.Scopes)
+	}
+
+	if w := doRequest(r, "DELETE", "/service-accounts/2/keys/"+fmt.Sprint(full.APIKey.ID), adminJWT, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Revogação falhou: %d", w.Code)
+	}
+	if code := withAPIKey(r, "GET", "/users", full.Key); code != http.StatusUnauthorized {
+		t.Errorf("Chave revogada deveria ser recusada, obtido %d", code)
+	}
+	expired := createAPIKey(t, r, adminJWT, "/service-accounts/2/keys", `{"name":"curta","expires_in":"1ns"}`)
+	if code := withAPIKey(r, "GET", "/users", expired.Key); code != http.StatusUnauthorized {
+		t.Errorf("Chave expirada deveria ser recusada, obtido %d", code)
+	}
+	if code := withAPIKey(r, "GET", "/users", "avk_000000000000_inventada"); code != http.StatusUnauthorized {
+		t.Errorf("Chave desconhecida deveria ser recusada, obtido %d", code)
+	}
+
+	var keys []auth.APIKey
+	json.Unmarshal(doRequest(r, "GET", "/service-accounts/2/keys", adminJWT, "").Body.Bytes(), &keys)
+	if len(keys) != 4 {
+		t.Errorf("Listagem deveria trazer as 4 chaves, obtido %d", len(keys))
+	}
+}
+
+func TestAPIKeyScopesDoNotExpandRole(t *testing.T) {
+	r, adminJWT := setupAPIKeyRouter(t)
+	doRequest(r, "POST", "/service-accounts", adminJWT, `{"username":"svc-user","role":"user"}`)
+	key := createAPIKey(t, r, adminJWT, "/service-accounts/2/keys", `{"name":"x","scopes":["users:read"]}`)
+	if code := withAPIKey(r, "GET", "/users", key.Key); code != http.StatusForbidden {
+		t.Errorf("Escopo fora do papel não deveria conceder acesso, obtido %d", code)
+	}
+	if w := doRequest(r, "POST", "/service-accounts/2/keys", adminJWT, `{"name":"y","scopes":["nada:tudo"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Escopo desconhecido deveria dar 400, obtido %d", w.Code)
+	}
+}
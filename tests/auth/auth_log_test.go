@@ -25,6 +25,8 @@ func TestAuditLogOnUserCreate(t *testing.T) {
 	}
 	db.AutoMigrate(&auth.User{})
 
+	// Auto cadastro de role user sem JWT só é aceito com OPEN_SIGNUP
+	t.Setenv("OPEN_SIGNUP", "true")
 	r := gin.New()
 	// Não precisa de middleware JWT para teste do cadastro
 	auth.RegisterRoutes(r, db, nil)
@@ -0,0 +1,88 @@
+package auth_test
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/auth"
+	"api-vault/internal/authz"
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupUsersRouter(t *testing.T) (*gin.Engine, *gorm.DB, string) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Erro ao abrir banco em memória: %v", err)
+	}
+	db.AutoMigrate(&auth.User{}, &audit.AuditLog{}, &audit.ChainHead{}, &auth.Session{}, &auth.RevokedToken{}, &auth.RecoveryCode{}, &auth.MFAChallenge{}, &auth.LoginAttempt{}, &auth.APIKey{}, &authz.MFAPolicy{})
+	t.Setenv("JWT_DEV_MODE", "true") // segredo HS256 padrão
+	mw, err := auth.JWTMiddlewareWithDB(db)
+	if err != nil {
+		t.Fatalf("Erro ao criar middleware JWT: %v", err)
+	}
+	admin, err := auth.CreateInitialAdmin(db, "root", "root1234")
+	if err != nil {
+		t.Fatalf("Bootstrap do admin falhou: %v", err)
+	}
+	adminJWT, _, err := mw.TokenGenerator(admin)
+	if err != nil {
+		t.Fatalf("Erro ao gerar JWT: %v", err)
+	}
+	r := gin.New()
+	auth.RegisterRoutes(r, db, mw)
+	return r, db, adminJWT
+}
+
+func postUser(r *gin.Engine, payload, jwtToken string) int {
+	req := httptest.NewRequest("POST", "/users", bytes.NewBufferString(payload))
+	req.Header.Set("Content-Type", "application/json")
+	if jwtToken != "" {
+		req.Header.Set("Authorization", "Bearer "+jwtToken)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestCreateInitialAdminOnlyOnce(t *testing.T) {
+	_, db, _ := setupUsersRouter(t)
+	if _, err := auth.CreateInitialAdmin(db, "outro", "outro1234"); !errors.Is(err, auth.ErrAdminExists) {
+		t.Errorf("Segundo bootstrap deveria falhar com ErrAdminExists, obtido %v", err)
+	}
+}
+
+func TestUserCreationRequiresAdmin(t *testing.T) {
+	r, _, adminJWT := setupUsersRouter(t)
+
+	if code := postUser(r, `{"username":"intruso","password":"senha123","role":"admin"}`, ""); code != http.StatusUnauthorized {
+		t.Errorf("Cadastro de admin sem JWT deveria ser negado, obtido %d", code)
+	}
+	if code := postUser(r, `{"username":"comum","password":"senha123","role":"user"}`, ""); code != http.StatusUnauthorized {
+		t.Errorf("Cadastro sem JWT com OPEN_SIGNUP desligado deveria ser negado, obtido %d", code)
+	}
+	if code := postUser(r, `{"username":"comum","password":"senha123","role":"user"}`, "jwt-invalido"); code != http.StatusUnauthorized {
+		t.Errorf("JWT inválido deveria ser rejeitado, obtido %d", code)
+	}
+	if code := postUser(r, `{"username":"operador","password":"senha123","role":"admin"}`, adminJWT); code != http.StatusCreated {
+		t.Errorf("Admin deveria conseguir criar outro admin, obtido %d", code)
+	}
+}
+
+func TestOpenSignupIsLimitedToUserRole(t *testing.T) {
+	t.Setenv("OPEN_SIGNUP", "true")
+	r, _, _ := setupUsersRouter(t)
+
+	if code := postUser(r, `{"username":"novo","password":"senha123","role":"user"}`, ""); code != http.StatusCreated {
+		t.Errorf("Auto cadastro de user deveria ser aceito, obtido %d", code)
+	}
+	if code := postUser(r, `{"username":"intruso","password":"senha123","role":"admin"}`, ""); code != http.StatusUnauthorized {
+		t.Errorf("Auto cadastro de admin deveria ser negado, obtido %d", code)
+	}
+}
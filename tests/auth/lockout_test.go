@@ -0,0 +1,110 @@
+package auth_test
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/totp"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLoginLockoutAndUnlock(t *testing.T) {
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "3")
+	t.Setenv("LOGIN_IP_MAX_ATTEMPTS", "100")
+	r, db, adminJWT := setupUsersRouter(t)
+	if code := postUser(r, `{"username":"maria","password":"maria1234","role":"user"}`, adminJWT); code != http.StatusCreated {
+		t.Fatalf("Cadastro falhou: %d", code)
+	}
+
+	// Senha errada e username inexistente têm a mesma resposta
+	wrong := doRequest(r, "POST", "/login", "", `{"username":"maria","password":"errada123"}`)
+	unknown := doRequest(r, "POST", "/login", "", `{"username":"ninguem","password":"errada123"}`)
+	if wrong.Code != http.StatusUnauthorized || wrong.Code != unknown.Code || wrong.Body.String() != unknown.Body.String() {
+		t.Errorf("Respostas deveriam ser iguais: %d %s / %d %s", wrong.Code, wrong.Body.String(), unknown.Code, unknown.Body.String())
+	}
+
+	for i := 0; i < 2; i++ {
+		doRequest(r, "POST", "/login", "", `{"username":"maria","password":"errada123"}`)
+	}
+	w := doRequest(r, "POST", "/login", "", `{"username":"maria","password":"maria1234"}`)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("Username bloqueado deveria receber 429 com Retry-After, obtido %d", w.Code)
+	}
+	var locks int64
+	db.Model(&audit.AuditLog{}).Where("action = ? AND user = ?", "bloqueio_login", "maria").Count(&locks)
+	if locks != 1 {
+		t.Errorf("Bloqueio deveria ser auditado uma vez, encontrado %d", locks)
+	}
+
+	// Usernames inexistentes também são bloqueados, sem revelar nada
+	for i := 0; i < 3; i++ {
+		doRequest(r, "POST", "/login", "", `{"username":"ninguem","password":"errada123"}`)
+	}
+	if w := doRequest(r, "POST", "/login", "", `{"username":"ninguem","password":"errada123"}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Username inexistente deveria ser bloqueado igual, obtido %d", w.Code)
+	}
+
+	if w := doRequest(r, "DELETE", "/users/2/lockout", adminJWT, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Desbloqueio falhou: %d %s", w.Code, w.Body.String())
+	}
+	login(t, r, "maria", "maria1234")
+	var unlocks int64
+	db.Model(&audit.AuditLog{}).Where("action = ? AND status = ?", "desbloqueio_login", "OK").Count(&unlocks)
+	if unlocks != 1 {
+		t.Errorf("Desbloqueio deveria ser auditado, encontrado %d", unlocks)
+	}
+}
+
+func TestLoginLockoutPerIP(t *testing.T) {
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "100")
+	t.Setenv("LOGIN_IP_MAX_ATTEMPTS", "4")
+	r, _, _ := setupUsersRouter(t)
+	// Tentativas espalhadas por vários usernames somam no IP
+	for _, u := range []string{"ana", "bia", "caio", "davi"} {
+		doRequest(r, "POST", "/login", "", `{"username":"`+u+`","password":"errada123"}`)
+	}
+	if w := doRequest(r, "POST", "/login", "", `{"username":"root","password":"root1234"}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("IP bloqueado deveria receber 429 mesmo com senha certa, obtido %d", w.Code)
+	}
+}
+
+func TestLoginLockoutSurvivesPasswordUntilMFA(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "3")
+	t.Setenv("LOGIN_IP_MAX_ATTEMPTS", "100")
+	r, _, adminJWT := setupUsersRouter(t)
+	postUser(r, `{"username":"maria","password":"maria1234","role":"user"}`, adminJWT)
+	secret := enrollTOTP(t, r, login(t, r, "maria", "maria1234").Token)
+	step := totp.Step(time.Now())
+
+	// Senha certa com MFA pendente não zera as falhas anteriores
+	for i := 0; i < 2; i++ {
+		doRequest(r, "POST", "/login", "", `{"username":"maria","password":"errada123"}`)
+	}
+	challenge := startMFALogin(t, r, "maria", "maria1234")
+	if status, _ := finishMFALogin(r, challenge, "000000"); status != http.StatusUnauthorized {
+		t.Fatalf("Código errado deveria dar 401, obtido %d", status)
+	}
+	code, _ := totp.Code(secret, step+1)
+	if status, _ := finishMFALogin(r, challenge, code); status != http.StatusTooManyRequests {
+		t.Errorf("Usuário bloqueado não deveria concluir o MFA, obtido %d", status)
+	}
+	if w := doRequest(r, "POST", "/login", "", `{"username":"maria","password":"maria1234"}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Usuário bloqueado deveria receber 429 no login, obtido %d", w.Code)
+	}
+
+	if w := doRequest(r, "DELETE", "/users/2%20OR%201=1/lockout", adminJWT, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("ID não numérico deveria dar 400, obtido %d", w.Code)
+	}
+	doRequest(r, "DELETE", "/users/2/lockout", adminJWT, "")
+
+	// Só o segundo fator certo zera as falhas
+	doRequest(r, "POST", "/login", "", `{"username":"maria","password":"errada123"}`)
+	if status, _ := finishMFALogin(r, startMFALogin(t, r, "maria", "maria1234"), code); status != http.StatusOK {
+		t.Fatalf("Login com MFA deveria funcionar após o desbloqueio, obtido %d", status)
+	}
+	for i := 0; i < 2; i++ {
+		doRequest(r, "POST", "/login", "", `{"username":"maria","password":"errada123"}`)
+	}
+	startMFALogin(t, r, "maria", "maria1234")
+}
@@ -0,0 +1,168 @@
+package auth_test
+
+import (
+	"api-vault/internal/totp"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type mfaChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	Challenge   string `json:"challenge"`
+}
+
+func startMFALogin(t *testing.T, r *gin.Engine, username, password string) string {
+	w := doRequest(r, "POST", "/login", "", `{"username":"`+username+`","password":"`+password+`"}`)
+	var resp mfaChallenge
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || !resp.MFARequired || resp.Challenge == "" {
+		t.Fatalf("Login com MFA ativo deveria devolver desafio: %d %s", w.Code, w.Body.String())
+	}
+	return resp.Challenge
+}
+
+func finishMFALogin(r *gin.Engine, challenge, code string) (int, sessionResponse) {
+	w := doRequest(r, "POST", "/login/mfa", "", `{"challenge":"`+challenge+`","code":"`+code+`"}`)
+	var resp sessionResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+// enrollTOTP cadastra e confirma o TOTP do dono do JWT e devolve a semente
+func enrollTOTP(t *testing.T, r *gin.Engine, jwtToken string) string {
+	w := doRequest(r, "POST", "/mfa/totp/enroll", jwtToken, "")
+	var enrollment struct {
+		Secret string `json:"secret"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &enrollment)
+	code, _ := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	if w := doRequest(r, "POST", "/mfa/totp/confirm", jwtToken, `{"code":"`+code+`"}`); w.Code != http.StatusOK {
+		t.Fatalf("Confirmação TOTP falhou: %d %s", w.Code, w.Body.String())
+	}
+	return enrollment.Secret
+}
+
+func TestTOTPEnrollmentAndTwoStepLogin(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	// Códigos errados também bloqueiam o usuário; aqui só o limite por desafio interessa
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "100")
+	r, _, adminJWT := setupUsersRouter(t)
+	if w := doRequest(r, "PUT", "/roles/user/mfa", adminJWT, `{"required":true}`); w.Code != http.StatusOK {
+		t.Fatalf("Exigir MFA para o papel falhou: %d %s", w.Code, w.Body.String())
+	}
+	if code := postUser(r, `{"username":"maria","password":"maria1234","role":"user"}`, adminJWT); code != http.StatusCreated {
+		t.Fatalf("Cadastro falhou: %d", code)
+	}
+
+	// Sem TOTP cadastrado, o JWT só dá acesso ao cadastro
+	pending := login(t, r, "maria", "maria1234")
+	w := doRequest(r, "POST", "/mfa/recovery-codes", pending.Token, `{"code":"000000"}`)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "MFA obrigatório") {
+		t.Errorf("JWT pendente de MFA deveria ser barrado fora do cadastro, obtido %d %s", w.Code, w.Body.String())
+	}
+
+	w = doRequest(r, "POST", "/mfa/totp/enroll", pending.Token, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Cadastro TOTP falhou: %d %s", w.Code, w.Body.String())
+	}
+	var enrollment struct {
+		Secret          string `json:"secret"`
+		ProvisioningURI string `json:"provisioning_uri"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &enrollment)
+	if !strings.HasPrefix(enrollment.ProvisioningURI, "otpauth://totp/") || !strings.Contains(enrollment.ProvisioningURI, enrollment.Secret) {
+		t.Errorf("URI de provisionamento inesperada: %s", enrollment.ProvisioningURI)
+	}
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(enrollment.Secret, step)
+	w = doRequest(r, "POST", "/mfa/totp/confirm", pending.Token, `{"code":"`+code+`"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Confirmação TOTP falhou: %d %s", w.Code, w.Body.String())
+	}
+	var recovery struct {
+		Codes []string `json:"recovery_codes"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &recovery)
+	if len(recovery.Codes) != 10 {
+		t.Fatalf("Deveria devolver 10 códigos de recuperação, obtido %d", len(recovery.Codes))
+	}
+
+	// Login em dois passos; o mesmo código não vale duas vezes
+	if status, _ := finishMFALogin(r, startMFALogin(t, r, "maria", "maria1234"), code); status != http.StatusUnauthorized {
+		t.Errorf("Código TOTP já usado deveria ser recusado, obtido %d", status)
+	}
+	next, _ := totp.Code(enrollment.Secret, step+1)
+	status, session := finishMFALogin(r, startMFALogin(t, r, "maria", "maria1234"), next)
+	if status != http.StatusOK || session.Token == "" || session.RefreshToken == "" {
+		t.Fatalf("Login com TOTP deveria emitir JWT e refresh token, obtido %d", status)
+	}
+	if w := doRequest(r, "POST", "/mfa/recovery-codes", session.Token, `{"code":"000000"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("JWT completo deveria passar do middleware e falhar só no código, obtido %d", w.Code)
+	}
+
+	// Código de recuperação é de uso único
+	if status, _ := finishMFALogin(r, startMFALogin(t, r, "maria", "maria1234"), strings.ToUpper(recovery.Codes[0])); status != http.StatusOK {
+		t.Errorf("Código de recuperação deveria permitir o login, obtido %d", status)
+	}
+	if status, _ := finishMFALogin(r, startMFALogin(t, r, "maria", "maria1234"), recovery.Codes[0]); status != http.StatusUnauthorized {
+		t.Errorf("Código de recuperação reutilizado deveria ser recusado, obtido %d", status)
+	}
+
+	// O desafio é descartado após tentativas demais
+	challenge := startMFALogin(t, r, "maria", "maria1234")
+	for i := 0; i < 5; i++ {
+		finishMFALogin(r, challenge, "111111")
+	}
+	if status, _ := finishMFALogin(r, challenge, recovery.Codes[1]); status != http.StatusUnauthorized {
+		t.Errorf("Desafio esgotado deveria ser recusado, obtido %d", status)
+	}
+
+	// O papel exige MFA: a usuária não pode desativá-lo, mas o admin pode resetar
+	if w := doRequest(r, "DELETE", "/mfa/totp", session.Token, `{"code":"`+recovery.Codes[2]+`"}`); w.Code != http.StatusConflict {
+		t.Errorf("Desativar MFA exigido pelo papel deveria dar 409, obtido %d", w.Code)
+	}
+	if w := doRequest(r, "DELETE", "/users/2/mfa", adminJWT, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Reset de MFA falhou: %d %s", w.Code, w.Body.String())
+	}
+	if w := doRequest(r, "GET", "/users", session.Token, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Reset de MFA deveria encerrar as sessões, obtido %d", w.Code)
+	}
+}
+
+func TestMFACodeGuessingAcrossChallengesLocksUser(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "5")
+	t.Setenv("LOGIN_IP_MAX_ATTEMPTS", "100")
+	r, _, adminJWT := setupUsersRouter(t)
+	postUser(r, `{"username":"maria","password":"maria1234","role":"user"}`, adminJWT)
+	secret := enrollTOTP(t, r, login(t, r, "maria", "maria1234").Token)
+
+	// Quem tem a senha abre vários desafios para somar palpites além do limite de cada um
+	challenges := make([]string, 8)
+	for i := range challenges {
+		challenges[i] = startMFALogin(t, r, "maria", "maria1234")
+	}
+	for _, challenge := range challenges[:5] {
+		if status, _ := finishMFALogin(r, challenge, "000000"); status != http.StatusUnauthorized {
+			t.Fatalf("Código errado deveria dar 401, obtido %d", status)
+		}
+	}
+	code, _ := totp.Code(secret, totp.Step(time.Now())+1)
+	for _, challenge := range challenges[5:] {
+		if status, _ := finishMFALogin(r, challenge, code); status != http.StatusTooManyRequests {
+			t.Errorf("Usuário bloqueado não deveria concluir o MFA, obtido %d", status)
+		}
+	}
+	if w := doRequest(r, "POST", "/login", "", `{"username":"maria","password":"maria1234"}`); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Usuário bloqueado deveria receber 429 no login, obtido %d", w.Code)
+	}
+
+	if w := doRequest(r, "DELETE", "/users/2%20OR%201=1/mfa", adminJWT, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("ID não numérico deveria dar 400, obtido %d", w.Code)
+	}
+}
@@ -0,0 +1,126 @@
+package auth_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type sessionResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func doRequest(r *gin.Engine, method, path, jwtToken, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if jwtToken != "" {
+		req.Header.Set("Authorization", "Bearer "+jwtToken)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func login(t *testing.T, r *gin.Engine, username, password string) sessionResponse {
+	w := doRequest(r, "POST", "/login", "", `{"username":"`+username+`","password":"`+password+`"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Login falhou: %d %s", w.Code, w.Body.String())
+	}
+	var resp sessionResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Token == "" || resp.RefreshToken == "" {
+		t.Fatalf("Login deveria devolver token e refresh_token: %s", w.Body.String())
+	}
+	return resp
+}
+
+func refresh(r *gin.Engine, refreshToken string) (*httptest.ResponseRecorder, sessionResponse) {
+	w := doRequest(r, "POST", "/auth/refresh", "", `{"refresh_token":"`+refreshToken+`"}`)
+	var resp sessionResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+func TestRefreshRotatesAndLogoutRevokes(t *testing.T) {
+	r, _, _ := setupUsersRouter(t)
+	session := login(t, r, "root", "root1234")
+
+	w, renewed := refresh(r, session.RefreshToken)
+	if w.Code != http.StatusOK || renewed.Token == "" || renewed.RefreshToken == session.RefreshToken {
+		t.Fatalf("Renovação deveria emitir novo JWT e novo refresh token: %d %s", w.Code, w.Body.String())
+	}
+	// O refresh token é de uso único
+	if w, _ := refresh(r, session.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Refresh token já usado deveria dar 401, obtido %d", w.Code)
+	}
+	if w := doRequest(r, "GET", "/users", renewed.Token, ""); w.Code != http.StatusOK {
+		t.Fatalf("JWT renovado deveria funcionar, obtido %d", w.Code)
+	}
+
+	if w := doRequest(r, "POST", "/logout", renewed.Token, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Logout falhou: %d %s", w.Code, w.Body.String())
+	}
+	if w := doRequest(r, "GET", "/users", renewed.Token, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("JWT após logout deveria dar 401, obtido %d", w.Code)
+	}
+	// JWTs anteriores da mesma sessão também caem com ela
+	if w := doRequest(r, "GET", "/users", session.Token, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("JWT anterior da sessão encerrada deveria dar 401, obtido %d", w.Code)
+	}
+	if w, _ := refresh(r, renewed.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Refresh após logout deveria dar 401, obtido %d", w.Code)
+	}
+}
+
+func TestDeletingUserEndsSessions(t *testing.T) {
+	r, _, adminJWT := setupUsersRouter(t)
+	if code := postUser(r, `{"username":"maria","password":"maria1234","role":"user"}`, adminJWT); code != http.StatusCreated {
+		t.Fatalf("Cadastro falhou: %d", code)
+	}
+	session := login(t, r, "maria", "maria1234")
+	if w := doRequest(r, "POST", "/logout", session.Token, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("JWT da Maria deveria ser aceito antes da remoção, obtido %d", w.Code)
+	}
+
+	other := login(t, r, "maria", "maria1234")
+	if w := doRequest(r, "DELETE", "/users/2", adminJWT, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Remoção do usuário falhou: %d %s", w.Code, w.Body.String())
+	}
+	if w := doRequest(r, "POST", "/logout", other.Token, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("JWT de usuário removido deveria dar 401, obtido %d", w.Code)
+	}
+	if w, _ := refresh(r, other.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Refresh de usuário removido deveria dar 401, obtido %d", w.Code)
+	}
+}
+
+func TestRevokingSessionsRejectsSessionlessJWT(t *testing.T) {
+	r, _, adminJWT := setupUsersRouter(t)
+	postUser(r, `{"username":"ana","password":"ana12345","role":"admin"}`, adminJWT)
+	ana := login(t, r, "ana", "ana12345")
+	if w := doRequest(r, "DELETE", "/users/1%20OR%201=1/sessions", ana.Token, ""); w.Code != http.StatusBadRequest {
+		t.Errorf("ID não numérico deveria dar 400, obtido %d", w.Code)
+	}
+
+	// O JWT do bootstrap não tem sessão; o iat tem resolução de segundos
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	if w := doRequest(r, "DELETE", "/users/1/sessions", ana.Token, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Revogação falhou: %d %s", w.Code, w.Body.String())
+	}
+	if w := doRequest(r, "GET", "/me", adminJWT, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("JWT sem sessão emitido antes da revogação deveria dar 401, obtido %d", w.Code)
+	}
+	if w := doRequest(r, "GET", "/me", ana.Token, ""); w.Code != http.StatusOK {
+		t.Errorf("Sessões de outro usuário não deveriam ser afetadas, obtido %d", w.Code)
+	}
+	root := login(t, r, "root", "root1234")
+	if w := doRequest(r, "GET", "/me", root.Token, ""); w.Code != http.StatusOK {
+		t.Errorf("Login depois da revogação deveria funcionar, obtido %d", w.Code)
+	}
+}
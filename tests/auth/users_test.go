@@ -0,0 +1,148 @@
+package auth_test
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/auth"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestUserResponsesNeverIncludePasswordHash(t *testing.T) {
+	r, _, adminJWT := setupUsersRouter(t)
+	postUser(r, `{"username":"maria","password":"maria1234","role":"user"}`, adminJWT)
+	for _, path := range []string{"/users", "/users/2", "/me"} {
+		body := doRequest(r, "GET", path, adminJWT, "").Body.String()
+		if strings.Contains(body, "Password") || strings.Contains(body, "$2a$") {
+			t.Errorf("%s não deveria expor o hash da senha: %s", path, body)
+		}
+	}
+}
+
+func TestUserLifecycle(t *testing.T) {
+	r, db, adminJWT := setupUsersRouter(t)
+	if code := postUser(r, `{"username":"maria","password":"maria1234","role":"user"}`, adminJWT); code != http.StatusCreated {
+		t.Fatalf("Cadastro falhou: %d", code)
+	}
+
+	w := doRequest(r, "PATCH", "/users/2", adminJWT, `{"username":"maria.silva","role":"admin"}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "maria.silva") {
+		t.Fatalf("PATCH falhou: %d %s", w.Code, w.Body.String())
+	}
+	var entry audit.AuditLog
+	db.Where("action = ?", "alteracao_usuario").First(&entry)
+	if entry.User != "root" || !strings.Contains(entry.Details, "alvo=maria id=2") || !strings.Contains(entry.Details, "role=user->admin") {
+		t.Errorf("Auditoria deveria ter ator e alvo, obtido %+v", entry)
+	}
+
+	// Desativar encerra as sessões e bloqueia o login
+	session := login(t, r, "maria.silva", "maria1234")
+	if w := doRequest(r, "POST", "/users/1/disable", adminJWT, ""); w.Code != http.StatusConflict {
+		t.Errorf("Desativar o próprio usuário deveria dar 409, obtido %d", w.Code)
+	}
+	if w := doRequest(r, "POST", "/users/2/disable", adminJWT, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Desativação falhou: %d", w.Code)
+	}
+	if w := doRequest(r, "GET", "/me", session.Token, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("JWT de usuário desativado deveria ser recusado, obtido %d", w.Code)
+	}
+	if w, _ := refresh(r, session.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Refresh de usuário desativado deveria falhar, obtido %d", w.Code)
+	}
+	w = doRequest(r, "POST", "/login", "", `{"username":"maria.silva","password":"maria1234"}`)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "desativado") {
+		t.Errorf("Login de usuário desativado deveria dar 401, obtido %d %s", w.Code, w.Body.String())
+	}
+	doRequest(r, "POST", "/users/2/enable", adminJWT, "")
+
+	// Redefinição pelo admin troca a senha e encerra as sessões
+	session = login(t, r, "maria.silva", "maria1234")
+	if w := doRequest(r, "PUT", "/users/2/password", adminJWT, `{"password":"temporaria1"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("Redefinição falhou: %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := refresh(r, session.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Redefinição deveria encerrar as sessões, obtido %d", w.Code)
+	}
+	session = login(t, r, "maria.silva", "temporaria1")
+
+	// Troca da própria senha mantém a sessão atual e encerra as demais
+	other := login(t, r, "maria.silva", "temporaria1")
+	if w := doRequest(r, "PUT", "/me/password", session.Token, `{"current_password":"errada","new_password":"definitiva1"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("Senha atual errada deveria dar 401, obtido %d", w.Code)
+	}
+	if w := doRequest(r, "PUT", "/me/password", session.Token, `{"current_password":"temporaria1","new_password":"definitiva1"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("Troca de senha falhou: %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := refresh(r, other.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Troca de senha deveria encerrar as outras sessões, obtido %d", w.Code)
+	}
+	w = doRequest(r, "GET", "/me", session.Token, "")
+	var me struct {
+		User struct {
+			Username string
+		} `json:"user"`
+		Permissions []string `json:"permissions"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &me)
+	if w.Code != http.StatusOK || me.User.Username != "maria.silva" || len(me.Permissions) == 0 {
+		t.Errorf("GET /me deveria manter a sessão atual, obtido %d %s", w.Code, w.Body.String())
+	}
+	login(t, r, "maria.silva", "definitiva1")
+}
+
+func TestRoleChangeEndsSessions(t *testing.T) {
+	r, _, adminJWT := setupUsersRouter(t)
+	postUser(r, `{"username":"maria","password":"maria1234","role":"user"}`, adminJWT)
+
+	session := login(t, r, "maria", "maria1234")
+	if w := doRequest(r, "PATCH", "/users/2", adminJWT, `{"role":"admin"}`); w.Code != http.StatusOK {
+		t.Fatalf("PATCH falhou: %d %s", w.Code, w.Body.String())
+	}
+	if w := doRequest(r, "GET", "/me", session.Token, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("JWT com o papel antigo deveria ser recusado após o PATCH, obtido %d", w.Code)
+	}
+	if w, _ := refresh(r, session.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Refresh com o papel antigo deveria falhar após o PATCH, obtido %d", w.Code)
+	}
+
+	// Só o username não encerra as sessões
+	session = login(t, r, "maria", "maria1234")
+	doRequest(r, "PATCH", "/users/2", adminJWT, `{"username":"maria.silva"}`)
+	if w := doRequest(r, "GET", "/me", session.Token, ""); w.Code != http.StatusOK {
+		t.Errorf("Troca de username não deveria encerrar a sessão, obtido %d", w.Code)
+	}
+
+	if w := doRequest(r, "PUT", "/users/2/role", adminJWT, `{"role":"user"}`); w.Code != http.StatusOK {
+		t.Fatalf("PUT role falhou: %d %s", w.Code, w.Body.String())
+	}
+	if w, _ := refresh(r, session.RefreshToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Refresh com o papel antigo deveria falhar após o PUT role, obtido %d", w.Code)
+	}
+}
+
+func TestUserRoutesRejectNonNumericID(t *testing.T) {
+	r, db, adminJWT := setupUsersRouter(t)
+	postUser(r, `{"username":"maria","password":"maria1234","role":"user"}`, adminJWT)
+
+	// A condição injetada iria para o SQL antes do filtro de organização
+	injected := url.PathEscape("2 OR 1=1")
+	for _, route := range []struct{ method, path, body string }{
+		{"GET", "/users/" + injected, ""},
+		{"PATCH", "/users/" + injected, `{"username":"x"}`},
+		{"POST", "/users/" + injected + "/disable", ""},
+		{"PUT", "/users/" + injected + "/password", `{"password":"outra-senha1"}`},
+		{"PUT", "/users/" + injected + "/role", `{"role":"user"}`},
+		{"DELETE", "/users/" + injected, ""},
+	} {
+		if w := doRequest(r, route.method, route.path, adminJWT, route.body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s %s deveria dar 400, obtido %d", route.method, route.path, w.Code)
+		}
+	}
+	var count int64
+	db.Model(&auth.User{}).Count(&count)
+	if count != 2 {
+		t.Errorf("Nenhum usuário deveria ter sido removido, restam %d", count)
+	}
+}
@@ -0,0 +1,186 @@
+package authz_test
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/auth"
+	"api-vault/internal/authz"
+	"api-vault/internal/integrations"
+	"api-vault/internal/middleware"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setup(t *testing.T) (*gin.Engine, *gorm.DB, func(user auth.User) string) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("DATA_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Erro ao abrir banco em memória: %v", err)
+	}
+	db.AutoMigrate(&auth.User{}, &authz.Role{}, &auth.Group{}, &auth.GroupMember{}, &integrations.Integration{}, &integrations.ACLEntry{}, &audit.AuditLog{}, &audit.ChainHead{}, &auth.Session{}, &auth.RevokedToken{})
+	t.Setenv("JWT_DEV_MODE", "true") // segredo HS256 padrão
+	mw, err := auth.JWTMiddlewareWithDB(db)
+	if err != nil {
+		t.Fatalf("Erro ao criar middleware JWT: %v", err)
+	}
+	r := gin.New()
+	auth.RegisterRoutes(r, db, mw)
+	integrations.RegisterRoutes(r, db, mw)
+	issue := func(user auth.User) string {
+		token, _, err := mw.TokenGenerator(&user)
+		if err != nil {
+			t.Fatalf("Erro ao gerar JWT: %v", err)
+		}
+		return token
+	}
+	return r, db, issue
+}
+
+func do(r *gin.Engine, method, path, jwtToken, body string) int {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+jwtToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRoleValidation(t *testing.T) {
+	var role authz.Role
+	if err := role.SetPermissions([]string{authz.PermAuditRead, "integrations:fly"}); !errors.Is(err, authz.ErrUnknownPermission) {
+		t.Errorf("Permissão desconhecida deveria ser rejeitada, obtido %v", err)
+	}
+	if err := role.SetPermissions([]string{authz.PermTokensRead, authz.PermAuditRead, authz.PermAuditRead}); err != nil {
+		t.Fatalf("Erro ao definir permissões: %v", err)
+	}
+	if got := role.PermissionList(); len(got) != 2 {
+		t.Errorf("Permissões duplicadas deveriam ser removidas: %v", got)
+	}
+	if !authz.CanGrant(authz.AllPermissions, role.PermissionList()) {
+		t.Error("Admin deveria poder conceder qualquer papel")
+	}
+	if authz.CanGrant([]string{authz.PermTokensRead}, role.PermissionList()) {
+		t.Error("Não deveria ser possível conceder permissões que o concedente não tem")
+	}
+}
+
+func TestCustomRoleLimitsRoutes(t *testing.T) {
+	r, _, issue := setup(t)
+	adminJWT := issue(auth.User{ID: 1, Username: "admin", Role: authz.RoleAdmin})
+
+	if code := do(r, "POST", "/roles", adminJWT, `{"name":"leitor","permissions":["integrations:read"]}`); code != http.StatusCreated {
+		t.Fatalf("Criação de papel falhou: %d", code)
+	}
+	if code := do(r, "POST", "/roles", adminJWT, `{"name":"admin","permissions":["integrations:read"]}`); code != http.StatusConflict {
+		t.Errorf("Papel embutido não deveria ser sobrescrito, obtido %d", code)
+	}
+
+	readerJWT := issue(auth.User{ID: 2, Username: "leitor1", Role: "leitor"})
+	if code := do(r, "GET", "/integrations", readerJWT, ""); code != http.StatusOK {
+		t.Errorf("Papel com integrations:read deveria listar integrações, obtido %d", code)
+	}
+	if code := do(r, "POST", "/integrations", readerJWT, `{"name":"erp","auth_type":"client_credentials","client_id":"cid","client_secret":"sec","token_url":"https://erp.example.com/token"}`); code != http.StatusForbidden {
+		t.Errorf("Papel sem integrations:write não deveria cadastrar, obtido %d", code)
+	}
+
+	// Papel desconhecido (ex.: removido) não concede nada
+	ghostJWT := issue(auth.User{ID: 3, Username: "fantasma", Role: "inexistente"})
+	if code := do(r, "GET", "/integrations", ghostJWT, ""); code != http.StatusForbidden {
+		t.Errorf("Papel inexistente deveria ser negado, obtido %d", code)
+	}
+}
+
+func TestUserManagerCannotEscalate(t *testing.T) {
+	r, db, issue := setup(t)
+	manager := authz.Role{Name: "gestor"}
+	_ = manager.SetPermissions([]string{authz.PermUsersRead, authz.PermUsersWrite, authz.PermIntegrationsRead})
+	db.Create(&manager)
+	managerJWT := issue(auth.User{ID: 1, Username: "gestor1", Role: "gestor"})
+
+	if code := do(r, "POST", "/users", managerJWT, `{"username":"novoadmin","password":"senha123","role":"admin"}`); code != http.StatusForbidden {
+		t.Errorf("Gestor não deveria criar admin, obtido %d", code)
+	}
+	if code := do(r, "POST", "/users", managerJWT, `{"username":"colega","password":"senha123","role":"gestor"}`); code != http.StatusCreated {
+		t.Errorf("Gestor deveria criar usuário com o próprio papel, obtido %d", code)
+	}
+	var colega auth.User
+	db.Where("username = ?", "colega").First(&colega)
+	if code := do(r, "PUT", fmt.Sprintf("/users/%d/role", colega.ID), managerJWT, `{"role":"admin"}`); code != http.StatusForbidden {
+		t.Errorf("Gestor não deveria promover a admin, obtido %d", code)
+	}
+	if code := do(r, "DELETE", "/roles/gestor", issue(auth.User{ID: 9, Username: "admin", Role: authz.RoleAdmin}), ""); code != http.StatusConflict {
+		t.Errorf("Papel atribuído não deveria ser removido, obtido %d", code)
+	}
+
+	// Usuários com papel acima do gestor também ficam fora do alcance dele
+	admin := auth.User{Username: "chefe", Password: "x", Role: authz.RoleAdmin}
+	db.Create(&admin)
+	for _, req := range []struct{ method, path, body string }{
+		{"PATCH", "/users/%d", `{"username":"chefe2"}`},
+		{"PUT", "/users/%d/role", `{"role":"gestor"}`},
+		{"POST", "/users/%d/disable", ""},
+		{"POST", "/users/%d/enable", ""},
+		{"DELETE", "/users/%d", ""},
+	} {
+		if code := do(r, req.method, fmt.Sprintf(req.path, admin.ID), managerJWT, req.body); code != http.StatusForbidden {
+			t.Errorf("Gestor não deveria usar %s %s num admin, obtido %d", req.method, req.path, code)
+		}
+	}
+	var still auth.User
+	if err := db.First(&still, admin.ID).Error; err != nil || still.Username != "chefe" || still.Role != authz.RoleAdmin {
+		t.Errorf("Admin não deveria ter sido alterado: %+v (%v)", still, err)
+	}
+}
+
+func TestUserManagerCannotResetAdminMFA(t *testing.T) {
+	r, db, issue := setup(t)
+	manager := authz.Role{Name: "gestor"}
+	_ = manager.SetPermissions([]string{authz.PermUsersRead, authz.PermUsersWrite})
+	db.Create(&manager)
+	admin := auth.User{Username: "chefe", Password: "x", Role: authz.RoleAdmin, MFAEnabled: true}
+	db.Create(&admin)
+
+	managerJWT := issue(auth.User{ID: 99, Username: "gestor1", Role: "gestor"})
+	if code := do(r, "DELETE", fmt.Sprintf("/users/%d/mfa", admin.ID), managerJWT, ""); code != http.StatusForbidden {
+		t.Errorf("Gestor não deveria resetar o MFA de um admin, obtido %d", code)
+	}
+	var still auth.User
+	db.First(&still, admin.ID)
+	if !still.MFAEnabled {
+		t.Error("MFA do admin não deveria ter sido removido")
+	}
+}
+
+func TestKeysRotateIsSystemPermission(t *testing.T) {
+	r, db, issue := setup(t)
+	// Rota de sistema como /admin/rekey e /admin/jwt-keys/rotate
+	mw, _ := auth.JWTMiddlewareWithDB(db)
+	r.POST("/system/rotate", mw.MiddlewareFunc(), middleware.RequirePermission(db, authz.PermKeysRotate), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	systemAdmin := issue(auth.User{ID: 1, Username: "root", Role: authz.RoleAdmin, OrgID: 1})
+	orgAdmin := issue(auth.User{ID: 2, Username: "admin-org2", Role: authz.RoleAdmin, OrgID: 2})
+	if code := do(r, "POST", "/system/rotate", systemAdmin, ""); code != http.StatusNoContent {
+		t.Errorf("Admin da organização de sistema deveria ter keys:rotate, obtido %d", code)
+	}
+	if code := do(r, "POST", "/system/rotate", orgAdmin, ""); code != http.StatusForbidden {
+		t.Errorf("Admin de outra organização não deveria ter keys:rotate, obtido %d", code)
+	}
+
+	var role authz.Role
+	if err := role.SetPermissions([]string{authz.PermKeysRotate}); !errors.Is(err, authz.ErrSystemPermission) {
+		t.Errorf("keys:rotate não deveria ser concedida a papéis, obtido %v", err)
+	}
+	if code := do(r, "POST", "/roles", systemAdmin, `{"name":"rotacionador","permissions":["keys:rotate"]}`); code != http.StatusBadRequest {
+		t.Errorf("Criação de papel com keys:rotate deveria dar 400, obtido %d", code)
+	}
+}
@@ -0,0 +1,73 @@
+package crypto_test
+
+import (
+	"api-vault/internal/crypto"
+	"errors"
+	"testing"
+)
+
+func TestEncryptField_BoundToRecordAndColumn(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", legacyKey)
+	field := crypto.Field{Table: "integrations", Column: "client_secret", RecordID: 1}
+	cipherText, err := crypto.EncryptField("segredo", field)
+	if err != nil {
+		t.Fatalf("Erro ao criptografar: %v", err)
+	}
+	if !crypto.IsBound(cipherText) {
+		t.Error("cipherText deveria estar vinculado")
+	}
+	plain, err := crypto.DecryptField(cipherText, field)
+	if err != nil || plain != "segredo" {
+		t.Fatalf("DecryptField falhou: %s (%v)", plain, err)
+	}
+
+	// Outro registro, outra coluna ou outra tabela não abrem o mesmo cipherText
+	for _, other := range []crypto.Field{
+		{Table: "integrations", Column: "client_secret", RecordID: 2},
+		{Table: "integrations", Column: "client_id", RecordID: 1},
+		{Table: "tokens", Column: "access_token", RecordID: 1},
+	} {
+		if _, err := crypto.DecryptField(cipherText, other); err == nil {
+			t.Errorf("cipherText não deveria abrir em %+v", other)
+		}
+	}
+	if _, err := crypto.Decrypt(cipherText); !errors.Is(err, crypto.ErrFieldRequired) {
+		t.Errorf("Decrypt sem Field deveria falhar com ErrFieldRequired, obtido %v", err)
+	}
+}
+
+func TestDecryptField_UnboundCipherText(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", legacyKey)
+	field := crypto.Field{Table: "tokens", Column: "access_token", RecordID: 7}
+	unbound, _ := crypto.Encrypt("antigo")
+
+	// Durante a migração, valores sem vínculo continuam legíveis
+	plain, err := crypto.DecryptField(unbound, field)
+	if err != nil || plain != "antigo" {
+		t.Fatalf("Valor sem vínculo deveria decifrar: %s (%v)", plain, err)
+	}
+
+	// Depois da migração, CRYPTO_REQUIRE_AAD passa a rejeitá-los
+	t.Setenv("CRYPTO_REQUIRE_AAD", "true")
+	if _, err := crypto.DecryptField(unbound, field); !errors.Is(err, crypto.ErrUnboundCipherText) {
+		t.Errorf("Esperado ErrUnboundCipherText, obtido %v", err)
+	}
+}
+
+func TestDecryptField_RejectsUnboundAfterMigration(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", legacyKey)
+	t.Cleanup(func() { crypto.SetRequireAAD(false) })
+	field := crypto.Field{Table: "tokens", Column: "access_token", RecordID: 7}
+	unbound, _ := crypto.Encrypt("antigo")
+
+	// Recriptografia concluída: a recusa vale sem CRYPTO_REQUIRE_AAD
+	crypto.SetRequireAAD(true)
+	if _, err := crypto.DecryptField(unbound, field); !errors.Is(err, crypto.ErrUnboundCipherText) {
+		t.Errorf("Esperado ErrUnboundCipherText após a migração, obtido %v", err)
+	}
+	// CRYPTO_REQUIRE_AAD=false reabre a leitura, por exemplo ao restaurar um backup antigo
+	t.Setenv("CRYPTO_REQUIRE_AAD", "false")
+	if plain, err := crypto.DecryptField(unbound, field); err != nil || plain != "antigo" {
+		t.Errorf("CRYPTO_REQUIRE_AAD=false deveria aceitar valor sem vínculo: %s (%v)", plain, err)
+	}
+}
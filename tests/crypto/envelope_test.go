@@ -0,0 +1,93 @@
+package crypto_test
+
+import (
+	"api-vault/internal/crypto"
+	stdaes "crypto/aes"
+	stdcipher "crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+const (
+	legacyKey = "12345678901234567890123456789012"
+	masterK1  = "abcdefghijklmnopqrstuvwxyz012345"
+	masterK2  = "ABCDEFGHIJKLMNOPQRSTUVWXYZ012345"
+)
+
+// legacyEncrypt reproduz o formato original: base64(nonce + AES-GCM) sem identificação de chave
+func legacyEncrypt(t *testing.T, key, plain string) string {
+	block, _ := stdaes.NewCipher([]byte(key))
+	gcm, _ := stdcipher.NewGCM(block)
+	nonce := make([]byte, gcm.NonceSize())
+	rand.Read(nonce)
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plain), nil))
+}
+
+func TestEncrypt_VersionedFormatCarriesKeyID(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", "")
+	t.Setenv("MASTER_KEYS", "k1:"+masterK1)
+	cipherText, err := crypto.Encrypt("segredo")
+	if err != nil {
+		t.Fatalf("Erro ao criptografar: %v", err)
+	}
+	if !strings.HasPrefix(cipherText, "v1:k1:") || crypto.KeyID(cipherText) != "k1" {
+		t.Errorf("cipherText sem versão/ID de chave: %s", cipherText)
+	}
+	other, _ := crypto.Encrypt("segredo")
+	if strings.Split(other, ":")[2] == strings.Split(cipherText, ":")[2] {
+		t.Error("Cada registro deveria ter sua própria chave de dados")
+	}
+}
+
+func TestEncrypt_MasterKeyRotation(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", "")
+	t.Setenv("MASTER_KEYS", "k1:"+masterK1)
+	old, err := crypto.Encrypt("segredo-antigo")
+	if err != nil {
+		t.Fatalf("Erro ao criptografar: %v", err)
+	}
+
+	// Rotação: k2 passa a ser a atual e k1 continua aceita para leitura
+	t.Setenv("MASTER_KEYS", "k1:"+masterK1+",k2:"+base64.StdEncoding.EncodeToString([]byte(masterK2)))
+	t.Setenv("MASTER_KEY_ID", "k2")
+	plain, err := crypto.Decrypt(old)
+	if err != nil || plain != "segredo-antigo" {
+		t.Fatalf("Chave antiga deveria decifrar durante a rotação: %s (%v)", plain, err)
+	}
+	current, _ := crypto.Encrypt("segredo-novo")
+	if crypto.KeyID(current) != "k2" {
+		t.Errorf("Novos dados deveriam usar k2, obtido %s", crypto.KeyID(current))
+	}
+
+	// Após retirar k1, dados antigos não decifram mais
+	t.Setenv("MASTER_KEYS", "k2:"+masterK2)
+	if _, err := crypto.Decrypt(old); err == nil {
+		t.Error("Esperado erro ao decifrar com chave mestra removida")
+	}
+}
+
+func TestDecrypt_LegacyUnversionedCipherText(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", legacyKey)
+	t.Setenv("MASTER_KEYS", "k1:"+masterK1)
+	legacy := legacyEncrypt(t, legacyKey, "segredo-legado")
+	plain, err := crypto.Decrypt(legacy)
+	if err != nil || plain != "segredo-legado" {
+		t.Fatalf("cipherText legado deveria decifrar: %s (%v)", plain, err)
+	}
+	if crypto.KeyID(legacy) != "" {
+		t.Errorf("cipherText legado não deveria ter ID de chave")
+	}
+}
+
+func TestDecrypt_TamperedEnvelope(t *testing.T) {
+	t.Setenv("MASTER_KEYS", "k1:"+masterK1+",k2:"+masterK2)
+	t.Setenv("MASTER_KEY_ID", "k1")
+	cipherText, _ := crypto.Encrypt("segredo")
+	// Trocar o ID da chave invalida o envelope, pois o ID faz parte dos dados autenticados
+	tampered := strings.Replace(cipherText, "v1:k1:", "v1:k2:", 1)
+	if _, err := crypto.Decrypt(tampered); err == nil {
+		t.Error("Esperado erro ao decifrar envelope adulterado")
+	}
+}
@@ -0,0 +1,139 @@
+package crypto_test
+
+import (
+	"api-vault/internal/crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "k1.key"), []byte(masterK1), 0o600)
+	os.WriteFile(filepath.Join(dir, "k2.key"), []byte(base64.StdEncoding.EncodeToString([]byte(masterK2))+"\n"), 0o600)
+	os.WriteFile(filepath.Join(dir, "current"), []byte("k2\n"), 0o600)
+	t.Setenv("KMS_PROVIDER", "file")
+	t.Setenv("KMS_KEY_DIR", dir)
+
+	provider, err := crypto.ProviderFromEnv()
+	if err != nil {
+		t.Fatalf("Erro ao carregar provider de arquivo: %v", err)
+	}
+	crypto.SetProvider(provider)
+	t.Cleanup(func() { crypto.SetProvider(nil) })
+
+	cipherText, err := crypto.Encrypt("segredo")
+	if err != nil {
+		t.Fatalf("Erro ao criptografar: %v", err)
+	}
+	if crypto.KeyID(cipherText) != "k2" {
+		t.Errorf("Esperada chave k2, obtida %s", crypto.KeyID(cipherText))
+	}
+	plain, err := crypto.Decrypt(cipherText)
+	if err != nil || plain != "segredo" {
+		t.Errorf("Decrypt falhou: %s (%v)", plain, err)
+	}
+}
+
+// fakeTransit simula o engine transit do Vault, guardando a chave mestra no "servidor".
+// latest é a versão atual da chave; paths registra os caminhos recebidos.
+func fakeTransit(t *testing.T, latest *int, paths *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*paths = append(*paths, r.URL.Path)
+		if r.Header.Get("X-Vault-Token") != "root-token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/v1/transit/keys/app-key":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]int{"latest_version": *latest}})
+		case "/v1/transit/encrypt/app-key":
+			version := *latest
+			if v, ok := body["key_version"].(float64); ok {
+				version = int(v)
+			}
+			plaintext, _ := body["plaintext"].(string)
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"ciphertext": fmt.Sprintf("vault:v%d:", version) + reverse(plaintext)}})
+		case "/v1/transit/decrypt/app-key":
+			ciphertext, _ := body["ciphertext"].(string)
+			parts := strings.SplitN(ciphertext, ":", 3)
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"plaintext": reverse(parts[len(parts)-1])}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func reverse(s string) string {
+	b := []byte(s)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+	return string(b)
+}
+
+func TestVaultTransitProvider(t *testing.T) {
+	latest := 1
+	var paths []string
+	srv := fakeTransit(t, &latest, &paths)
+	defer srv.Close()
+
+	provider, err := crypto.NewVaultTransitProvider(srv.URL, "root-token", "app-key", srv.Client())
+	if err != nil {
+		t.Fatalf("Erro ao criar provider: %v", err)
+	}
+	crypto.SetProvider(provider)
+	t.Cleanup(func() { crypto.SetProvider(nil) })
+
+	cipherText, err := crypto.Encrypt("segredo-no-vault")
+	if err != nil {
+		t.Fatalf("Erro ao criptografar: %v", err)
+	}
+	if crypto.KeyID(cipherText) != "app-key.v1" {
+		t.Errorf("Esperada chave app-key.v1, obtida %s", crypto.KeyID(cipherText))
+	}
+	plain, err := crypto.Decrypt(cipherText)
+	if err != nil || plain != "segredo-no-vault" {
+		t.Errorf("Decrypt falhou: %s (%v)", plain, err)
+	}
+
+	// Nova versão no Vault muda o ID atual, e a recriptografia passa a ver o valor antigo como pendente
+	latest = 2
+	if keyID, err := crypto.CurrentKeyID(); err != nil || keyID != "app-key.v2" {
+		t.Errorf("Esperada chave app-key.v2 após a rotação, obtida %s (%v)", keyID, err)
+	}
+	if plain, err := crypto.Decrypt(cipherText); err != nil || plain != "segredo-no-vault" {
+		t.Errorf("Valor da versão anterior deveria decifrar: %s (%v)", plain, err)
+	}
+
+	// O ID vem do banco: não pode apontar para outro caminho do Vault
+	paths = nil
+	for _, keyID := range []string{"../../sys/seal", "app-key.v1/x", "app-key.vx", "app-key.v01", "app%2Fkey"} {
+		forged := strings.Replace(cipherText, "app-key.v1", keyID, 1)
+		if _, err := crypto.Decrypt(forged); err == nil {
+			t.Errorf("ID de chave %q deveria ser recusado", keyID)
+		}
+	}
+	if len(paths) != 0 {
+		t.Errorf("IDs inválidos não deveriam chegar ao Vault: %v", paths)
+	}
+	if _, err := crypto.NewVaultTransitProvider(srv.URL, "root-token", "../sys", srv.Client()); err == nil {
+		t.Error("VAULT_TRANSIT_KEY com caminho deveria ser recusada")
+	}
+
+	// Token inválido: o servidor recusa e o erro chega ao chamador
+	denied, _ := crypto.NewVaultTransitProvider(srv.URL, "errado", "app-key", srv.Client())
+	crypto.SetProvider(denied)
+	if _, err := crypto.Decrypt(cipherText); err == nil {
+		t.Error("Esperado erro com token do Vault inválido")
+	}
+}
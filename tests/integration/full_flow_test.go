@@ -3,6 +3,7 @@ package integration_test
 import (
 	"api-vault/internal/audit"
 	"api-vault/internal/auth"
+	"api-vault/internal/authz"
 	"api-vault/internal/integrations"
 	"api-vault/internal/tokens"
 	"bytes"
@@ -27,14 +28,10 @@ func TestFullFlow(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Erro ao abrir banco em memória: %v", err)
 	}
-	db.AutoMigrate(&auth.User{}, &integrations.Integration{}, &tokens.Token{}, &audit.AuditLog{})
+	db.AutoMigrate(&auth.User{}, &authz.Role{}, &integrations.Integration{}, &tokens.Token{}, &audit.AuditLog{}, &audit.ChainHead{}, &auth.Session{}, &auth.RevokedToken{}, &auth.RecoveryCode{}, &auth.MFAChallenge{}, &auth.LoginAttempt{}, &auth.APIKey{}, &authz.MFAPolicy{})
 
 	r := gin.New()
-	// Simula admin
-	r.Use(func(c *gin.Context) {
-		c.Set("role", "admin")
-		c.Next()
-	})
+	t.Setenv("JWT_DEV_MODE", "true") // segredo HS256 padrão
 	mw, err := auth.JWTMiddlewareWithDB(db)
 	if err != nil {
 		t.Fatalf("Erro ao criar middleware JWT: %v", err)
@@ -42,16 +39,11 @@ func TestFullFlow(t *testing.T) {
 	auth.RegisterRoutes(r, db, mw)
 	integrations.RegisterRoutes(r, db, mw)
 	tokens.RegisterRoutes(r, db, mw)
-	audit.RegisterRoutes(r, db)
+	audit.RegisterRoutes(r, db, mw)
 
-	// Cadastro de usuário admin
-	userPayload := `{"username":"admin","password":"admin123","role":"admin"}`
-	req := httptest.NewRequest("POST", "/users", bytes.NewBufferString(userPayload))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
-	r.ServeHTTP(w, req)
-	if w.Code != http.StatusCreated {
-		t.Fatalf("Cadastro de usuário falhou: %d", w.Code)
+	// Bootstrap do admin inicial
+	if _, err := auth.CreateInitialAdmin(db, "admin", "admin123"); err != nil {
+		t.Fatalf("Bootstrap do admin falhou: %v", err)
 	}
 
 	// Login para obter token JWT
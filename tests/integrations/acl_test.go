@@ -0,0 +1,131 @@
+package integrations_test
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/auth"
+	"api-vault/internal/integrations"
+	"api-vault/internal/tokens"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupACLRouter(t *testing.T) (*gin.Engine, *gorm.DB, func(auth.User) string) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("DATA_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Erro ao abrir banco em memória: %v", err)
+	}
+	db.AutoMigrate(&auth.User{}, &auth.Group{}, &auth.GroupMember{}, &integrations.Integration{}, &integrations.ACLEntry{}, &tokens.Token{}, &audit.AuditLog{}, &audit.ChainHead{}, &auth.Session{}, &auth.RevokedToken{})
+	t.Setenv("JWT_DEV_MODE", "true") // segredo HS256 padrão
+	mw, err := auth.JWTMiddlewareWithDB(db)
+	if err != nil {
+		t.Fatalf("Erro ao criar middleware JWT: %v", err)
+	}
+	r := gin.New()
+	integrations.RegisterRoutes(r, db, mw)
+	tokens.RegisterRoutes(r, db, mw)
+	issue := func(u auth.User) string {
+		db.FirstOrCreate(&u, auth.User{ID: u.ID, Username: u.Username, Password: "x", Role: u.Role})
+		token, _, err := mw.TokenGenerator(&u)
+		if err != nil {
+			t.Fatalf("Erro ao gerar JWT: %v", err)
+		}
+		return token
+	}
+	return r, db, issue
+}
+
+func listCount(t *testing.T, r *gin.Engine, path, jwtToken string) int {
+	w := doJSON(r, "GET", path, jwtToken, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s falhou: %d %s", path, w.Code, w.Body.String())
+	}
+	var list []map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	return len(list)
+}
+
+func TestIntegrationACL(t *testing.T) {
+	r, db, issue := setupACLRouter(t)
+	ana := issue(auth.User{ID: 1, Username: "ana", Role: "user"})
+	bia := issue(auth.User{ID: 2, Username: "bia", Role: "user"})
+	admin := issue(auth.User{ID: 3, Username: "admin", Role: "admin"})
+
+	w := doJSON(r, "POST", "/integrations", ana, `{"name":"erp","auth_type":"client_credentials","client_id":"cid","client_secret":"segredo","token_url":"https://erp.example.com/token"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Cadastro de integração falhou: %d %s", w.Code, w.Body.String())
+	}
+	var integration integrations.Integration
+	json.Unmarshal(w.Body.Bytes(), &integration)
+	if integration.OwnerID != 1 {
+		t.Errorf("Dono deveria ser quem cadastrou, obtido %d", integration.OwnerID)
+	}
+	expires := time.Now().Add(time.Hour).Format(time.RFC3339)
+	tokenPayload := fmt.Sprintf(`{"integration_id":%d,"access_token":"access-erp","refresh_token":"refresh-erp","expires_at":"%s"}`, integration.ID, expires)
+	if w := doJSON(r, "POST", "/tokens", ana, tokenPayload); w.Code != http.StatusCreated {
+		t.Fatalf("Cadastro de token falhou: %d %s", w.Code, w.Body.String())
+	}
+
+	// Outro time não enxerga a integração nem os tokens dela
+	if n := listCount(t, r, "/integrations", bia); n != 0 {
+		t.Errorf("Bia não deveria ver integrações, viu %d", n)
+	}
+	if n := listCount(t, r, "/tokens", bia); n != 0 {
+		t.Errorf("Bia não deveria ver tokens, viu %d", n)
+	}
+	if w := doJSON(r, "GET", "/tokens/1", bia, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Token de integração invisível deveria dar 404, obtido %d", w.Code)
+	}
+	if w := doJSON(r, "POST", "/tokens", bia, tokenPayload); w.Code != http.StatusNotFound {
+		t.Errorf("Bia não deveria criar token na integração, obtido %d", w.Code)
+	}
+	if n := listCount(t, r, "/integrations", admin); n != 1 {
+		t.Errorf("Admin (integrations:all) deveria ver todas, viu %d", n)
+	}
+	// Nenhuma rota de integrações responde sem JWT
+	if w := doJSON(r, "GET", "/integrations/test", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("/integrations/test sem JWT deveria dar 401, obtido %d %s", w.Code, w.Body.String())
+	}
+
+	// Concessão read ao grupo da Bia
+	group := auth.Group{Name: "financeiro"}
+	db.Create(&group)
+	db.Create(&auth.GroupMember{GroupID: group.ID, UserID: 2})
+	aclPath := fmt.Sprintf("/integrations/%d/acl", integration.ID)
+	if w := doJSON(r, "POST", aclPath, bia, fmt.Sprintf(`{"subject_type":"group","subject_id":%d,"level":"read"}`, group.ID)); w.Code != http.StatusNotFound {
+		t.Errorf("Bia não deveria gerenciar a ACL, obtido %d", w.Code)
+	}
+	if w := doJSON(r, "POST", aclPath, ana, fmt.Sprintf(`{"subject_type":"group","subject_id":%d,"level":"read"}`, group.ID)); w.Code != http.StatusCreated {
+		t.Fatalf("Concessão falhou: %d %s", w.Code, w.Body.String())
+	}
+	if n := listCount(t, r, "/integrations", bia); n != 1 {
+		t.Errorf("Bia deveria ver a integração via grupo, viu %d", n)
+	}
+	if n := listCount(t, r, "/tokens", bia); n != 1 {
+		t.Errorf("Tokens deveriam herdar a ACL da integração, Bia viu %d", n)
+	}
+	// O PUT recebe a integração como o GET a devolve
+	putPayload := `{"Name":"erp2","AuthType":"client_credentials","ClientID":"cid","ClientSecret":"segredo","TokenURL":"https://erp.example.com/token"}`
+	if w := doJSON(r, "PUT", fmt.Sprintf("/integrations/%d", integration.ID), bia, putPayload); w.Code != http.StatusForbidden {
+		t.Errorf("Read não deveria permitir alterar a integração, obtido %d", w.Code)
+	}
+
+	// Concessão direta manage substitui/complementa a do grupo
+	if w := doJSON(r, "POST", aclPath, ana, `{"subject_type":"user","subject_id":2,"level":"manage"}`); w.Code != http.StatusCreated {
+		t.Fatalf("Concessão manage falhou: %d %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, "PUT", fmt.Sprintf("/integrations/%d", integration.ID), bia, putPayload); w.Code != http.StatusOK {
+		t.Errorf("Manage deveria permitir alterar a integração, obtido %d", w.Code)
+	}
+	if w := doJSON(r, "POST", aclPath, ana, `{"subject_type":"user","subject_id":2,"level":"owner"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Nível inválido deveria ser rejeitado, obtido %d", w.Code)
+	}
+}
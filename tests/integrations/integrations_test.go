@@ -2,6 +2,8 @@ package integrations_test
 
 import (
 	"api-vault/internal/crypto"
+	"api-vault/internal/integrations"
+	"api-vault/internal/tokens"
 	"testing"
 )
 
@@ -22,3 +24,26 @@ func TestIntegrationEncryptDecrypt(t *testing.T) {
 		t.Errorf("ClientSecret decriptografado diferente do original: got %s, want %s", plain, secret)
 	}
 }
+
+func TestIntegrationSecretCannotBeSwapped(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	a := integrations.Integration{ID: 1}
+	b := integrations.Integration{ID: 2}
+	if err := integrations.EncryptSecret(&a, "segredo-a"); err != nil {
+		t.Fatalf("Erro ao criptografar ClientSecret: %v", err)
+	}
+	if err := integrations.EncryptSecret(&b, "segredo-b"); err != nil {
+		t.Fatalf("Erro ao criptografar ClientSecret: %v", err)
+	}
+
+	// Simula quem tem acesso de escrita ao banco trocando os segredos entre linhas
+	a.ClientSecret, b.ClientSecret = b.ClientSecret, a.ClientSecret
+	if _, err := integrations.DecryptSecret(&a); err == nil {
+		t.Error("ClientSecret copiado de outra integração não deveria decifrar")
+	}
+	// Nem movido para a coluna de AccessToken de um token
+	token := tokens.Token{ID: 1, AccessToken: b.ClientSecret}
+	if _, err := tokens.DecryptAccessToken(&token); err == nil {
+		t.Error("ClientSecret movido para AccessToken não deveria decifrar")
+	}
+}
@@ -0,0 +1,203 @@
+package integrations_test
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/auth"
+	"api-vault/internal/crypto"
+	"api-vault/internal/integrations"
+	"api-vault/internal/tokens"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupRevealRouter(t *testing.T) (*gin.Engine, *gorm.DB, map[string]string) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("DATA_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Erro ao abrir banco em memória: %v", err)
+	}
+	db.AutoMigrate(&integrations.Integration{}, &integrations.ACLEntry{}, &auth.GroupMember{}, &tokens.Token{}, &audit.AuditLog{}, &audit.ChainHead{}, &auth.User{}, &auth.Session{}, &auth.RevokedToken{})
+
+	t.Setenv("JWT_DEV_MODE", "true") // segredo HS256 padrão
+	mw, err := auth.JWTMiddlewareWithDB(db)
+	if err != nil {
+		t.Fatalf("Erro ao criar middleware JWT: %v", err)
+	}
+	jwts := map[string]string{}
+	for _, u := range []auth.User{{ID: 1, Username: "admin", Role: "admin"}, {ID: 2, Username: "leitor", Role: "user"}} {
+		token, _, err := mw.TokenGenerator(&u)
+		if err != nil {
+			t.Fatalf("Erro ao gerar JWT: %v", err)
+		}
+		jwts[u.Role] = token
+	}
+	r := gin.New()
+	integrations.RegisterRoutes(r, db, mw)
+	tokens.RegisterRoutes(r, db, mw)
+	return r, db, jwts
+}
+
+func doJSON(r *gin.Engine, method, path, jwtToken, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+jwtToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestSecretsAreMaskedAndRevealedWithReason(t *testing.T) {
+	r, db, jwts := setupRevealRouter(t)
+
+	w := doJSON(r, "POST", "/integrations", jwts["user"], `{"name":"erp","auth_type":"client_credentials","client_id":"cid","client_secret":"segredo-erp","token_url":"https://erp.example.com/token"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Cadastro de integração falhou: %d %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "segredo-erp") {
+		t.Error("Resposta do cadastro não deveria conter o ClientSecret")
+	}
+	w = doJSON(r, "POST", "/tokens", jwts["user"], `{"integration_id":1,"access_token":"access-erp","refresh_token":"refresh-erp","expires_at":"`+time.Now().Add(time.Hour).Format(time.RFC3339)+`"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Cadastro de token falhou: %d %s", w.Code, w.Body.String())
+	}
+
+	for _, path := range []string{"/integrations", "/integrations/1", "/tokens", "/tokens/1"} {
+		w := doJSON(r, "GET", path, jwts["user"], "")
+		body := w.Body.String()
+		if w.Code != http.StatusOK || !strings.Contains(body, crypto.MaskedValue) {
+			t.Errorf("%s deveria responder com segredos mascarados: %d %s", path, w.Code, body)
+		}
+		for _, secret := range []string{"segredo-erp", "access-erp", "refresh-erp"} {
+			if strings.Contains(body, secret) {
+				t.Errorf("%s expôs segredo em texto puro", path)
+			}
+		}
+	}
+
+	// Sem permissão ou sem justificativa, nada é revelado
+	if w := doJSON(r, "POST", "/integrations/1/reveal", jwts["user"], `{"reason":"investigando incidente"}`); w.Code != http.StatusForbidden {
+		t.Errorf("Usuário comum não deveria revelar segredo: %d", w.Code)
+	}
+	if w := doJSON(r, "POST", "/tokens/1/reveal", jwts["admin"], `{"reason":"curto"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Justificativa curta deveria ser rejeitada: %d", w.Code)
+	}
+
+	w = doJSON(r, "POST", "/integrations/1/reveal", jwts["admin"], `{"reason":"rotação manual no parceiro"}`)
+	var revealed map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &revealed)
+	if w.Code != http.StatusOK || revealed["client_secret"] != "segredo-erp" {
+		t.Errorf("Revelação do ClientSecret falhou: %d %s", w.Code, w.Body.String())
+	}
+	w = doJSON(r, "POST", "/tokens/1/reveal", jwts["admin"], `{"reason":"depuração de chamada ao parceiro"}`)
+	revealed = nil
+	json.Unmarshal(w.Body.Bytes(), &revealed)
+	if w.Code != http.StatusOK || revealed["access_token"] != "access-erp" || revealed["refresh_token"] != "refresh-erp" {
+		t.Errorf("Revelação do token falhou: %d %s", w.Code, w.Body.String())
+	}
+
+	var logs []audit.AuditLog
+	db.Where("action IN ? AND status = ?", []string{"revelacao_segredo_integracao", "revelacao_segredo_token"}, "OK").Find(&logs)
+	if len(logs) != 2 {
+		t.Fatalf("Esperados 2 eventos de revelação, obtidos %d", len(logs))
+	}
+	if logs[0].User != "admin" || !strings.Contains(logs[0].Details, "rotação manual no parceiro") {
+		t.Errorf("Evento de revelação sem usuário ou justificativa: %+v", logs[0])
+	}
+}
+
+func TestMaskedSecretsSurviveGetPutRoundTrip(t *testing.T) {
+	r, _, jwts := setupRevealRouter(t)
+	expires := time.Now().Add(time.Hour).Format(time.RFC3339)
+	doJSON(r, "POST", "/integrations", jwts["admin"], `{"name":"erp","auth_type":"client_credentials","client_id":"cid","client_secret":"segredo-erp","token_url":"https://erp.example.com/token"}`)
+	doJSON(r, "POST", "/tokens", jwts["admin"], `{"integration_id":1,"access_token":"access-erp","refresh_token":"refresh-erp","expires_at":"`+expires+`"}`)
+
+	// A integração volta do GET com o segredo mascarado e é reenviada como está
+	w := doJSON(r, "GET", "/integrations/1", jwts["admin"], "")
+	var integration map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &integration)
+	integration["Name"] = "erp-novo"
+	body, _ := json.Marshal(integration)
+	if w := doJSON(r, "PUT", "/integrations/1", jwts["admin"], string(body)); w.Code != http.StatusOK {
+		t.Fatalf("Atualização da integração falhou: %d %s", w.Code, w.Body.String())
+	}
+	delete(integration, "ClientSecret")
+	body, _ = json.Marshal(integration)
+	if w := doJSON(r, "PUT", "/integrations/1", jwts["admin"], string(body)); w.Code != http.StatusOK {
+		t.Fatalf("Atualização sem ClientSecret falhou: %d %s", w.Code, w.Body.String())
+	}
+
+	// O token volta mascarado; sem refresh token a atualização também mantém o atual
+	w = doJSON(r, "GET", "/tokens/1", jwts["admin"], "")
+	var token tokens.Token
+	json.Unmarshal(w.Body.Bytes(), &token)
+	put := fmt.Sprintf(`{"integration_id":%d,"access_token":%q,"refresh_token":%q,"expires_at":%q}`, token.IntegrationID, token.AccessToken, token.RefreshToken, expires)
+	if w := doJSON(r, "PUT", "/tokens/1", jwts["admin"], put); w.Code != http.StatusOK {
+		t.Fatalf("Atualização do token falhou: %d %s", w.Code, w.Body.String())
+	}
+	put = fmt.Sprintf(`{"integration_id":%d,"access_token":"access-novo","expires_at":%q}`, token.IntegrationID, expires)
+	if w := doJSON(r, "PUT", "/tokens/1", jwts["admin"], put); w.Code != http.StatusOK {
+		t.Fatalf("Atualização só do AccessToken falhou: %d %s", w.Code, w.Body.String())
+	}
+
+	var revealed map[string]interface{}
+	w = doJSON(r, "POST", "/integrations/1/reveal", jwts["admin"], `{"reason":"conferindo o segredo mantido"}`)
+	json.Unmarshal(w.Body.Bytes(), &revealed)
+	if revealed["client_secret"] != "segredo-erp" {
+		t.Errorf("ClientSecret deveria ter sido mantido: %s", w.Body.String())
+	}
+	revealed = nil
+	w = doJSON(r, "POST", "/tokens/1/reveal", jwts["admin"], `{"reason":"conferindo os segredos mantidos"}`)
+	json.Unmarshal(w.Body.Bytes(), &revealed)
+	if revealed["access_token"] != "access-novo" || revealed["refresh_token"] != "refresh-erp" {
+		t.Errorf("Só o AccessToken deveria ter mudado: %s", w.Body.String())
+	}
+
+	// A máscara não é aceita como segredo no cadastro
+	if w := doJSON(r, "POST", "/tokens", jwts["admin"], `{"integration_id":1,"access_token":"********","refresh_token":"refresh-erp","expires_at":"`+expires+`"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Cadastro com segredo mascarado deveria dar 400, obtido %d", w.Code)
+	}
+}
+
+func TestRepointingIntegrationRequiresSecret(t *testing.T) {
+	r, _, jwts := setupRevealRouter(t)
+	doJSON(r, "POST", "/integrations", jwts["user"], `{"name":"erp","auth_type":"client_credentials","client_id":"cid","client_secret":"segredo-erp","token_url":"https://erp.example.com/token"}`)
+
+	// Sem integrations:reveal, apontar o segredo mantido para outro servidor é recusado
+	repoint := `{"Name":"erp","AuthType":"client_credentials","ClientID":"cid","ClientSecret":"%s","TokenURL":"%s"}`
+	if w := doJSON(r, "PUT", "/integrations/1", jwts["user"], fmt.Sprintf(repoint, crypto.MaskedValue, "https://atacante.example.com/token")); w.Code != http.StatusForbidden {
+		t.Errorf("Trocar TokenURL com segredo mascarado deveria dar 403, obtido %d", w.Code)
+	}
+	if w := doJSON(r, "PUT", "/integrations/1", jwts["user"], fmt.Sprintf(repoint, "", "https://atacante.example.com/token")); w.Code != http.StatusForbidden {
+		t.Errorf("Trocar TokenURL sem segredo deveria dar 403, obtido %d", w.Code)
+	}
+	if w := doJSON(r, "PUT", "/integrations/1", jwts["user"], fmt.Sprintf(repoint, "segredo-novo", "ftp://erp")); w.Code != http.StatusBadRequest {
+		t.Errorf("TokenURL inválida deveria dar 400, obtido %d", w.Code)
+	}
+	if w := doJSON(r, "PUT", "/integrations/1", jwts["user"], `{"Name":"erp","AuthType":"authorization_code","ClientID":"cid","ClientSecret":"segredo-novo","TokenURL":"https://erp.example.com/token"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("authorization_code sem AuthURL deveria dar 400, obtido %d", w.Code)
+	}
+
+	// Com o segredo novo, ou com integrations:reveal, a troca é permitida
+	if w := doJSON(r, "PUT", "/integrations/1", jwts["user"], fmt.Sprintf(repoint, "segredo-novo", "https://erp2.example.com/token")); w.Code != http.StatusOK {
+		t.Errorf("Trocar TokenURL com segredo novo deveria funcionar: %d %s", w.Code, w.Body.String())
+	}
+	if w := doJSON(r, "PUT", "/integrations/1", jwts["admin"], fmt.Sprintf(repoint, crypto.MaskedValue, "https://erp3.example.com/token")); w.Code != http.StatusOK {
+		t.Errorf("Admin com integrations:reveal deveria trocar a TokenURL: %d %s", w.Code, w.Body.String())
+	}
+	var integration integrations.Integration
+	w := doJSON(r, "GET", "/integrations/1", jwts["admin"], "")
+	json.Unmarshal(w.Body.Bytes(), &integration)
+	if integration.TokenURL != "https://erp3.example.com/token" {
+		t.Errorf("TokenURL deveria ter sido atualizada, obtido %s", integration.TokenURL)
+	}
+}
@@ -0,0 +1,107 @@
+package oauth_test
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/auth"
+	"api-vault/internal/crypto"
+	"api-vault/internal/integrations"
+	"api-vault/internal/oauth"
+	"api-vault/internal/tokens"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("DATA_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	t.Setenv("OAUTH_REDIRECT_URL", "http://vault.local/oauth/callback")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Erro ao abrir banco em memória: %v", err)
+	}
+	db.AutoMigrate(&integrations.Integration{}, &tokens.Token{}, &audit.AuditLog{}, &audit.ChainHead{}, &oauth.AuthorizationRequest{}, &auth.User{}, &auth.Session{}, &auth.RevokedToken{})
+
+	// Provedor falso: valida o code e o code_verifier contra o challenge enviado na autorização
+	var challenge string
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("code") != "codigo-123" ||
+			r.PostForm.Get("redirect_uri") != "http://vault.local/oauth/callback" ||
+			oauth.CodeChallengeS256(r.PostForm.Get("code_verifier")) != challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access-consentido",
+			"refresh_token": "refresh-consentido",
+			"expires_in":    3600,
+		})
+	}))
+	defer provider.Close()
+
+	secret, _ := crypto.Encrypt("csecret")
+	integration := integrations.Integration{Name: "Consent", AuthType: "authorization_code", ClientID: "cid", ClientSecret: secret,
+		TokenURL: provider.URL + "/token", AuthURL: provider.URL + "/authorize", Scopes: "read write"}
+	db.Create(&integration)
+
+	t.Setenv("JWT_DEV_MODE", "true") // segredo HS256 padrão
+	mw, err := auth.JWTMiddlewareWithDB(db)
+	if err != nil {
+		t.Fatalf("Erro ao criar middleware JWT: %v", err)
+	}
+	jwtToken, _, _ := mw.TokenGenerator(&auth.User{ID: 1, Username: "admin", Role: "admin"})
+	r := gin.New()
+	oauth.RegisterRoutes(r, db, mw, oauth.NewClient(provider.Client()))
+
+	// Inicia o consentimento
+	req := httptest.NewRequest("POST", fmt.Sprintf("/integrations/%d/authorize", integration.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+jwtToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status esperado 200, obtido %d: %s", w.Code, w.Body.String())
+	}
+	var start map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &start)
+	authorizeURL, _ := url.Parse(start["authorize_url"].(string))
+	q := authorizeURL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != "cid" || q.Get("code_challenge_method") != "S256" ||
+		q.Get("scope") != "read write" || q.Get("state") == "" {
+		t.Fatalf("URL de autorização incompleta: %s", authorizeURL)
+	}
+	challenge = q.Get("code_challenge")
+
+	// Provedor redireciona de volta com o código
+	callback := fmt.Sprintf("/oauth/callback?code=codigo-123&state=%s", url.QueryEscape(q.Get("state")))
+	w2 := httptest.NewRecorder()
+	r.ServeHTTP(w2, httptest.NewRequest("GET", callback, nil))
+	if w2.Code != http.StatusOK {
+		t.Fatalf("Callback falhou: %d %s", w2.Code, w2.Body.String())
+	}
+	var token tokens.Token
+	if err := db.Where("integration_id = ?", integration.ID).First(&token).Error; err != nil {
+		t.Fatalf("Token não persistido: %v", err)
+	}
+	access, _ := tokens.DecryptAccessToken(&token)
+	refresh, _ := tokens.DecryptRefreshToken(&token)
+	if access != "access-consentido" || refresh != "refresh-consentido" {
+		t.Errorf("Token persistido incorreto: access=%s refresh=%s", access, refresh)
+	}
+
+	// O state não pode ser reutilizado
+	w3 := httptest.NewRecorder()
+	r.ServeHTTP(w3, httptest.NewRequest("GET", callback, nil))
+	if w3.Code != http.StatusBadRequest {
+		t.Errorf("Reuso do state deveria falhar com 400, obtido %d", w3.Code)
+	}
+}
@@ -0,0 +1,308 @@
+package oidc_test
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/auth"
+	"api-vault/internal/authz"
+	"api-vault/internal/oauth"
+	"api-vault/internal/oidc"
+	"api-vault/internal/signing"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakeIdP é um provedor OIDC mínimo: descoberta, JWKS e endpoint de token com PKCE
+type fakeIdP struct {
+	server *httptest.Server
+	key    *ecdsa.PrivateKey
+	// Claims do próximo ID token; o nonce e o challenge vêm do redirecionamento
+	claims    jwt.MapClaims
+	challenge string
+	// slash publica o issuer com barra final, como alguns provedores fazem
+	slash bool
+}
+
+func (idp *fakeIdP) issuer() string {
+	if idp.slash {
+		return idp.server.URL + "/"
+	}
+	return idp.server.URL
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	idp := &fakeIdP{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.issuer(),
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		enc := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []signing.JWK{{
+			Kty: "EC", Kid: "idp-1", Alg: signing.AlgES256, Use: "sig", Crv: "P-256",
+			X: enc(key.X.FillBytes(make([]byte, 32))), Y: enc(key.Y.FillBytes(make([]byte, 32))),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("code") != "codigo-sso" || oauth.CodeChallengeS256(r.PostForm.Get("code_verifier")) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, idp.claims)
+		token.Header["kid"] = "idp-1"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "at", "id_token": signed, "expires_in": 3600})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func setupOIDCRouter(t *testing.T, idp *fakeIdP) (*gin.Engine, *gorm.DB) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("DATA_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	t.Setenv("JWT_DEV_MODE", "true") // segredo HS256 padrão
+	t.Setenv("OIDC_ISSUER", idp.issuer())
+	t.Setenv("OIDC_CLIENT_ID", "vault")
+	t.Setenv("OIDC_CLIENT_SECRET", "segredo")
+	t.Setenv("OIDC_REDIRECT_URL", "http://vault.local/auth/oidc/callback")
+	t.Setenv("OIDC_ROLE_MAPPING", "vault-admins=admin,engenharia=user")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Erro ao abrir banco em memória: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&auth.User{}, &authz.Role{}, &audit.AuditLog{}, &audit.ChainHead{}, &auth.Session{}, &auth.RevokedToken{}, &auth.LoginAttempt{}, &authz.MFAPolicy{}, &oidc.LoginRequest{}, &oidc.Identity{})
+	mw, err := auth.JWTMiddlewareWithDB(db)
+	if err != nil {
+		t.Fatalf("Erro ao criar middleware JWT: %v", err)
+	}
+	provider, err := oidc.ProviderFromEnv(context.Background(), idp.server.Client())
+	if err != nil {
+		t.Fatalf("Descoberta OIDC falhou: %v", err)
+	}
+	mapping, err := oidc.MappingFromEnv()
+	if err != nil {
+		t.Fatalf("Mapeamento OIDC inválido: %v", err)
+	}
+	r := gin.New()
+	auth.RegisterRoutes(r, db, mw)
+	oidc.RegisterRoutes(r, db, mw, provider, mapping)
+	return r, db
+}
+
+func doRequest(r *gin.Engine, method, path, jwtToken string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(""))
+	if jwtToken != "" {
+		req.Header.Set("Authorization", "Bearer "+jwtToken)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// ssoLogin percorre o redirecionamento e o callback; claims recebe o nonce do pedido
+func ssoLogin(t *testing.T, r *gin.Engine, idp *fakeIdP, claims jwt.MapClaims) *httptest.ResponseRecorder {
+	w := doRequest(r, "GET", "/auth/oidc/login", "")
+	if w.Code != http.StatusFound {
+		t.Fatalf("Início do login SSO deveria redirecionar, obtido %d %s", w.Code, w.Body.String())
+	}
+	location, _ := url.Parse(w.Header().Get("Location"))
+	q := location.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("client_id") != "vault" || q.Get("scope") != "openid profile email" {
+		t.Fatalf("URL de autorização inesperada: %s", location)
+	}
+	idp.challenge = q.Get("code_challenge")
+	if _, ok := claims["nonce"]; !ok {
+		claims["nonce"] = q.Get("nonce")
+	}
+	idp.claims = claims
+	return callback(r, q.Get("state"), "codigo-sso", stateCookie(w))
+}
+
+// stateCookie extrai o cookie do state gravado pelo início do login
+func stateCookie(w *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "oidc_state" {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// callback volta do provedor com o cookie do navegador, se houver
+func callback(r *gin.Engine, state, code string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/auth/oidc/callback?state="+url.QueryEscape(state)+"&code="+code, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func idClaims(idp *fakeIdP, groups ...string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":                idp.issuer(),
+		"aud":                "vault",
+		"sub":                "00u-maria",
+		"exp":                time.Now().Add(5 * time.Minute).Unix(),
+		"preferred_username": "maria",
+		"groups":             groups,
+	}
+}
+
+func TestOIDCLoginProvisionsAndMapsRoles(t *testing.T) {
+	idp := newFakeIdP(t)
+	r, db := setupOIDCRouter(t, idp)
+
+	w := ssoLogin(t, r, idp, idClaims(idp, "vault-admins", "engenharia"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Callback SSO falhou: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Token == "" || resp.RefreshToken == "" {
+		t.Fatalf("SSO deveria emitir JWT e refresh token: %s", w.Body.String())
+	}
+	if w := doRequest(r, "GET", "/users", resp.Token); w.Code != http.StatusOK {
+		t.Errorf("Grupo vault-admins deveria virar admin, obtido %d", w.Code)
+	}
+
+	// O papel acompanha os grupos a cada login; o usuário é o mesmo
+	w = ssoLogin(t, r, idp, idClaims(idp, "engenharia"))
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w := doRequest(r, "GET", "/users", resp.Token); w.Code != http.StatusForbidden {
+		t.Errorf("Sem vault-admins o usuário deveria voltar a user, obtido %d", w.Code)
+	}
+	var users []auth.User
+	db.Find(&users)
+	if len(users) != 1 || users[0].Username != "maria" || users[0].Role != authz.RoleUser {
+		t.Errorf("Deveria existir um único usuário maria com papel user, obtido %+v", users)
+	}
+
+	// Usuário do SSO não tem senha local
+	req := httptest.NewRequest("POST", "/login", bytes.NewBufferString(`{"username":"maria","password":""}`))
+	req.Header.Set("Content-Type", "application/json")
+	lw := httptest.NewRecorder()
+	r.ServeHTTP(lw, req)
+	if lw.Code == http.StatusOK {
+		t.Error("Usuário do SSO não deveria entrar por senha")
+	}
+
+	// Sem grupo mapeado e sem OIDC_DEFAULT_ROLE o login é recusado
+	claims := idClaims(idp, "financeiro")
+	claims["sub"], claims["preferred_username"] = "00u-joao", "joao"
+	if w := ssoLogin(t, r, idp, claims); w.Code != http.StatusForbidden {
+		t.Errorf("Grupo não mapeado deveria dar 403, obtido %d", w.Code)
+	}
+}
+
+func TestOIDCRejectsInvalidIDTokens(t *testing.T) {
+	idp := newFakeIdP(t)
+	r, db := setupOIDCRouter(t, idp)
+
+	wrongNonce := idClaims(idp, "engenharia")
+	wrongNonce["nonce"] = "outro"
+	wrongAudience := idClaims(idp, "engenharia")
+	wrongAudience["aud"] = "outra-api"
+	expired := idClaims(idp, "engenharia")
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	for name, claims := range map[string]jwt.MapClaims{"nonce": wrongNonce, "audiência": wrongAudience, "expirado": expired} {
+		if w := ssoLogin(t, r, idp, claims); w.Code != http.StatusUnauthorized {
+			t.Errorf("ID token com %s inválido deveria dar 401, obtido %d", name, w.Code)
+		}
+	}
+
+	// Username de usuário local não é assumido pelo SSO
+	local := auth.User{Username: "maria", Password: "hash", Role: authz.RoleAdmin}
+	db.Create(&local)
+	if w := ssoLogin(t, r, idp, idClaims(idp, "engenharia")); w.Code != http.StatusForbidden {
+		t.Errorf("Username local existente deveria dar 403, obtido %d", w.Code)
+	}
+
+	// State vale uma única vez
+	w := doRequest(r, "GET", "/auth/oidc/login", "")
+	location, _ := url.Parse(w.Header().Get("Location"))
+	state, cookie := location.Query().Get("state"), stateCookie(w)
+	if cookie == nil || !cookie.HttpOnly || cookie.Value != state {
+		t.Fatalf("Início do login deveria gravar o state num cookie HttpOnly, obtido %+v", cookie)
+	}
+	callback(r, state, "errado", cookie)
+	if w := callback(r, state, "codigo-sso", cookie); w.Code != http.StatusBadRequest {
+		t.Errorf("State reutilizado deveria dar 400, obtido %d", w.Code)
+	}
+}
+
+func TestOIDCStateIsBoundToBrowser(t *testing.T) {
+	idp := newFakeIdP(t)
+	r, db := setupOIDCRouter(t, idp)
+
+	// O atacante inicia um login e entrega o callback dele a outro navegador
+	w := doRequest(r, "GET", "/auth/oidc/login", "")
+	location, _ := url.Parse(w.Header().Get("Location"))
+	state := location.Query().Get("state")
+	idp.challenge = location.Query().Get("code_challenge")
+	claims := idClaims(idp, "engenharia")
+	claims["nonce"] = location.Query().Get("nonce")
+	idp.claims = claims
+
+	victim := doRequest(r, "GET", "/auth/oidc/login", "")
+	for name, cookie := range map[string]*http.Cookie{"sem cookie": nil, "cookie de outro login": stateCookie(victim)} {
+		if w := callback(r, state, "codigo-sso", cookie); w.Code != http.StatusBadRequest {
+			t.Errorf("Callback %s deveria dar 400, obtido %d %s", name, w.Code, w.Body.String())
+		}
+	}
+	var count int64
+	db.Model(&auth.User{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Nenhum usuário deveria ter sido provisionado, obtidos %d", count)
+	}
+}
+
+func TestOIDCIssuerWithTrailingSlash(t *testing.T) {
+	idp := newFakeIdP(t)
+	idp.slash = true
+	r, db := setupOIDCRouter(t, idp)
+
+	if w := ssoLogin(t, r, idp, idClaims(idp, "engenharia")); w.Code != http.StatusOK {
+		t.Fatalf("Issuer com barra final deveria ser aceito como publicado: %d %s", w.Code, w.Body.String())
+	}
+	var identity oidc.Identity
+	if err := db.First(&identity).Error; err != nil || identity.Issuer != idp.issuer() {
+		t.Errorf("Identidade deveria guardar o issuer publicado %q, obtido %q (%v)", idp.issuer(), identity.Issuer, err)
+	}
+
+	// Configurado sem a barra, o issuer difere do publicado e a descoberta falha
+	t.Setenv("OIDC_ISSUER", idp.server.URL)
+	if _, err := oidc.ProviderFromEnv(context.Background(), idp.server.Client()); err == nil {
+		t.Error("Issuer configurado diferente do publicado deveria ser recusado")
+	}
+}
@@ -0,0 +1,141 @@
+package refresher_test
+
+import (
+	"api-vault/internal/auth"
+	"api-vault/internal/integrations"
+	"api-vault/internal/oauth"
+	"api-vault/internal/refresher"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAccessToken_ConcurrentCallersShareOneRefresh(t *testing.T) {
+	db := setupDB(t)
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "access-sob-demanda", "expires_in": 3600})
+	}))
+	defer srv.Close()
+	token := createToken(t, db, srv.URL, time.Now().Add(-time.Minute))
+
+	rf := refresher.New(db, oauth.NewClient(srv.Client()))
+	var wg sync.WaitGroup
+	results := make([]string, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			access, _, err := rf.AccessToken(t.Context(), token.IntegrationID)
+			if err != nil {
+				t.Errorf("Erro ao obter access token: %v", err)
+			}
+			results[i] = access
+		}(i)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Esperada 1 chamada ao endpoint de token, obtidas %d", n)
+	}
+	for _, access := range results {
+		if access != "access-sob-demanda" {
+			t.Errorf("Access token inesperado: %s", access)
+		}
+	}
+
+	// Token ainda válido é servido do cache
+	if _, _, err := rf.AccessToken(t.Context(), token.IntegrationID); err != nil {
+		t.Fatalf("Erro ao obter access token: %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("Token válido não deveria ser renovado, chamadas=%d", n)
+	}
+}
+
+func TestAccessToken_SharedRefreshSurvivesFirstCallerCancel(t *testing.T) {
+	db := setupDB(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "access-sob-demanda", "expires_in": 3600})
+	}))
+	defer srv.Close()
+	token := createToken(t, db, srv.URL, time.Now().Add(-time.Minute))
+	rf := refresher.New(db, oauth.NewClient(srv.Client()))
+
+	// O primeiro chamador desiste no meio da renovação; o segundo aguarda a mesma renovação
+	first, cancel := context.WithCancel(t.Context())
+	go rf.AccessToken(first, token.IntegrationID)
+	time.Sleep(20 * time.Millisecond)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	access, _, err := rf.AccessToken(t.Context(), token.IntegrationID)
+	if err != nil || access != "access-sob-demanda" {
+		t.Errorf("Cancelamento do primeiro chamador não deveria derrubar a renovação: %q (%v)", access, err)
+	}
+}
+
+func TestAccessTokenEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupDB(t)
+	srv := fakeOAuthServer(t, http.StatusOK)
+	defer srv.Close()
+	token := createToken(t, db, srv.URL, time.Now().Add(-time.Minute))
+
+	t.Setenv("JWT_DEV_MODE", "true") // segredo HS256 padrão
+	mw, err := auth.JWTMiddlewareWithDB(db)
+	if err != nil {
+		t.Fatalf("Erro ao criar middleware JWT: %v", err)
+	}
+	jwtToken, _, err := mw.TokenGenerator(&auth.User{ID: 1, Username: "svc", Role: "user"})
+	if err != nil {
+		t.Fatalf("Erro ao gerar JWT: %v", err)
+	}
+	r := gin.New()
+	refresher.RegisterRoutes(r, db, mw, refresher.New(db, oauth.NewClient(srv.Client())))
+
+	// Sem concessão na ACL a integração nem aparece para o usuário
+	req0 := httptest.NewRequest("GET", fmt.Sprintf("/integrations/%d/access-token", token.IntegrationID), nil)
+	req0.Header.Set("Authorization", "Bearer "+jwtToken)
+	w0 := httptest.NewRecorder()
+	r.ServeHTTP(w0, req0)
+	if w0.Code != http.StatusNotFound {
+		t.Fatalf("Status esperado 404 sem acesso na ACL, obtido %d", w0.Code)
+	}
+	db.Create(&integrations.ACLEntry{IntegrationID: token.IntegrationID, SubjectType: integrations.SubjectUser, SubjectID: 1, Level: integrations.AccessUse})
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/integrations/%d/access-token", token.IntegrationID), nil)
+	req.Header.Set("Authorization", "Bearer "+jwtToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Status esperado 200, obtido %d: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp["access_token"] != "novo-access-token" {
+		t.Errorf("access_token inesperado: %v", resp["access_token"])
+	}
+
+	req2 := httptest.NewRequest("GET", "/integrations/999/access-token", nil)
+	req2.Header.Set("Authorization", "Bearer "+jwtToken)
+	w2 := httptest.NewRecorder()
+	r.ServeHTTP(w2, req2)
+	if w2.Code != http.StatusNotFound {
+		t.Errorf("Status esperado 404 para integração inexistente, obtido %d", w2.Code)
+	}
+}
@@ -0,0 +1,96 @@
+package refresher_test
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/oauth"
+	"api-vault/internal/refresher"
+	"api-vault/internal/tokens"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeRefreshServer simula um endpoint de token que aceita apenas o refresh token esperado
+func fakeRefreshServer(t *testing.T, validRefresh, rotatedRefresh string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("grant_type") != "refresh_token" {
+			t.Errorf("grant_type inesperado: %s", r.PostForm.Get("grant_type"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("refresh_token") != validRefresh {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "refresh token revogado"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "access-renovado",
+			"refresh_token": rotatedRefresh,
+			"expires_in":    120,
+		})
+	}))
+}
+
+func TestRefresher_RefreshTokenGrantRotatesRefreshToken(t *testing.T) {
+	db := setupDB(t)
+	srv := fakeRefreshServer(t, "refresh-antigo", "refresh-novo")
+	defer srv.Close()
+	token := createTokenWithAuthType(t, db, "authorization_code", srv.URL, time.Now().Add(time.Minute))
+
+	rf := refresher.New(db, oauth.NewClient(srv.Client()))
+	if err := rf.RunOnce(context.Background()); err != nil {
+		t.Fatalf("Erro na varredura: %v", err)
+	}
+
+	var updated tokens.Token
+	db.First(&updated, token.ID)
+	access, _ := tokens.DecryptAccessToken(&updated)
+	refresh, _ := tokens.DecryptRefreshToken(&updated)
+	if access != "access-renovado" || refresh != "refresh-novo" {
+		t.Errorf("Tokens não renovados: access=%s refresh=%s", access, refresh)
+	}
+	if d := time.Until(updated.ExpiresAt); d > 2*time.Minute || d < time.Minute {
+		t.Errorf("ExpiresAt deveria refletir expires_in=120, obtido %v", updated.ExpiresAt)
+	}
+	if updated.Status != tokens.StatusActive {
+		t.Errorf("Status esperado %s, obtido %s", tokens.StatusActive, updated.Status)
+	}
+}
+
+func TestRefresher_InvalidGrantMarksReconsentRequired(t *testing.T) {
+	db := setupDB(t)
+	srv := fakeRefreshServer(t, "outro-refresh", "")
+	defer srv.Close()
+	token := createTokenWithAuthType(t, db, "authorization_code", srv.URL, time.Now().Add(time.Minute))
+
+	rf := refresher.New(db, oauth.NewClient(srv.Client()))
+	err := rf.Refresh(context.Background(), &token)
+	if !errors.Is(err, refresher.ErrReconsentRequired) {
+		t.Fatalf("Esperado ErrReconsentRequired, obtido %v", err)
+	}
+
+	var updated tokens.Token
+	db.First(&updated, token.ID)
+	if updated.Status != tokens.StatusReconsentRequired {
+		t.Errorf("Status esperado %s, obtido %s", tokens.StatusReconsentRequired, updated.Status)
+	}
+	var logs []audit.AuditLog
+	db.Where("action = ?", "reconsentimento_token").Find(&logs)
+	if len(logs) != 1 {
+		t.Errorf("Esperado 1 log de reconsentimento, obtido %d", len(logs))
+	}
+
+	// Tokens que exigem reconsentimento saem da varredura automática
+	if err := rf.RunOnce(context.Background()); err != nil {
+		t.Fatalf("Erro na varredura: %v", err)
+	}
+	var count int64
+	db.Model(&audit.AuditLog{}).Where("action IN ?", []string{"renovacao_token", "reconsentimento_token"}).Count(&count)
+	if count != 1 {
+		t.Errorf("Token com reconsentimento pendente não deveria ser renovado, logs=%d", count)
+	}
+}
@@ -0,0 +1,179 @@
+package refresher_test
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/auth"
+	"api-vault/internal/crypto"
+	"api-vault/internal/integrations"
+	"api-vault/internal/oauth"
+	"api-vault/internal/refresher"
+	"api-vault/internal/tokens"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupDB(t *testing.T) *gorm.DB {
+	t.Setenv("DATA_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Erro ao abrir banco em memória: %v", err)
+	}
+	// Cada conexão a ":memory:" abre um banco novo; mantém uma só para as goroutines dos testes
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&integrations.Integration{}, &integrations.ACLEntry{}, &auth.GroupMember{}, &tokens.Token{}, &audit.AuditLog{}, &audit.ChainHead{}, &auth.User{}, &auth.Session{}, &auth.RevokedToken{})
+	return db
+}
+
+// fakeOAuthServer simula um endpoint de token client_credentials
+func fakeOAuthServer(t *testing.T, status int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("Erro ao ler formulário: %v", err)
+		}
+		if r.PostForm.Get("grant_type") != "client_credentials" {
+			t.Errorf("grant_type inesperado: %s", r.PostForm.Get("grant_type"))
+		}
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "cid" || secret != "csecret" {
+			t.Errorf("Credenciais do cliente inválidas: %s/%s", id, secret)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if status != http.StatusOK {
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "novo-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+}
+
+func createToken(t *testing.T, db *gorm.DB, tokenURL string, expiresAt time.Time) tokens.Token {
+	return createTokenWithAuthType(t, db, "client_credentials", tokenURL, expiresAt)
+}
+
+func createTokenWithAuthType(t *testing.T, db *gorm.DB, authType, tokenURL string, expiresAt time.Time) tokens.Token {
+	secret, _ := crypto.Encrypt("csecret")
+	integration := integrations.Integration{Name: "TestAPI", AuthType: authType, ClientID: "cid", ClientSecret: secret, TokenURL: tokenURL}
+	if err := db.Create(&integration).Error; err != nil {
+		t.Fatalf("Erro ao criar integração: %v", err)
+	}
+	access, _ := crypto.Encrypt("access-antigo")
+	refresh, _ := crypto.Encrypt("refresh-antigo")
+	token := tokens.Token{IntegrationID: integration.ID, AccessToken: access, RefreshToken: refresh, ExpiresAt: expiresAt}
+	if err := db.Create(&token).Error; err != nil {
+		t.Fatalf("Erro ao criar token: %v", err)
+	}
+	return token
+}
+
+func TestRefresher_RenewsExpiringToken(t *testing.T) {
+	db := setupDB(t)
+	srv := fakeOAuthServer(t, http.StatusOK)
+	defer srv.Close()
+	token := createToken(t, db, srv.URL, time.Now().Add(time.Minute))
+
+	rf := refresher.New(db, oauth.NewClient(srv.Client()))
+	rf.Lead = 5 * time.Minute
+	if err := rf.RunOnce(context.Background()); err != nil {
+		t.Fatalf("Erro na varredura: %v", err)
+	}
+
+	var updated tokens.Token
+	db.First(&updated, token.ID)
+	access, err := tokens.DecryptAccessToken(&updated)
+	if err != nil || access != "novo-access-token" {
+		t.Errorf("AccessToken não renovado: %s (%v)", access, err)
+	}
+	refresh, _ := tokens.DecryptRefreshToken(&updated)
+	if refresh != "refresh-antigo" {
+		t.Errorf("RefreshToken deveria ser mantido, obtido %s", refresh)
+	}
+	if time.Until(updated.ExpiresAt) < 50*time.Minute {
+		t.Errorf("ExpiresAt não atualizado: %v", updated.ExpiresAt)
+	}
+
+	var logs []audit.AuditLog
+	db.Where("action = ? AND status = ?", "renovacao_token", "OK").Find(&logs)
+	if len(logs) != 1 {
+		t.Errorf("Esperado 1 log de renovação OK, obtido %d", len(logs))
+	}
+}
+
+func TestRefresher_SkipsTokensFarFromExpiry(t *testing.T) {
+	db := setupDB(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Endpoint de token não deveria ser chamado")
+	}))
+	defer srv.Close()
+	createToken(t, db, srv.URL, time.Now().Add(time.Hour))
+
+	rf := refresher.New(db, oauth.NewClient(srv.Client()))
+	rf.Lead = 5 * time.Minute
+	if err := rf.RunOnce(context.Background()); err != nil {
+		t.Fatalf("Erro na varredura: %v", err)
+	}
+}
+
+func TestRefresher_RecordsFailure(t *testing.T) {
+	db := setupDB(t)
+	srv := fakeOAuthServer(t, http.StatusUnauthorized)
+	defer srv.Close()
+	token := createToken(t, db, srv.URL, time.Now().Add(time.Minute))
+
+	rf := refresher.New(db, oauth.NewClient(srv.Client()))
+	if err := rf.RunOnce(context.Background()); err != nil {
+		t.Fatalf("Erro na varredura: %v", err)
+	}
+
+	var unchanged tokens.Token
+	db.First(&unchanged, token.ID)
+	access, _ := tokens.DecryptAccessToken(&unchanged)
+	if access != "access-antigo" {
+		t.Errorf("AccessToken não deveria mudar após falha, obtido %s", access)
+	}
+	var logs []audit.AuditLog
+	db.Where("action = ? AND status = ?", "renovacao_token", "FAIL").Find(&logs)
+	if len(logs) != 1 {
+		t.Errorf("Esperado 1 log de renovação FAIL, obtido %d", len(logs))
+	}
+}
+
+func TestRefresher_SkipsTokenRenewedAfterScan(t *testing.T) {
+	db := setupDB(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Token renovado por outra instância não deveria ser renovado de novo")
+	}))
+	defer srv.Close()
+	token := createToken(t, db, srv.URL, time.Now().Add(time.Minute))
+
+	// Simula outra instância renovando o token logo após a varredura lê-lo
+	renewed := false
+	db.Callback().Query().After("gorm:query").Register("test:renovacao_concorrente", func(tx *gorm.DB) {
+		if renewed || tx.Statement.Table != "tokens" {
+			return
+		}
+		renewed = true
+		tx.Session(&gorm.Session{NewDB: true}).Model(&tokens.Token{}).Where("id = ?", token.ID).Update("expires_at", time.Now().Add(time.Hour))
+	})
+
+	rf := refresher.New(db, oauth.NewClient(srv.Client()))
+	rf.Lead = 5 * time.Minute
+	if err := rf.RunOnce(context.Background()); err != nil {
+		t.Fatalf("Erro na varredura: %v", err)
+	}
+	if !renewed {
+		t.Fatal("Renovação concorrente não foi simulada")
+	}
+}
@@ -0,0 +1,154 @@
+package rekey_test
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/auth"
+	"api-vault/internal/crypto"
+	"api-vault/internal/integrations"
+	"api-vault/internal/rekey"
+	"api-vault/internal/signing"
+	"api-vault/internal/tokens"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestRekey_MigratesAllSecretsAndResumes(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	t.Setenv("MASTER_KEYS", "")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Erro ao abrir banco em memória: %v", err)
+	}
+	db.AutoMigrate(&integrations.Integration{}, &tokens.Token{}, &audit.AuditLog{}, &audit.ChainHead{}, &rekey.Job{}, &signing.SigningKey{}, &auth.User{})
+
+	// Dados cifrados com a chave antiga
+	for i := 0; i < 5; i++ {
+		secret, _ := crypto.Encrypt(fmt.Sprintf("secret-%d", i))
+		integration := integrations.Integration{Name: fmt.Sprintf("API-%d", i), AuthType: "client_credentials", ClientID: "cid", ClientSecret: secret, TokenURL: "http://token.url"}
+		db.Create(&integration)
+		access, _ := crypto.Encrypt(fmt.Sprintf("access-%d", i))
+		refresh, _ := crypto.Encrypt(fmt.Sprintf("refresh-%d", i))
+		db.Create(&tokens.Token{IntegrationID: integration.ID, AccessToken: access, RefreshToken: refresh, ExpiresAt: time.Now()})
+	}
+	// Um valor corrompido não deve interromper o job
+	db.Create(&integrations.Integration{Name: "Corrompida", AuthType: "client_credentials", ClientID: "cid", ClientSecret: "lixo", TokenURL: "http://token.url"})
+
+	// Nova chave mestra passa a ser a atual
+	t.Setenv("MASTER_KEYS", "k2:abcdefghijklmnopqrstuvwxyz012345")
+
+	// Primeira execução é interrompida antes de começar
+	job, err := rekey.Start(db, "teste")
+	if err != nil {
+		t.Fatalf("Erro ao iniciar job: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := rekey.Run(ctx, db, job, 2); err == nil {
+		t.Fatal("Esperado erro com contexto cancelado")
+	}
+
+	// Start retoma o mesmo job e o marca como em execução; outra instância não o pega
+	resumed, err := rekey.Start(db, "teste")
+	if err != nil || resumed.ID != job.ID || resumed.Status != rekey.StatusRunning {
+		t.Fatalf("Esperado retomar o job %d, obtido %+v (%v)", job.ID, resumed, err)
+	}
+	if _, err := rekey.Start(db, "outra-instancia"); !errors.Is(err, rekey.ErrJobRunning) {
+		t.Fatalf("Job em execução não deveria ser retomado de novo, obtido %v", err)
+	}
+	if err := rekey.Run(context.Background(), db, resumed, 2); err != nil {
+		t.Fatalf("Erro na recriptografia: %v", err)
+	}
+	if resumed.Status != rekey.StatusCompleted || resumed.Processed != 15 || resumed.Failed != 1 {
+		t.Errorf("Progresso inesperado: %+v", resumed)
+	}
+
+	var list []integrations.Integration
+	db.Where("name <> ?", "Corrompida").Find(&list)
+	for _, i := range list {
+		if crypto.KeyID(i.ClientSecret) != "k2" || !crypto.IsBound(i.ClientSecret) {
+			t.Errorf("ClientSecret da integração %d não migrado: %s", i.ID, i.ClientSecret)
+		}
+	}
+	var toks []tokens.Token
+	db.Find(&toks)
+	for i, tk := range toks {
+		access, err := tokens.DecryptAccessToken(&tk)
+		if crypto.KeyID(tk.AccessToken) != "k2" || !crypto.IsBound(tk.RefreshToken) || err != nil || access != fmt.Sprintf("access-%d", i) {
+			t.Errorf("Token %d não migrado corretamente", tk.ID)
+		}
+	}
+
+	var failures int64
+	db.Model(&audit.AuditLog{}).Where("action = ? AND status = ?", "rekey_registro", "FAIL").Count(&failures)
+	if failures != 1 {
+		t.Errorf("Esperado 1 log de falha por registro, obtido %d", failures)
+	}
+
+	// Uma nova execução não encontra nada pendente
+	again, _ := rekey.Start(db, "teste")
+	if again.ID == job.ID {
+		t.Fatal("Job concluído não deveria ser retomado")
+	}
+	rekey.Run(context.Background(), db, again, 2)
+	if again.Processed != 0 || again.Skipped != 15 {
+		t.Errorf("Segunda execução deveria apenas ignorar valores já migrados: %+v", again)
+	}
+}
+
+func TestRekey_ConcurrentWriteIsNotOverwritten(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	t.Setenv("MASTER_KEYS", "")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Erro ao abrir banco em memória: %v", err)
+	}
+	db.AutoMigrate(&integrations.Integration{}, &tokens.Token{}, &audit.AuditLog{}, &audit.ChainHead{}, &rekey.Job{}, &signing.SigningKey{}, &auth.User{})
+	for i := 0; i < 3; i++ {
+		secret, _ := crypto.Encrypt(fmt.Sprintf("secret-%d", i))
+		db.Create(&integrations.Integration{Name: fmt.Sprintf("API-%d", i), AuthType: "client_credentials", ClientID: "cid", ClientSecret: secret, TokenURL: "http://token.url"})
+	}
+	t.Setenv("MASTER_KEYS", "k2:abcdefghijklmnopqrstuvwxyz012345")
+
+	// Um PUT grava um segredo novo na integração 2 logo depois de o lote lê-la
+	written := false
+	db.Callback().Query().After("gorm:query").Register("test:escrita_concorrente", func(tx *gorm.DB) {
+		if written || tx.Statement.Table != "integrations" {
+			return
+		}
+		written = true
+		secret, _ := crypto.EncryptField("segredo-novo", crypto.Field{Table: "integrations", Column: "client_secret", RecordID: 2})
+		tx.Session(&gorm.Session{NewDB: true}).Table("integrations").Where("id = ?", 2).UpdateColumn("client_secret", secret)
+	})
+
+	job, err := rekey.Start(db, "teste")
+	if err != nil {
+		t.Fatalf("Erro ao iniciar job: %v", err)
+	}
+	if err := rekey.Run(context.Background(), db, job, 10); err != nil {
+		t.Fatalf("Erro na recriptografia: %v", err)
+	}
+	if job.Conflicts != 1 || job.Processed != 2 || job.Skipped != 1 {
+		t.Errorf("Esperado 1 conflito relido como já migrado: %+v", job)
+	}
+
+	// Job sem falhas: segredos sem vínculo passam a ser recusados
+	t.Cleanup(func() { crypto.SetRequireAAD(false) })
+	if migrated, err := rekey.Migrated(db); err != nil || !migrated {
+		t.Errorf("Job sem falhas deveria marcar a migração como concluída: %v (%v)", migrated, err)
+	}
+	unbound, _ := crypto.Encrypt("antigo")
+	if _, err := crypto.DecryptField(unbound, integrations.SecretField(1)); !errors.Is(err, crypto.ErrUnboundCipherText) {
+		t.Errorf("Valor sem vínculo deveria ser recusado após a migração, obtido %v", err)
+	}
+	var integration integrations.Integration
+	db.First(&integration, 2)
+	if secret, err := integrations.DecryptSecret(&integration); err != nil || secret != "segredo-novo" {
+		t.Errorf("Escrita concorrente foi sobrescrita pela recriptografia: %q (%v)", secret, err)
+	}
+}
@@ -0,0 +1,236 @@
+package signing_test
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/auth"
+	"api-vault/internal/authz"
+	"api-vault/internal/signing"
+	"api-vault/internal/tenant"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/appleboy/gin-jwt/v2"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupSigningRouter(t *testing.T, alg string) (*gin.Engine, *jwt.GinJWTMiddleware) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("DATA_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	t.Setenv("JWT_SIGNING_ALG", alg)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Erro ao abrir banco em memória: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&auth.User{}, &authz.Role{}, &audit.AuditLog{}, &audit.ChainHead{}, &auth.Session{}, &auth.RevokedToken{}, &signing.SigningKey{}, &auth.RecoveryCode{}, &auth.MFAChallenge{}, &auth.LoginAttempt{}, &auth.APIKey{}, &authz.MFAPolicy{})
+	if err := tenant.Register(db); err != nil {
+		t.Fatalf("Erro ao registrar callbacks de organização: %v", err)
+	}
+	mw, err := auth.JWTMiddlewareWithDB(db)
+	if err != nil {
+		t.Fatalf("Erro ao criar middleware JWT: %v", err)
+	}
+	if _, err := auth.CreateInitialAdmin(tenant.ForOrg(db, tenant.DefaultOrgID), "root", "root1234"); err != nil {
+		t.Fatalf("Bootstrap do admin falhou: %v", err)
+	}
+	r := gin.New()
+	auth.RegisterRoutes(r, db, mw)
+	signing.RegisterRoutes(r, db, mw, auth.KeyringFor(mw))
+	return r, mw
+}
+
+func doRequest(r *gin.Engine, method, path, jwtToken, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	if jwtToken != "" {
+		req.Header.Set("Authorization", "Bearer "+jwtToken)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func login(t *testing.T, r *gin.Engine) string {
+	w := doRequest(r, "POST", "/login", "", `{"username":"root","password":"root1234"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Login falhou: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp.Token
+}
+
+// header decodifica o cabeçalho do JWT
+func header(t *testing.T, token string) map[string]string {
+	raw, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+	if err != nil {
+		t.Fatalf("Cabeçalho JWT inválido: %v", err)
+	}
+	h := map[string]string{}
+	json.Unmarshal(raw, &h)
+	return h
+}
+
+func jwks(t *testing.T, r *gin.Engine) []signing.JWK {
+	w := doRequest(r, "GET", "/.well-known/jwks.json", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("JWKS falhou: %d", w.Code)
+	}
+	var set struct {
+		Keys []signing.JWK `json:"keys"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &set)
+	return set.Keys
+}
+
+func TestAsymmetricSigningWithRotation(t *testing.T) {
+	for _, alg := range []string{signing.AlgRS256, signing.AlgES256, signing.AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			r, mw := setupSigningRouter(t, alg)
+			first := login(t, r)
+			h := header(t, first)
+			if h["alg"] != alg || h["kid"] == "" {
+				t.Fatalf("JWT deveria ter alg %s e kid, obtido %v", alg, h)
+			}
+			keys := jwks(t, r)
+			if len(keys) != 1 || keys[0].Kid != h["kid"] || keys[0].Alg != alg {
+				t.Fatalf("JWKS deveria publicar a chave %s, obtido %+v", h["kid"], keys)
+			}
+			if w := doRequest(r, "GET", "/users", first, ""); w.Code != http.StatusOK {
+				t.Fatalf("JWT assinado deveria ser aceito, obtido %d %s", w.Code, w.Body.String())
+			}
+
+			// JWT HS256 (sem kid) não é aceito quando a assinatura é assimétrica
+			forged, _, _ := mw.TokenGenerator(&auth.User{ID: 1, Username: "root", Role: "admin"})
+			if w := doRequest(r, "GET", "/users", forged, ""); w.Code != http.StatusUnauthorized {
+				t.Errorf("JWT HS256 deveria ser recusado, obtido %d", w.Code)
+			}
+
+			// Após a rotação, a chave antiga continua verificando os JWTs emitidos
+			if w := doRequest(r, "POST", "/admin/jwt-keys/rotate", first, ""); w.Code != http.StatusCreated {
+				t.Fatalf("Rotação falhou: %d %s", w.Code, w.Body.String())
+			}
+			second := login(t, r)
+			if header(t, second)["kid"] == h["kid"] {
+				t.Error("Novos JWTs deveriam usar a nova chave")
+			}
+			if n := len(jwks(t, r)); n != 2 {
+				t.Errorf("JWKS deveria manter a chave anterior durante a carência, tem %d", n)
+			}
+			if w := doRequest(r, "GET", "/users", first, ""); w.Code != http.StatusOK {
+				t.Errorf("JWT da chave anterior deveria valer durante a carência, obtido %d", w.Code)
+			}
+
+			// Passada a carência, a chave aposentada sai do JWKS e deixa de verificar
+			ring := auth.KeyringFor(mw)
+			ring.Now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+			if n := len(jwks(t, r)); n != 1 {
+				t.Errorf("JWKS deveria ter só a chave corrente após a carência, tem %d", n)
+			}
+			if w := doRequest(r, "GET", "/users", first, ""); w.Code != http.StatusUnauthorized {
+				t.Errorf("JWT de chave expirada deveria ser recusado, obtido %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestScheduledRotation(t *testing.T) {
+	_, mw := setupSigningRouter(t, signing.AlgES256)
+	ring := auth.KeyringFor(mw)
+	before := ring.Current().KID
+	if rotated, err := ring.RotateIfDue(); err != nil || rotated {
+		t.Fatalf("Chave recente não deveria ser trocada: rotated=%v err=%v", rotated, err)
+	}
+	ring.Now = func() time.Time { return time.Now().Add(ring.RotationInterval + time.Minute) }
+	if rotated, err := ring.RotateIfDue(); err != nil || !rotated {
+		t.Fatalf("Chave vencida deveria ser trocada: rotated=%v err=%v", rotated, err)
+	}
+	if ring.Current().KID == before {
+		t.Error("Chave corrente deveria ter mudado")
+	}
+}
+
+func TestScheduledRotationAcrossInstances(t *testing.T) {
+	t.Setenv("DATA_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Erro ao abrir banco em memória: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	db.AutoMigrate(&signing.SigningKey{})
+	a, err := signing.New(db, signing.AlgES256, time.Hour, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Erro ao criar keyring: %v", err)
+	}
+	b, _ := signing.New(db, signing.AlgES256, time.Hour, 24*time.Hour)
+	later := func() time.Time { return time.Now().Add(25 * time.Hour) }
+	a.Now, b.Now = later, later
+	active := func() (total, current int64) {
+		db.Model(&signing.SigningKey{}).Count(&total)
+		db.Model(&signing.SigningKey{}).Where("retired_at IS NULL").Count(&current)
+		return
+	}
+
+	// A segunda instância relê o banco e usa a chave que a primeira gerou
+	if rotated, err := a.RotateIfDue(); err != nil || !rotated {
+		t.Fatalf("Primeira instância deveria rotacionar: rotated=%v err=%v", rotated, err)
+	}
+	if rotated, err := b.RotateIfDue(); err != nil || rotated || b.Current().KID != a.Current().KID {
+		t.Fatalf("Segunda instância deveria adotar a chave nova: rotated=%v err=%v", rotated, err)
+	}
+	if total, current := active(); total != 2 || current != 1 {
+		t.Errorf("Esperadas 2 chaves e 1 corrente, obtido %d e %d", total, current)
+	}
+
+	// Rotação da outra instância entre a leitura e a troca: só uma vale
+	a.Now = func() time.Time { return time.Now().Add(50 * time.Hour) }
+	b.Now = a.Now
+	raced := false
+	db.Callback().Query().After("gorm:query").Register("test:rotacao_concorrente", func(tx *gorm.DB) {
+		if raced || tx.Statement.Table != "signing_keys" {
+			return
+		}
+		raced = true
+		if _, err := a.Rotate(); err != nil {
+			t.Errorf("Rotação concorrente falhou: %v", err)
+		}
+	})
+	if rotated, err := b.RotateIfDue(); err != nil || rotated || b.Current().KID != a.Current().KID {
+		t.Fatalf("Chave já trocada não deveria ser trocada de novo: rotated=%v err=%v", rotated, err)
+	}
+	if total, current := active(); total != 3 || current != 1 {
+		t.Errorf("Esperadas 3 chaves e 1 corrente, obtido %d e %d", total, current)
+	}
+}
+
+func TestDefaultSecretRequiresDevMode(t *testing.T) {
+	t.Setenv("JWT_SIGNING_ALG", "HS256")
+	t.Setenv("JWT_SECRET", "")
+	t.Setenv("JWT_DEV_MODE", "false")
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if _, err := auth.JWTMiddlewareWithDB(db); !errors.Is(err, auth.ErrDefaultJWTSecret) {
+		t.Errorf("Segredo padrão deveria ser recusado, obtido %v", err)
+	}
+	t.Setenv("JWT_DEV_MODE", "true")
+	if _, err := auth.JWTMiddlewareWithDB(db); err != nil {
+		t.Errorf("Modo de desenvolvimento deveria aceitar o segredo padrão: %v", err)
+	}
+	t.Setenv("JWT_DEV_MODE", "false")
+	t.Setenv("JWT_SECRET", "um-segredo-de-verdade")
+	if _, err := auth.JWTMiddlewareWithDB(db); err != nil {
+		t.Errorf("JWT_SECRET configurado deveria ser aceito: %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package tenant_test
+
+import (
+	"api-vault/internal/audit"
+	"api-vault/internal/auth"
+	"api-vault/internal/integrations"
+	"api-vault/internal/tenant"
+	"api-vault/internal/tokens"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTenantRouter(t *testing.T) (*gin.Engine, *gorm.DB, func(auth.User) string) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("DATA_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Erro ao abrir banco em memória: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := tenant.Register(db); err != nil {
+		t.Fatalf("Erro ao registrar callbacks de tenant: %v", err)
+	}
+	db.AutoMigrate(&tenant.Organization{}, &auth.User{}, &auth.Group{}, &auth.GroupMember{}, &integrations.Integration{}, &integrations.ACLEntry{}, &tokens.Token{}, &audit.AuditLog{}, &audit.ChainHead{}, &auth.Session{}, &auth.RevokedToken{})
+	t.Setenv("JWT_DEV_MODE", "true") // segredo HS256 padrão
+	mw, err := auth.JWTMiddlewareWithDB(db)
+	if err != nil {
+		t.Fatalf("Erro ao criar middleware JWT: %v", err)
+	}
+	r := gin.New()
+	integrations.RegisterRoutes(r, db, mw)
+	tokens.RegisterRoutes(r, db, mw)
+	audit.RegisterRoutes(r, db, mw)
+	issue := func(u auth.User) string {
+		u.Password = "x"
+		if err := db.Create(&u).Error; err != nil {
+			t.Fatalf("Erro ao criar usuário: %v", err)
+		}
+		token, _, err := mw.TokenGenerator(&u)
+		if err != nil {
+			t.Fatalf("Erro ao gerar JWT: %v", err)
+		}
+		return token
+	}
+	return r, db, issue
+}
+
+func doJSON(r *gin.Engine, method, path, jwtToken, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+jwtToken)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func listOf(t *testing.T, r *gin.Engine, path, jwtToken string) []map[string]interface{} {
+	w := doJSON(r, "GET", path, jwtToken, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s falhou: %d %s", path, w.Code, w.Body.String())
+	}
+	var list []map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	return list
+}
+
+func TestOrganizationsAreIsolated(t *testing.T) {
+	r, db, issue := setupTenantRouter(t)
+	acme := tenant.Organization{Name: "acme"}
+	globex := tenant.Organization{Name: "globex"}
+	db.Create(&acme)
+	db.Create(&globex)
+	// Admins têm integrations:all, mas só dentro da própria organização
+	acmeAdmin := issue(auth.User{Username: "acme-admin", Role: "admin", OrgID: acme.ID})
+	globexAdmin := issue(auth.User{Username: "globex-admin", Role: "admin", OrgID: globex.ID})
+
+	// O mesmo nome de integração pode existir em organizações diferentes
+	payload := `{"name":"erp","auth_type":"client_credentials","client_id":"cid","client_secret":"segredo","token_url":"https://erp.example.com/token"}`
+	ids := map[string]uint{}
+	for name, jwtToken := range map[string]string{"acme": acmeAdmin, "globex": globexAdmin} {
+		w := doJSON(r, "POST", "/integrations", jwtToken, payload)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("Cadastro de integração (%s) falhou: %d %s", name, w.Code, w.Body.String())
+		}
+		var integration integrations.Integration
+		json.Unmarshal(w.Body.Bytes(), &integration)
+		ids[name] = integration.ID
+	}
+
+	var stored integrations.Integration
+	db.First(&stored, ids["acme"])
+	if stored.OrgID != acme.ID {
+		t.Errorf("Integração deveria pertencer à organização do criador, obtido org=%d", stored.OrgID)
+	}
+
+	expires := time.Now().Add(time.Hour).Format(time.RFC3339)
+	tokenPayload := fmt.Sprintf(`{"integration_id":%d,"access_token":"access","refresh_token":"refresh","expires_at":"%s"}`, ids["acme"], expires)
+	w := doJSON(r, "POST", "/tokens", acmeAdmin, tokenPayload)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Cadastro de token falhou: %d %s", w.Code, w.Body.String())
+	}
+	var token tokens.Token
+	json.Unmarshal(w.Body.Bytes(), &token)
+
+	if n := len(listOf(t, r, "/integrations", acmeAdmin)); n != 1 {
+		t.Errorf("Acme deveria ver apenas a própria integração, viu %d", n)
+	}
+	if n := len(listOf(t, r, "/tokens", globexAdmin)); n != 0 {
+		t.Errorf("Globex não deveria ver tokens da Acme, viu %d", n)
+	}
+	if w := doJSON(r, "GET", fmt.Sprintf("/integrations/%d", ids["acme"]), globexAdmin, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Integração de outra organização deveria dar 404, obtido %d", w.Code)
+	}
+	if w := doJSON(r, "GET", fmt.Sprintf("/tokens/%d", token.ID), globexAdmin, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Token de outra organização deveria dar 404, obtido %d", w.Code)
+	}
+	// Criar token apontando para integração de outra organização também é bloqueado
+	if w := doJSON(r, "POST", "/tokens", globexAdmin, tokenPayload); w.Code != http.StatusNotFound {
+		t.Errorf("Token em integração de outra organização deveria dar 404, obtido %d", w.Code)
+	}
+	if w := doJSON(r, "DELETE", fmt.Sprintf("/integrations/%d", ids["acme"]), globexAdmin, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Remoção cruzada deveria dar 404, obtido %d", w.Code)
+	}
+
+	// Auditoria também é separada por organização
+	for _, entry := range listOf(t, r, "/audit-logs", globexAdmin) {
+		if entry["user"] == "acme-admin" {
+			t.Errorf("Globex não deveria ver eventos da Acme: %v", entry)
+		}
+	}
+	if n := len(listOf(t, r, "/audit-logs", acmeAdmin)); n == 0 {
+		t.Error("Acme deveria ver os próprios eventos")
+	}
+}
+
+func TestNonNumericIDIsRejected(t *testing.T) {
+	r, db, issue := setupTenantRouter(t)
+	acme := tenant.Organization{Name: "acme"}
+	globex := tenant.Organization{Name: "globex"}
+	db.Create(&acme)
+	db.Create(&globex)
+	issue(auth.User{Username: "victim", Role: "user", OrgID: acme.ID})
+	globexAdmin := issue(auth.User{Username: "globex-admin", Role: "admin", OrgID: globex.ID})
+	w := doJSON(r, "POST", "/integrations", globexAdmin, `{"name":"erp","auth_type":"client_credentials","client_id":"cid","client_secret":"segredo","token_url":"https://erp.example.com/token"}`)
+	var integration integrations.Integration
+	json.Unmarshal(w.Body.Bytes(), &integration)
+	expires := time.Now().Add(time.Hour).Format(time.RFC3339)
+	w = doJSON(r, "POST", "/tokens", globexAdmin, fmt.Sprintf(`{"integration_id":%d,"access_token":"access","refresh_token":"refresh","expires_at":"%s"}`, integration.ID, expires))
+	var token tokens.Token
+	json.Unmarshal(w.Body.Bytes(), &token)
+
+	// A condição injetada consultaria usuários de outra organização antes do filtro de tenant
+	for _, id := range []uint{integration.ID, token.ID} {
+		injected := url.PathEscape(fmt.Sprintf("%d AND (SELECT count(*) FROM users WHERE username='victim')>0", id))
+		for _, route := range []string{"GET /integrations/%s", "DELETE /integrations/%s", "GET /integrations/%s/acl", "GET /tokens/%s", "DELETE /tokens/%s"} {
+			method, path, _ := strings.Cut(fmt.Sprintf(route, injected), " ")
+			if w := doJSON(r, method, path, globexAdmin, ""); w.Code != http.StatusBadRequest {
+				t.Errorf("%s %s deveria dar 400, obtido %d", method, path, w.Code)
+			}
+		}
+	}
+	if err := db.First(&integrations.Integration{}, integration.ID).Error; err != nil {
+		t.Errorf("Integração não deveria ter sido removida: %v", err)
+	}
+	if err := db.First(&tokens.Token{}, token.ID).Error; err != nil {
+		t.Errorf("Token não deveria ter sido removido: %v", err)
+	}
+}
+
+func TestScopedWithoutOrgSeesNothing(t *testing.T) {
+	_, db, _ := setupTenantRouter(t)
+	for _, org := range []uint{0, 1, 2} {
+		db.Create(&integrations.Integration{OrgID: org, Name: fmt.Sprintf("erp-%d", org), AuthType: "client_credentials", ClientID: "cid", ClientSecret: "x", TokenURL: "https://erp.example.com/token"})
+	}
+	audit.SaveAuditLog(db, "", "renovacao_token", "OK", "evento de sistema")
+
+	// Rota sem JWT: nenhuma organização nas claims
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	scoped := tenant.Scoped(c, db)
+
+	var list []integrations.Integration
+	if err := scoped.Find(&list).Error; err != nil || len(list) != 0 {
+		t.Errorf("Sem organização nada deveria ser listado: %d %v", len(list), err)
+	}
+	var count int64
+	scoped.Model(&audit.AuditLog{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Eventos de sistema não deveriam aparecer sem organização: %d", count)
+	}
+	if res := scoped.Model(&integrations.Integration{}).Where("1 = 1").Update("name", "invadido"); res.RowsAffected != 0 {
+		t.Errorf("Sem organização nada deveria ser alterado: %d", res.RowsAffected)
+	}
+	if err := scoped.Create(&integrations.Integration{Name: "nova", AuthType: "client_credentials", ClientID: "cid", ClientSecret: "x", TokenURL: "https://erp.example.com/token"}).Error; !errors.Is(err, tenant.ErrNoOrg) {
+		t.Errorf("Cadastro sem organização deveria ser recusado: %v", err)
+	}
+	// A auditoria do acesso anônimo vai para a cadeia de sistema
+	if err := audit.SaveAuditLog(scoped, "", "login", "FAIL", "anônimo"); err != nil {
+		t.Errorf("Evento sem organização deveria ser gravado: %v", err)
+	}
+	if result, _ := audit.Verify(db, 0, nil); !result.OK || result.Checked != 2 {
+		t.Errorf("Cadeia de sistema deveria ter os 2 eventos: %+v", result)
+	}
+}